@@ -2,18 +2,26 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/camptocamp/terraboard/auth"
 	"github.com/camptocamp/terraboard/compare"
 	"github.com/camptocamp/terraboard/db"
+	"github.com/camptocamp/terraboard/export"
+	"github.com/camptocamp/terraboard/planfile"
 	"github.com/camptocamp/terraboard/state"
+	"github.com/camptocamp/terraboard/types"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // Terraform plan payload structure usedfor swagger documentation
@@ -42,6 +50,141 @@ func JSONError(w http.ResponseWriter, message string, err error) {
 	}
 }
 
+// listError writes the error of a list request, as a bad request
+// when it was caused by an invalid cursor
+func listError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, db.ErrInvalidCursor) {
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	JSONError(w, message, err)
+}
+
+// bearerToken returns the token sent in the Authorization header, if any
+func bearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticate returns the APIToken of the request,
+// writing the error if it is missing or invalid
+func authenticate(w http.ResponseWriter, r *http.Request, d *db.Database, message string) (apiToken types.APIToken, ok bool) {
+	apiToken, err := d.GetAPIToken(bearerToken(r))
+	if err != nil {
+		log.Errorf("%s: %v", message, err)
+		if errors.Is(err, db.ErrInvalidToken) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		JSONError(w, message, err)
+		return
+	}
+	return apiToken, true
+}
+
+// authorizePlan returns the APIToken of the request if it is allowed
+// to manage the plan of the request, writing the error otherwise
+func authorizePlan(w http.ResponseWriter, r *http.Request, d *db.Database, message string) (apiToken types.APIToken, ok bool) {
+	if apiToken, ok = authenticate(w, r, d, message); !ok {
+		return
+	}
+	if err := d.CheckPlanToken(apiToken, mux.Vars(r)["id"]); err != nil {
+		log.Errorf("%s: %v", message, err)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, db.ErrTokenScope):
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		JSONError(w, message, err)
+		return apiToken, false
+	}
+	return apiToken, true
+}
+
+// planError writes the error of a plan submission: a bad request if the plan
+// is malformed, an unprocessable entity listing its problems if it is invalid,
+// forbidden if the API token is not allowed to submit plans for its lineage
+func planError(w http.ResponseWriter, message string, err error) {
+	var validationErr *db.PlanValidationError
+	switch {
+	case errors.Is(err, db.ErrMalformedPlan):
+		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, db.ErrTokenScope):
+		w.WriteHeader(http.StatusForbidden)
+	case errors.As(err, &validationErr):
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		j, _ := json.Marshal(map[string]interface{}{
+			"error":    message,
+			"details":  err.Error(),
+			"problems": validationErr.Problems,
+		})
+		if _, err := io.WriteString(w, string(j)); err != nil {
+			log.Error(err.Error())
+		}
+		return
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	JSONError(w, message, err)
+}
+
+// setPageInfo adds paging information to a list response
+func setPageInfo(response map[string]interface{}, info db.PageInfo) {
+	response["page"] = info.Page
+	response["page_size"] = info.PageSize
+	response["total"] = info.Total
+	response["next_cursor"] = info.NextCursor
+}
+
+// exportWriter is an io.Writer recording whether the export
+// has started writing the response body
+type exportWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	e.written = true
+	return e.w.Write(p)
+}
+
+// writeExport streams the records written by fn to the http.ResponseWriter
+// as a file in the given export format.
+// If fn fails before writing anything, an error response is returned;
+// once the body has started, the response is aborted so that clients
+// do not mistake a truncated export for a complete one.
+func writeExport(w http.ResponseWriter, format, filename string, fn func(io.Writer) error) {
+	contentType, err := export.ContentType(format)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		JSONError(w, "Unsupported export format", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", filename, format))
+	out := &exportWriter{w: w}
+	if err := fn(out); err != nil {
+		log.Errorf("Failed to export %s: %v", filename, err)
+		if out.written {
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Del("Content-Disposition")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		JSONError(w, "Failed to export "+filename, err)
+	}
+}
+
 // ListTerraformVersionsWithCount lists Terraform versions with their associated
 // counts, sorted by the 'orderBy' parameter (version by default)
 // @Summary Lists Terraform versions with counts
@@ -66,22 +209,38 @@ func ListTerraformVersionsWithCount(w http.ResponseWriter, r *http.Request, d *d
 }
 
 // ListStateStats returns State information for a given path as parameter
+// An optional 'format' parameter ('csv' or 'ndjson') exports all stats at once
 // @Summary Get Lineage states stats
-// @Description Returns Lineage states stats along with paging information
+// @Description Returns Lineage states stats along with paging information, or all of them as a CSV/NDJSON file when 'format' is set
 // @ID list-state-stats
 // @Produce  json
+// @Produce  text/csv
+// @Produce  application/x-ndjson
 // @Param   page      query   integer     false  "Current page for pagination"
+// @Param   page_size      query   integer     false  "Number of results per page (default 20, max 1000)"
+// @Param   cursor      query   string     false  "Cursor returned as next_cursor by the previous page"
+// @Param   format      query   string     false  "Export format (csv, ndjson)"
 // @Success 200 {string} string	"ok"
 // @Router /lineages/stats [get]
 func ListStateStats(w http.ResponseWriter, r *http.Request, d *db.Database) {
 	query := r.URL.Query()
-	states, page, total := d.ListStateStats(query)
+	if format := query.Get("format"); format != "" && format != "json" {
+		writeExport(w, format, "states", func(out io.Writer) error {
+			return export.StateStats(d, format, out)
+		})
+		return
+	}
+
+	states, info, err := d.ListStateStats(query)
+	if err != nil {
+		listError(w, "Failed to list states", err)
+		return
+	}
 
 	// Build response object
 	response := make(map[string]interface{})
 	response["states"] = states
-	response["page"] = page
-	response["total"] = total
+	setPageInfo(response, info)
 	j, err := json.Marshal(response)
 	if err != nil {
 		JSONError(w, "Failed to marshal states", err)
@@ -146,6 +305,78 @@ func GetLineageActivity(w http.ResponseWriter, r *http.Request, d *db.Database)
 	}
 }
 
+// GetLineageChanges returns the resource changes between consecutive versions of a Lineage
+// @Summary Get Lineage changes
+// @Description Retrieves, for each pair of consecutive versions of a Lineage, the counts and addresses of resources added, removed, changed and moved. Sorted by most recent to oldest.
+// @ID get-lineage-changes
+// @Produce  json
+// @Param   lineage      path   string     true  "Lineage"
+// @Param   page      query   integer     false  "Page"
+// @Param   page_size      query   integer     false  "Number of changes per page (default 20, max 1000)"
+// @Param   cursor      query   string     false  "Cursor returned as next_cursor by the previous page"
+// @Success 200 {string} string	"ok"
+// @Router /lineages/{lineage}/changes [get]
+func GetLineageChanges(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	params := mux.Vars(r)
+	changes, info, err := d.GetLineageChanges(params["lineage"], db.NewPagination(r.URL.Query()))
+	if err != nil {
+		listError(w, "Failed to get lineage changes", err)
+		return
+	}
+
+	response := make(map[string]interface{})
+	response["changes"] = changes
+	setPageInfo(response, info)
+	j, err := json.Marshal(response)
+	if err != nil {
+		JSONError(w, "Failed to marshal lineage changes", err)
+		return
+	}
+	if _, err := io.WriteString(w, string(j)); err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// GetResourceHistory returns the history of a resource address in a Lineage
+// @Summary Get resource history
+// @Description Retrieves every version of a Lineage in which a resource address existed, oldest first, with its attribute values and their changes since the previous of these versions
+// @ID get-resource-history
+// @Produce  json
+// @Param   lineage      query   string     true  "Lineage"
+// @Param   address      query   string     true  "Resource address (e.g. module.network.aws_security_group.web[0])"
+// @Success 200 {object} types.ResourceHistory
+// @Router /resources/history [get]
+func GetResourceHistory(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	query := r.URL.Query()
+	lineage := query.Get("lineage")
+	address := query.Get("address")
+	if lineage == "" || address == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		JSONError(w, "Missing parameter", fmt.Errorf("'lineage' and 'address' parameters are required"))
+		return
+	}
+
+	history, err := d.GetResourceHistory(lineage, address)
+	if err != nil {
+		JSONError(w, "Failed to get resource history", err)
+		return
+	}
+	if len(history.Versions) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		JSONError(w, "Resource not found", fmt.Errorf("no resource %s in lineage %s", address, lineage))
+		return
+	}
+
+	j, err := json.Marshal(history)
+	if err != nil {
+		JSONError(w, "Failed to marshal resource history", err)
+		return
+	}
+	if _, err := io.WriteString(w, string(j)); err != nil {
+		log.Error(err.Error())
+	}
+}
+
 // StateCompare compares two versions ('from' and 'to') of a State
 // @Summary Compares two versions of a State
 // @Description Compares two versions ('from' and 'to') of a State
@@ -154,6 +385,11 @@ func GetLineageActivity(w http.ResponseWriter, r *http.Request, d *db.Database)
 // @Param   lineage      path   string     true  "Lineage"
 // @Param   from      query   string     true  "Version from"
 // @Param   to      query   string     true  "Version to"
+// @Param   ignore      query   []string     false  "Attribute path to ignore for all resource types (overrides configured rules)"  collectionFormat(multi)
+// @Param   ignore_rule      query   []string     false  "Ignore rule, as resource_type.attribute globs (overrides configured rules)"  collectionFormat(multi)
+// @Param   format      query   string     false  "Report format ('markdown', 'html'), JSON by default"
+// @Produce  text/markdown
+// @Produce  text/html
 // @Success 200 {string} string	"ok"
 // @Router /lineages/{lineage}/compare [get]
 func StateCompare(w http.ResponseWriter, r *http.Request, d *db.Database) {
@@ -162,15 +398,156 @@ func StateCompare(w http.ResponseWriter, r *http.Request, d *db.Database) {
 	fromVersion := query.Get("from")
 	toVersion := query.Get("to")
 
+	format := query.Get("format")
+	var contentType string
+	if format != "" && format != "json" {
+		var err error
+		if contentType, err = compare.ReportContentType(format); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			JSONError(w, "Unsupported report format", err)
+			return
+		}
+	}
+
+	opts := compare.Options{IgnoreRules: d.IgnoreRules}
+	if err := ignoreRules(query, &opts); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		JSONError(w, "Invalid compare options", err)
+		return
+	}
+
 	from := d.GetState(params["lineage"], fromVersion)
 	to := d.GetState(params["lineage"], toVersion)
-	compare, err := compare.Compare(from, to)
+	comp, err := compare.CompareWithOptions(from, to, opts)
 	if err != nil {
 		JSONError(w, "Failed to compare state versions", err)
 		return
 	}
 
-	j, err := json.Marshal(compare)
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+		if err := compare.WriteReport(w, format, comp); err != nil {
+			log.Errorf("Failed to write compare report: %v", err)
+		}
+		return
+	}
+
+	j, err := json.Marshal(comp)
+	if err != nil {
+		JSONError(w, "Failed to marshal state compare", err)
+		return
+	}
+	if _, err := io.WriteString(w, string(j)); err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// ignoreRules overrides the configured ignore rules of comparison options
+// with the ones of a request, if any: attribute paths ignored for all resource
+// types ('ignore', e.g. 'tags.Environment') and rules written as
+// '<resource type>.<attribute>' ('ignore_rule'). Empty parameters disable
+// the configured rules.
+func ignoreRules(query url.Values, opts *compare.Options) (err error) {
+	_, hasAttributes := query["ignore"]
+	_, hasRules := query["ignore_rule"]
+	if !hasAttributes && !hasRules {
+		return
+	}
+	if opts.IgnoreRules, err = compare.ParseIgnoreRules(query["ignore_rule"]); err != nil {
+		return
+	}
+	for _, path := range query["ignore"] {
+		if path != "" {
+			opts.IgnoreRules = append(opts.IgnoreRules, compare.IgnoreAttribute(path))
+		}
+	}
+	return
+}
+
+// compareOptions reads the comparison options of a request:
+// path prefix mappings ('map', as 'from_prefix=to_prefix') and
+// ignore rules ('ignore'), overriding the configured ignore rules
+func compareOptions(query url.Values, rules []compare.IgnoreRule) (opts compare.Options, err error) {
+	opts = compare.Options{IgnoreRules: rules}
+	for _, m := range query["map"] {
+		parts := strings.SplitN(m, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return opts, fmt.Errorf("invalid path mapping '%s', expected 'from_prefix=to_prefix'", m)
+		}
+		if opts.PathMappings == nil {
+			opts.PathMappings = make(map[string]string)
+		}
+		opts.PathMappings[parts[0]] = parts[1]
+	}
+	err = ignoreRules(query, &opts)
+	return
+}
+
+// getCompareState returns a State of a lineage, defaulting to its latest version
+func getCompareState(d *db.Database, lineage, versionID string) (st types.State, err error) {
+	if versionID == "" {
+		if versionID, err = d.DefaultVersion(lineage); err != nil {
+			return st, fmt.Errorf("no state found for lineage %s: %v", lineage, err)
+		}
+	}
+	st = d.GetState(lineage, versionID)
+	if st.Path == "" {
+		return st, fmt.Errorf("no state found for lineage %s at version %s", lineage, versionID)
+	}
+	return
+}
+
+// CompareStates compares two arbitrary States, which may belong to different lineages
+// @Summary Compares two States of any lineages
+// @Description Compares two States ('from' and 'to'), which may belong to different lineages (e.g. staging and production workspaces of a stack). Module path prefixes of the 'from' State can be mapped to the ones of the 'to' State, and attributes can be ignored.
+// @ID compare-states
+// @Produce  json
+// @Param   from_lineage      query   string     true  "Lineage of the from State"
+// @Param   from      query   string     false  "Version of the from State (defaults to latest)"
+// @Param   to_lineage      query   string     true  "Lineage of the to State"
+// @Param   to      query   string     false  "Version of the to State (defaults to latest)"
+// @Param   map      query   []string     false  "Module path prefix mapping, as from_prefix=to_prefix"  collectionFormat(multi)
+// @Param   ignore      query   []string     false  "Attribute path to ignore for all resource types (overrides configured rules)"  collectionFormat(multi)
+// @Param   ignore_rule      query   []string     false  "Ignore rule, as resource_type.attribute globs (overrides configured rules)"  collectionFormat(multi)
+// @Success 200 {string} string	"ok"
+// @Router /compare [get]
+func CompareStates(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	query := r.URL.Query()
+	fromLineage := query.Get("from_lineage")
+	toLineage := query.Get("to_lineage")
+	if fromLineage == "" || toLineage == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		JSONError(w, "Missing lineage", fmt.Errorf("'from_lineage' and 'to_lineage' parameters are required"))
+		return
+	}
+
+	opts, err := compareOptions(query, d.IgnoreRules)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		JSONError(w, "Invalid compare options", err)
+		return
+	}
+
+	from, err := getCompareState(d, fromLineage, query.Get("from"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		JSONError(w, "Failed to get from state", err)
+		return
+	}
+	to, err := getCompareState(d, toLineage, query.Get("to"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		JSONError(w, "Failed to get to state", err)
+		return
+	}
+
+	comp, err := compare.CompareWithOptions(from, to, opts)
+	if err != nil {
+		JSONError(w, "Failed to compare states", err)
+		return
+	}
+
+	j, err := json.Marshal(comp)
 	if err != nil {
 		JSONError(w, "Failed to marshal state compare", err)
 		return
@@ -211,11 +588,15 @@ func GetLocks(w http.ResponseWriter, _ *http.Request, sps []state.Provider) {
 }
 
 // SearchAttribute performs a search on Resource Attributes
-// by various parameters
+// by various parameters, along with the count of results per
+// resource type, Terraform version, lineage and module path
+// An optional 'format' parameter ('csv' or 'ndjson') exports all results at once
 // @Summary Search Resource Attributes
-// @Description Performs a search on Resource Attributes by various parameters
+// @Description Performs a search on Resource Attributes by various parameters, returning paging information and result counts (facets) per resource type, Terraform version, lineage and module path, or all results as a CSV/NDJSON file when 'format' is set
 // @ID search-attribute
 // @Produce  json
+// @Produce  text/csv
+// @Produce  application/x-ndjson
 // @Param   versionid      query   string     false  "Version ID"
 // @Param   type      query   string     false  "Ressource type"
 // @Param   name      query   string     false  "Resource ID"
@@ -223,17 +604,79 @@ func GetLocks(w http.ResponseWriter, _ *http.Request, sps []state.Provider) {
 // @Param   value      query   string     false  "Attribute Value"
 // @Param   tf_version      query   string     false  "Terraform Version"
 // @Param   lineage_value      query   string     false  "Lineage"
+// @Param   page      query   integer     false  "Current page for pagination"
+// @Param   page_size      query   integer     false  "Number of results per page (default 20, max 1000)"
+// @Param   cursor      query   string     false  "Cursor returned as next_cursor by the previous page"
+// @Param   format      query   string     false  "Export format (csv, ndjson)"
 // @Success 200 {string} string	"ok"
 // @Router /search/attribute [get]
 func SearchAttribute(w http.ResponseWriter, r *http.Request, d *db.Database) {
 	query := r.URL.Query()
-	result, page, total := d.SearchAttribute(query)
+	if format := query.Get("format"); format != "" && format != "json" {
+		writeExport(w, format, "search", func(out io.Writer) error {
+			return export.SearchAttribute(d, query, format, out)
+		})
+		return
+	}
+
+	result, info, err := d.SearchAttribute(query)
+	if err != nil {
+		listError(w, "Failed to search attributes", err)
+		return
+	}
+	facets, err := d.SearchAttributeFacets(query)
+	if err != nil {
+		JSONError(w, "Failed to compute search facets", err)
+		return
+	}
 
 	// Build response object
 	response := make(map[string]interface{})
 	response["results"] = result
-	response["page"] = page
-	response["total"] = total
+	setPageInfo(response, info)
+	response["facets"] = facets
+
+	j, err := json.Marshal(response)
+	if err != nil {
+		JSONError(w, "Failed to marshal json", err)
+		return
+	}
+	if _, err := io.WriteString(w, string(j)); err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// FullTextSearch performs a full-text search on Resources of the latest States,
+// covering their address, type and attribute keys and values
+// @Summary Full-text search on Resources
+// @Description Performs a full-text search on Resources of the latest States (address, type, attribute keys and values), ranked by relevance. The query supports quoted phrases, OR and -exclusions.
+// @ID full-text-search
+// @Produce  json
+// @Param   q      query   string     true  "Search query"
+// @Param   page      query   integer     false  "Current page for pagination"
+// @Param   page_size      query   integer     false  "Number of results per page (default 20, max 1000)"
+// @Param   cursor      query   string     false  "Cursor returned as next_cursor by the previous page"
+// @Success 200 {string} string	"ok"
+// @Router /search [get]
+func FullTextSearch(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	query := r.URL.Query()
+	q := query.Get("q")
+	if q == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		JSONError(w, "Missing search query", fmt.Errorf("'q' parameter is required"))
+		return
+	}
+
+	results, info, err := d.FullTextSearch(q, db.NewPagination(query))
+	if err != nil {
+		listError(w, "Failed to search resources", err)
+		return
+	}
+
+	// Build response object
+	response := make(map[string]interface{})
+	response["results"] = results
+	setPageInfo(response, info)
 
 	j, err := json.Marshal(response)
 	if err != nil {
@@ -369,51 +812,105 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 // SubmitPlan inserts a new Terraform plan in the database.
 // /api/plans POST endpoint callback
 // @Summary Submit a new plan
-// @Description Submits and inserts a new Terraform plan in the database.
+// @Description Submits and inserts a new Terraform plan in the database, either wrapped in JSON or as a binary plan file ('terraform plan -out'). Binary plan files are decoded without the schemas of providers or their configuration, their metadata are passed as query parameters. Requires an API token allowed to submit plans for the plan's lineage.
 // @ID submit-plan
 // @Accept  json
+// @Accept  application/zip
 // @Param   plan      body   api.planPayload     false  "Wrapped plan"
+// @Param   git_remote      query   string     false  "Binary plan files: URL of the remote that generated the plan"
+// @Param   git_commit      query   string     false  "Binary plan files: commit hash"
+// @Param   ci_url      query   string     false  "Binary plan files: URL of the CI that sent the plan"
+// @Param   source      query   string     false  "Binary plan files: triggering event"
+// @Param   exit_code      query   int     false  "Binary plan files: exit code of 'terraform plan -detailed-exitcode'"
+// @Param   Authorization      header   string     true  "API token, as 'Bearer <token>'"
+// @Success 200 {string} string	"ok"
+// @Failure 400 {object} map[string]string "Malformed plan"
+// @Failure 401 {object} map[string]string "Missing or invalid API token"
+// @Failure 403 {object} map[string]string "API token not allowed for the plan's lineage"
+// @Failure 422 {object} map[string]interface{} "Invalid plan, with the list of its problems"
 // @Router /plans [post]
-func SubmitPlan(w http.ResponseWriter, r *http.Request, db *db.Database) {
+func SubmitPlan(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	apiToken, ok := authenticate(w, r, d, "Failed to authenticate plan submission")
+	if !ok {
+		return
+	}
+
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Errorf("Failed to read body: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
 		JSONError(w, "Failed to read body during plan submit", err)
 		return
 	}
 
-	if err = db.InsertPlan(body); err != nil {
+	if planfile.IsPlanFile(body) {
+		query := r.URL.Query()
+		var exitCode int
+		if v := query.Get("exit_code"); v != "" {
+			if exitCode, err = strconv.Atoi(v); err != nil {
+				log.Errorf("Invalid exit code: %v", err)
+				w.WriteHeader(http.StatusBadRequest)
+				JSONError(w, "Invalid exit code", err)
+				return
+			}
+		}
+		meta := types.Plan{
+			GitRemote: query.Get("git_remote"),
+			GitCommit: query.Get("git_commit"),
+			CiURL:     query.Get("ci_url"),
+			Source:    query.Get("source"),
+			ExitCode:  exitCode,
+		}
+		if err = d.InsertPlanFile(body, meta, apiToken); err != nil {
+			log.Errorf("Failed to insert plan file to db: %v", err)
+			planError(w, "Failed to insert plan file to db", err)
+		}
+		return
+	}
+
+	if err = d.InsertPlan(body, apiToken); err != nil {
 		log.Errorf("Failed to insert plan to db: %v", err)
-		JSONError(w, "Failed to insert plan to db", err)
+		planError(w, "Failed to insert plan to db", err)
 		return
 	}
 }
 
-// GetPlansSummary provides summary of all Plan by lineage (only metadata added by the wrapper).
-// Optional "&limit=X" parameter to limit requested quantity of plans.
-// Optional "&page=X" parameter to add an offset to the query and enable pagination.
+// GetPlansSummary provides summary of all Plan by lineage (only metadata added by the wrapper,
+// and the counts of changes with the risk level computed on insertion).
+// Optional "&page_size=X" (or "&limit=X") parameter to set the requested quantity of plans.
+// Optional "&cursor=X" or "&page=X" parameter to select the page to return.
 // Sorted by most recent to oldest.
 // /api/plans/summary GET endpoint callback
 // Also return pagination informations (current page ans total items count in database)
 // @Summary Get summary of all Plan by lineage
-// @Description Provides summary of all Plan by lineage (only metadata added by the wrapper). Sorted by most recent to oldest. Returns also paging informations (current page ans total items count in database)
+// @Description Provides summary of all Plan by lineage (only metadata added by the wrapper, and the counts of changes with the risk level computed on insertion). Sorted by most recent to oldest. Returns also paging informations (current page ans total items count in database)
 // @ID get-plans-summary
 // @Produce  json
 // @Param   lineage      query   string     false  "Lineage"
 // @Param   page      query   integer     false  "Page"
-// @Param   limit      query   integer     false  "Limit"
+// @Param   page_size      query   integer     false  "Number of plans per page (default 20, max 1000)"
+// @Param   limit      query   integer     false  "Alias of page_size"
+// @Param   cursor      query   string     false  "Cursor returned as next_cursor by the previous page"
 // @Success 200 {string} string	"ok"
 // @Router /plans/summary [get]
-func GetPlansSummary(w http.ResponseWriter, r *http.Request, db *db.Database) {
+func GetPlansSummary(w http.ResponseWriter, r *http.Request, d *db.Database) {
 	lineage := r.URL.Query().Get("lineage")
-	limit := r.URL.Query().Get("limit")
-	page := r.URL.Query().Get("page")
-	plans, currentPage, total := db.GetPlansSummary(lineage, limit, page)
+	plans, info, err := d.GetPlansSummary(lineage, db.NewPagination(r.URL.Query()))
+	if err != nil {
+		listError(w, "Failed to get plans", err)
+		return
+	}
+	for i := range plans {
+		if err := plans[i].Redact(); err != nil {
+			log.Errorf("Failed to redact plan: %v", err)
+			JSONError(w, "Failed to redact plans", err)
+			return
+		}
+	}
 
 	response := make(map[string]interface{})
 	response["plans"] = plans
-	response["page"] = currentPage
-	response["total"] = total
+	setPageInfo(response, info)
 	j, err := json.Marshal(response)
 	if err != nil {
 		log.Errorf("Failed to marshal plans: %v", err)
@@ -428,17 +925,24 @@ func GetPlansSummary(w http.ResponseWriter, r *http.Request, db *db.Database) {
 // GetPlan provides a specific Plan of a lineage using ID.
 // /api/plans GET endpoint callback on request with ?plan_id=X parameter
 // @Summary Get plans
-// @Description Provides a specific Plan of a lineage using ID or all plans if no ID is provided
+// @Description Provides a specific Plan of a lineage using ID or all plans if no ID is provided. Values marked as sensitive by Terraform are masked.
 // @ID get-plans
 // @Produce  json
 // @Param   planid      query   string     false  "Plan's ID"
 // @Param   page      query   integer     false  "Page"
-// @Param   limit      query   integer     false  "Limit"
+// @Param   page_size      query   integer     false  "Number of plans per page (default 20, max 1000)"
+// @Param   limit      query   integer     false  "Alias of page_size"
+// @Param   cursor      query   string     false  "Cursor returned as next_cursor by the previous page"
 // @Success 200 {string} string	"ok"
 // @Router /plans [get]
 func GetPlan(w http.ResponseWriter, r *http.Request, db *db.Database) {
 	id := r.URL.Query().Get("planid")
 	plan := db.GetPlan(id)
+	if err := plan.Redact(); err != nil {
+		log.Errorf("Failed to redact plan: %v", err)
+		JSONError(w, "Failed to redact plan", err)
+		return
+	}
 
 	j, err := json.Marshal(plan)
 	if err != nil {
@@ -452,21 +956,29 @@ func GetPlan(w http.ResponseWriter, r *http.Request, db *db.Database) {
 }
 
 // GetPlans provides all Plan by lineage.
-// Optional "&limit=X" parameter to limit requested quantity of plans.
-// Optional "&page=X" parameter to add an offset to the query and enable pagination.
+// Optional "&page_size=X" (or "&limit=X") parameter to set the requested quantity of plans.
+// Optional "&cursor=X" or "&page=X" parameter to select the page to return.
 // Sorted by most recent to oldest.
 // /api/plans GET endpoint callback
 // Also return pagination informations (current page ans total items count in database)
-func GetPlans(w http.ResponseWriter, r *http.Request, db *db.Database) {
+func GetPlans(w http.ResponseWriter, r *http.Request, d *db.Database) {
 	lineage := r.URL.Query().Get("lineage")
-	limit := r.URL.Query().Get("limit")
-	page := r.URL.Query().Get("page")
-	plans, currentPage, total := db.GetPlans(lineage, limit, page)
+	plans, info, err := d.GetPlans(lineage, db.NewPagination(r.URL.Query()))
+	if err != nil {
+		listError(w, "Failed to get plans", err)
+		return
+	}
+	for i := range plans {
+		if err := plans[i].Redact(); err != nil {
+			log.Errorf("Failed to redact plan: %v", err)
+			JSONError(w, "Failed to redact plans", err)
+			return
+		}
+	}
 
 	response := make(map[string]interface{})
 	response["plans"] = plans
-	response["page"] = currentPage
-	response["total"] = total
+	setPageInfo(response, info)
 	j, err := json.Marshal(response)
 	if err != nil {
 		log.Errorf("Failed to marshal plans: %v", err)
@@ -478,6 +990,89 @@ func GetPlans(w http.ResponseWriter, r *http.Request, db *db.Database) {
 	}
 }
 
+// ComparePlan compares the prior State of a Plan with the latest State of its lineage
+// @Summary Compares a Plan with the latest State
+// @Description Compares the prior State of a Plan with the latest State of its lineage, reporting whether the State was written since the Plan was computed (serial status, unknown if the Plan has no prior serial) and which resources changed in between. The values marked as sensitive by the Plan are masked on both sides, and their changes are unknown.
+// @ID compare-plan
+// @Produce  json
+// @Param   id      path   string     true  "Plan's ID"
+// @Success 200 {object} types.PlanStateCompare
+// @Router /plans/{id}/compare [get]
+func ComparePlan(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	params := mux.Vars(r)
+	plan, err := d.GetPlanJSON(params["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		JSONError(w, "Plan not found", err)
+		return
+	}
+	if err := plan.Redact(); err != nil {
+		log.Errorf("Failed to redact plan: %v", err)
+		JSONError(w, "Failed to redact plan", err)
+		return
+	}
+
+	latest, err := getCompareState(d, plan.Lineage.Value, "")
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		JSONError(w, "State not found", err)
+		return
+	}
+	var base *types.StateStat
+	if plan.PriorSerial != nil {
+		stat, err := d.LineageStateBySerial(plan.Lineage.Value, *plan.PriorSerial)
+		if err != nil {
+			JSONError(w, "Failed to get plan state version", err)
+			return
+		}
+		base = &stat
+	}
+
+	comp, err := compare.ComparePlan(plan, base, latest, d.IgnoreRules)
+	if err != nil {
+		JSONError(w, "Failed to compare plan", err)
+		return
+	}
+
+	j, err := json.Marshal(comp)
+	if err != nil {
+		JSONError(w, "Failed to marshal plan compare", err)
+		return
+	}
+	if _, err := io.WriteString(w, string(j)); err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// GetPlanApply provides the State version resulting from the apply of a Plan
+// @Summary Get the apply of a Plan
+// @Description Provides the State version resulting from the apply of a Plan, matched when the version was inserted, and whether (and where) it diverges from the Plan's planned values
+// @ID get-plan-apply
+// @Produce  json
+// @Param   id      path   string     true  "Plan's ID"
+// @Success 200 {object} types.PlanApply
+// @Failure 404 {object} map[string]string "Plan not applied yet"
+// @Router /plans/{id}/apply [get]
+func GetPlanApply(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	apply, err := d.GetPlanApply(mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		JSONError(w, "Failed to get plan apply", err)
+		return
+	}
+
+	j, err := json.Marshal(apply)
+	if err != nil {
+		JSONError(w, "Failed to marshal plan apply", err)
+		return
+	}
+	if _, err := io.WriteString(w, string(j)); err != nil {
+		log.Error(err.Error())
+	}
+}
+
 // ManagePlans is used to route the request to the appropriated handler function
 // on /api/plans request
 func ManagePlans(w http.ResponseWriter, r *http.Request, db *db.Database) {
@@ -494,21 +1089,71 @@ func ManagePlans(w http.ResponseWriter, r *http.Request, db *db.Database) {
 	}
 }
 
+// DeletePlan removes a Plan, along with its parsed plan, summary, reviews, apply and policy results
+// @Summary Delete a Plan
+// @Description Removes a Plan, along with its parsed plan, summary, reviews, apply and policy results. Requires an API token allowed for the plan's lineage.
+// @ID delete-plan
+// @Param   id      path   integer     true  "Plan's ID"
+// @Param   Authorization      header   string     true  "API token, as 'Bearer <token>'"
+// @Success 204 {string} string	"no content"
+// @Failure 401 {object} map[string]string "Missing or invalid API token"
+// @Failure 403 {object} map[string]string "API token not allowed for the plan's lineage"
+// @Failure 404 {object} map[string]string "Plan not found"
+// @Router /plans/{id} [delete]
+func DeletePlan(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	if _, ok := authorizePlan(w, r, d, "Failed to authorize plan deletion"); !ok {
+		return
+	}
+	if err := d.DeletePlan(mux.Vars(r)["id"]); err != nil {
+		log.Errorf("Failed to delete plan: %v", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		JSONError(w, "Failed to delete plan", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ManagePlan is used to route the request to the appropriated handler function
+// on /api/plans/{id} request
+func ManagePlan(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	switch r.Method {
+	case http.MethodDelete:
+		DeletePlan(w, r, d)
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+	}
+}
+
 // GetLineages recover all Lineage from db.
-// Optional "&limit=X" parameter to limit requested quantity of them.
+// Optional "&page_size=X" (or "&limit=X") parameter to set the requested quantity of lineages.
+// Optional "&cursor=X" or "&page=X" parameter to select the page to return.
 // Sorted by most recent to oldest.
+// Also return pagination informations (current page ans total items count in database)
 // @Summary Get lineages
-// @Description List all existing lineages
+// @Description List existing lineages, most recent first. Returns also paging informations (current page ans total items count in database)
 // @ID get-lineages
 // @Produce  json
-// @Param   limit      query   integer     false  "Limit"
+// @Param   page      query   integer     false  "Page"
+// @Param   page_size      query   integer     false  "Number of lineages per page (default 20, max 1000)"
+// @Param   limit      query   integer     false  "Alias of page_size"
+// @Param   cursor      query   string     false  "Cursor returned as next_cursor by the previous page"
 // @Success 200 {string} string	"ok"
 // @Router /lineages [get]
-func GetLineages(w http.ResponseWriter, r *http.Request, db *db.Database) {
-	limit := r.URL.Query().Get("limit")
-	lineages := db.GetLineages(limit)
+func GetLineages(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	lineages, info, err := d.GetLineages(db.NewPagination(r.URL.Query()))
+	if err != nil {
+		listError(w, "Failed to get lineages", err)
+		return
+	}
 
-	j, err := json.Marshal(lineages)
+	response := make(map[string]interface{})
+	response["lineages"] = lineages
+	setPageInfo(response, info)
+	j, err := json.Marshal(response)
 	if err != nil {
 		log.Errorf("Failed to marshal lineages: %v", err)
 		JSONError(w, "Failed to marshal lineages", err)
@@ -2,9 +2,12 @@ package api
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -13,7 +16,9 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
+	"github.com/camptocamp/terraboard/compare"
 	"github.com/camptocamp/terraboard/db"
+	"github.com/camptocamp/terraboard/types"
 )
 
 func TestJSONError(t *testing.T) {
@@ -72,7 +77,7 @@ func TestListStateStats(t *testing.T) {
 			AddRow(3))
 
 	mock.ExpectQuery("^SELECT (.+)").
-		WithArgs(0).
+		WithArgs(21, 0).
 		WillReturnRows(sqlmock.NewRows([]string{"path"}).
 			AddRow("foo").
 			AddRow("bar").
@@ -86,11 +91,77 @@ func TestListStateStats(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/lineages/stats?page=1", nil)
 	ListStateStats(buf, req, db)
 
-	if buf.Body.String() != `{"page":1,"states":[{"path":"foo","lineage_value":"","terraform_version":"","serial":0,"version_id":"","last_modified":"0001-01-01T00:00:00Z","resource_count":0},{"path":"bar","lineage_value":"","terraform_version":"","serial":0,"version_id":"","last_modified":"0001-01-01T00:00:00Z","resource_count":0},{"path":"baz","lineage_value":"","terraform_version":"","serial":0,"version_id":"","last_modified":"0001-01-01T00:00:00Z","resource_count":0}],"total":3}` {
+	if buf.Body.String() != `{"next_cursor":"","page":1,"page_size":20,"states":[{"path":"foo","lineage_value":"","terraform_version":"","serial":0,"version_id":"","last_modified":"0001-01-01T00:00:00Z","resource_count":0},{"path":"bar","lineage_value":"","terraform_version":"","serial":0,"version_id":"","last_modified":"0001-01-01T00:00:00Z","resource_count":0},{"path":"baz","lineage_value":"","terraform_version":"","serial":0,"version_id":"","last_modified":"0001-01-01T00:00:00Z","resource_count":0}],"total":3}` {
 		t.Errorf("TestListStateStats returned unexpected body: %s", buf.Body.String())
 	}
 }
 
+func TestListStateStats_CSV(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"path", "lineage_value"}).
+			AddRow("foo", "lineage1"))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/lineages/stats?format=csv", nil)
+	ListStateStats(buf, req, db)
+
+	assert.Equal(t, "text/csv", buf.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="states.csv"`, buf.Header().Get("Content-Disposition"))
+	if buf.Body.String() != "path,lineage_value,terraform_version,serial,version_id,last_modified,resource_count\nfoo,lineage1,,0,,0001-01-01T00:00:00Z,0\n" {
+		t.Errorf("TestListStateStats_CSV returned unexpected body: %s", buf.Body.String())
+	}
+}
+
+func TestWriteExport_Error(t *testing.T) {
+	buf := httptest.NewRecorder()
+	writeExport(buf, "csv", "states", func(io.Writer) error {
+		return errors.New("connection lost")
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, buf.Code)
+	assert.Equal(t, "application/json", buf.Header().Get("Content-Type"))
+	assert.Empty(t, buf.Header().Get("Content-Disposition"))
+	assert.Equal(t, `{"details":"connection lost","error":"Failed to export states"}`, buf.Body.String())
+}
+
+func TestWriteExport_ErrorAfterWrite(t *testing.T) {
+	buf := httptest.NewRecorder()
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		writeExport(buf, "csv", "states", func(out io.Writer) error {
+			if _, err := io.WriteString(out, "path\n"); err != nil {
+				return err
+			}
+			return errors.New("connection lost")
+		})
+	})
+}
+
+func TestSearchAttribute_UnsupportedFormat(t *testing.T) {
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/search/attribute?format=xml", nil)
+	SearchAttribute(buf, req, nil)
+
+	assert.Equal(t, http.StatusBadRequest, buf.Code)
+	if buf.Body.String() != `{"details":"unsupported export format 'xml'","error":"Unsupported export format"}` {
+		t.Errorf("TestSearchAttribute_UnsupportedFormat returned unexpected body: %s", buf.Body.String())
+	}
+}
+
 func TestGetState(t *testing.T) {
 	fakeDB, mock, err := sqlmock.New()
 	if err != nil {
@@ -162,6 +233,90 @@ func TestGetLineageActivity(t *testing.T) {
 	}
 }
 
+func TestGetLineageChanges(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT count(.+)").
+		WithArgs("123456789").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("^SELECT (.+) FROM \"lineage_changes\" (.+) LIMIT 21").
+		WithArgs("123456789").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "from_version_id", "to_version_id", "added_count", "removed_count"}).
+			AddRow(2, "foo", "bar", 1, 1))
+	mock.ExpectQuery("^SELECT (.+) FROM \"lineage_change_resources\"").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "lineage_change_id", "action", "address"}).
+			AddRow(1, 2, "added", "aws_instance.web").
+			AddRow(2, 2, "removed", "aws_instance.db"))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/lineages/123456789/changes", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"lineage": "123456789",
+	})
+	GetLineageChanges(buf, req, db)
+
+	if buf.Body.String() != `{"changes":[{"from_version_id":"foo","to_version_id":"bar","last_modified":"0001-01-01T00:00:00Z","added_count":1,"removed_count":1,"changed_count":0,"moved_count":0,"resources":[{"action":"added","address":"aws_instance.web"},{"action":"removed","address":"aws_instance.db"}]}],"next_cursor":"","page":1,"page_size":20,"total":1}` {
+		t.Errorf("TestGetLineageChanges returned unexpected body: %s", buf.Body.String())
+	}
+}
+
+func TestGetResourceHistory(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT (.+)").
+		WithArgs("123456789", "aws_instance.web").
+		WillReturnRows(sqlmock.NewRows([]string{"state_id", "path", "version_id", "key", "value"}).
+			AddRow(1, "path", "foo", "ami", `"ami-123"`))
+	mock.ExpectQuery("^SELECT (.+)").
+		WithArgs("123456789", "aws_instance.db").
+		WillReturnRows(sqlmock.NewRows([]string{"state_id"}))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/resources/history?lineage=123456789&address=aws_instance.web", nil)
+	GetResourceHistory(buf, req, db)
+
+	if buf.Body.String() != `{"lineage":"123456789","address":"aws_instance.web","versions":[{"path":"path","version_id":"foo","last_modified":"0001-01-01T00:00:00Z","serial":0,"changed":false,"attributes":[{"key":"ami","value":"\"ami-123\""}]}]}` {
+		t.Errorf("TestGetResourceHistory returned unexpected body: %s", buf.Body.String())
+	}
+
+	buf = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/resources/history?lineage=123456789&address=aws_instance.db", nil)
+	GetResourceHistory(buf, req, db)
+	assert.Equal(t, http.StatusNotFound, buf.Code)
+
+	buf = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/resources/history?lineage=123456789", nil)
+	GetResourceHistory(buf, req, db)
+	assert.Equal(t, http.StatusBadRequest, buf.Code)
+}
+
 func TestStateCompare(t *testing.T) {
 	fakeDB, mock, err := sqlmock.New()
 	if err != nil {
@@ -201,11 +356,148 @@ func TestStateCompare(t *testing.T) {
 	req = mux.SetURLVars(req, vars)
 	StateCompare(buf, req, db)
 
-	if buf.Body.String() != `{"stats":{"from":{"path":"path","version_id":"","resource_count":0,"terraform_version":"","serial":0},"to":{"path":"path2","version_id":"","resource_count":0,"terraform_version":"","serial":0}},"differences":{"only_in_old":{},"only_in_new":{},"in_both":null,"resource_diff":{}}}` {
+	if buf.Body.String() != `{"stats":{"from":{"path":"path","version_id":"","resource_count":0,"terraform_version":"","serial":0},"to":{"path":"path2","version_id":"","resource_count":0,"terraform_version":"","serial":0}},"differences":{"only_in_old":{},"only_in_new":{},"in_both":null,"resource_diff":{},"moved":[]},"outputs":{"added":{},"removed":{},"changed":{}}}` {
 		t.Errorf("TestStateCompare returned unexpected body: %s", buf.Body.String())
 	}
 }
 
+func TestStateCompare_Report(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT (.+) FROM "states" (.+)`).
+		WithArgs("123456789", "123").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "path"}).AddRow(1, `path`))
+	mock.ExpectQuery(`^SELECT (.+) FROM "modules" (.+)`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	mock.ExpectQuery(`^SELECT (.+) FROM "states" (.+)`).
+		WithArgs("123456789", "456").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "path"}).AddRow(2, `path`))
+	mock.ExpectQuery(`^SELECT (.+) FROM "modules" (.+)`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/lineages/123456789/compare?from=123&to=456&format=markdown", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"lineage": "123456789",
+	})
+	StateCompare(buf, req, db)
+
+	assert.Equal(t, http.StatusOK, buf.Code)
+	assert.Equal(t, "text/markdown; charset=utf-8", buf.Header().Get("Content-Type"))
+	assert.Contains(t, buf.Body.String(), "# State comparison: `path`")
+
+	buf = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/lineages/123456789/compare?from=123&to=456&format=pdf", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"lineage": "123456789",
+	})
+	StateCompare(buf, req, db)
+
+	assert.Equal(t, http.StatusBadRequest, buf.Code)
+}
+
+func TestCompareStates(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT (.+) FROM "states" (.+)`).
+		WithArgs("staging", "123").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "path"}).AddRow(1, `staging`))
+	mock.ExpectQuery(`^SELECT (.+) FROM "modules" (.+)`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	mock.ExpectQuery(`^SELECT versions.version_id FROM (.+)`).
+		WithArgs("production").
+		WillReturnRows(sqlmock.NewRows([]string{"version_id"}).AddRow("456"))
+	mock.ExpectQuery(`^SELECT (.+) FROM "states" (.+)`).
+		WithArgs("production", "456").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "path"}).AddRow(2, `production`))
+	mock.ExpectQuery(`^SELECT (.+) FROM "modules" (.+)`).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/compare?from_lineage=staging&from=123&to_lineage=production&map=module.staging=module.production&ignore=tags.Env&ignore_rule=*.tags_all", nil)
+	CompareStates(buf, req, db)
+
+	assert.Equal(t, http.StatusOK, buf.Code)
+	if buf.Body.String() != `{"stats":{"from":{"path":"staging","version_id":"","resource_count":0,"terraform_version":"","serial":0},"to":{"path":"production","version_id":"","resource_count":0,"terraform_version":"","serial":0}},"differences":{"only_in_old":{},"only_in_new":{},"in_both":null,"resource_diff":{},"moved":[]},"outputs":{"added":{},"removed":{},"changed":{}}}` {
+		t.Errorf("TestCompareStates returned unexpected body: %s", buf.Body.String())
+	}
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestCompareStates_InvalidOptions(t *testing.T) {
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/compare?from_lineage=staging&to_lineage=production&map=module.staging", nil)
+	CompareStates(buf, req, &db.Database{})
+
+	assert.Equal(t, http.StatusBadRequest, buf.Code)
+
+	buf = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/compare?from_lineage=staging", nil)
+	CompareStates(buf, req, &db.Database{})
+
+	assert.Equal(t, http.StatusBadRequest, buf.Code)
+
+	buf = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/compare?from_lineage=staging&to_lineage=production&ignore_rule=tags", nil)
+	CompareStates(buf, req, &db.Database{})
+
+	assert.Equal(t, http.StatusBadRequest, buf.Code)
+}
+
+func TestIgnoreRules(t *testing.T) {
+	configured := compare.IgnoreAttribute("last_modified")
+
+	opts := compare.Options{IgnoreRules: []compare.IgnoreRule{configured}}
+	assert.Nil(t, ignoreRules(url.Values{}, &opts))
+	assert.Len(t, opts.IgnoreRules, 1)
+
+	query := url.Values{"ignore": {"tags.Environment"}, "ignore_rule": {"aws_lambda_function.source_code_hash"}}
+	assert.Nil(t, ignoreRules(query, &opts))
+	assert.Len(t, opts.IgnoreRules, 2)
+	assert.True(t, opts.IgnoreRules[0].Match("aws_lambda_function", "source_code_hash"))
+	assert.False(t, opts.IgnoreRules[0].Match("aws_instance", "source_code_hash"))
+	assert.True(t, opts.IgnoreRules[1].Match("aws_instance", "tags.Environment"))
+	assert.False(t, opts.IgnoreRules[1].Match("aws_instance", "tags"))
+
+	opts = compare.Options{IgnoreRules: []compare.IgnoreRule{configured}}
+	assert.Nil(t, ignoreRules(url.Values{"ignore": {""}}, &opts))
+	assert.Empty(t, opts.IgnoreRules)
+}
+
 func TestGetLocks(t *testing.T) {
 	// TODO: Test with state provider
 }
@@ -225,8 +517,15 @@ func TestSearchAttribute(t *testing.T) {
 	mock.ExpectQuery("^SELECT count(.+)").
 		WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(1))
 	mock.ExpectQuery("^SELECT (.+)").
-		WithArgs("%test_thing%", "%baz%", "%woozles%", `%"confuzles"%`, `%1.0.0%`, 20).
+		WithArgs("%test_thing%", "%baz%", "%woozles%", `%"confuzles"%`, `%1.0.0%`, 21, 0).
 		WillReturnRows(sqlmock.NewRows([]string{"path", "version_id", "tf_version"}).AddRow("path", "foo", "1.0.0"))
+	mock.ExpectQuery("^SELECT GROUPING(.+)").
+		WithArgs("%test_thing%", "%baz%", "%woozles%", `%"confuzles"%`, `%1.0.0%`).
+		WillReturnRows(sqlmock.NewRows([]string{"facet", "value", "count"}).
+			AddRow(7, "test_thing", 1).
+			AddRow(11, "1.0.0", 1).
+			AddRow(13, "lineage", 1).
+			AddRow(14, "", 1))
 
 	db := &db.Database{
 		DB: gormDB,
@@ -236,11 +535,51 @@ func TestSearchAttribute(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, `/search/attribute?name=baz&type=test_thing&key=woozles&value="confuzles"&tf_version=1.0.0`, nil)
 	SearchAttribute(buf, req, db)
 
-	if buf.Body.String() != `{"page":1,"results":[{"path":"path","version_id":"foo","tf_version":"1.0.0","serial":0,"lineage_value":"","module_path":"","resource_type":"","resource_name":"","resource_index":"","attribute_key":"","attribute_value":""}],"total":1}` {
+	if buf.Body.String() != `{"facets":{"resource_type":[{"value":"test_thing","count":1}],"tf_version":[{"value":"1.0.0","count":1}],"lineage_value":[{"value":"lineage","count":1}],"module_path":[{"value":"","count":1}]},"next_cursor":"","page":1,"page_size":20,"results":[{"path":"path","version_id":"foo","tf_version":"1.0.0","serial":0,"lineage_value":"","module_path":"","resource_type":"","resource_name":"","resource_index":"","attribute_key":"","attribute_value":""}],"total":1}` {
 		t.Errorf("TestSearchAttribute returned unexpected body: %s", buf.Body.String())
 	}
 }
 
+func TestFullTextSearch(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT count(.+)").
+		WithArgs("web.example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(1))
+	mock.ExpectQuery("^SELECT (.+)").
+		WithArgs("web.example.com", 21, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"path", "type", "name", "rank"}).AddRow("path", "aws_route53_record", "web", 0.5))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, `/search?q=web.example.com`, nil)
+	FullTextSearch(buf, req, db)
+
+	if buf.Body.String() != `{"next_cursor":"","page":1,"page_size":20,"results":[{"path":"path","version_id":"","tf_version":"","serial":0,"lineage_value":"","module_path":"","resource_type":"aws_route53_record","resource_name":"web","resource_index":"","rank":0.5}],"total":1}` {
+		t.Errorf("TestFullTextSearch returned unexpected body: %s", buf.Body.String())
+	}
+}
+
+func TestFullTextSearch_NoQuery(t *testing.T) {
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, `/search`, nil)
+	FullTextSearch(buf, req, nil)
+
+	assert.Equal(t, http.StatusBadRequest, buf.Code)
+}
+
 func TestListResourceTypes(t *testing.T) {
 	fakeDB, mock, err := sqlmock.New()
 	if err != nil {
@@ -423,6 +762,14 @@ func TestGetPlansSummary(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).
 			AddRow(1).AddRow(2).AddRow(3))
 
+	mock.ExpectQuery(`^SELECT \* FROM "plan_summaries"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_id", "create", "risk"}).
+			AddRow(1, 3, 2, "low"))
+
+	mock.ExpectQuery(`^SELECT \* FROM "plan_summary_resource_types"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_summary_id", "type", "create"}).
+			AddRow(1, 1, "aws_instance", 2))
+
 	db := &db.Database{
 		DB: gormDB,
 	}
@@ -431,7 +778,7 @@ func TestGetPlansSummary(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, `/plans/summary?lineage=lineage_value&limit=10&page=1`, nil)
 	GetPlansSummary(buf, req, db)
 
-	if buf.Body.String() != `{"page":1,"plans":[{"ID":1,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage_data":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},"terraform_version":"","git_remote":"","git_commit":"","ci_url":"","source":"","exit_code":0,"parsed_plan":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"planned_values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}},"prior_state":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}}}},"plan_json":null},{"ID":2,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage_data":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},"terraform_version":"","git_remote":"","git_commit":"","ci_url":"","source":"","exit_code":0,"parsed_plan":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"planned_values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}},"prior_state":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}}}},"plan_json":null},{"ID":3,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage_data":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},"terraform_version":"","git_remote":"","git_commit":"","ci_url":"","source":"","exit_code":0,"parsed_plan":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"planned_values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}},"prior_state":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}}}},"plan_json":null}],"total":3}` {
+	if buf.Body.String() != `{"next_cursor":"","page":1,"page_size":10,"plans":[{"ID":1,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage_data":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},"terraform_version":"","git_remote":"","git_commit":"","ci_url":"","source":"","exit_code":0,"parsed_plan":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"planned_values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}},"prior_state":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}}}},"plan_json":null,"status":""},{"ID":2,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage_data":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},"terraform_version":"","git_remote":"","git_commit":"","ci_url":"","source":"","exit_code":0,"parsed_plan":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"planned_values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}},"prior_state":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}}}},"plan_json":null,"status":""},{"ID":3,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage_data":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},"terraform_version":"","git_remote":"","git_commit":"","ci_url":"","source":"","exit_code":0,"parsed_plan":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"planned_values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}},"prior_state":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}}}},"plan_json":null,"status":"","summary":{"create":2,"update":0,"delete":0,"replace":0,"risk":"low","resource_types":[{"type":"aws_instance","create":2,"update":0,"delete":0,"replace":0}]}}],"total":3}` {
 		t.Errorf("TestGetPlansSummary returned unexpected body: %s", buf.Body.String())
 	}
 }
@@ -452,6 +799,14 @@ func TestGetPlan(t *testing.T) {
 		WithArgs("1").
 		WillReturnRows(sqlmock.NewRows([]string{"id", "tf_version"}).
 			AddRow(1, "1.0.0"))
+	mock.ExpectQuery(`^SELECT \* FROM "plan_policy_results" WHERE "plan_policy_results"."plan_id" = \$1 ORDER BY policy`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_id", "policy", "passed"}).
+			AddRow(1, 1, "s3", false))
+	mock.ExpectQuery(`^SELECT \* FROM "plan_policy_messages" WHERE "plan_policy_messages"."plan_policy_result_id" = \$1 ORDER BY id`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_policy_result_id", "level", "message"}).
+			AddRow(1, 1, types.PolicyDeny, "aws_s3_bucket_acl.logs must not be public"))
 
 	db := &db.Database{
 		DB: gormDB,
@@ -461,11 +816,42 @@ func TestGetPlan(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, `/plans?planid=1`, nil)
 	ManagePlans(buf, req, db)
 
-	if buf.Body.String() != `{"ID":1,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage_data":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},"terraform_version":"1.0.0","git_remote":"","git_commit":"","ci_url":"","source":"","exit_code":0,"parsed_plan":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"planned_values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}},"prior_state":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}}}},"plan_json":null}` {
+	if buf.Body.String() != `{"ID":1,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage_data":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},"terraform_version":"1.0.0","git_remote":"","git_commit":"","ci_url":"","source":"","exit_code":0,"parsed_plan":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"planned_values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}},"prior_state":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}}}},"plan_json":null,"status":"","policy_results":[{"policy":"s3","passed":false,"messages":[{"level":"deny","message":"aws_s3_bucket_acl.logs must not be public"}]}]}` {
 		t.Errorf("TestGetPlan returned unexpected body: %s", buf.Body.String())
 	}
 }
 
+func TestComparePlan_NotFound(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT (.+) FROM \"plans\" (.+)").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/plans/1/compare", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"id": "1",
+	})
+	ComparePlan(buf, req, db)
+
+	assert.Equal(t, http.StatusNotFound, buf.Code)
+	assert.Contains(t, buf.Body.String(), `"error":"Plan not found"`)
+}
+
 func TestGetPlans(t *testing.T) {
 	fakeDB, mock, err := sqlmock.New()
 	if err != nil {
@@ -486,6 +872,8 @@ func TestGetPlans(t *testing.T) {
 	mock.ExpectQuery("^SELECT (.+)").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).
 			AddRow(1).AddRow(2).AddRow(3))
+	mock.ExpectQuery(`^SELECT \* FROM "plan_policy_results"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_id", "policy", "passed"}))
 
 	db := &db.Database{
 		DB: gormDB,
@@ -495,7 +883,7 @@ func TestGetPlans(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, `/plans?lineage=lineage_value&limit=10&page=1`, nil)
 	ManagePlans(buf, req, db)
 
-	if buf.Body.String() != `{"page":1,"plans":[{"ID":1,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage_data":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},"terraform_version":"","git_remote":"","git_commit":"","ci_url":"","source":"","exit_code":0,"parsed_plan":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"planned_values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}},"prior_state":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}}}},"plan_json":null},{"ID":2,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage_data":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},"terraform_version":"","git_remote":"","git_commit":"","ci_url":"","source":"","exit_code":0,"parsed_plan":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"planned_values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}},"prior_state":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}}}},"plan_json":null},{"ID":3,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage_data":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},"terraform_version":"","git_remote":"","git_commit":"","ci_url":"","source":"","exit_code":0,"parsed_plan":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"planned_values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}},"prior_state":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}}}},"plan_json":null}],"total":3}` {
+	if buf.Body.String() != `{"next_cursor":"","page":1,"page_size":10,"plans":[{"ID":1,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage_data":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},"terraform_version":"","git_remote":"","git_commit":"","ci_url":"","source":"","exit_code":0,"parsed_plan":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"planned_values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}},"prior_state":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}}}},"plan_json":null,"status":""},{"ID":2,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage_data":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},"terraform_version":"","git_remote":"","git_commit":"","ci_url":"","source":"","exit_code":0,"parsed_plan":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"planned_values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}},"prior_state":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}}}},"plan_json":null,"status":""},{"ID":3,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage_data":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},"terraform_version":"","git_remote":"","git_commit":"","ci_url":"","source":"","exit_code":0,"parsed_plan":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"planned_values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}},"prior_state":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"values":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"root_module":{"ID":0,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null}}}},"plan_json":null,"status":""}],"total":3}` {
 		t.Errorf("TestGetPlans returned unexpected body: %s", buf.Body.String())
 	}
 }
@@ -512,6 +900,7 @@ func TestSubmitPlan(t *testing.T) {
 	}))
 	assert.Nil(t, err)
 
+	expectAPIToken(mock, types.APITokenScope{Lineage: "lineage_value"})
 	mock.ExpectQuery("^SELECT (.+)").
 		WillReturnRows(sqlmock.NewRows([]string{"id", "lineage"}).
 			AddRow(1, "lineage_value"))
@@ -533,6 +922,13 @@ func TestSubmitPlan(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id"}))
 	mock.ExpectQuery("^INSERT (.+)").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`^INSERT INTO "plan_summaries" (.+)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`^INSERT INTO "plan_summary_resource_types" (.+)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`^SELECT "id" FROM "plans"`).
+		WithArgs(1, sqlmock.AnyArg(), types.PlanPending, types.PlanApproved).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
 	mock.ExpectCommit()
 
 	db := &db.Database{
@@ -541,6 +937,7 @@ func TestSubmitPlan(t *testing.T) {
 
 	buf := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPost, `/plans`, bytes.NewReader([]byte(`{"lineage":"lineage_value","terraform_version":"1.0.0","git_remote":"foo.com","git_commit":"#12345","ci_url":"","source":"","exit_code":0,"plan_json":{"format_version":"0.1","terraform_version":"0.12.6","planned_values":{"root_module":{"resources":[{"address":"aws_autoscaling_group.my_asg","mode":"managed","type":"aws_autoscaling_group","name":"my_asg","provider_name":"aws","schema_version":0,"values":{"availability_zones":["us-west-1a"],"desired_capacity":4,"enabled_metrics":null,"force_delete":true,"health_check_grace_period":300,"health_check_type":"ELB","initial_lifecycle_hook":[],"launch_configuration":"my_web_config","launch_template":[],"max_size":5,"metrics_granularity":"1Minute","min_elb_capacity":null,"min_size":1,"mixed_instances_policy":[],"name":"my_asg","name_prefix":null,"placement_group":null,"protect_from_scale_in":false,"suspended_processes":null,"tag":[],"tags":null,"termination_policies":null,"timeouts":null,"wait_for_capacity_timeout":"10m","wait_for_elb_capacity":null}},{"address":"aws_instance.web","mode":"managed","type":"aws_instance","name":"web","provider_name":"aws","schema_version":1,"values":{"ami":"ami-09b4b74c","credit_specification":[],"disable_api_termination":null,"ebs_optimized":null,"get_password_data":false,"iam_instance_profile":null,"instance_initiated_shutdown_behavior":null,"instance_type":"t2.micro","monitoring":null,"source_dest_check":true,"tags":null,"timeouts":null,"user_data":null,"user_data_base64":null}},{"address":"aws_launch_configuration.my_web_config","mode":"managed","type":"aws_launch_configuration","name":"my_web_config","provider_name":"aws","schema_version":0,"values":{"associate_public_ip_address":false,"enable_monitoring":true,"ephemeral_block_device":[],"iam_instance_profile":null,"image_id":"ami-09b4b74c","instance_type":"t2.micro","name":"my_web_config","name_prefix":null,"placement_tenancy":null,"security_groups":null,"spot_price":null,"user_data":null,"user_data_base64":null,"vpc_classic_link_id":null,"vpc_classic_link_security_groups":null}}]}},"resource_changes":[{"address":"aws_autoscaling_group.my_asg","mode":"managed","type":"aws_autoscaling_group","name":"my_asg","provider_name":"aws","change":{"actions":["create"],"before":null,"after":{"availability_zones":["us-west-1a"],"desired_capacity":4,"enabled_metrics":null,"force_delete":true,"health_check_grace_period":300,"health_check_type":"ELB","initial_lifecycle_hook":[],"launch_configuration":"my_web_config","launch_template":[],"max_size":5,"metrics_granularity":"1Minute","min_elb_capacity":null,"min_size":1,"mixed_instances_policy":[],"name":"my_asg","name_prefix":null,"placement_group":null,"protect_from_scale_in":false,"suspended_processes":null,"tag":[],"tags":null,"termination_policies":null,"timeouts":null,"wait_for_capacity_timeout":"10m","wait_for_elb_capacity":null},"after_unknown":{"arn":true,"availability_zones":[false],"default_cooldown":true,"id":true,"initial_lifecycle_hook":[],"launch_template":[],"load_balancers":true,"mixed_instances_policy":[],"service_linked_role_arn":true,"tag":[],"target_group_arns":true,"vpc_zone_identifier":true}}},{"address":"aws_instance.web","mode":"managed","type":"aws_instance","name":"web","provider_name":"aws","change":{"actions":["create"],"before":null,"after":{"ami":"ami-09b4b74c","credit_specification":[],"disable_api_termination":null,"ebs_optimized":null,"get_password_data":false,"iam_instance_profile":null,"instance_initiated_shutdown_behavior":null,"instance_type":"t2.micro","monitoring":null,"source_dest_check":true,"tags":null,"timeouts":null,"user_data":null,"user_data_base64":null},"after_unknown":{"arn":true,"associate_public_ip_address":true,"availability_zone":true,"cpu_core_count":true,"cpu_threads_per_core":true,"credit_specification":[],"ebs_block_device":true,"ephemeral_block_device":true,"host_id":true,"id":true,"instance_state":true,"ipv6_address_count":true,"ipv6_addresses":true,"key_name":true,"network_interface":true,"network_interface_id":true,"password_data":true,"placement_group":true,"primary_network_interface_id":true,"private_dns":true,"private_ip":true,"public_dns":true,"public_ip":true,"root_block_device":true,"security_groups":true,"subnet_id":true,"tenancy":true,"volume_tags":true,"vpc_security_group_ids":true}}},{"address":"aws_launch_configuration.my_web_config","mode":"managed","type":"aws_launch_configuration","name":"my_web_config","provider_name":"aws","change":{"actions":["create"],"before":null,"after":{"associate_public_ip_address":false,"enable_monitoring":true,"ephemeral_block_device":[],"iam_instance_profile":null,"image_id":"ami-09b4b74c","instance_type":"t2.micro","name":"my_web_config","name_prefix":null,"placement_tenancy":null,"security_groups":null,"spot_price":null,"user_data":null,"user_data_base64":null,"vpc_classic_link_id":null,"vpc_classic_link_security_groups":null},"after_unknown":{"ebs_block_device":true,"ebs_optimized":true,"ephemeral_block_device":[],"id":true,"key_name":true,"root_block_device":true}}}],"configuration":{"provider_config":{"aws":{"name":"aws","expressions":{"region":{"constant_value":"us-west-1"}}}},"root_module":{"resources":[{"address":"aws_autoscaling_group.my_asg","mode":"managed","type":"aws_autoscaling_group","name":"my_asg","provider_config_key":"aws","expressions":{"availability_zones":{"constant_value":["us-west-1a"]},"desired_capacity":{"constant_value":4},"force_delete":{"constant_value":true},"health_check_grace_period":{"constant_value":300},"health_check_type":{"constant_value":"ELB"},"launch_configuration":{"constant_value":"my_web_config"},"max_size":{"constant_value":5},"min_size":{"constant_value":1},"name":{"constant_value":"my_asg"}},"schema_version":0},{"address":"aws_instance.web","mode":"managed","type":"aws_instance","name":"web","provider_config_key":"aws","expressions":{"ami":{"constant_value":"ami-09b4b74c"},"instance_type":{"constant_value":"t2.micro"}},"schema_version":1},{"address":"aws_launch_configuration.my_web_config","mode":"managed","type":"aws_launch_configuration","name":"my_web_config","provider_config_key":"aws","expressions":{"image_id":{"constant_value":"ami-09b4b74c"},"instance_type":{"constant_value":"t2.micro"},"name":{"constant_value":"my_web_config"}},"schema_version":0}]}}}}`)))
+	req.Header.Set("Authorization", "Bearer tb_test")
 	ManagePlans(buf, req, db)
 
 	if buf.Body.String() != `` {
@@ -548,6 +945,287 @@ func TestSubmitPlan(t *testing.T) {
 	}
 }
 
+// expectAPIToken expects the lookup of an API token with the given scopes
+func expectAPIToken(mock sqlmock.Sqlmock, scopes ...types.APITokenScope) {
+	mock.ExpectQuery(`^SELECT \* FROM "api_tokens" WHERE hash = \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "ci"))
+	rows := sqlmock.NewRows([]string{"id", "api_token_id", "lineage", "path_prefix"})
+	for i, scope := range scopes {
+		rows.AddRow(i+1, 1, scope.Lineage, scope.PathPrefix)
+	}
+	mock.ExpectQuery(`^SELECT \* FROM "api_token_scopes" WHERE "api_token_scopes"."api_token_id" = \$1`).
+		WithArgs(1).
+		WillReturnRows(rows)
+}
+
+// expectPlanToken expects the lookup of an API token allowed for a lineage,
+// and of the lineage of the plan it manages: none if lineage is empty
+func expectPlanToken(mock sqlmock.Sqlmock, id, lineage string) {
+	expectAPIToken(mock, types.APITokenScope{Lineage: "lineage_value"})
+	rows := sqlmock.NewRows([]string{"id", "Lineage__value"})
+	if lineage != "" {
+		rows.AddRow(id, lineage)
+	}
+	mock.ExpectQuery(`^SELECT "plans"."id",(.+) FROM "plans" LEFT JOIN "lineages" "Lineage"`).
+		WithArgs(id).
+		WillReturnRows(rows)
+}
+
+func TestSubmitPlan_Invalid(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	testCases := []struct {
+		name     string
+		body     string
+		code     int
+		problems []interface{}
+	}{
+		{
+			name: "malformed",
+			body: `{"lineage":`,
+			code: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid",
+			body:     `{"terraform_version":"1.0.0","plan_json":{"format_version":"2.0"}}`,
+			code:     http.StatusUnprocessableEntity,
+			problems: []interface{}{"lineage is required", "plan_json.format_version '2.0' is not supported (expected 0.x or 1.x)"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := httptest.NewRecorder()
+			expectAPIToken(mock, types.APITokenScope{Lineage: "lineage_value"})
+			req := httptest.NewRequest(http.MethodPost, `/plans`, bytes.NewReader([]byte(tc.body)))
+			req.Header.Set("Authorization", "Bearer tb_test")
+			SubmitPlan(buf, req, db)
+
+			assert.Equal(t, tc.code, buf.Code)
+			var body map[string]interface{}
+			assert.Nil(t, json.Unmarshal(buf.Body.Bytes(), &body))
+			assert.Equal(t, "Failed to insert plan to db", body["error"])
+			if tc.problems != nil {
+				assert.Equal(t, tc.problems, body["problems"])
+			}
+		})
+	}
+}
+
+func TestSubmitPlan_InvalidPlanFile(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	expectAPIToken(mock, types.APITokenScope{Lineage: "lineage_value"})
+	req := httptest.NewRequest(http.MethodPost, `/plans?exit_code=changes`, bytes.NewReader([]byte("PK\x03\x04")))
+	req.Header.Set("Authorization", "Bearer tb_test")
+	SubmitPlan(buf, req, db)
+
+	assert.Equal(t, http.StatusBadRequest, buf.Code)
+	var body map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Body.Bytes(), &body))
+	assert.Equal(t, "Invalid exit code", body["error"])
+
+	buf = httptest.NewRecorder()
+	expectAPIToken(mock, types.APITokenScope{Lineage: "lineage_value"})
+	req = httptest.NewRequest(http.MethodPost, `/plans?exit_code=2`, bytes.NewReader([]byte("PK\x03\x04garbage")))
+	req.Header.Set("Authorization", "Bearer tb_test")
+	SubmitPlan(buf, req, db)
+
+	assert.Equal(t, http.StatusBadRequest, buf.Code)
+	assert.Nil(t, json.Unmarshal(buf.Body.Bytes(), &body))
+	assert.Equal(t, "Failed to insert plan file to db", body["error"])
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestSubmitPlan_Unauthorized(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT \* FROM "api_tokens" WHERE hash = \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	expectAPIToken(mock, types.APITokenScope{PathPrefix: "prod/"})
+	mock.ExpectQuery(`^SELECT DISTINCT "states"."path" FROM "states" JOIN lineages ON lineages.id = states.lineage_id WHERE lineages.value = \$1`).
+		WithArgs("lineage_value").
+		WillReturnRows(sqlmock.NewRows([]string{"path"}).AddRow("staging/terraform.tfstate"))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	testCases := []struct {
+		name          string
+		authorization string
+		code          int
+		error         string
+	}{
+		{"missing token", "", http.StatusUnauthorized, "Failed to authenticate plan submission"},
+		{"unknown token", "Bearer tb_unknown", http.StatusUnauthorized, "Failed to authenticate plan submission"},
+		{"lineage out of scope", "Bearer tb_test", http.StatusForbidden, "Failed to insert plan to db"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, `/plans`, bytes.NewReader([]byte(`{"lineage":"lineage_value","terraform_version":"1.0.0","plan_json":{"format_version":"1.0"}}`)))
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			SubmitPlan(buf, req, db)
+
+			assert.Equal(t, tc.code, buf.Code)
+			var body map[string]interface{}
+			assert.Nil(t, json.Unmarshal(buf.Body.Bytes(), &body))
+			assert.Equal(t, tc.error, body["error"])
+		})
+	}
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestGetPlanApply(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT \* FROM "plan_applies" WHERE plan_id = \$1`).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_id", "version_id", "serial", "diverged"}).
+			AddRow(1, 1, "v2", 5, true))
+	mock.ExpectQuery(`^SELECT \* FROM "plan_divergences" WHERE "plan_divergences"."plan_apply_id" = \$1 ORDER BY id`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_apply_id", "kind", "address", "path"}).
+			AddRow(1, 1, types.DivergenceChanged, "aws_instance.web", "instance_type"))
+	mock.ExpectQuery(`^SELECT \* FROM "plan_applies" WHERE plan_id = \$1`).
+		WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, `/plans/1/apply`, nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	GetPlanApply(buf, req, db)
+
+	assert.Equal(t, http.StatusOK, buf.Code)
+	assert.Equal(t, `{"plan_id":1,"version_id":"v2","serial":5,"last_modified":"0001-01-01T00:00:00Z","diverged":true,"divergences":[{"kind":"changed","address":"aws_instance.web","path":"instance_type"}]}`, buf.Body.String())
+
+	buf = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, `/plans/2/apply`, nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "2"})
+	GetPlanApply(buf, req, db)
+
+	assert.Equal(t, http.StatusNotFound, buf.Code)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestDeletePlan(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	expectPlanToken(mock, "1", "lineage_value")
+	mock.ExpectQuery(`^SELECT "id","parsed_plan_id" FROM "plans"`).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parsed_plan_id"}).AddRow(1, nil))
+	mock.ExpectBegin()
+	for _, table := range []string{"plan_summary_resource_types", "plan_summaries", "plan_reviews", "plan_divergences", "plan_applies", "plan_policy_messages", "plan_policy_results", "plans"} {
+		mock.ExpectExec(`^DELETE FROM "` + table + `"`).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+	expectPlanToken(mock, "2", "")
+	expectPlanToken(mock, "3", "other_lineage")
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	testCases := []struct {
+		id            string
+		authorization string
+		code          int
+	}{
+		{"1", "Bearer tb_test", http.StatusNoContent},
+		{"2", "Bearer tb_test", http.StatusNotFound},
+		{"3", "Bearer tb_test", http.StatusForbidden},
+		{"1", "", http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		buf := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, `/plans/`+tc.id, nil)
+		req = mux.SetURLVars(req, map[string]string{"id": tc.id})
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+		ManagePlan(buf, req, db)
+
+		assert.Equal(t, tc.code, buf.Code, "plan %s", tc.id)
+	}
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
 func TestManagePlansMethodError(t *testing.T) {
 	buf := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPut, `/plans`, nil)
@@ -570,7 +1248,10 @@ func TestGetLineages(t *testing.T) {
 	}))
 	assert.Nil(t, err)
 
-	mock.ExpectQuery("^SELECT (.+)").
+	mock.ExpectQuery("^SELECT count(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).
+			AddRow(3))
+	mock.ExpectQuery("^SELECT (.+) LIMIT 3").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).
 			AddRow(1).AddRow(2).AddRow(3))
 
@@ -579,10 +1260,73 @@ func TestGetLineages(t *testing.T) {
 	}
 
 	buf := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodGet, `/lineages?limit=10`, nil)
+	req := httptest.NewRequest(http.MethodGet, `/lineages?limit=2`, nil)
 	GetLineages(buf, req, db)
 
-	if buf.Body.String() != `[{"ID":1,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},{"ID":2,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},{"ID":3,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null}]` {
+	if buf.Body.String() != `{"lineages":[{"ID":1,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null},{"ID":2,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"lineage":"","states":null,"plans":null}],"next_cursor":"WyIwMDAxLTAxLTAxVDAwOjAwOjAwWiIsMl0","page":1,"page_size":2,"total":3}` {
 		t.Errorf("TestGetLineages returned unexpected body: %s", buf.Body.String())
 	}
 }
+
+func TestGetLineages_Paged(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT count(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).
+			AddRow(3))
+	mock.ExpectQuery("^SELECT (.+) LIMIT 3").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).
+			AddRow(1).AddRow(2).AddRow(3))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, `/lineages?page_size=2`, nil)
+	GetLineages(buf, req, db)
+
+	var response map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Body.Bytes(), &response))
+	assert.Len(t, response["lineages"], 2)
+	assert.Equal(t, float64(3), response["total"])
+	assert.Equal(t, float64(2), response["page_size"])
+	assert.NotEmpty(t, response["next_cursor"])
+}
+
+func TestGetLineages_InvalidCursor(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT count(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).
+			AddRow(3))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, `/lineages?cursor=foo`, nil)
+	GetLineages(buf, req, db)
+
+	assert.Equal(t, http.StatusBadRequest, buf.Code)
+	assert.Contains(t, buf.Body.String(), `"error":"Failed to get lineages"`)
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/camptocamp/terraboard/comment"
+	"github.com/camptocamp/terraboard/db"
+	"github.com/camptocamp/terraboard/types"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// planComment renders the plan of the request as a Markdown comment,
+// writing the error if it fails
+func planComment(w http.ResponseWriter, r *http.Request, d *db.Database) (plan types.Plan, md string, ok bool) {
+	plan = d.GetPlan(mux.Vars(r)["id"])
+	if plan.ID == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		JSONError(w, "Plan not found", gorm.ErrRecordNotFound)
+		return
+	}
+
+	md, err := comment.Render(plan, d.RiskRules)
+	if err != nil {
+		log.Errorf("Failed to render plan comment: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		JSONError(w, "Failed to render plan comment", err)
+		return
+	}
+	return plan, md, true
+}
+
+// GetPlanComment provides a plan as a Markdown comment
+// @Summary Get a plan as a Markdown comment
+// @Description Renders a plan as a Markdown summary of its resource changes, grouped by module, with the attribute diffs of updated and replaced resources in collapsible sections. Sensitive values are masked, and the resource changes beyond the size limit of GitHub comments (65536 characters) are left out.
+// @ID get-plan-comment
+// @Produce  text/markdown
+// @Param   id      path   integer     true  "Plan ID"
+// @Success 200 {string} string	"Markdown comment"
+// @Failure 404 {object} map[string]string "Plan not found"
+// @Router /plans/{id}/comment [get]
+func GetPlanComment(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	_, md, ok := planComment(w, r, d)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	if _, err := io.WriteString(w, md); err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// PostPlanComment comments a plan on the merge request (GitLab)
+// or pull request (GitHub) of its commit
+// @Summary Comment a plan on its merge request
+// @Description Posts a plan, rendered as a Markdown comment, on the open GitLab merge request or GitHub pull request containing its commit, in the repository of its git remote. Requires a GitLab or GitHub token to be set for the repository host, and an API token allowed for the plan's lineage.
+// @ID post-plan-comment
+// @Produce  json
+// @Param   id      path   integer     true  "Plan ID"
+// @Param   Authorization      header   string     true  "API token, as 'Bearer <token>'"
+// @Success 201 {object} map[string]string "URL of the comment"
+// @Failure 401 {object} map[string]string "Missing or invalid API token"
+// @Failure 403 {object} map[string]string "API token not allowed for the plan's lineage"
+// @Failure 404 {object} map[string]string "Plan or merge request not found"
+// @Failure 422 {object} map[string]string "Unsupported git remote"
+// @Router /plans/{id}/comment [post]
+func PostPlanComment(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	if _, ok := authorizePlan(w, r, d, "Failed to authorize plan comment"); !ok {
+		return
+	}
+	plan, md, ok := planComment(w, r, d)
+	if !ok {
+		return
+	}
+
+	url, err := comment.Post(d.Comment, plan, md)
+	if err != nil {
+		log.Errorf("Failed to post plan comment: %v", err)
+		switch {
+		case errors.Is(err, comment.ErrNoMergeRequest):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, comment.ErrUnsupportedRemote):
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		JSONError(w, "Failed to post plan comment", err)
+		return
+	}
+
+	j, err := json.Marshal(map[string]string{"url": url})
+	if err != nil {
+		JSONError(w, "Failed to marshal plan comment", err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	if _, err := io.WriteString(w, string(j)); err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// ManagePlanComment is used to route the request to the appropriated handler function
+// on /api/plans/{id}/comment request
+func ManagePlanComment(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	switch r.Method {
+	case http.MethodGet:
+		GetPlanComment(w, r, d)
+	case http.MethodPost:
+		PostPlanComment(w, r, d)
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/camptocamp/terraboard/db"
+)
+
+func TestGetPlanComment(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT (.+) FROM "plans"`).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tf_version", "git_commit", "plan_json"}).
+			AddRow(1, "1.5.0", "abc1234", `{"planned_values": {}}`))
+	mock.ExpectQuery(`^SELECT (.+) FROM "plans"`).
+		WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/plans/1/comment", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	ManagePlanComment(buf, req, db)
+
+	assert.Equal(t, http.StatusOK, buf.Code)
+	assert.Equal(t, "text/markdown; charset=utf-8", buf.Header().Get("Content-Type"))
+	assert.Equal(t, "### Terraform plan: no changes\n\nRisk: **none** · Terraform 1.5.0 · commit `abc1234`\n", buf.Body.String())
+
+	buf = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/plans/2/comment", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "2"})
+	ManagePlanComment(buf, req, db)
+
+	assert.Equal(t, http.StatusNotFound, buf.Code)
+	assert.Contains(t, buf.Body.String(), `"error":"Plan not found"`)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestPostPlanComment_UnsupportedRemote(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	expectPlanToken(mock, "1", "lineage_value")
+	mock.ExpectQuery(`^SELECT (.+) FROM "plans"`).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "git_remote", "git_commit", "plan_json"}).
+			AddRow(1, "git@git.example.com:group/project.git", "abc1234", `{"planned_values": {}}`))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/plans/1/comment", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	req.Header.Set("Authorization", "Bearer tb_test")
+	ManagePlanComment(buf, req, db)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, buf.Code)
+	assert.Contains(t, buf.Body.String(), `"error":"Failed to post plan comment"`)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestPostPlanComment_Unauthorized(t *testing.T) {
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/plans/1/comment", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	ManagePlanComment(buf, req, &db.Database{})
+
+	assert.Equal(t, http.StatusUnauthorized, buf.Code)
+	assert.Equal(t, "Bearer", buf.Header().Get("WWW-Authenticate"))
+}
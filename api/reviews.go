@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/camptocamp/terraboard/db"
+	"github.com/camptocamp/terraboard/types"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// reviewPayload is the body of a plan review
+type reviewPayload struct {
+	// The status to move the plan to (approved, rejected, applied or superseded), empty for comments
+	Status  string `json:"status"`
+	Comment string `json:"comment"`
+}
+
+// proxyUser returns the identity of the logged user, from the auth headers
+func proxyUser(r *http.Request) string {
+	if user := r.Header.Get("X-Forwarded-User"); user != "" {
+		return user
+	}
+	return r.Header.Get("X-Forwarded-Email")
+}
+
+// reviewer authenticates the reviewer of a plan: the logged user if the
+// auth headers are trusted, or else the API token, which must be allowed for
+// the plan's lineage. It writes the error and returns false on failure.
+func reviewer(w http.ResponseWriter, r *http.Request, d *db.Database) (string, bool) {
+	if d.TrustProxyAuth {
+		if user := proxyUser(r); user != "" {
+			return user, true
+		}
+	}
+	apiToken, ok := authorizePlan(w, r, d, "Failed to authorize plan review")
+	if !ok {
+		return "", false
+	}
+	return apiToken.Identity(), true
+}
+
+// reviewError writes the error of a plan review with the status matching its cause
+func reviewError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, db.ErrInvalidReview):
+		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, db.ErrInvalidTransition):
+		w.WriteHeader(http.StatusConflict)
+	case errors.Is(err, db.ErrSelfApproval):
+		w.WriteHeader(http.StatusForbidden)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	JSONError(w, message, err)
+}
+
+// GetPlanStatus provides the review status of a plan, along with its reviews.
+// It is meant to be polled by CI pipelines before running 'terraform apply'.
+// @Summary Get the review status of a plan
+// @Description Provides the review status of a plan (pending, approved, rejected, applied or superseded), along with its reviews, oldest first
+// @ID get-plan-status
+// @Produce  json
+// @Param   id      path   integer     true  "Plan ID"
+// @Success 200 {object} types.PlanStatus
+// @Router /plans/{id}/reviews [get]
+func GetPlanStatus(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	status, err := d.GetPlanStatus(mux.Vars(r)["id"])
+	if err != nil {
+		reviewError(w, "Failed to get plan status", err)
+		return
+	}
+
+	j, err := json.Marshal(status)
+	if err != nil {
+		JSONError(w, "Failed to marshal plan status", err)
+		return
+	}
+	if _, err := io.WriteString(w, string(j)); err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// ReviewPlan records a review of a plan: a change of its status, a comment, or both.
+// The reviewer is the API token, or the logged user if the auth headers are trusted.
+// @Summary Review a plan
+// @Description Records a review of a plan: a change of its status, a comment, or both. Pending plans can be approved, rejected or superseded, approved plans can be applied, rejected or superseded. Requires an API token allowed for the plan's lineage, which is the reviewer, unless the auth headers are trusted: the logged user is then the reviewer. A plan can't be approved or rejected by the token it was submitted with.
+// @ID review-plan
+// @Accept  json
+// @Produce  json
+// @Param   id      path   integer     true  "Plan ID"
+// @Param   review      body   api.reviewPayload     true  "Review"
+// @Param   Authorization      header   string     false  "API token, as 'Bearer <token>', required unless the auth headers are trusted"
+// @Success 201 {object} types.PlanReview
+// @Failure 400 {object} map[string]string "Invalid review"
+// @Failure 401 {object} map[string]string "Missing or invalid API token"
+// @Failure 403 {object} map[string]string "API token not allowed for the plan's lineage, or plan approved or rejected by its submitter"
+// @Failure 404 {object} map[string]string "Plan not found"
+// @Failure 409 {object} map[string]string "Invalid status transition"
+// @Router /plans/{id}/reviews [post]
+func ReviewPlan(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	user, ok := reviewer(w, r, d)
+	if !ok {
+		return
+	}
+
+	var payload reviewPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		JSONError(w, "Failed to decode review", err)
+		return
+	}
+
+	review := types.PlanReview{
+		Status:   payload.Status,
+		Comment:  payload.Comment,
+		Reviewer: user,
+	}
+
+	if err := d.ReviewPlan(mux.Vars(r)["id"], &review); err != nil {
+		log.Errorf("Failed to review plan: %v", err)
+		reviewError(w, "Failed to review plan", err)
+		return
+	}
+
+	j, err := json.Marshal(review)
+	if err != nil {
+		JSONError(w, "Failed to marshal review", err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	if _, err := io.WriteString(w, string(j)); err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// ManagePlanReviews is used to route the request to the appropriated handler function
+// on /api/plans/{id}/reviews request
+func ManagePlanReviews(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	switch r.Method {
+	case http.MethodGet:
+		GetPlanStatus(w, r, d)
+	case http.MethodPost:
+		ReviewPlan(w, r, d)
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/camptocamp/terraboard/db"
+	"github.com/camptocamp/terraboard/types"
+)
+
+func TestGetPlanStatus(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT "plans"."id","plans"."status",(.+) FROM "plans" LEFT JOIN "lineages" "Lineage"`).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "Lineage__value"}).
+			AddRow(1, types.PlanApproved, "lineage_value"))
+	mock.ExpectQuery(`^SELECT \* FROM "plan_reviews" WHERE plan_id = \$1 ORDER BY created_at,id`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_id", "status", "reviewer", "comment"}).
+			AddRow(1, 1, types.PlanApproved, "testUser", "LGTM"))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, `/plans/1/reviews`, nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	ManagePlanReviews(buf, req, db)
+
+	assert.Equal(t, http.StatusOK, buf.Code)
+	assert.Equal(t, `{"plan_id":1,"lineage":"lineage_value","status":"approved","reviews":[{"id":1,"plan_id":1,"created_at":"0001-01-01T00:00:00Z","status":"approved","reviewer":"testUser","comment":"LGTM"}]}`, buf.Body.String())
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestReviewPlan(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		name           string
+		trustProxyAuth bool
+		reviewer       string
+	}{
+		// The user header is ignored unless the auth headers are trusted
+		{"token", false, "token:ci"},
+		{"trusted proxy", true, "testUser"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if !tc.trustProxyAuth {
+				expectPlanToken(mock, "1", "lineage_value")
+			}
+			mock.ExpectQuery(`^SELECT "id","lineage_id","status","submitted_by" FROM "plans"`).
+				WithArgs("1").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "lineage_id", "status", "submitted_by"}).
+					AddRow(1, 1, types.PlanPending, "token:submitter"))
+			// The status and the review are recorded together
+			mock.ExpectBegin()
+			mock.ExpectExec(`^UPDATE "plans"`).
+				WithArgs(types.PlanApproved, sqlmock.AnyArg(), 1, types.PlanPending).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(`^INSERT INTO "plan_reviews"`).
+				WithArgs(1, sqlmock.AnyArg(), types.PlanApproved, tc.reviewer, "LGTM").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			mock.ExpectCommit()
+
+			db := &db.Database{
+				DB:             gormDB,
+				TrustProxyAuth: tc.trustProxyAuth,
+			}
+
+			buf := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, `/plans/1/reviews`, bytes.NewReader([]byte(`{"status":"approved","comment":"LGTM"}`)))
+			req = mux.SetURLVars(req, map[string]string{"id": "1"})
+			req.Header.Set("X-Forwarded-User", "testUser")
+			if !tc.trustProxyAuth {
+				req.Header.Set("Authorization", "Bearer tb_test")
+			}
+			ManagePlanReviews(buf, req, db)
+
+			assert.Equal(t, http.StatusCreated, buf.Code)
+			assert.Contains(t, buf.Body.String(), `"id":1,"plan_id":1,`)
+			assert.Contains(t, buf.Body.String(), `"status":"approved","reviewer":"`+tc.reviewer+`","comment":"LGTM"`)
+		})
+	}
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestReviewPlan_Errors(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	testCases := []struct {
+		name          string
+		id            string
+		authorization string
+		user          string
+		body          string
+		code          int
+		// The lineage of the plan, empty if it doesn't exist
+		lineage string
+		// The status and the submitter of the plan, empty if the review doesn't reach it
+		status    string
+		submitter string
+	}{
+		{"missing token", "1", "", "testUser", `{"comment":"LGTM"}`, http.StatusUnauthorized, "", "", ""},
+		{"anonymous transition", "1", "", "", `{"status":"applied"}`, http.StatusUnauthorized, "", "", ""},
+		{"lineage out of scope", "1", "Bearer tb_test", "testUser", `{"comment":"LGTM"}`, http.StatusForbidden, "other_lineage", "", ""},
+		{"malformed review", "1", "Bearer tb_test", "testUser", `{"status":`, http.StatusBadRequest, "lineage_value", "", ""},
+		{"empty review", "1", "Bearer tb_test", "testUser", `{}`, http.StatusBadRequest, "lineage_value", "", ""},
+		{"invalid transition", "1", "Bearer tb_test", "testUser", `{"status":"approved"}`, http.StatusConflict, "lineage_value", types.PlanRejected, "token:submitter"},
+		{"self approval", "1", "Bearer tb_test", "testUser", `{"status":"approved"}`, http.StatusForbidden, "lineage_value", types.PlanPending, "token:ci"},
+		{"unknown plan", "2", "Bearer tb_test", "testUser", `{"comment":"LGTM"}`, http.StatusNotFound, "", "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.authorization != "" {
+				expectPlanToken(mock, tc.id, tc.lineage)
+			}
+			if tc.status != "" {
+				mock.ExpectQuery(`^SELECT "id","lineage_id","status","submitted_by" FROM "plans"`).
+					WithArgs(tc.id).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "lineage_id", "status", "submitted_by"}).
+						AddRow(1, 1, tc.status, tc.submitter))
+			}
+
+			buf := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, `/plans/`+tc.id+`/reviews`, bytes.NewReader([]byte(tc.body)))
+			req = mux.SetURLVars(req, map[string]string{"id": tc.id})
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			if tc.user != "" {
+				req.Header.Set("X-Forwarded-User", tc.user)
+			}
+			ReviewPlan(buf, req, db)
+
+			assert.Equal(t, tc.code, buf.Code)
+			assert.Contains(t, buf.Body.String(), `"error":"Failed to`)
+		})
+	}
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
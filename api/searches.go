@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/camptocamp/terraboard/db"
+	"github.com/camptocamp/terraboard/types"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListSavedSearches lists all saved searches
+// Optional "&owner=X" parameter to only list the searches of a user.
+// @Summary List saved searches
+// @Description Lists all saved searches, optionally filtered by owner
+// @ID list-saved-searches
+// @Produce  json
+// @Param   owner      query   string     false  "Owner"
+// @Success 200 {string} string	"ok"
+// @Router /searches [get]
+func ListSavedSearches(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	searches, err := d.ListSavedSearches(r.URL.Query().Get("owner"))
+	if err != nil {
+		JSONError(w, "Failed to list saved searches", err)
+		return
+	}
+
+	j, err := json.Marshal(searches)
+	if err != nil {
+		JSONError(w, "Failed to marshal saved searches", err)
+		return
+	}
+	if _, err := io.WriteString(w, string(j)); err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// searchOwner returns the owner of the saved searches of a request:
+// the logged user if the auth headers are trusted, none otherwise
+func searchOwner(r *http.Request, d *db.Database) string {
+	if d.TrustProxyAuth {
+		return proxyUser(r)
+	}
+	return ""
+}
+
+// SaveSearch saves a search query, which will then be evaluated after each sync.
+// The owner is the logged user, if the auth headers are trusted.
+// @Summary Save a search
+// @Description Saves a search query (name and SearchAttribute parameters), evaluated after each database sync
+// @ID save-search
+// @Accept  json
+// @Produce  json
+// @Param   search      body   types.SavedSearch     true  "Saved search"
+// @Success 201 {string} string	"created"
+// @Router /searches [post]
+func SaveSearch(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	var search types.SavedSearch
+	if err := json.NewDecoder(r.Body).Decode(&search); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		JSONError(w, "Failed to decode saved search", err)
+		return
+	}
+	search.Owner = searchOwner(r, d)
+
+	if err := d.InsertSavedSearch(&search); err != nil {
+		log.Errorf("Failed to insert saved search: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		JSONError(w, "Failed to save search", err)
+		return
+	}
+
+	j, err := json.Marshal(search)
+	if err != nil {
+		JSONError(w, "Failed to marshal saved search", err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	if _, err := io.WriteString(w, string(j)); err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// GetSavedSearch provides a saved search by its ID
+// @Summary Get a saved search
+// @Description Provides a saved search by its ID
+// @ID get-saved-search
+// @Produce  json
+// @Param   id      path   integer     true  "Saved search ID"
+// @Success 200 {string} string	"ok"
+// @Router /searches/{id} [get]
+func GetSavedSearch(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	search, err := d.GetSavedSearch(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		JSONError(w, "Failed to retrieve saved search", err)
+		return
+	}
+
+	j, err := json.Marshal(search)
+	if err != nil {
+		JSONError(w, "Failed to marshal saved search", err)
+		return
+	}
+	if _, err := io.WriteString(w, string(j)); err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// DeleteSavedSearch removes a saved search of the logged user and its results history
+// @Summary Delete a saved search
+// @Description Removes a saved search and its results history. Only the searches of the logged user can be deleted (the searches without owner when the auth headers are not trusted).
+// @ID delete-saved-search
+// @Param   id      path   integer     true  "Saved search ID"
+// @Success 204 {string} string	"no content"
+// @Router /searches/{id} [delete]
+func DeleteSavedSearch(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	if err := d.DeleteSavedSearch(mux.Vars(r)["id"], searchOwner(r, d)); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		JSONError(w, "Failed to delete saved search", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSavedSearchResults returns the history of result counts of a saved search
+// @Summary Get saved search results
+// @Description Returns the history of result counts of a saved search, most recent first
+// @ID get-saved-search-results
+// @Produce  json
+// @Param   id      path   integer     true  "Saved search ID"
+// @Success 200 {string} string	"ok"
+// @Router /searches/{id}/results [get]
+func GetSavedSearchResults(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	search, err := d.GetSavedSearch(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		JSONError(w, "Failed to retrieve saved search", err)
+		return
+	}
+
+	results, err := d.GetSavedSearchResults(mux.Vars(r)["id"])
+	if err != nil {
+		JSONError(w, "Failed to retrieve saved search results", err)
+		return
+	}
+
+	response := make(map[string]interface{})
+	response["search"] = search
+	response["results"] = results
+	j, err := json.Marshal(response)
+	if err != nil {
+		JSONError(w, "Failed to marshal saved search results", err)
+		return
+	}
+	if _, err := io.WriteString(w, string(j)); err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// ManageSavedSearches is used to route the request to the appropriated handler function
+// on /api/searches request
+func ManageSavedSearches(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	switch r.Method {
+	case http.MethodGet:
+		ListSavedSearches(w, r, d)
+	case http.MethodPost:
+		SaveSearch(w, r, d)
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+	}
+}
+
+// ManageSavedSearch is used to route the request to the appropriated handler function
+// on /api/searches/{id} request
+func ManageSavedSearch(w http.ResponseWriter, r *http.Request, d *db.Database) {
+	switch r.Method {
+	case http.MethodGet:
+		GetSavedSearch(w, r, d)
+	case http.MethodDelete:
+		DeleteSavedSearch(w, r, d)
+	default:
+		http.Error(w, "Invalid request method.", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/camptocamp/terraboard/db"
+)
+
+func TestSaveSearch(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT (.+)").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "old amis", "testUser", "type=aws_instance").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT (.+)").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "old amis", "", "type=aws_instance").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectCommit()
+
+	db := &db.Database{
+		DB:             gormDB,
+		TrustProxyAuth: true,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, `/searches`, bytes.NewReader([]byte(`{"name":"old amis","owner":"someone","query":"type=aws_instance"}`)))
+	req.Header.Set("X-Forwarded-User", "testUser")
+	ManageSavedSearches(buf, req, db)
+
+	assert.Equal(t, http.StatusCreated, buf.Code)
+	assert.Contains(t, buf.Body.String(), `"ID":1`)
+	assert.Contains(t, buf.Body.String(), `"name":"old amis","owner":"testUser","query":"type=aws_instance"`)
+
+	// The auth headers are ignored unless they are trusted
+	db.TrustProxyAuth = false
+	buf = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, `/searches`, bytes.NewReader([]byte(`{"name":"old amis","owner":"someone","query":"type=aws_instance"}`)))
+	req.Header.Set("X-Forwarded-User", "testUser")
+	ManageSavedSearches(buf, req, db)
+
+	assert.Equal(t, http.StatusCreated, buf.Code)
+	assert.Contains(t, buf.Body.String(), `"name":"old amis","owner":"","query":"type=aws_instance"`)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestSaveSearch_Invalid(t *testing.T) {
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, `/searches`, bytes.NewReader([]byte(`{"name":"empty","query":"page=1"}`)))
+	ManageSavedSearches(buf, req, &db.Database{})
+
+	assert.Equal(t, http.StatusBadRequest, buf.Code)
+	if buf.Body.String() != `{"details":"invalid saved search query: query has no search parameter","error":"Failed to save search"}` {
+		t.Errorf("TestSaveSearch_Invalid returned unexpected body: %s", buf.Body.String())
+	}
+}
+
+func TestGetSavedSearchResults(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT (.+) FROM \"saved_searches\" (.+)").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "owner", "query"}).
+			AddRow(1, "old amis", "testUser", "type=aws_instance"))
+	mock.ExpectQuery("^SELECT (.+) FROM \"saved_search_results\" (.+)").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "count"}).
+			AddRow(2, 3).
+			AddRow(1, 4))
+
+	db := &db.Database{
+		DB: gormDB,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, `/searches/1/results`, nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	GetSavedSearchResults(buf, req, db)
+
+	if buf.Body.String() != `{"results":[{"evaluated_at":"0001-01-01T00:00:00Z","count":3},{"evaluated_at":"0001-01-01T00:00:00Z","count":4}],"search":{"ID":1,"CreatedAt":"0001-01-01T00:00:00Z","UpdatedAt":"0001-01-01T00:00:00Z","DeletedAt":null,"name":"old amis","owner":"testUser","query":"type=aws_instance"}}` {
+		t.Errorf("TestGetSavedSearchResults returned unexpected body: %s", buf.Body.String())
+	}
+}
+
+func TestDeleteSavedSearch(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT (.+) FROM \"saved_searches\" WHERE \\(id = \\$1 AND owner = \\$2\\)").
+		WithArgs("1", "testUser").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "owner", "query"}).
+			AddRow(1, "old amis", "testUser", "type=aws_instance"))
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE \"saved_search_results\" SET \"deleted_at\"|^DELETE FROM \"saved_search_results\"").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE \"saved_searches\" SET \"deleted_at\"").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	// The searches of other owners are not found
+	mock.ExpectQuery("^SELECT (.+) FROM \"saved_searches\" WHERE \\(id = \\$1 AND owner = \\$2\\)").
+		WithArgs("1", "otherUser").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	db := &db.Database{
+		DB:             gormDB,
+		TrustProxyAuth: true,
+	}
+
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, `/searches/1`, nil)
+	req.Header.Set("X-Forwarded-User", "testUser")
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	ManageSavedSearch(buf, req, db)
+
+	assert.Equal(t, http.StatusNoContent, buf.Code)
+
+	buf = httptest.NewRecorder()
+	req.Header.Set("X-Forwarded-User", "otherUser")
+	ManageSavedSearch(buf, req, db)
+
+	assert.Equal(t, http.StatusNotFound, buf.Code)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestManageSavedSearchMethodError(t *testing.T) {
+	buf := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, `/searches/1`, nil)
+	ManageSavedSearch(buf, req, nil)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, buf.Code)
+}
@@ -0,0 +1,322 @@
+package comment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/camptocamp/terraboard/compare"
+	"github.com/camptocamp/terraboard/risk"
+	"github.com/camptocamp/terraboard/types"
+)
+
+// unknownValue replaces the values of a resource change only known after apply
+const unknownValue = "(known after apply)"
+
+// maxLength is the maximum length of a comment, in bytes: the size limit of
+// GitHub comments, in characters, the one of GitLab notes being larger
+const maxLength = 65536
+
+// truncatedReserve is the length kept for the note ending a truncated comment
+const truncatedReserve = 256
+
+// resourceChange is a resource change of a Plan, as rendered in a comment
+type resourceChange struct {
+	Address string
+	Action  string
+	// The attribute diffs of updated and replaced resources
+	Diffs []types.AttributeDiff
+}
+
+// hasUnknown returns whether an unknown values object marks any value as unknown
+func hasUnknown(unknown interface{}) bool {
+	switch u := unknown.(type) {
+	case bool:
+		return u
+	case map[string]interface{}:
+		for _, v := range u {
+			if hasUnknown(v) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, v := range u {
+			if hasUnknown(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markUnknown replaces the parts of a value marked as unknown
+// by an unknown values object (after_unknown) with unknownValue
+func markUnknown(value, unknown interface{}) interface{} {
+	if !hasUnknown(unknown) {
+		return value
+	}
+	switch u := unknown.(type) {
+	case map[string]interface{}:
+		v, _ := value.(map[string]interface{})
+		if v == nil {
+			v = make(map[string]interface{})
+		}
+		for k, e := range u {
+			if hasUnknown(e) {
+				v[k] = markUnknown(v[k], e)
+			}
+		}
+		return v
+	case []interface{}:
+		v, _ := value.([]interface{})
+		for i, e := range u {
+			if i < len(v) {
+				v[i] = markUnknown(v[i], e)
+			}
+		}
+		return v
+	}
+	return unknownValue
+}
+
+// changeResource returns a decoded resource change value as a Resource,
+// with the sensitivity object of its value
+func changeResource(value, sensitive interface{}) (res types.Resource, err error) {
+	res.SensitiveAttributes, _ = sensitive.(map[string]interface{})
+	attrs, _ := value.(map[string]interface{})
+	for k, v := range attrs {
+		j, err := json.Marshal(v)
+		if err != nil {
+			return res, err
+		}
+		res.Attributes = append(res.Attributes, types.Attribute{Key: k, Value: string(j)})
+	}
+	return
+}
+
+// decodeChangeValue decodes a value of a Change, which may be unset
+func decodeChangeValue(raw string) (v interface{}, err error) {
+	if raw == "" {
+		return nil, nil
+	}
+	err = json.Unmarshal([]byte(raw), &v)
+	return
+}
+
+// changeDiffs returns the attribute diffs of a resource Change,
+// whose sensitive values are masked
+func changeDiffs(c types.Change) (diffs []types.AttributeDiff, err error) {
+	before, err := decodeChangeValue(string(c.Before))
+	if err != nil {
+		return nil, fmt.Errorf("invalid before value: %v", err)
+	}
+	after, err := decodeChangeValue(string(c.After))
+	if err != nil {
+		return nil, fmt.Errorf("invalid after value: %v", err)
+	}
+	afterUnknown, err := decodeChangeValue(string(c.AfterUnknown))
+	if err != nil {
+		return nil, fmt.Errorf("invalid after_unknown value: %v", err)
+	}
+	beforeSensitive, err := decodeChangeValue(string(c.BeforeSensitive))
+	if err != nil {
+		return nil, fmt.Errorf("invalid before_sensitive value: %v", err)
+	}
+	afterSensitive, err := decodeChangeValue(string(c.AfterSensitive))
+	if err != nil {
+		return nil, fmt.Errorf("invalid after_sensitive value: %v", err)
+	}
+
+	beforeRes, err := changeResource(before, beforeSensitive)
+	if err != nil {
+		return
+	}
+	afterRes, err := changeResource(markUnknown(after, afterUnknown), afterSensitive)
+	if err != nil {
+		return
+	}
+	return compare.DiffAttributes(beforeRes, afterRes), nil
+}
+
+// moduleChanges returns the resource changes of a Plan by module address,
+// the root module address being empty. Unchanged and read resources are skipped.
+func moduleChanges(plan types.PlanModel) (map[string][]resourceChange, error) {
+	modules := make(map[string][]resourceChange)
+	for _, rc := range plan.PlanResourceChanges {
+		action := risk.ChangeAction(string(rc.Change.Actions))
+		if action == "" {
+			continue
+		}
+		c := resourceChange{Address: rc.Address, Action: action}
+		if action == risk.Update || action == risk.Replace {
+			diffs, err := changeDiffs(rc.Change)
+			if err != nil {
+				return nil, fmt.Errorf("failed to diff change of %s: %v", rc.Address, err)
+			}
+			c.Diffs = diffs
+		}
+		modules[rc.ModuleAddress] = append(modules[rc.ModuleAddress], c)
+	}
+	for _, changes := range modules {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Address < changes[j].Address })
+	}
+	return modules, nil
+}
+
+// countsLine describes the counts of changes of a Plan
+func countsLine(counts types.PlanChangeCounts) string {
+	if counts == (types.PlanChangeCounts{}) {
+		return "no changes"
+	}
+	return fmt.Sprintf("%d to create, %d to update, %d to replace, %d to delete",
+		counts.Create, counts.Update, counts.Replace, counts.Delete)
+}
+
+// diffValue formats a value of an attribute diff
+func diffValue(v interface{}, sensitive bool) string {
+	if sensitive {
+		return types.SensitiveValue
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(j)
+}
+
+// writeDiffs writes attribute diffs as the lines of a diff code block
+func writeDiffs(b *strings.Builder, diffs []types.AttributeDiff) {
+	for _, d := range diffs {
+		switch d.Kind {
+		case types.AttributeAdded:
+			fmt.Fprintf(b, "  + %s: %s\n", d.Path, diffValue(d.NewValue, d.Sensitive))
+		case types.AttributeRemoved:
+			fmt.Fprintf(b, "  - %s: %s\n", d.Path, diffValue(d.OldValue, d.Sensitive))
+		default:
+			fmt.Fprintf(b, "  - %s: %s\n", d.Path, diffValue(d.OldValue, d.Sensitive))
+			fmt.Fprintf(b, "  + %s: %s\n", d.Path, diffValue(d.NewValue, d.Sensitive))
+		}
+	}
+}
+
+// longestBackticks returns the length of the longest run of backticks in s
+func longestBackticks(s string) (longest int) {
+	run := 0
+	for _, c := range s {
+		if c != '`' {
+			run = 0
+			continue
+		}
+		run++
+		if run > longest {
+			longest = run
+		}
+	}
+	return
+}
+
+// inlineCode formats s as a Markdown code span, delimited by more
+// backticks than it holds in a row
+func inlineCode(s string) string {
+	fence := strings.Repeat("`", longestBackticks(s)+1)
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
+
+// linkDestination escapes the characters of a URL ending a Markdown link
+func linkDestination(u string) string {
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E").Replace(u)
+}
+
+// writeChange writes a resource change as a Markdown list item, with the
+// attribute diffs of updated and replaced resources in a collapsible
+// section, fenced by more backticks than they hold in a row
+func writeChange(b *strings.Builder, c resourceChange) {
+	if len(c.Diffs) == 0 {
+		fmt.Fprintf(b, "- **%s** %s\n", c.Action, inlineCode(c.Address))
+		return
+	}
+	var diffs strings.Builder
+	writeDiffs(&diffs, c.Diffs)
+	fence := strings.Repeat("`", max(3, longestBackticks(diffs.String())+1))
+	fmt.Fprintf(b, "- <details><summary><b>%s</b> <code>%s</code></summary>\n\n  %sdiff\n",
+		c.Action, html.EscapeString(c.Address), fence)
+	b.WriteString(diffs.String())
+	fmt.Fprintf(b, "  %s\n\n  </details>\n", fence)
+}
+
+// Render renders a Plan as a Markdown summary of its resource changes, grouped
+// by module, with the attribute diffs of updated and replaced resources in
+// collapsible sections. Its risk is classified with rules.
+// The sensitive values of the Plan are masked, and the changes which would
+// exceed the size limit of comments are left out.
+func Render(plan types.Plan, rules []risk.Rule) (string, error) {
+	summary := risk.Summarize(plan.ParsedPlan, rules)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Terraform plan: %s\n\n", countsLine(summary.PlanChangeCounts))
+
+	details := []string{fmt.Sprintf("Risk: **%s**", summary.Risk)}
+	if plan.Lineage.Value != "" {
+		details = append(details, "lineage "+inlineCode(plan.Lineage.Value))
+	}
+	if plan.TFVersion != "" {
+		details = append(details, fmt.Sprintf("Terraform %s", plan.TFVersion))
+	}
+	if plan.GitCommit != "" {
+		details = append(details, "commit "+inlineCode(plan.GitCommit))
+	}
+	if plan.CiURL != "" {
+		details = append(details, fmt.Sprintf("[CI job](%s)", linkDestination(plan.CiURL)))
+	}
+	b.WriteString(strings.Join(details, " · ") + "\n")
+
+	if _, err := compare.PlannedState(plan); errors.Is(err, compare.ErrNoPlannedValues) {
+		b.WriteString("\nThe resource changes of this plan are unknown.\n")
+		return b.String(), nil
+	}
+
+	modules, err := moduleChanges(plan.ParsedPlan)
+	if err != nil {
+		return "", err
+	}
+	addresses := make([]string, 0, len(modules))
+	for m := range modules {
+		addresses = append(addresses, m)
+	}
+	sort.Strings(addresses)
+
+	omitted := 0
+	for _, m := range addresses {
+		var section strings.Builder
+		if m == "" {
+			section.WriteString("\n#### Root module\n\n")
+		} else {
+			fmt.Fprintf(&section, "\n#### Module %s\n\n", inlineCode(m))
+		}
+		written := 0
+		for _, c := range modules[m] {
+			var item strings.Builder
+			writeChange(&item, c)
+			if omitted > 0 || b.Len()+section.Len()+item.Len() > maxLength-truncatedReserve {
+				omitted++
+				continue
+			}
+			section.WriteString(item.String())
+			written++
+		}
+		if written > 0 {
+			b.WriteString(section.String())
+		}
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&b, "\n_%d more resource change(s) left out, as the comment would exceed %d characters: see the plan in Terraboard._\n",
+			omitted, maxLength)
+	}
+	return b.String(), nil
+}
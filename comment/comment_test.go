@@ -0,0 +1,164 @@
+package comment
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/terraboard/risk"
+	"github.com/camptocamp/terraboard/types"
+)
+
+const testPlanJSON = `{
+	"format_version": "1.1",
+	"configuration": {
+		"root_module": {
+			"variables": {"db_password": {"sensitive": true}}
+		}
+	},
+	"variables": {"db_password": {"value": "hunter2"}},
+	"planned_values": {"root_module": {}},
+	"resource_changes": [
+		{
+			"address": "aws_s3_bucket.logs",
+			"type": "aws_s3_bucket",
+			"change": {"actions": ["create"], "before": null, "after": {"bucket": "logs"}}
+		},
+		{
+			"address": "aws_instance.web",
+			"type": "aws_instance",
+			"change": {
+				"actions": ["update"],
+				"before": {"instance_type": "t3.small", "tags": {"env": "prod"}, "arn": "arn:1"},
+				"after": {"instance_type": "t3.large", "tags": {"env": "prod", "team": "ops"}},
+				"after_unknown": {"arn": true}
+			}
+		},
+		{
+			"address": "module.db.aws_db_instance.db[\"main\"]",
+			"module_address": "module.db",
+			"type": "aws_db_instance",
+			"change": {
+				"actions": ["delete", "create"],
+				"before": {"engine": "postgres", "password": "old"},
+				"after": {"engine": "mysql", "password": "new"},
+				"before_sensitive": {"password": true},
+				"after_sensitive": {"password": true}
+			}
+		},
+		{
+			"address": "aws_iam_role.ci",
+			"type": "aws_iam_role",
+			"change": {"actions": ["no-op"], "before": {"name": "ci"}, "after": {"name": "ci"}}
+		}
+	]
+}`
+
+func testPlan(t *testing.T) (plan types.Plan) {
+	plan = types.Plan{
+		Lineage:   types.Lineage{Value: "lineage_value"},
+		TFVersion: "1.5.0",
+		GitCommit: "abc1234",
+		CiURL:     "https://ci.example.com/jobs/1",
+		PlanJSON:  []byte(testPlanJSON),
+	}
+	if err := json.Unmarshal(plan.PlanJSON, &plan.ParsedPlan); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestRender(t *testing.T) {
+	rules, err := risk.ParseRules([]string{"high:delete:aws_db_*"})
+	assert.Nil(t, err)
+	md, err := Render(testPlan(t), rules)
+	assert.Nil(t, err)
+	assert.Equal(t, "### Terraform plan: 1 to create, 1 to update, 1 to replace, 0 to delete\n\n"+
+		"Risk: **high** · lineage `lineage_value` · Terraform 1.5.0 · commit `abc1234` · [CI job](https://ci.example.com/jobs/1)\n"+
+		"\n#### Root module\n\n"+
+		"- <details><summary><b>update</b> <code>aws_instance.web</code></summary>\n\n"+
+		"  ```diff\n"+
+		"  - arn: \"arn:1\"\n"+
+		"  + arn: \"(known after apply)\"\n"+
+		"  - instance_type: \"t3.small\"\n"+
+		"  + instance_type: \"t3.large\"\n"+
+		"  + tags.team: \"ops\"\n"+
+		"  ```\n\n"+
+		"  </details>\n"+
+		"- **create** `aws_s3_bucket.logs`\n"+
+		"\n#### Module `module.db`\n\n"+
+		"- <details><summary><b>replace</b> <code>module.db.aws_db_instance.db[&#34;main&#34;]</code></summary>\n\n"+
+		"  ```diff\n"+
+		"  - engine: \"postgres\"\n"+
+		"  + engine: \"mysql\"\n"+
+		"  - password: (sensitive)\n"+
+		"  + password: (sensitive)\n"+
+		"  ```\n\n"+
+		"  </details>\n", md)
+	assert.NotContains(t, md, "hunter2")
+	assert.NotContains(t, md, `"old"`)
+}
+
+func TestRender_Escaped(t *testing.T) {
+	plan := types.Plan{
+		PlanJSON: []byte(`{
+			"format_version": "1.1",
+			"planned_values": {"root_module": {}},
+			"resource_changes": [
+				{
+					"address": "aws_ssm_parameter.doc[\"` + "`a`" + `\"]",
+					"type": "aws_ssm_parameter",
+					"change": {"actions": ["create"], "before": null, "after": {}}
+				},
+				{
+					"address": "aws_ssm_parameter.readme",
+					"type": "aws_ssm_parameter",
+					"change": {"actions": ["update"], "before": {"value": "a"}, "after": {"value": "` + "```\\n</details>" + `"}}
+				}
+			]
+		}`),
+	}
+	assert.Nil(t, json.Unmarshal(plan.PlanJSON, &plan.ParsedPlan))
+
+	// Addresses and diffs are fenced by more backticks than they hold
+	md, err := Render(plan, nil)
+	assert.Nil(t, err)
+	assert.Contains(t, md, "- **create** ``aws_ssm_parameter.doc[\"`a`\"]``\n")
+	assert.Contains(t, md, "  ````diff\n"+
+		"  - value: \"a\"\n"+
+		"  + value: \"```\\n\\u003c/details\\u003e\"\n"+
+		"  ````\n")
+}
+
+func TestRender_Truncated(t *testing.T) {
+	var changes []string
+	for i := 0; i < 2000; i++ {
+		changes = append(changes, fmt.Sprintf(`{"address": "aws_s3_bucket.logs_%04d", "type": "aws_s3_bucket",
+			"change": {"actions": ["update"], "before": {"bucket": "old"}, "after": {"bucket": "new"}}}`, i))
+	}
+	plan := types.Plan{
+		PlanJSON: []byte(`{"format_version": "1.1", "planned_values": {"root_module": {}},
+			"resource_changes": [` + strings.Join(changes, ",") + `]}`),
+	}
+	assert.Nil(t, json.Unmarshal(plan.PlanJSON, &plan.ParsedPlan))
+
+	md, err := Render(plan, nil)
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, len(md), maxLength)
+	assert.Contains(t, md, "aws_s3_bucket.logs_0000")
+	assert.NotContains(t, md, "aws_s3_bucket.logs_1999")
+	assert.Regexp(t, `\n_[0-9]+ more resource change\(s\) left out, as the comment would exceed 65536 characters: see the plan in Terraboard._\n$`, md)
+}
+
+func TestRender_PlanFile(t *testing.T) {
+	md, err := Render(types.Plan{
+		PlanJSON: []byte(`{"format_version": "1.0", "prior_state": {}}`),
+	}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "### Terraform plan: no changes\n\n"+
+		"Risk: **none**\n"+
+		"\nThe resource changes of this plan are unknown.\n", md)
+}
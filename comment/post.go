@@ -0,0 +1,115 @@
+package comment
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/camptocamp/terraboard/config"
+	"github.com/camptocamp/terraboard/pkg/client/github"
+	"github.com/camptocamp/terraboard/pkg/client/gitlab"
+	"github.com/camptocamp/terraboard/types"
+)
+
+var (
+	// ErrUnsupportedRemote is returned when the git remote of a Plan
+	// is not a repository Terraboard can comment on
+	ErrUnsupportedRemote = errors.New("unsupported git remote")
+	// ErrNoMergeRequest is returned when no open merge request
+	// contains the git commit of a Plan
+	ErrNoMergeRequest = errors.New("no open merge request found")
+)
+
+// hostname returns the host of a URL, without its port
+func hostname(address string) string {
+	u, err := url.Parse(address)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// parseRemote returns the host and the repository path of a git remote,
+// written as a URL or as '[user@]host:path'
+func parseRemote(remote string) (host, path string, err error) {
+	if !strings.Contains(remote, "://") {
+		if i := strings.Index(remote, ":"); i > 0 {
+			remote = "ssh://" + remote[:i] + "/" + remote[i+1:]
+		}
+	}
+	// Remotes may hold credentials, which must not be reported in errors
+	u, err := url.Parse(remote)
+	if err != nil {
+		return "", "", ErrUnsupportedRemote
+	}
+	host = u.Hostname()
+	path = strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if host == "" || path == "" {
+		return "", "", ErrUnsupportedRemote
+	}
+	return
+}
+
+// postGitlab comments the open merge request of a GitLab project containing a commit
+func postGitlab(settings config.CommentConfig, project, commit, body string) (string, error) {
+	c := gitlab.NewClient(strings.TrimSuffix(settings.GitlabAddress, "/"), settings.GitlabToken)
+	mergeRequests, err := c.GetCommitMergeRequests(project, commit)
+	if err != nil {
+		return "", fmt.Errorf("failed to get merge requests of %s: %v", project, err)
+	}
+	for _, mr := range mergeRequests {
+		if mr.State != "opened" {
+			continue
+		}
+		note, err := c.CreateMergeRequestNote(project, mr.IID, body)
+		if err != nil {
+			return "", fmt.Errorf("failed to comment merge request !%d of %s: %v", mr.IID, project, err)
+		}
+		return fmt.Sprintf("%s#note_%d", mr.WebURL, note.ID), nil
+	}
+	return "", fmt.Errorf("%w for commit %s of %s", ErrNoMergeRequest, commit, project)
+}
+
+// postGithub comments the open pull request of a GitHub repository containing a commit
+func postGithub(settings config.CommentConfig, repository, commit, body string) (string, error) {
+	c := github.NewClient(strings.TrimSuffix(settings.GithubAPIURL, "/"), settings.GithubToken)
+	pullRequests, err := c.GetCommitPullRequests(repository, commit)
+	if err != nil {
+		return "", fmt.Errorf("failed to get pull requests of %s: %v", repository, err)
+	}
+	for _, pr := range pullRequests {
+		if pr.State != "open" {
+			continue
+		}
+		comment, err := c.CreateIssueComment(repository, pr.Number, body)
+		if err != nil {
+			return "", fmt.Errorf("failed to comment pull request #%d of %s: %v", pr.Number, repository, err)
+		}
+		return comment.HTMLURL, nil
+	}
+	return "", fmt.Errorf("%w for commit %s of %s", ErrNoMergeRequest, commit, repository)
+}
+
+// Post comments a Plan, with the GitLab and GitHub parameters of settings, on the open GitLab merge request or GitHub pull request
+// containing its commit, in the repository of its git remote, and returns the
+// URL of the comment. The repository is commented on GitHub if its host is the
+// one of the GitHub API URL (without 'api.'), on GitLab if it is the one of the
+// GitLab address, provided a token is set for it.
+func Post(settings config.CommentConfig, plan types.Plan, body string) (string, error) {
+	if plan.GitCommit == "" {
+		return "", fmt.Errorf("%w: the plan has no git commit", ErrNoMergeRequest)
+	}
+	host, path, err := parseRemote(plan.GitRemote)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case settings.GithubToken != "" && host == strings.TrimPrefix(hostname(settings.GithubAPIURL), "api."):
+		return postGithub(settings, path, plan.GitCommit, body)
+	case settings.GitlabToken != "" && host == hostname(settings.GitlabAddress):
+		return postGitlab(settings, path, plan.GitCommit, body)
+	}
+	return "", fmt.Errorf("%w: no GitLab or GitHub token set for %s", ErrUnsupportedRemote, host)
+}
@@ -0,0 +1,261 @@
+package compare
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+// decodeAttributeValue decodes a JSON attribute value, as stored in the database.
+// Values which are not valid JSON are kept as raw strings.
+func decodeAttributeValue(raw string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return raw
+	}
+	return v
+}
+
+// decodeJSONString decodes strings holding a JSON document (e.g. IAM policies),
+// so that they can be diffed as nested values
+func decodeJSONString(v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return v
+	}
+	var doc interface{}
+	if err := json.Unmarshal([]byte(trimmed), &doc); err != nil {
+		return v
+	}
+	return doc
+}
+
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// mergeSensitive merges the sensitivity objects of two versions of a value:
+// a part of the value is sensitive if it is sensitive in either version
+func mergeSensitive(s1, s2 interface{}) interface{} {
+	if s1 == nil || s1 == false {
+		return s2
+	}
+	if s2 == nil || s2 == false || s1 == true {
+		return s1
+	}
+	if s2 == true {
+		return s2
+	}
+
+	switch m1 := s1.(type) {
+	case map[string]interface{}:
+		if m2, ok := s2.(map[string]interface{}); ok {
+			merged := make(map[string]interface{}, len(m1)+len(m2))
+			for k, v := range m1 {
+				merged[k] = v
+			}
+			for k, v := range m2 {
+				merged[k] = mergeSensitive(merged[k], v)
+			}
+			return merged
+		}
+	case []interface{}:
+		if l2, ok := s2.([]interface{}); ok {
+			merged := make([]interface{}, 0, len(m1)+len(l2))
+			for i := 0; i < len(m1) || i < len(l2); i++ {
+				var e1, e2 interface{}
+				if i < len(m1) {
+					e1 = m1[i]
+				}
+				if i < len(l2) {
+					e2 = l2[i]
+				}
+				merged = append(merged, mergeSensitive(e1, e2))
+			}
+			return merged
+		}
+	}
+	// The structure of the value changed
+	return types.IsSensitive(s1) || types.IsSensitive(s2)
+}
+
+// sensitiveKey returns the sensitivity object of an attribute of an object
+func sensitiveKey(sensitive interface{}, key string) interface{} {
+	s, _ := sensitive.(map[string]interface{})
+	return s[key]
+}
+
+// sensitiveIndex returns the sensitivity object of an element of a list
+func sensitiveIndex(sensitive interface{}, i int) interface{} {
+	s, _ := sensitive.([]interface{})
+	if i < len(s) {
+		return s[i]
+	}
+	return nil
+}
+
+// sensitiveDiff returns a diff of a value which was added or removed,
+// masked as set by its sensitivity object
+func sensitiveDiff(path, kind string, value, sensitive interface{}) types.AttributeDiff {
+	d := types.AttributeDiff{Path: path, Kind: kind, Sensitive: types.IsSensitive(sensitive)}
+	value = types.RedactValue(value, sensitive)
+	if kind == types.AttributeRemoved {
+		d.OldValue = value
+	} else {
+		d.NewValue = value
+	}
+	return d
+}
+
+// diffValues appends the differences between two decoded values to diffs,
+// walking objects and lists recursively. sensitive is the sensitivity object
+// marking the sensitive parts of either value, whose diffs are masked.
+// Sensitive values which were masked before the diff are unknown, and never differ.
+func diffValues(path string, oldValue, newValue, sensitive interface{}, diffs []types.AttributeDiff) []types.AttributeDiff {
+	if sensitive == true {
+		if oldValue == types.SensitiveValue || newValue == types.SensitiveValue || reflect.DeepEqual(oldValue, newValue) {
+			return diffs
+		}
+		return append(diffs, types.AttributeDiff{
+			Path:      path,
+			Kind:      types.AttributeChanged,
+			OldValue:  types.SensitiveValue,
+			NewValue:  types.SensitiveValue,
+			Sensitive: true,
+		})
+	}
+	oldValue = decodeJSONString(oldValue)
+	newValue = decodeJSONString(newValue)
+
+	switch o := oldValue.(type) {
+	case map[string]interface{}:
+		if n, ok := newValue.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(o)+len(n))
+			for k := range o {
+				keys = append(keys, k)
+			}
+			for k := range n {
+				if _, ok := o[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				ov, inOld := o[k]
+				nv, inNew := n[k]
+				s := sensitiveKey(sensitive, k)
+				switch {
+				case !inNew:
+					diffs = append(diffs, sensitiveDiff(joinKey(path, k), types.AttributeRemoved, ov, s))
+				case !inOld:
+					diffs = append(diffs, sensitiveDiff(joinKey(path, k), types.AttributeAdded, nv, s))
+				default:
+					diffs = diffValues(joinKey(path, k), ov, nv, s, diffs)
+				}
+			}
+			return diffs
+		}
+	case []interface{}:
+		if n, ok := newValue.([]interface{}); ok {
+			for i := 0; i < len(o) || i < len(n); i++ {
+				p := fmt.Sprintf("%s[%d]", path, i)
+				s := sensitiveIndex(sensitive, i)
+				switch {
+				case i >= len(n):
+					diffs = append(diffs, sensitiveDiff(p, types.AttributeRemoved, o[i], s))
+				case i >= len(o):
+					diffs = append(diffs, sensitiveDiff(p, types.AttributeAdded, n[i], s))
+				default:
+					diffs = diffValues(p, o[i], n[i], s, diffs)
+				}
+			}
+			return diffs
+		}
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		diffs = append(diffs, types.AttributeDiff{
+			Path:      path,
+			Kind:      types.AttributeChanged,
+			OldValue:  types.RedactValue(oldValue, sensitive),
+			NewValue:  types.RedactValue(newValue, sensitive),
+			Sensitive: types.IsSensitive(sensitive),
+		})
+	}
+	return diffs
+}
+
+// resourcesSensitivity merges the sensitivity objects of the attributes
+// of two versions of a Resource
+func resourcesSensitivity(res1, res2 types.Resource) map[string]interface{} {
+	if len(res1.SensitiveAttributes) == 0 && len(res2.SensitiveAttributes) == 0 {
+		return nil
+	}
+	sensitive := make(map[string]interface{})
+	for k, s := range res1.SensitiveAttributes {
+		sensitive[k] = s
+	}
+	for k, s := range res2.SensitiveAttributes {
+		sensitive[k] = mergeSensitive(sensitive[k], s)
+	}
+	return sensitive
+}
+
+// redactResource returns a copy of a Resource whose attributes are masked
+// as set by their sensitivity objects
+func redactResource(res types.Resource, sensitive map[string]interface{}) types.Resource {
+	if len(sensitive) == 0 {
+		return res
+	}
+	attrs := make([]types.Attribute, len(res.Attributes))
+	for i, a := range res.Attributes {
+		if s := sensitive[a.Key]; types.IsSensitive(s) {
+			if j, err := json.Marshal(types.RedactValue(decodeAttributeValue(a.Value), s)); err == nil {
+				a.Value = string(j)
+			} else {
+				a.Value = types.SensitiveValue
+			}
+		}
+		attrs[i] = a
+	}
+	res.Attributes = attrs
+	return res
+}
+
+// DiffAttributes returns the structured, per-attribute differences
+// between two versions of a Resource. The values marked as sensitive
+// in either version are masked.
+func DiffAttributes(res1, res2 types.Resource) (diffs []types.AttributeDiff) {
+	attrs1 := resourceAttributes(res1)
+	attrs2 := resourceAttributes(res2)
+
+	keys := append(attrs1, sliceDiff(attrs2, attrs1)...)
+	sort.Strings(keys)
+
+	sensitive := resourcesSensitivity(res1, res2)
+	for _, k := range keys {
+		v1, err1 := getResourceAttribute(res1, k)
+		v2, err2 := getResourceAttribute(res2, k)
+		switch {
+		case err2 != nil:
+			diffs = append(diffs, sensitiveDiff(k, types.AttributeRemoved, decodeJSONString(decodeAttributeValue(v1)), sensitive[k]))
+		case err1 != nil:
+			diffs = append(diffs, sensitiveDiff(k, types.AttributeAdded, decodeJSONString(decodeAttributeValue(v2)), sensitive[k]))
+		case v1 != v2:
+			diffs = diffValues(k, decodeAttributeValue(v1), decodeAttributeValue(v2), sensitive[k], diffs)
+		}
+	}
+	return
+}
@@ -0,0 +1,121 @@
+package compare
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+func TestDiffAttributes(t *testing.T) {
+	oldResource := types.Resource{
+		Type: "aws_iam_policy",
+		Name: "foo",
+		Attributes: []types.Attribute{
+			{Key: "name", Value: `"foo"`},
+			{Key: "policy", Value: `"{\"Version\":\"2012-10-17\",\"Statement\":[{\"Effect\":\"Allow\",\"Action\":[\"s3:GetObject\"]}]}"`},
+			{Key: "tags", Value: `{"env":"prod","owner":"alice"}`},
+			{Key: "path", Value: `"/"`},
+		},
+	}
+	newResource := types.Resource{
+		Type: "aws_iam_policy",
+		Name: "foo",
+		Attributes: []types.Attribute{
+			{Key: "name", Value: `"foo"`},
+			{Key: "policy", Value: `"{\"Version\":\"2012-10-17\",\"Statement\":[{\"Effect\":\"Allow\",\"Action\":[\"s3:GetObject\",\"s3:PutObject\"]}]}"`},
+			{Key: "tags", Value: `{"env":"staging","team":"ops"}`},
+			{Key: "description", Value: `"bar"`},
+		},
+	}
+
+	expectedResult := []types.AttributeDiff{
+		{Path: "description", Kind: types.AttributeAdded, NewValue: "bar"},
+		{Path: "path", Kind: types.AttributeRemoved, OldValue: "/"},
+		{Path: "policy.Statement[0].Action[1]", Kind: types.AttributeAdded, NewValue: "s3:PutObject"},
+		{Path: "tags.env", Kind: types.AttributeChanged, OldValue: "prod", NewValue: "staging"},
+		{Path: "tags.owner", Kind: types.AttributeRemoved, OldValue: "alice"},
+		{Path: "tags.team", Kind: types.AttributeAdded, NewValue: "ops"},
+	}
+
+	result := DiffAttributes(oldResource, newResource)
+
+	if !reflect.DeepEqual(result, expectedResult) {
+		t.Fatalf("Expected %v, got %v", expectedResult, result)
+	}
+}
+
+func TestDiffValues_TypeChange(t *testing.T) {
+	expectedResult := []types.AttributeDiff{
+		{Path: "ports", Kind: types.AttributeChanged, OldValue: float64(80), NewValue: []interface{}{float64(80), float64(443)}},
+	}
+
+	result := diffValues("ports", float64(80), []interface{}{float64(80), float64(443)}, nil, nil)
+
+	if !reflect.DeepEqual(result, expectedResult) {
+		t.Fatalf("Expected %v, got %v", expectedResult, result)
+	}
+}
+
+func TestDiffAttributes_Sensitive(t *testing.T) {
+	planned := types.Resource{
+		Type: "aws_db_instance",
+		Name: "foo",
+		Attributes: []types.Attribute{
+			{Key: "password", Value: `"(sensitive)"`},
+			{Key: "username", Value: `"admin"`},
+			{Key: "tags", Value: `{"env":"prod","token":"old","note":"(sensitive)"}`},
+			{Key: "api_key", Value: `"old"`},
+		},
+		SensitiveAttributes: map[string]interface{}{
+			"password": true,
+			"tags":     map[string]interface{}{"token": true},
+			"api_key":  true,
+		},
+	}
+	applied := types.Resource{
+		Type: "aws_db_instance",
+		Name: "foo",
+		Attributes: []types.Attribute{
+			{Key: "password", Value: `"secret"`},
+			{Key: "username", Value: `"root"`},
+			{Key: "tags", Value: `{"env":"staging","token":"new","note":"secret"}`},
+		},
+	}
+
+	// Masked values are unknown, changed sensitive values are masked, and
+	// values which are not marked as sensitive are diffed as they are
+	expectedResult := []types.AttributeDiff{
+		{Path: "api_key", Kind: types.AttributeRemoved, OldValue: types.SensitiveValue, Sensitive: true},
+		{Path: "tags.env", Kind: types.AttributeChanged, OldValue: "prod", NewValue: "staging"},
+		{Path: "tags.note", Kind: types.AttributeChanged, OldValue: types.SensitiveValue, NewValue: "secret"},
+		{Path: "tags.token", Kind: types.AttributeChanged, OldValue: types.SensitiveValue, NewValue: types.SensitiveValue, Sensitive: true},
+		{Path: "username", Kind: types.AttributeChanged, OldValue: "admin", NewValue: "root"},
+	}
+
+	result := DiffAttributes(planned, applied)
+
+	if !reflect.DeepEqual(result, expectedResult) {
+		t.Fatalf("Expected %v, got %v", expectedResult, result)
+	}
+}
+
+func TestMergeSensitive(t *testing.T) {
+	cases := []struct {
+		s1, s2   interface{}
+		expected interface{}
+	}{
+		{nil, true, true},
+		{false, map[string]interface{}{"a": true}, map[string]interface{}{"a": true}},
+		{map[string]interface{}{"a": true}, map[string]interface{}{"b": true}, map[string]interface{}{"a": true, "b": true}},
+		{[]interface{}{false}, []interface{}{false, true}, []interface{}{false, true}},
+		{map[string]interface{}{"a": true}, []interface{}{false}, true},
+		{map[string]interface{}{}, []interface{}{false}, false},
+	}
+
+	for _, c := range cases {
+		if got := mergeSensitive(c.s1, c.s2); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("Expected %v merged with %v to be %v, got %v", c.s1, c.s2, c.expected, got)
+		}
+	}
+}
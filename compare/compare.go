@@ -10,11 +10,23 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// resourceKey returns the address of a resource instance in a module,
+// including its mode and its count/for_each index
+func resourceKey(modulePath string, r types.Resource) (key string) {
+	if modulePath != "" {
+		key = modulePath + "."
+	}
+	if r.Mode == "data" {
+		key += "data."
+	}
+	return fmt.Sprintf("%s%s.%s%s", key, r.Type, r.Name, r.Index)
+}
+
 // Return all resources of a state
 func stateResources(state types.State) (res []string) {
 	for _, m := range state.Modules {
 		for _, r := range m.Resources {
-			res = append(res, fmt.Sprintf("%s.%s.%s", m.Path, r.Type, r.Name))
+			res = append(res, resourceKey(m.Path, r))
 		}
 	}
 	return
@@ -53,15 +65,14 @@ func sliceInter(s1, s2 []string) (inter []string) {
 
 func getResource(state types.State, key string) (res types.Resource, err error) {
 	for _, m := range state.Modules {
-		if strings.HasPrefix(key, m.Path) {
-			for _, r := range m.Resources {
-				if key == fmt.Sprintf("%s.%s.%s", m.Path, r.Type, r.Name) {
-					return r, nil
-				}
-			}
-		} else {
+		if !strings.HasPrefix(key, m.Path) {
 			continue
 		}
+		for _, r := range m.Resources {
+			if key == resourceKey(m.Path, r) {
+				return r, nil
+			}
+		}
 	}
 	return res, fmt.Errorf("Could not find resource with key %s in state %s", key, state.Path)
 }
@@ -86,7 +97,11 @@ func getResourceAttribute(res types.Resource, key string) (val string, err error
 
 // TODO: use terraform/command/format.State()
 func formatResource(res types.Resource) (out string) {
-	out = fmt.Sprintf("resource \"%s\" \"%s\" {\n", res.Type, res.Name)
+	block := "resource"
+	if res.Mode == "data" {
+		block = "data"
+	}
+	out = fmt.Sprintf("%s \"%s\" \"%s\" {\n", block, res.Type, res.Name)
 	for _, attr := range resourceAttributes(res) {
 		a, _ := getResourceAttribute(res, attr) // TODO: err
 		out += fmt.Sprintf("  %s = \"%s\"\n", attr, a)
@@ -103,8 +118,20 @@ func stateInfo(state types.State) (info string) {
 // Compare a resource in two states
 func compareResource(st1, st2 types.State, key string) (comp types.ResourceDiff) {
 	res1, _ := getResource(st1, key) // TODO: err
-	attrs1 := resourceAttributes(res1)
 	res2, _ := getResource(st2, key) // TODO: err
+	return diffResources(res1, res2, stateInfo(st1), stateInfo(st2))
+}
+
+// Compare two resources, described by info1 and info2 in the unified diff.
+// The values marked as sensitive in either resource are masked.
+func diffResources(res1, res2 types.Resource, info1, info2 string) (comp types.ResourceDiff) {
+	comp.AttributeDiffs = DiffAttributes(res1, res2)
+
+	sensitive := resourcesSensitivity(res1, res2)
+	res1 = redactResource(res1, sensitive)
+	res2 = redactResource(res2, sensitive)
+
+	attrs1 := resourceAttributes(res1)
 	attrs2 := resourceAttributes(res2)
 
 	// Only in old
@@ -125,8 +152,8 @@ func compareResource(st1, st2 types.State, key string) (comp types.ResourceDiff)
 	diff := difflib.UnifiedDiff{
 		A:        difflib.SplitLines(formatResource(res1)),
 		B:        difflib.SplitLines(formatResource(res2)),
-		FromFile: stateInfo(st1),
-		ToFile:   stateInfo(st2),
+		FromFile: info1,
+		ToFile:   info2,
 		Context:  3,
 		Eol:      "\n",
 	}
@@ -136,13 +163,64 @@ func compareResource(st1, st2 types.State, key string) (comp types.ResourceDiff)
 	return
 }
 
+// Options tunes the comparison of two States
+type Options struct {
+	// PathMappings maps module path prefixes of the 'from' State
+	// (e.g. "module.staging") to the ones of the 'to' State
+	// (e.g. "module.production")
+	PathMappings map[string]string
+	// IgnoreRules lists the attributes excluded from the comparison,
+	// along with their nested values
+	IgnoreRules []IgnoreRule
+}
+
+// mapModulePath replaces the longest mapped prefix of a module path
+func mapModulePath(path string, mappings map[string]string) string {
+	var prefix string
+	for p := range mappings {
+		if p == "" || len(p) <= len(prefix) {
+			continue
+		}
+		if path == p || strings.HasPrefix(path, p+".") {
+			prefix = p
+		}
+	}
+	if prefix == "" {
+		return path
+	}
+	return mappings[prefix] + strings.TrimPrefix(path, prefix)
+}
+
+// mapState returns a copy of a State with its module paths mapped
+func mapState(state types.State, mappings map[string]string) types.State {
+	if len(mappings) == 0 {
+		return state
+	}
+	modules := make([]types.Module, len(state.Modules))
+	for i, m := range state.Modules {
+		m.Path = mapModulePath(m.Path, mappings)
+		modules[i] = m
+	}
+	state.Modules = modules
+	return state
+}
+
 // Compare returns the difference between two versions of a State
-// as a StateCompare structure
+// as a StateCompare structure, without ignoring any attribute
 func Compare(from, to types.State) (comp types.StateCompare, err error) {
+	return CompareWithOptions(from, to, Options{})
+}
+
+// CompareWithOptions returns the difference between two States,
+// which may belong to different lineages, as a StateCompare structure
+func CompareWithOptions(from, to types.State, opts Options) (comp types.StateCompare, err error) {
 	if from.Path == "" {
 		err = fmt.Errorf("from version is unknown")
 		return
 	}
+	from = filterState(mapState(from, opts.PathMappings), opts.IgnoreRules)
+	to = filterState(to, opts.IgnoreRules)
+
 	fromResources := stateResources(from)
 	comp.Stats.From = types.StateInfo{
 		Path:          from.Path,
@@ -165,30 +243,65 @@ func Compare(from, to types.State) (comp types.StateCompare, err error) {
 		Serial:        to.Serial,
 	}
 
-	// OnlyInOld
 	onlyInOld := sliceDiff(fromResources, toResources)
+	onlyInNew := sliceDiff(toResources, fromResources)
+
+	// Moved resources are not reported as removed and added
+	comp.Differences.Moved, err = detectMoves(from, to, onlyInOld, onlyInNew)
+	if err != nil {
+		return
+	}
+	movedFrom, movedTo := movedKeys(comp.Differences.Moved)
+	onlyInOld = sliceDiff(onlyInOld, movedFrom)
+	onlyInNew = sliceDiff(onlyInNew, movedTo)
+
+	for i, m := range comp.Differences.Moved {
+		res1, err := getResource(from, m.From)
+		if err != nil {
+			return comp, err
+		}
+		res2, err := getResource(to, m.To)
+		if err != nil {
+			return comp, err
+		}
+		c := diffResources(res1, res2, stateInfo(from), stateInfo(to))
+		c.AttributeDiffs = filterAttributeDiffs(c.AttributeDiffs, res1.Type, opts.IgnoreRules)
+		if c.UnifiedDiff != "" || len(c.AttributeDiffs) > 0 {
+			comp.Differences.Moved[i].ResourceDiff = &c
+		}
+	}
+
+	// OnlyInOld
 	comp.Differences.OnlyInOld = make(map[string]string)
 	for _, r := range onlyInOld {
 		res, _ := getResource(from, r) // TODO: err
-		comp.Differences.OnlyInOld[r] = formatResource(res)
+		comp.Differences.OnlyInOld[r] = formatResource(redactResource(res, res.SensitiveAttributes))
 	}
 
 	// OnlyInNew
-	onlyInNew := sliceDiff(toResources, fromResources)
 	comp.Differences.OnlyInNew = make(map[string]string)
 	for _, r := range onlyInNew {
 		res, _ := getResource(to, r) // TODO: err
-		comp.Differences.OnlyInNew[r] = formatResource(res)
+		comp.Differences.OnlyInNew[r] = formatResource(redactResource(res, res.SensitiveAttributes))
 	}
 	comp.Differences.InBoth = sliceInter(toResources, fromResources)
 	comp.Differences.ResourceDiff = make(map[string]types.ResourceDiff)
 
 	for _, r := range comp.Differences.InBoth {
-		if c := compareResource(to, from, r); c.UnifiedDiff != "" {
+		res, err := getResource(to, r)
+		if err != nil {
+			return comp, err
+		}
+		c := compareResource(from, to, r)
+		c.AttributeDiffs = filterAttributeDiffs(c.AttributeDiffs, res.Type, opts.IgnoreRules)
+		// Changes of sensitive values are masked in the unified diff
+		if c.UnifiedDiff != "" || len(c.AttributeDiffs) > 0 {
 			comp.Differences.ResourceDiff[r] = c
 		}
 	}
 
+	comp.Outputs = compareOutputs(from, to)
+
 	log.WithFields(log.Fields{
 		"path": from.Path,
 		"from": from.Version.VersionID,
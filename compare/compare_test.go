@@ -2,6 +2,7 @@ package compare
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -75,6 +76,48 @@ func TestStateResources(t *testing.T) {
 	}
 }
 
+func TestStateResources_Instances(t *testing.T) {
+	expectedResult := []string{
+		`module.foo.aws_instance.web["a"]`,
+		`module.foo.aws_instance.web["b"]`,
+		"module.foo.data.aws_ami.ubuntu",
+		"aws_eip.web[0]",
+	}
+
+	state := types.State{
+		Modules: []types.Module{
+			{
+				Path: "module.foo",
+				Resources: []types.Resource{
+					{Mode: "managed", Type: "aws_instance", Name: "web", Index: `["a"]`},
+					{Mode: "managed", Type: "aws_instance", Name: "web", Index: `["b"]`},
+					{Mode: "data", Type: "aws_ami", Name: "ubuntu"},
+				},
+			},
+			{
+				Path: "",
+				Resources: []types.Resource{
+					{Mode: "managed", Type: "aws_eip", Name: "web", Index: "[0]"},
+				},
+			},
+		},
+	}
+
+	result := stateResources(state)
+
+	if !reflect.DeepEqual(result, expectedResult) {
+		t.Fatalf("Expected %s, got %s", expectedResult, result)
+	}
+
+	res, err := getResource(state, `module.foo.aws_instance.web["b"]`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if res.Index != `["b"]` {
+		t.Fatalf("Expected instance [\"b\"], got %s", res.Index)
+	}
+}
+
 func TestSliceDiff(t *testing.T) {
 	expectedResult := []string{"apple", "orange"}
 	s1 := []string{"apple", "banana", "orange", "melon"}
@@ -194,6 +237,12 @@ func TestCompareResource(t *testing.T) {
  }
  
 `,
+		AttributeDiffs: []types.AttributeDiff{
+			{Path: "fakeKey", Kind: types.AttributeRemoved, OldValue: "fakeValue"},
+			{Path: "fakeKey2", Kind: types.AttributeRemoved, OldValue: "fakeValue2"},
+			{Path: "fakeNewKey", Kind: types.AttributeAdded, NewValue: "fakeNewValue"},
+			{Path: "fakeNewKey2", Kind: types.AttributeAdded, NewValue: "fakeNewValue2"},
+		},
 	}
 
 	fakeNewAttribute := types.Attribute{
@@ -231,7 +280,7 @@ func TestCompareResource(t *testing.T) {
 	result := compareResource(fakeState, fakeNewState, "root.fakeType.fakeName")
 
 	if !reflect.DeepEqual(result, expectedResult) {
-		t.Fatalf("Expected %s, got %s", expectedResult, result)
+		t.Fatalf("Expected %v, got %v", expectedResult, result)
 	}
 }
 
@@ -258,6 +307,7 @@ func TestCompare_Result(t *testing.T) {
 			OnlyInNew    map[string]string             `json:"only_in_new"`
 			InBoth       []string                      `json:"in_both"`
 			ResourceDiff map[string]types.ResourceDiff `json:"resource_diff"`
+			Moved        []types.ResourceMove          `json:"moved"`
 		}{
 			OnlyInOld: map[string]string{
 				"root.fakeTotoType.fakeTotoName": `resource "fakeTotoType" "fakeTotoName" {
@@ -274,20 +324,31 @@ func TestCompare_Result(t *testing.T) {
 			InBoth: []string{"root.fakeType.fakeName"},
 			ResourceDiff: map[string]types.ResourceDiff{
 				"root.fakeType.fakeName": types.ResourceDiff{
-					OnlyInOld: map[string]string{"fakeKey": "fakeValue", "fakeKey2": "fakeValue2"},
-					OnlyInNew: map[string]string{"fakeNewKey": "fakeNewValue"},
+					OnlyInOld: map[string]string{"fakeNewKey": "fakeNewValue"},
+					OnlyInNew: map[string]string{"fakeKey": "fakeValue", "fakeKey2": "fakeValue2"},
 					UnifiedDiff: `--- myfakepath/terraform.tfstate (2017-08-03 17:47:23 +0000 UTC)
 +++ myfakepath/terraform.tfstate (2017-08-03 17:47:23 +0000 UTC)
-@@ -1,5 +1,4 @@
+@@ -1,4 +1,5 @@
  resource "fakeType" "fakeName" {
--  fakeKey = "fakeValue"
--  fakeKey2 = "fakeValue2"
-+  fakeNewKey = "fakeNewValue"
+-  fakeNewKey = "fakeNewValue"
++  fakeKey = "fakeValue"
++  fakeKey2 = "fakeValue2"
  }
  
 `,
+					AttributeDiffs: []types.AttributeDiff{
+						{Path: "fakeKey", Kind: types.AttributeAdded, NewValue: "fakeValue"},
+						{Path: "fakeKey2", Kind: types.AttributeAdded, NewValue: "fakeValue2"},
+						{Path: "fakeNewKey", Kind: types.AttributeRemoved, OldValue: "fakeNewValue"},
+					},
 				},
 			},
+			Moved: []types.ResourceMove{},
+		},
+		Outputs: types.OutputsCompare{
+			Added:   map[string]types.OutputDiff{},
+			Removed: map[string]types.OutputDiff{},
+			Changed: map[string]types.OutputDiff{},
 		},
 	}
 
@@ -370,3 +431,205 @@ func TestCompare_noto(t *testing.T) {
 		t.Fatalf("Expected %s, got %s", expectedError, err.Error())
 	}
 }
+
+func TestCompareWithOptions(t *testing.T) {
+	staging := types.State{
+		Path: "staging/terraform.tfstate",
+		Modules: []types.Module{
+			{
+				Path: "module.staging",
+				Resources: []types.Resource{
+					{Type: "aws_instance", Name: "web", Attributes: []types.Attribute{
+						{Key: "instance_type", Value: `"t3.small"`},
+						{Key: "tags", Value: `{"Env":"staging","Team":"ops"}`},
+					}},
+				},
+			},
+		},
+	}
+	production := types.State{
+		Path: "production/terraform.tfstate",
+		Modules: []types.Module{
+			{
+				Path: "module.production",
+				Resources: []types.Resource{
+					{Type: "aws_instance", Name: "web", Attributes: []types.Attribute{
+						{Key: "instance_type", Value: `"t3.large"`},
+						{Key: "tags", Value: `{"Env":"production","Team":"ops"}`},
+					}},
+				},
+			},
+		},
+	}
+
+	rules, err := ParseIgnoreRules([]string{"*.tags.Env"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	result, err := CompareWithOptions(staging, production, Options{
+		PathMappings: map[string]string{"module.staging": "module.production"},
+		IgnoreRules:  rules,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expectedInBoth := []string{"module.production.aws_instance.web"}
+	if !reflect.DeepEqual(result.Differences.InBoth, expectedInBoth) {
+		t.Fatalf("Expected %v, got %v", expectedInBoth, result.Differences.InBoth)
+	}
+	if len(result.Differences.OnlyInOld) != 0 || len(result.Differences.OnlyInNew) != 0 {
+		t.Fatalf("Expected no resource only in one state, got %v and %v",
+			result.Differences.OnlyInOld, result.Differences.OnlyInNew)
+	}
+
+	expectedDiffs := []types.AttributeDiff{
+		{Path: "instance_type", Kind: types.AttributeChanged, OldValue: "t3.small", NewValue: "t3.large"},
+	}
+	diff := result.Differences.ResourceDiff["module.production.aws_instance.web"]
+	if !reflect.DeepEqual(diff.AttributeDiffs, expectedDiffs) {
+		t.Fatalf("Expected %v, got %v", expectedDiffs, diff.AttributeDiffs)
+	}
+	if strings.Contains(diff.UnifiedDiff, "Env") || !strings.Contains(diff.UnifiedDiff, `tags = "{"Team":"ops"}"`) {
+		t.Fatalf("Expected the ignored nested value to be excluded from the unified diff, got %s", diff.UnifiedDiff)
+	}
+
+	rules, err = ParseIgnoreRules([]string{"aws_instance.tags", "aws_*.instance_type"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	result, err = CompareWithOptions(staging, production, Options{
+		PathMappings: map[string]string{"module.staging": "module.production"},
+		IgnoreRules:  rules,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(result.Differences.ResourceDiff) != 0 {
+		t.Fatalf("Expected no resource diff, got %v", result.Differences.ResourceDiff)
+	}
+}
+
+func TestCompareWithOptions_EquivalentValues(t *testing.T) {
+	from := types.State{
+		Path: "app/terraform.tfstate",
+		Modules: []types.Module{
+			{Resources: []types.Resource{
+				{Type: "aws_autoscaling_group", Name: "web", Attributes: []types.Attribute{
+					{Key: "desired_capacity", Value: `1`},
+				}},
+			}},
+		},
+	}
+	to := types.State{
+		Path: "app/terraform.tfstate",
+		Modules: []types.Module{
+			{Resources: []types.Resource{
+				{Type: "aws_autoscaling_group", Name: "web", Attributes: []types.Attribute{
+					{Key: "desired_capacity", Value: `1.0`},
+				}},
+			}},
+		},
+	}
+
+	result, err := CompareWithOptions(from, to, Options{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	diff, ok := result.Differences.ResourceDiff["aws_autoscaling_group.web"]
+	if !ok || diff.UnifiedDiff == "" {
+		t.Fatalf("Expected the resource to be reported as changed, got %v", result.Differences.ResourceDiff)
+	}
+	if len(diff.AttributeDiffs) != 0 {
+		t.Fatalf("Expected no attribute diff between equivalent values, got %v", diff.AttributeDiffs)
+	}
+}
+
+func TestMapModulePath(t *testing.T) {
+	mappings := map[string]string{
+		"module.app":           "module.service",
+		"module.app.module.db": "module.database",
+	}
+
+	for path, expected := range map[string]string{
+		"module.app":                    "module.service",
+		"module.app.module.cache":       "module.service.module.cache",
+		"module.app.module.db":          "module.database",
+		"module.app.module.db.module.x": "module.database.module.x",
+		"module.application":            "module.application",
+		"":                              "",
+	} {
+		if result := mapModulePath(path, mappings); result != expected {
+			t.Errorf("Expected %s to map to %s, got %s", path, expected, result)
+		}
+	}
+}
+
+func TestCompare_Moved(t *testing.T) {
+	from := types.State{
+		Path: "myfakepath/terraform.tfstate",
+		Modules: []types.Module{
+			{
+				Path: "",
+				Resources: []types.Resource{
+					{Mode: "managed", Type: "aws_instance", Name: "web", Attributes: []types.Attribute{
+						{Key: "id", Value: `"i-123"`},
+						{Key: "instance_type", Value: `"t3.small"`},
+					}},
+					{Mode: "managed", Type: "aws_eip", Name: "web", Attributes: []types.Attribute{
+						{Key: "id", Value: `"eipalloc-1"`},
+					}},
+					{Mode: "managed", Type: "aws_s3_bucket", Name: "logs", Attributes: []types.Attribute{
+						{Key: "id", Value: `"logs"`},
+					}},
+				},
+			},
+		},
+	}
+	to := types.State{
+		Path: "myfakepath/terraform.tfstate",
+		Modules: []types.Module{
+			{
+				Path: "module.app",
+				Resources: []types.Resource{
+					{Mode: "managed", Type: "aws_instance", Name: "web", Attributes: []types.Attribute{
+						{Key: "id", Value: `"i-123"`},
+						{Key: "instance_type", Value: `"t3.small"`},
+					}},
+					{Mode: "managed", Type: "aws_eip", Name: "this", Attributes: []types.Attribute{
+						{Key: "id", Value: `"eipalloc-1"`},
+						{Key: "domain", Value: `"vpc"`},
+					}},
+					{Mode: "managed", Type: "aws_s3_bucket", Name: "logs", Attributes: []types.Attribute{
+						{Key: "id", Value: `"logs-new"`},
+					}},
+				},
+			},
+		},
+	}
+
+	result, err := Compare(from, to)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(result.Differences.Moved) != 2 {
+		t.Fatalf("Expected 2 moves, got %v", result.Differences.Moved)
+	}
+	if m := result.Differences.Moved[0]; m.From != "aws_instance.web" || m.To != "module.app.aws_instance.web" || m.ResourceDiff != nil {
+		t.Fatalf("Unexpected move %v", m)
+	}
+	if m := result.Differences.Moved[1]; m.From != "aws_eip.web" || m.To != "module.app.aws_eip.this" || m.ResourceDiff == nil {
+		t.Fatalf("Unexpected move %v", m)
+	}
+
+	expectedOnlyInOld := []string{"aws_s3_bucket.logs"}
+	for _, r := range expectedOnlyInOld {
+		if _, ok := result.Differences.OnlyInOld[r]; !ok || len(result.Differences.OnlyInOld) != 1 {
+			t.Fatalf("Expected only %v in old, got %v", expectedOnlyInOld, result.Differences.OnlyInOld)
+		}
+	}
+	if _, ok := result.Differences.OnlyInNew["module.app.aws_s3_bucket.logs"]; !ok || len(result.Differences.OnlyInNew) != 1 {
+		t.Fatalf("Expected only module.app.aws_s3_bucket.logs in new, got %v", result.Differences.OnlyInNew)
+	}
+}
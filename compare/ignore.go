@@ -0,0 +1,210 @@
+package compare
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+// IgnoreRule excludes attributes from comparisons. Both the resource type
+// and the attribute path are globs, where '*' matches any sequence of
+// characters within a path element.
+type IgnoreRule struct {
+	ResourceType string
+	Attribute    string
+
+	resourceType *regexp.Regexp
+	attribute    *regexp.Regexp
+	// root matches the top-level attribute of the rules on nested values
+	root *regexp.Regexp
+}
+
+// globRegexp compiles a glob into a regexp matching a value,
+// along with the nested values of an attribute path when nested is set
+func globRegexp(glob string, nested bool) *regexp.Regexp {
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(glob), `\*`, `[^.\[\]]*`)
+	if nested {
+		expr += `([.\[].*)?`
+	}
+	return regexp.MustCompile(expr + "$")
+}
+
+// newIgnoreRule returns the rule ignoring an attribute path of a resource type
+func newIgnoreRule(resourceType, attribute string) IgnoreRule {
+	r := IgnoreRule{
+		ResourceType: resourceType,
+		Attribute:    attribute,
+		resourceType: globRegexp(resourceType, false),
+		attribute:    globRegexp(attribute, true),
+	}
+	if i := strings.IndexAny(attribute, ".["); i > 0 {
+		r.root = globRegexp(attribute[:i], false)
+	}
+	return r
+}
+
+// ParseIgnoreRule parses an ignore rule written as '<resource type>.<attribute path>',
+// e.g. 'aws_lambda_function.source_code_hash' or '*.tags.LastDeployed'
+func ParseIgnoreRule(rule string) (r IgnoreRule, err error) {
+	parts := strings.SplitN(rule, ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return r, fmt.Errorf("invalid ignore rule '%s', expected '<resource type>.<attribute>'", rule)
+	}
+	return newIgnoreRule(parts[0], parts[1]), nil
+}
+
+// IgnoreAttribute returns the rule ignoring an attribute path
+// (e.g. 'tags.LastDeployed') of all resource types
+func IgnoreAttribute(path string) IgnoreRule {
+	return newIgnoreRule("*", path)
+}
+
+// ParseIgnoreRules parses a list of ignore rules, skipping empty ones
+func ParseIgnoreRules(rules []string) (parsed []IgnoreRule, err error) {
+	for _, rule := range rules {
+		if rule == "" {
+			continue
+		}
+		r, err := ParseIgnoreRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, r)
+	}
+	return
+}
+
+// Match tells whether an attribute path of a resource type is excluded by the rule
+func (r IgnoreRule) Match(resourceType, path string) bool {
+	return r.resourceType.MatchString(resourceType) && r.attribute.MatchString(path)
+}
+
+// isIgnored tells whether an attribute path of a resource type is excluded by ignore rules
+func isIgnored(resourceType, path string, rules []IgnoreRule) bool {
+	for _, r := range rules {
+		if r.Match(resourceType, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoresNested tells whether ignore rules exclude nested values of an attribute of a resource type
+func ignoresNested(resourceType, key string, rules []IgnoreRule) bool {
+	for _, r := range rules {
+		if r.root != nil && r.root.MatchString(key) && r.resourceType.MatchString(resourceType) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterValue removes the nested values of a decoded attribute value excluded
+// by ignore rules, and tells whether any was removed
+func filterValue(resourceType, path string, value interface{}, rules []IgnoreRule) (interface{}, bool) {
+	filtered := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			p := joinKey(path, k)
+			if isIgnored(resourceType, p, rules) {
+				filtered = true
+				continue
+			}
+			e, f := filterValue(resourceType, p, e, rules)
+			m[k] = e
+			filtered = filtered || f
+		}
+		return m, filtered
+	case []interface{}:
+		l := make([]interface{}, 0, len(v))
+		for i, e := range v {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			if isIgnored(resourceType, p, rules) {
+				filtered = true
+				continue
+			}
+			e, f := filterValue(resourceType, p, e, rules)
+			l = append(l, e)
+			filtered = filtered || f
+		}
+		return l, filtered
+	}
+	return value, false
+}
+
+// filterAttributeValue returns the JSON value of an attribute of a resource type
+// without its nested values excluded by ignore rules
+func filterAttributeValue(resourceType string, a types.Attribute, rules []IgnoreRule) string {
+	if !ignoresNested(resourceType, a.Key, rules) {
+		return a.Value
+	}
+	d := json.NewDecoder(strings.NewReader(a.Value))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return a.Value
+	}
+	v, filtered := filterValue(resourceType, a.Key, v, rules)
+	if !filtered {
+		return a.Value
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return a.Value
+	}
+	return string(j)
+}
+
+// filterAttributes returns a copy of a Resource without its ignored attributes,
+// along with their ignored nested values
+func filterAttributes(res types.Resource, rules []IgnoreRule) types.Resource {
+	if len(rules) == 0 {
+		return res
+	}
+	attrs := make([]types.Attribute, 0, len(res.Attributes))
+	for _, a := range res.Attributes {
+		if !isIgnored(res.Type, a.Key, rules) {
+			a.Value = filterAttributeValue(res.Type, a, rules)
+			attrs = append(attrs, a)
+		}
+	}
+	res.Attributes = attrs
+	return res
+}
+
+// filterState returns a copy of a State without ignored attributes
+func filterState(state types.State, rules []IgnoreRule) types.State {
+	if len(rules) == 0 {
+		return state
+	}
+	modules := make([]types.Module, len(state.Modules))
+	for i, m := range state.Modules {
+		resources := make([]types.Resource, len(m.Resources))
+		for j, r := range m.Resources {
+			resources[j] = filterAttributes(r, rules)
+		}
+		m.Resources = resources
+		modules[i] = m
+	}
+	state.Modules = modules
+	return state
+}
+
+// filterAttributeDiffs removes the differences of ignored attribute paths
+func filterAttributeDiffs(diffs []types.AttributeDiff, resourceType string, rules []IgnoreRule) []types.AttributeDiff {
+	if len(rules) == 0 {
+		return diffs
+	}
+	var filtered []types.AttributeDiff
+	for _, d := range diffs {
+		if !isIgnored(resourceType, d.Path, rules) {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered
+}
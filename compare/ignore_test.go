@@ -0,0 +1,81 @@
+package compare
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+func TestIgnoreRule_Match(t *testing.T) {
+	cases := []struct {
+		rule         string
+		resourceType string
+		path         string
+		expected     bool
+	}{
+		{"*.last_modified", "aws_s3_object", "last_modified", true},
+		{"*.last_modified", "aws_s3_object", "last_modified_by", false},
+		{"aws_lambda_function.source_code_hash", "aws_lambda_function", "source_code_hash", true},
+		{"aws_lambda_function.source_code_hash", "aws_lambda_layer_version", "source_code_hash", false},
+		{"aws_*.tags", "aws_instance", "tags.Env", true},
+		{"aws_*.tags", "aws_instance", "tags_all", false},
+		{"*.tags.*", "aws_instance", "tags.Env", true},
+		{"*.ebs_block_device", "aws_instance", "ebs_block_device[0].volume_size", true},
+	}
+
+	for _, c := range cases {
+		r, err := ParseIgnoreRule(c.rule)
+		if err != nil {
+			t.Fatalf("Expected no error for %s, got %v", c.rule, err)
+		}
+		if got := r.Match(c.resourceType, c.path); got != c.expected {
+			t.Errorf("Expected %s to match %s.%s: %v, got %v", c.rule, c.resourceType, c.path, c.expected, got)
+		}
+	}
+}
+
+func TestParseIgnoreRule_Invalid(t *testing.T) {
+	for _, rule := range []string{"tags", "aws_instance.", ".tags"} {
+		if _, err := ParseIgnoreRule(rule); err == nil {
+			t.Errorf("Expected an error for %s, got nil", rule)
+		}
+	}
+}
+
+func TestParseIgnoreRules(t *testing.T) {
+	rules, err := ParseIgnoreRules([]string{"*.last_modified", ""})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rules) != 1 || rules[0].Attribute != "last_modified" {
+		t.Fatalf("Expected one rule on last_modified, got %v", rules)
+	}
+	if _, err := ParseIgnoreRules([]string{"last_modified"}); err == nil {
+		t.Fatalf("Expected an error, got nil")
+	}
+}
+
+func TestFilterAttributes_Nested(t *testing.T) {
+	rules, err := ParseIgnoreRules([]string{"aws_instance.config.rules[*].updated", "*.tags.Env"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	res := filterAttributes(types.Resource{
+		Type: "aws_instance",
+		Attributes: []types.Attribute{
+			{Key: "config", Value: `{"ratio":1.50,"rules":[{"name":"a","updated":"today"}]}`},
+			{Key: "tags", Value: `{"Env":"prod","Team":"ops"}`},
+			{Key: "tags_all", Value: `{"Env":"prod"}`},
+		},
+	}, rules)
+
+	expected := []types.Attribute{
+		{Key: "config", Value: `{"ratio":1.50,"rules":[{"name":"a"}]}`},
+		{Key: "tags", Value: `{"Team":"ops"}`},
+		{Key: "tags_all", Value: `{"Env":"prod"}`},
+	}
+	if !reflect.DeepEqual(res.Attributes, expected) {
+		t.Errorf("Expected %v, got %v", expected, res.Attributes)
+	}
+}
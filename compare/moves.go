@@ -0,0 +1,70 @@
+package compare
+
+import (
+	"github.com/camptocamp/terraboard/types"
+)
+
+// resourceIdentity identifies a resource across addresses by its
+// mode, type and provider 'id' attribute
+type resourceIdentity struct {
+	mode, resourceType, id string
+}
+
+// getResourceIdentity returns the identity of a resource,
+// and false when it has no usable 'id' attribute
+func getResourceIdentity(res types.Resource) (resourceIdentity, bool) {
+	id, err := getResourceAttribute(res, "id")
+	if err != nil || id == "" || id == "null" || id == `""` {
+		return resourceIdentity{}, false
+	}
+	return resourceIdentity{res.Mode, res.Type, id}, true
+}
+
+// detectMoves matches resources only in the 'from' State with resources only in
+// the 'to' State sharing the same type and 'id' attribute, which were moved
+// (moved blocks, terraform state mv, module refactors) rather than replaced
+func detectMoves(from, to types.State, onlyInOld, onlyInNew []string) (moves []types.ResourceMove, err error) {
+	moves = []types.ResourceMove{}
+	newByIdentity := make(map[resourceIdentity]string)
+	for _, key := range onlyInNew {
+		res, err := getResource(to, key)
+		if err != nil {
+			return nil, err
+		}
+		identity, ok := getResourceIdentity(res)
+		if !ok {
+			continue
+		}
+		if _, dup := newByIdentity[identity]; dup {
+			// Ambiguous identity, don't guess
+			newByIdentity[identity] = ""
+			continue
+		}
+		newByIdentity[identity] = key
+	}
+
+	for _, key := range onlyInOld {
+		res, err := getResource(from, key)
+		if err != nil {
+			return nil, err
+		}
+		identity, ok := getResourceIdentity(res)
+		if !ok {
+			continue
+		}
+		if newKey := newByIdentity[identity]; newKey != "" {
+			moves = append(moves, types.ResourceMove{From: key, To: newKey})
+			delete(newByIdentity, identity)
+		}
+	}
+	return
+}
+
+// movedKeys returns the 'from' and 'to' addresses of moved resources
+func movedKeys(moves []types.ResourceMove) (fromKeys, toKeys []string) {
+	for _, m := range moves {
+		fromKeys = append(fromKeys, m.From)
+		toKeys = append(toKeys, m.To)
+	}
+	return
+}
@@ -0,0 +1,71 @@
+package compare
+
+import (
+	"github.com/camptocamp/terraboard/types"
+)
+
+// stateOutputs returns all outputs of a state, by name.
+// Outputs of non-root modules are prefixed with their module path.
+func stateOutputs(state types.State) map[string]types.OutputValue {
+	outputs := make(map[string]types.OutputValue)
+	for _, m := range state.Modules {
+		for _, o := range m.OutputValues {
+			key := o.Name
+			if m.Path != "" {
+				key = m.Path + "." + o.Name
+			}
+			outputs[key] = o
+		}
+	}
+	return outputs
+}
+
+// maskOutput returns the value of an output, masked if sensitive
+func maskOutput(o types.OutputValue, sensitive bool) string {
+	if sensitive {
+		return types.SensitiveValue
+	}
+	return o.Value
+}
+
+// compareOutputs returns the outputs added, removed and changed between two states.
+// An output sensitive in either state has both its values masked.
+func compareOutputs(from, to types.State) (comp types.OutputsCompare) {
+	fromOutputs := stateOutputs(from)
+	toOutputs := stateOutputs(to)
+
+	comp.Added = make(map[string]types.OutputDiff)
+	comp.Removed = make(map[string]types.OutputDiff)
+	comp.Changed = make(map[string]types.OutputDiff)
+
+	for name, o := range fromOutputs {
+		n, ok := toOutputs[name]
+		if !ok {
+			comp.Removed[name] = types.OutputDiff{
+				Sensitive: o.Sensitive,
+				OldValue:  maskOutput(o, o.Sensitive),
+			}
+			continue
+		}
+
+		if o.Value != n.Value || o.Sensitive != n.Sensitive {
+			sensitive := o.Sensitive || n.Sensitive
+			comp.Changed[name] = types.OutputDiff{
+				Sensitive: sensitive,
+				OldValue:  maskOutput(o, sensitive),
+				NewValue:  maskOutput(n, sensitive),
+			}
+		}
+	}
+
+	for name, n := range toOutputs {
+		if _, ok := fromOutputs[name]; !ok {
+			comp.Added[name] = types.OutputDiff{
+				Sensitive: n.Sensitive,
+				NewValue:  maskOutput(n, n.Sensitive),
+			}
+		}
+	}
+
+	return
+}
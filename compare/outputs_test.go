@@ -0,0 +1,56 @@
+package compare
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+func TestCompareOutputs(t *testing.T) {
+	from := types.State{
+		Modules: []types.Module{
+			{
+				Path: "",
+				OutputValues: []types.OutputValue{
+					{Name: "vpc_id", Value: `"vpc-123"`},
+					{Name: "subnets", Value: `["subnet-1"]`},
+					{Name: "db_password", Value: `"hunter2"`, Sensitive: true},
+					{Name: "old", Value: `"foo"`},
+				},
+			},
+		},
+	}
+	to := types.State{
+		Modules: []types.Module{
+			{
+				Path: "",
+				OutputValues: []types.OutputValue{
+					{Name: "vpc_id", Value: `"vpc-123"`},
+					{Name: "subnets", Value: `["subnet-1","subnet-2"]`},
+					{Name: "db_password", Value: `"correct horse"`, Sensitive: true},
+					{Name: "token", Value: `"secret"`, Sensitive: true},
+				},
+			},
+		},
+	}
+
+	expectedResult := types.OutputsCompare{
+		Added: map[string]types.OutputDiff{
+			"token": {Sensitive: true, NewValue: types.SensitiveValue},
+		},
+		Removed: map[string]types.OutputDiff{
+			"old": {OldValue: `"foo"`},
+		},
+		Changed: map[string]types.OutputDiff{
+			"subnets":     {OldValue: `["subnet-1"]`, NewValue: `["subnet-1","subnet-2"]`},
+			"db_password": {Sensitive: true, OldValue: types.SensitiveValue, NewValue: types.SensitiveValue},
+		},
+	}
+
+	result := compareOutputs(from, to)
+
+	if !reflect.DeepEqual(result, expectedResult) {
+		t.Fatalf("Expected %v, got %v", expectedResult, result)
+	}
+}
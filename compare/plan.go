@@ -0,0 +1,193 @@
+package compare
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+// planModule is a module of the prior state or planned values
+// of a Terraform plan JSON export
+type planModule struct {
+	Address   string `json:"address"`
+	Resources []struct {
+		Mode            string                     `json:"mode"`
+		Type            string                     `json:"type"`
+		Name            string                     `json:"name"`
+		Index           json.RawMessage            `json:"index"`
+		Values          map[string]json.RawMessage `json:"values"`
+		SensitiveValues map[string]interface{}     `json:"sensitive_values"`
+	} `json:"resources"`
+	ChildModules []planModule `json:"child_modules"`
+}
+
+// planStateValues holds the resources of the prior state or planned values
+// of a Terraform plan JSON export
+type planStateValues struct {
+	RootModule planModule `json:"root_module"`
+}
+
+// attributeValue re-encodes a JSON value the way State attributes are stored
+func attributeValue(raw json.RawMessage) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", err
+	}
+	j, err := json.Marshal(v)
+	return string(j), err
+}
+
+// appendPlanModules adds a module of a plan and its child modules to a State
+func appendPlanModules(st *types.State, m planModule) error {
+	mod := types.Module{Path: m.Address}
+	for _, r := range m.Resources {
+		res := types.Resource{
+			Mode:                r.Mode,
+			Type:                r.Type,
+			Name:                r.Name,
+			SensitiveAttributes: r.SensitiveValues,
+		}
+		if len(r.Index) > 0 {
+			res.Index = fmt.Sprintf("[%s]", r.Index)
+		}
+		for k, raw := range r.Values {
+			v, err := attributeValue(raw)
+			if err != nil {
+				return fmt.Errorf("invalid value of %s.%s.%s: %v", res.Type, res.Name, k, err)
+			}
+			res.Attributes = append(res.Attributes, types.Attribute{Key: k, Value: v})
+		}
+		mod.Resources = append(mod.Resources, res)
+	}
+	st.Modules = append(st.Modules, mod)
+
+	for _, c := range m.ChildModules {
+		if err := appendPlanModules(st, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PlanPriorState returns the prior State of a Plan, built from its JSON representation.
+// Its Resources hold the sensitivity of their attributes.
+func PlanPriorState(plan types.Plan) (st types.State, err error) {
+	var planJSON struct {
+		PriorState struct {
+			Values planStateValues `json:"values"`
+		} `json:"prior_state"`
+	}
+	if err = json.Unmarshal(plan.PlanJSON, &planJSON); err != nil {
+		return st, fmt.Errorf("invalid plan JSON: %v", err)
+	}
+
+	st.TFVersion = plan.TFVersion
+	err = appendPlanModules(&st, planJSON.PriorState.Values.RootModule)
+	return
+}
+
+// ErrNoPlannedValues is returned when the planned values of a Plan are unknown,
+// as for the binary plan files inserted before their changes were decoded
+var ErrNoPlannedValues = errors.New("plan has no planned values")
+
+// PlannedState returns the State planned by a Plan, built from its JSON representation.
+// Values which are only known after apply are missing from its attributes,
+// and its Resources hold the sensitivity of their attributes.
+func PlannedState(plan types.Plan) (st types.State, err error) {
+	var planJSON struct {
+		PlannedValues *planStateValues `json:"planned_values"`
+	}
+	if err = json.Unmarshal(plan.PlanJSON, &planJSON); err != nil {
+		return st, fmt.Errorf("invalid plan JSON: %v", err)
+	}
+	if planJSON.PlannedValues == nil {
+		return st, ErrNoPlannedValues
+	}
+
+	st.TFVersion = plan.TFVersion
+	err = appendPlanModules(&st, planJSON.PlannedValues.RootModule)
+	return
+}
+
+// PlanDivergences lists the differences between the State planned by a Plan and
+// the State resulting from its apply: planned Resources missing from the State,
+// Resources which were not planned, and attributes whose values differ.
+// Attributes missing from the planned State, which were only known after apply,
+// masked sensitive values and the attributes excluded by ignore rules
+// are not divergences.
+func PlanDivergences(plan types.Plan, st types.State, rules []IgnoreRule) (divergences []types.PlanDivergence, err error) {
+	planned, err := PlannedState(plan)
+	if err != nil {
+		return
+	}
+
+	plannedResources := stateResources(planned)
+	appliedResources := stateResources(st)
+	sort.Strings(plannedResources)
+	sort.Strings(appliedResources)
+
+	for _, r := range sliceDiff(plannedResources, appliedResources) {
+		divergences = append(divergences, types.PlanDivergence{Kind: types.DivergenceMissing, Address: r})
+	}
+	for _, r := range sliceDiff(appliedResources, plannedResources) {
+		divergences = append(divergences, types.PlanDivergence{Kind: types.DivergenceUnexpected, Address: r})
+	}
+	for _, r := range sliceInter(plannedResources, appliedResources) {
+		plannedRes, err := getResource(planned, r)
+		if err != nil {
+			return nil, err
+		}
+		res, err := getResource(st, r)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range filterAttributeDiffs(DiffAttributes(plannedRes, res), res.Type, rules) {
+			if d.Kind == types.AttributeAdded {
+				continue
+			}
+			divergences = append(divergences, types.PlanDivergence{Kind: types.DivergenceChanged, Address: r, Path: d.Path})
+		}
+	}
+	return
+}
+
+// ComparePlan compares the prior State of a Plan with the latest State of its lineage.
+// base is the State version the Plan was computed from, nil if it is unknown.
+// The attributes excluded by ignore rules are not compared.
+func ComparePlan(plan types.Plan, base *types.StateStat, latest types.State, rules []IgnoreRule) (comp types.PlanStateCompare, err error) {
+	prior, err := PlanPriorState(plan)
+	if err != nil {
+		return
+	}
+	prior.Path = latest.Path
+
+	comp = types.PlanStateCompare{
+		PlanID:          plan.ID,
+		Lineage:         plan.Lineage.Value,
+		LatestSerial:    latest.Serial,
+		LatestVersionID: latest.Version.VersionID,
+		SerialStatus:    types.SerialUnknown,
+	}
+	if base != nil {
+		prior.Serial = base.Serial
+		prior.Version.VersionID = base.VersionID
+		comp.PlanSerial = base.Serial
+		comp.PlanVersionID = base.VersionID
+		comp.StaleSerial = latest.Serial > base.Serial
+		comp.SerialStatus = types.SerialCurrent
+		if comp.StaleSerial {
+			comp.SerialStatus = types.SerialStale
+		}
+	}
+	comp.Compare, err = CompareWithOptions(prior, latest, Options{IgnoreRules: rules})
+	if err != nil {
+		return
+	}
+
+	d := comp.Compare.Differences
+	comp.Changed = len(d.OnlyInOld) > 0 || len(d.OnlyInNew) > 0 || len(d.ResourceDiff) > 0 || len(d.Moved) > 0
+	return
+}
@@ -0,0 +1,239 @@
+package compare
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+const testPlanJSON = `{
+	"format_version": "1.1",
+	"prior_state": {
+		"values": {
+			"root_module": {
+				"resources": [
+					{"address": "aws_instance.web[0]", "mode": "managed", "type": "aws_instance", "name": "web", "index": 0,
+					 "values": {"id": "i-123", "instance_type": "t3.small", "tags": {"Name": "web", "Env": "prod"}}}
+				],
+				"child_modules": [
+					{"address": "module.db", "resources": [
+						{"address": "module.db.aws_db_instance.main[\"primary\"]", "mode": "managed", "type": "aws_db_instance", "name": "main", "index": "primary",
+						 "values": {"id": "db-1", "allocated_storage": 20}}
+					]}
+				]
+			}
+		}
+	}
+}`
+
+func TestPlanPriorState(t *testing.T) {
+	st, err := PlanPriorState(types.Plan{TFVersion: "1.5.0", PlanJSON: []byte(testPlanJSON)})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if st.TFVersion != "1.5.0" {
+		t.Fatalf("Expected Terraform version 1.5.0, got %s", st.TFVersion)
+	}
+	expectedResources := []string{`aws_instance.web[0]`, `module.db.aws_db_instance.main["primary"]`}
+	if res := stateResources(st); !reflect.DeepEqual(res, expectedResources) {
+		t.Fatalf("Expected %v, got %v", expectedResources, res)
+	}
+
+	attrs := st.Modules[0].Resources[0].Attributes
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	expectedAttrs := []types.Attribute{
+		{Key: "id", Value: `"i-123"`},
+		{Key: "instance_type", Value: `"t3.small"`},
+		{Key: "tags", Value: `{"Env":"prod","Name":"web"}`},
+	}
+	if !reflect.DeepEqual(attrs, expectedAttrs) {
+		t.Fatalf("Expected %v, got %v", expectedAttrs, attrs)
+	}
+}
+
+func TestPlanPriorState_Invalid(t *testing.T) {
+	if _, err := PlanPriorState(types.Plan{PlanJSON: []byte(`{`)}); err == nil {
+		t.Fatalf("Expected an error, got nil")
+	}
+}
+
+func TestComparePlan(t *testing.T) {
+	plan := types.Plan{PlanJSON: []byte(testPlanJSON)}
+	plan.ID = 4
+	plan.Lineage.Value = "lineage"
+
+	latest := types.State{
+		Path:    "app.tfstate",
+		Version: types.Version{VersionID: "v3"},
+		Serial:  3,
+		Modules: []types.Module{
+			{
+				Resources: []types.Resource{
+					{Mode: "managed", Type: "aws_instance", Name: "web", Index: "[0]", Attributes: []types.Attribute{
+						{Key: "id", Value: `"i-123"`},
+						{Key: "instance_type", Value: `"t3.large"`},
+						{Key: "tags", Value: `{"Env":"prod","Name":"web"}`},
+					}},
+				},
+			},
+			{
+				Path: "module.db",
+				Resources: []types.Resource{
+					{Mode: "managed", Type: "aws_db_instance", Name: "main", Index: `["primary"]`, Attributes: []types.Attribute{
+						{Key: "id", Value: `"db-1"`},
+						{Key: "allocated_storage", Value: `20`},
+					}},
+				},
+			},
+		},
+	}
+
+	comp, err := ComparePlan(plan, &types.StateStat{Serial: 2, VersionID: "v2"}, latest, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if comp.PlanID != 4 || comp.Lineage != "lineage" || comp.PlanSerial != 2 || comp.LatestSerial != 3 {
+		t.Fatalf("Unexpected plan compare: %+v", comp)
+	}
+	if !comp.StaleSerial || comp.SerialStatus != types.SerialStale || !comp.Changed {
+		t.Fatalf("Expected a stale serial and changes, got %v and %v", comp.StaleSerial, comp.Changed)
+	}
+	if _, ok := comp.Compare.Differences.ResourceDiff["aws_instance.web[0]"]; !ok || len(comp.Compare.Differences.ResourceDiff) != 1 {
+		t.Fatalf("Expected aws_instance.web[0] to be the only changed resource, got %v", comp.Compare.Differences.ResourceDiff)
+	}
+
+	comp, err = ComparePlan(plan, &types.StateStat{Serial: 3, VersionID: "v3"}, latest, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if comp.StaleSerial || comp.SerialStatus != types.SerialCurrent {
+		t.Fatalf("Expected no stale serial, got %s", comp.SerialStatus)
+	}
+
+	// Without a prior serial, the plan can't be told to be stale or not
+	comp, err = ComparePlan(plan, nil, latest, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if comp.StaleSerial || comp.SerialStatus != types.SerialUnknown || comp.PlanSerial != 0 {
+		t.Fatalf("Expected an unknown serial status, got %+v", comp)
+	}
+}
+
+func TestComparePlan_Sensitive(t *testing.T) {
+	planJSON := func(password string) []byte {
+		return []byte(`{"prior_state": {"values": {"root_module": {"resources": [
+			{"address": "aws_db_instance.main", "mode": "managed", "type": "aws_db_instance", "name": "main",
+			 "values": {"id": "db-1", "password": "` + password + `"}, "sensitive_values": {"password": true}}
+		]}}}}`)
+	}
+	latest := types.State{
+		Path: "app.tfstate",
+		Modules: []types.Module{{Resources: []types.Resource{
+			{Mode: "managed", Type: "aws_db_instance", Name: "main", Attributes: []types.Attribute{
+				{Key: "id", Value: `"db-1"`},
+				{Key: "password", Value: `"hunter3"`},
+			}},
+		}}},
+	}
+
+	// The change of the password is reported, masked on both sides
+	comp, err := ComparePlan(types.Plan{PlanJSON: planJSON("hunter2")}, nil, latest, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	diff, ok := comp.Compare.Differences.ResourceDiff["aws_db_instance.main"]
+	if !ok || !comp.Changed {
+		t.Fatalf("Expected aws_db_instance.main to be changed, got %v", comp.Compare.Differences.ResourceDiff)
+	}
+	expectedDiffs := []types.AttributeDiff{
+		{Path: "password", Kind: types.AttributeChanged, OldValue: types.SensitiveValue, NewValue: types.SensitiveValue, Sensitive: true},
+	}
+	if !reflect.DeepEqual(diff.AttributeDiffs, expectedDiffs) {
+		t.Fatalf("Expected %v, got %v", expectedDiffs, diff.AttributeDiffs)
+	}
+	if strings.Contains(diff.UnifiedDiff, "hunter") {
+		t.Fatalf("Expected the unified diff to be masked, got %s", diff.UnifiedDiff)
+	}
+
+	// The change of a password masked in the plan is unknown
+	comp, err = ComparePlan(types.Plan{PlanJSON: planJSON(types.SensitiveValue)}, nil, latest, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if comp.Changed {
+		t.Fatalf("Expected no changes, got %v", comp.Compare.Differences.ResourceDiff)
+	}
+}
+
+func TestPlanDivergences(t *testing.T) {
+	plan := types.Plan{PlanJSON: []byte(`{
+		"format_version": "1.1",
+		"planned_values": {
+			"root_module": {
+				"resources": [
+					{"address": "aws_instance.web[0]", "mode": "managed", "type": "aws_instance", "name": "web", "index": 0,
+					 "values": {"instance_type": "t3.large", "tags": {"Name": "web"}, "ebs_block_device": [{"volume_size": 8}]}},
+					{"address": "aws_eip.web", "mode": "managed", "type": "aws_eip", "name": "web", "values": {"vpc": true}}
+				]
+			}
+		}
+	}`)}
+
+	st := types.State{
+		Modules: []types.Module{
+			{
+				Resources: []types.Resource{
+					{Mode: "managed", Type: "aws_instance", Name: "web", Index: "[0]", Attributes: []types.Attribute{
+						{Key: "id", Value: `"i-123"`},
+						{Key: "instance_type", Value: `"t3.large"`},
+						{Key: "tags", Value: `{"Name":"web"}`},
+						{Key: "ebs_block_device", Value: `[{"volume_id":"vol-1","volume_size":8}]`},
+					}},
+				},
+			},
+		},
+	}
+
+	divergences, err := PlanDivergences(plan, st, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []types.PlanDivergence{{Kind: types.DivergenceMissing, Address: "aws_eip.web"}}
+	if !reflect.DeepEqual(divergences, expected) {
+		t.Fatalf("Expected %v, got %v", expected, divergences)
+	}
+
+	st.Modules[0].Resources[0].Attributes[1].Value = `"t3.small"`
+	st.Modules = append(st.Modules, types.Module{Path: "module.db", Resources: []types.Resource{
+		{Mode: "managed", Type: "aws_db_instance", Name: "main"},
+	}})
+	divergences, err = PlanDivergences(plan, st, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected = []types.PlanDivergence{
+		{Kind: types.DivergenceMissing, Address: "aws_eip.web"},
+		{Kind: types.DivergenceUnexpected, Address: "module.db.aws_db_instance.main"},
+		{Kind: types.DivergenceChanged, Address: "aws_instance.web[0]", Path: "instance_type"},
+	}
+	if !reflect.DeepEqual(divergences, expected) {
+		t.Fatalf("Expected %v, got %v", expected, divergences)
+	}
+
+	divergences, err = PlanDivergences(plan, st, []IgnoreRule{IgnoreAttribute("instance_type")})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(divergences, expected[:2]) {
+		t.Fatalf("Expected %v, got %v", expected[:2], divergences)
+	}
+
+	if _, err := PlanDivergences(types.Plan{PlanJSON: []byte(testPlanJSON)}, st, nil); err != ErrNoPlannedValues {
+		t.Fatalf("Expected ErrNoPlannedValues, got %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+package compare
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+// Supported report formats
+const (
+	Markdown = "markdown"
+	HTML     = "html"
+)
+
+// ReportContentType returns the MIME type associated to a report format,
+// or an error if the format is not supported
+func ReportContentType(format string) (string, error) {
+	switch format {
+	case Markdown:
+		return "text/markdown; charset=utf-8", nil
+	case HTML:
+		return "text/html; charset=utf-8", nil
+	}
+	return "", fmt.Errorf("unsupported report format '%s'", format)
+}
+
+// reportResource is a changed Resource, as presented in a report
+type reportResource struct {
+	Address        string
+	AttributeDiffs []types.AttributeDiff
+}
+
+// reportOutput is a changed output, as presented in a report
+type reportOutput struct {
+	Name   string
+	Change string
+	types.OutputDiff
+}
+
+// reportData holds the content of a report, sorted for display
+type reportData struct {
+	From, To  types.StateInfo
+	OnlyInOld []string
+	OnlyInNew []string
+	Changed   []reportResource
+	Moved     []types.ResourceMove
+	Outputs   []reportOutput
+}
+
+func newReportData(comp types.StateCompare) (data reportData) {
+	data.From = comp.Stats.From
+	data.To = comp.Stats.To
+	data.OnlyInOld = sortedKeys(comp.Differences.OnlyInOld)
+	data.OnlyInNew = sortedKeys(comp.Differences.OnlyInNew)
+	for _, r := range sortedKeys(comp.Differences.ResourceDiff) {
+		data.Changed = append(data.Changed, reportResource{
+			Address:        r,
+			AttributeDiffs: comp.Differences.ResourceDiff[r].AttributeDiffs,
+		})
+	}
+	data.Moved = comp.Differences.Moved
+	for _, o := range []struct {
+		change  string
+		outputs map[string]types.OutputDiff
+	}{
+		{types.AttributeAdded, comp.Outputs.Added},
+		{types.AttributeRemoved, comp.Outputs.Removed},
+		{types.AttributeChanged, comp.Outputs.Changed},
+	} {
+		for _, name := range sortedKeys(o.outputs) {
+			data.Outputs = append(data.Outputs, reportOutput{Name: name, Change: o.change, OutputDiff: o.outputs[name]})
+		}
+	}
+	return
+}
+
+// sortedKeys returns the keys of a map in alphabetical order
+func sortedKeys[V any](m map[string]V) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// formatValue returns the JSON representation of an attribute value,
+// or an empty string if it is not set
+func formatValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// markdownCode formats a value as a Markdown code span, so that no Markdown
+// syntax in the value is interpreted. The code span is delimited by more
+// backticks than the value contains in a row, and line breaks are replaced
+// by spaces as they would end a list item or a table row.
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	s = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(s)
+
+	longest, run := 0, 0
+	for _, c := range s {
+		if c != '`' {
+			run = 0
+			continue
+		}
+		run++
+		if run > longest {
+			longest = run
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
+
+// markdownCell formats a value as a Markdown code span to be used in a table
+// cell, where pipes must be escaped even in code spans
+func markdownCell(s string) string {
+	return markdownCode(strings.ReplaceAll(s, "|", `\|`))
+}
+
+var reportFuncs = map[string]interface{}{
+	"value": formatValue,
+	"code":  markdownCode,
+	"cell":  markdownCell,
+}
+
+var markdownReport = template.Must(template.New("markdown").Funcs(reportFuncs).Parse(
+	`# State comparison: {{ code .From.Path }}
+
+| | From | To |
+|---|---|---|
+| Path | {{ cell .From.Path }} | {{ cell .To.Path }} |
+| Version | {{ cell .From.VersionID }} | {{ cell .To.VersionID }} |
+| Serial | {{ .From.Serial }} | {{ .To.Serial }} |
+| Terraform version | {{ cell .From.TFVersion }} | {{ cell .To.TFVersion }} |
+| Resources | {{ .From.ResourceCount }} | {{ .To.ResourceCount }} |
+
+| Only in serial {{ .From.Serial }} | Only in serial {{ .To.Serial }} | Changed | Moved | Outputs changed |
+|---|---|---|---|---|
+| {{ len .OnlyInOld }} | {{ len .OnlyInNew }} | {{ len .Changed }} | {{ len .Moved }} | {{ len .Outputs }} |
+{{- if .Changed }}
+
+## Changed resources
+{{- range .Changed }}
+
+### {{ code .Address }}
+
+| Attribute | Change | Old value | New value |
+|---|---|---|---|
+{{- range .AttributeDiffs }}
+| {{ cell .Path }} | {{ .Kind }} | {{ cell (value .OldValue) }} | {{ cell (value .NewValue) }} |
+{{- end }}
+{{- end }}
+{{- end }}
+{{- if .OnlyInOld }}
+
+## Only in serial {{ .From.Serial }}
+{{ range .OnlyInOld }}
+- {{ code . }}
+{{- end }}
+{{- end }}
+{{- if .OnlyInNew }}
+
+## Only in serial {{ .To.Serial }}
+{{ range .OnlyInNew }}
+- {{ code . }}
+{{- end }}
+{{- end }}
+{{- if .Moved }}
+
+## Moved resources
+
+| From | To | Changed |
+|---|---|---|
+{{- range .Moved }}
+| {{ cell .From }} | {{ cell .To }} | {{ if .ResourceDiff }}yes{{ else }}no{{ end }} |
+{{- end }}
+{{- end }}
+{{- if .Outputs }}
+
+## Outputs
+
+| Output | Change | Old value | New value |
+|---|---|---|---|
+{{- range .Outputs }}
+| {{ cell .Name }} | {{ .Change }} | {{ cell .OldValue }} | {{ cell .NewValue }} |
+{{- end }}
+{{- end }}
+`))
+
+var htmlReport = htmltemplate.Must(htmltemplate.New("html").Funcs(reportFuncs).Parse(
+	`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>State comparison: {{ .From.Path }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f3f3f3; }
+code { white-space: pre-wrap; word-break: break-all; }
+.added { background: #e6ffed; }
+.removed { background: #ffeef0; }
+.changed { background: #fff5b1; }
+</style>
+</head>
+<body>
+<h1>State comparison: {{ .From.Path }}</h1>
+<table>
+<tr><th></th><th>From</th><th>To</th></tr>
+<tr><th>Path</th><td><code>{{ .From.Path }}</code></td><td><code>{{ .To.Path }}</code></td></tr>
+<tr><th>Version</th><td><code>{{ .From.VersionID }}</code></td><td><code>{{ .To.VersionID }}</code></td></tr>
+<tr><th>Serial</th><td>{{ .From.Serial }}</td><td>{{ .To.Serial }}</td></tr>
+<tr><th>Terraform version</th><td>{{ .From.TFVersion }}</td><td>{{ .To.TFVersion }}</td></tr>
+<tr><th>Resources</th><td>{{ .From.ResourceCount }}</td><td>{{ .To.ResourceCount }}</td></tr>
+</table>
+<table>
+<tr><th>Only in serial {{ .From.Serial }}</th><th>Only in serial {{ .To.Serial }}</th><th>Changed</th><th>Moved</th><th>Outputs changed</th></tr>
+<tr><td>{{ len .OnlyInOld }}</td><td>{{ len .OnlyInNew }}</td><td>{{ len .Changed }}</td><td>{{ len .Moved }}</td><td>{{ len .Outputs }}</td></tr>
+</table>
+{{- if .Changed }}
+<h2>Changed resources</h2>
+{{- range .Changed }}
+<h3><code>{{ .Address }}</code></h3>
+<table>
+<tr><th>Attribute</th><th>Change</th><th>Old value</th><th>New value</th></tr>
+{{- range .AttributeDiffs }}
+<tr class="{{ .Kind }}"><td><code>{{ .Path }}</code></td><td>{{ .Kind }}</td><td><code>{{ value .OldValue }}</code></td><td><code>{{ value .NewValue }}</code></td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- end }}
+{{- if .OnlyInOld }}
+<h2>Only in serial {{ .From.Serial }}</h2>
+<ul>
+{{- range .OnlyInOld }}
+<li><code>{{ . }}</code></li>
+{{- end }}
+</ul>
+{{- end }}
+{{- if .OnlyInNew }}
+<h2>Only in serial {{ .To.Serial }}</h2>
+<ul>
+{{- range .OnlyInNew }}
+<li><code>{{ . }}</code></li>
+{{- end }}
+</ul>
+{{- end }}
+{{- if .Moved }}
+<h2>Moved resources</h2>
+<table>
+<tr><th>From</th><th>To</th><th>Changed</th></tr>
+{{- range .Moved }}
+<tr><td><code>{{ .From }}</code></td><td><code>{{ .To }}</code></td><td>{{ if .ResourceDiff }}yes{{ else }}no{{ end }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Outputs }}
+<h2>Outputs</h2>
+<table>
+<tr><th>Output</th><th>Change</th><th>Old value</th><th>New value</th></tr>
+{{- range .Outputs }}
+<tr class="{{ .Change }}"><td><code>{{ .Name }}</code></td><td>{{ .Change }}</td><td><code>{{ .OldValue }}</code></td><td><code>{{ .NewValue }}</code></td></tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`))
+
+// WriteReport writes a StateCompare as a self-contained report in the given format
+func WriteReport(w io.Writer, format string, comp types.StateCompare) error {
+	data := newReportData(comp)
+	switch format {
+	case Markdown:
+		return markdownReport.Execute(w, data)
+	case HTML:
+		return htmlReport.Execute(w, data)
+	}
+	return fmt.Errorf("unsupported report format '%s'", format)
+}
@@ -0,0 +1,96 @@
+package compare
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+func reportCompare() (comp types.StateCompare) {
+	comp.Stats.From = types.StateInfo{Path: "app.tfstate", VersionID: "v1", ResourceCount: 2, TFVersion: "1.5.0", Serial: 1}
+	comp.Stats.To = types.StateInfo{Path: "app.tfstate", VersionID: "v2", ResourceCount: 2, TFVersion: "1.5.0", Serial: 2}
+	comp.Differences.OnlyInOld = map[string]string{"aws_s3_bucket.logs": ""}
+	comp.Differences.OnlyInNew = map[string]string{"aws_sqs_queue.jobs": ""}
+	comp.Differences.ResourceDiff = map[string]types.ResourceDiff{
+		"aws_instance.web": {AttributeDiffs: []types.AttributeDiff{
+			{Path: "tags.Name", Kind: types.AttributeChanged, OldValue: "a|b", NewValue: "<web>"},
+		}},
+	}
+	comp.Outputs.Changed = map[string]types.OutputDiff{
+		"password": {Sensitive: true, OldValue: types.SensitiveValue, NewValue: types.SensitiveValue},
+	}
+	return
+}
+
+func TestWriteReport_Markdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, Markdown, reportCompare()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	report := buf.String()
+
+	for _, expected := range []string{
+		"# State comparison: `app.tfstate`\n",
+		"| Version | `v1` | `v2` |\n",
+		"| 1 | 1 | 1 | 0 | 1 |\n",
+		"### `aws_instance.web`\n",
+		"| `tags.Name` | changed | `\"a\\|b\"` | `\"<web>\"` |\n",
+		"## Only in serial 1\n\n- `aws_s3_bucket.logs`\n",
+		"## Only in serial 2\n\n- `aws_sqs_queue.jobs`\n",
+		"| `password` | changed | `(sensitive)` | `(sensitive)` |\n",
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("Expected report to contain %q, got:\n%s", expected, report)
+		}
+	}
+	if strings.Contains(report, "## Moved resources") {
+		t.Errorf("Expected no moved resources section, got:\n%s", report)
+	}
+}
+
+func TestMarkdownCode(t *testing.T) {
+	for value, expected := range map[string]string{
+		"":                     "",
+		"aws_instance.web":     "`aws_instance.web`",
+		"a ` b":                "``a ` b``",
+		"```\n# title":         "```` ``` # title ````",
+		"**bold** [link](url)": "`**bold** [link](url)`",
+	} {
+		if got := markdownCode(value); got != expected {
+			t.Errorf("Expected %q to be formatted as %q, got %q", value, expected, got)
+		}
+	}
+	if got := markdownCell("a|b"); got != "`a\\|b`" {
+		t.Errorf("Expected pipes to be escaped, got %q", got)
+	}
+}
+
+func TestWriteReport_HTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, HTML, reportCompare()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	report := buf.String()
+
+	if !strings.HasPrefix(report, "<!DOCTYPE html>") {
+		t.Errorf("Expected an HTML document, got:\n%s", report)
+	}
+	if strings.Contains(report, "<web>") {
+		t.Errorf("Expected values to be escaped, got:\n%s", report)
+	}
+	if !strings.Contains(report, `<tr class="changed"><td><code>tags.Name</code></td>`) {
+		t.Errorf("Expected an attribute row, got:\n%s", report)
+	}
+}
+
+func TestWriteReport_Unsupported(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, "pdf", reportCompare()); err == nil {
+		t.Fatalf("Expected an error, got nil")
+	}
+	if _, err := ReportContentType("pdf"); err == nil {
+		t.Fatalf("Expected an error, got nil")
+	}
+}
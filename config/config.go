@@ -35,6 +35,18 @@ type configFlags struct {
 	Gitlab GitlabConfig `group:"GitLab Options" yaml:"gitlab"`
 
 	Web WebConfig `group:"Web" yaml:"web"`
+
+	Compare CompareConfig `group:"Compare Options" yaml:"compare"`
+
+	Plan PlanConfig `group:"Plan Options" yaml:"plan"`
+
+	Comment CommentConfig `group:"Comment Options" yaml:"comment"`
+
+	Export ExportConfig `command:"export" description:"Export search results or states stats from the database to a file."`
+
+	Token TokenConfig `command:"token" description:"Manage the API tokens allowed to submit plans."`
+
+	Command string
 }
 
 // LogConfig stores the log configuration
@@ -104,6 +116,65 @@ type WebConfig struct {
 	LogoutURL   string `long:"logout-url" env:"TERRABOARD_LOGOUT_URL" yaml:"logout-url" description:"Logout URL."`
 }
 
+// CompareConfig stores the state comparison parameters
+type CompareConfig struct {
+	IgnoreRules []string `long:"compare-ignore" env:"TERRABOARD_COMPARE_IGNORE" env-delim:"," yaml:"ignore" description:"Attributes to ignore in comparisons, as '<resource type>.<attribute>' globs (e.g. '*.last_modified')."`
+}
+
+// PlanConfig stores the plan review, retention, masking and policy parameters
+type PlanConfig struct {
+	RiskRules      []string `long:"plan-risk" env:"TERRABOARD_PLAN_RISK" env-delim:"," yaml:"risk" description:"Rules classifying the risk of plans, as '<level>:<action>:<resource type>' (e.g. 'high:delete:aws_rds_*')." default:"high:delete:aws_rds_*" default:"high:delete:google_sql_*"`
+	RetentionDays  uint16   `long:"plan-retention-days" env:"TERRABOARD_PLAN_RETENTION_DAYS" yaml:"retention-days" description:"Delete plans older than this number of days, except those waiting to be applied (0 to keep them regardless of their age)."`
+	RetentionCount uint16   `long:"plan-retention-count" env:"TERRABOARD_PLAN_RETENTION_COUNT" yaml:"retention-count" description:"Number of plans to keep per lineage, older ones being deleted unless waiting to be applied (0 to keep them all)."`
+	MaskSensitive  bool     `long:"plan-mask-sensitive" env:"TERRABOARD_PLAN_MASK_SENSITIVE" yaml:"mask-sensitive" description:"Mask the sensitive values of plans before storing them (they are always masked in API responses)."`
+	Policies       []string `long:"plan-policy" env:"TERRABOARD_PLAN_POLICY" env-delim:"," yaml:"policies" description:"Rego policy files or directories, evaluated against the plans on submission."`
+	TrustProxyAuth bool     `long:"plan-trust-proxy-auth" env:"TERRABOARD_PLAN_TRUST_PROXY_AUTH" yaml:"trust-proxy-auth" description:"Trust the X-Forwarded-User and X-Forwarded-Email headers as the identity of plan reviewers and saved search owners (only when Terraboard is reachable through the authentication proxy alone)."`
+}
+
+// CommentConfig stores the parameters used to comment plans on merge requests
+type CommentConfig struct {
+	GitlabAddress string `long:"comment-gitlab-address" env:"TERRABOARD_COMMENT_GITLAB_ADDRESS" yaml:"gitlab-address" description:"GitLab address (root) of the merge requests to comment plans on." default:"https://gitlab.com"`
+	GitlabToken   string `long:"comment-gitlab-token" env:"TERRABOARD_COMMENT_GITLAB_TOKEN" yaml:"gitlab-token" description:"GitLab token allowed to comment merge requests (no GitLab comments if empty)."`
+	GithubAPIURL  string `long:"comment-github-api-url" env:"TERRABOARD_COMMENT_GITHUB_API_URL" yaml:"github-api-url" description:"GitHub API URL of the pull requests to comment plans on." default:"https://api.github.com"`
+	GithubToken   string `long:"comment-github-token" env:"TERRABOARD_COMMENT_GITHUB_TOKEN" yaml:"github-token" description:"GitHub token allowed to comment pull requests (no GitHub comments if empty)."`
+}
+
+// ExportConfig stores the parameters of the export command
+type ExportConfig struct {
+	Type           string `long:"type" description:"Data to export ('search', 'states')." choice:"search" choice:"states" default:"search"`
+	Format         string `long:"format" description:"Export format ('csv', 'ndjson')." choice:"csv" choice:"ndjson" default:"csv"`
+	Output         string `short:"o" long:"output" description:"Output file (defaults to stdout)."`
+	VersionID      string `long:"version-id" description:"Search: version ID ('*' for all versions, latest ones by default)."`
+	ResourceType   string `long:"resource-type" description:"Search: resource type."`
+	ResourceName   string `long:"resource-name" description:"Search: resource name."`
+	AttributeKey   string `long:"attribute-key" description:"Search: attribute key."`
+	AttributeValue string `long:"attribute-value" description:"Search: attribute value."`
+	TFVersion      string `long:"tf-version" description:"Search: Terraform version."`
+	Lineage        string `long:"lineage" description:"Search: lineage."`
+}
+
+// TokenConfig stores the parameters of the token command
+type TokenConfig struct {
+	Create TokenCreateConfig `command:"create" description:"Create an API token, allowed to submit plans for the given lineages and state path prefixes."`
+	List   struct{}          `command:"list" description:"List the API tokens."`
+	Revoke TokenRevokeConfig `command:"revoke" description:"Revoke an API token."`
+
+	// Action is the name of the token subcommand to run
+	Action string
+}
+
+// TokenCreateConfig stores the parameters of the token create command
+type TokenCreateConfig struct {
+	Name         string   `long:"name" required:"true" description:"Token name."`
+	Lineages     []string `long:"lineage" description:"Lineage the token can submit plans for (repeatable)."`
+	PathPrefixes []string `long:"path-prefix" description:"Prefix of the state paths the token can submit plans for (repeatable)."`
+}
+
+// TokenRevokeConfig stores the parameters of the token revoke command
+type TokenRevokeConfig struct {
+	Name string `long:"name" required:"true" description:"Token name."`
+}
+
 // ProviderConfig stores genral provider parameters
 type ProviderConfig struct {
 	NoVersioning bool `long:"no-versioning" env:"TERRABOARD_NO_VERSIONING" yaml:"no-versioning" description:"Disable versioning support from Terraboard (useful for S3 compatible providers like MinIO)"`
@@ -131,6 +202,19 @@ type Config struct {
 	Gitlab []GitlabConfig `group:"GitLab Options" yaml:"gitlab"`
 
 	Web WebConfig `group:"Web" yaml:"web"`
+
+	Compare CompareConfig `group:"Compare Options" yaml:"compare"`
+
+	Plan PlanConfig `group:"Plan Options" yaml:"plan"`
+
+	Comment CommentConfig `group:"Comment Options" yaml:"comment"`
+
+	Export ExportConfig `yaml:"-"`
+
+	Token TokenConfig `yaml:"-"`
+
+	// Command is the name of the subcommand to run instead of the server, if any
+	Command string `yaml:"-"`
 }
 
 // LoadConfigFromYaml loads the config from config file
@@ -156,6 +240,7 @@ func (c *Config) LoadConfigFromYaml(filename string) *Config {
 func parseStructFlagsAndEnv() configFlags {
 	var tmpConfig configFlags
 	parser := flags.NewParser(&tmpConfig, flags.Default)
+	parser.SubcommandsOptional = true
 	if _, err := parser.Parse(); err != nil {
 		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
 			os.Exit(0)
@@ -163,6 +248,13 @@ func parseStructFlagsAndEnv() configFlags {
 		log.Fatalf("Failed to parse flags: %s", err)
 	}
 
+	if parser.Active != nil {
+		tmpConfig.Command = parser.Active.Name
+		if parser.Active.Active != nil {
+			tmpConfig.Token.Action = parser.Active.Active.Name
+		}
+	}
+
 	return tmpConfig
 }
 
@@ -187,6 +279,12 @@ func LoadConfig(version string) *Config {
 		GCP:            []GCPConfig{parsedConfig.GCP},
 		Gitlab:         []GitlabConfig{parsedConfig.Gitlab},
 		Web:            parsedConfig.Web,
+		Compare:        parsedConfig.Compare,
+		Plan:           parsedConfig.Plan,
+		Comment:        parsedConfig.Comment,
+		Export:         parsedConfig.Export,
+		Token:          parsedConfig.Token,
+		Command:        parsedConfig.Command,
 	}
 	c.AWS[0].S3 = append(c.AWS[0].S3, parsedConfig.S3)
 
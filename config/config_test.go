@@ -27,6 +27,7 @@ func TestSetLogging_debug(t *testing.T) {
 func TestLoadConfig(t *testing.T) {
 	var tmpConfig configFlags
 	parser := flags.NewParser(&tmpConfig, flags.Default)
+	parser.SubcommandsOptional = true
 	if _, err := parser.ParseArgs([]string{"--db-host=test", "--port=1234"}); err != nil {
 		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
 			os.Exit(0)
@@ -79,6 +80,17 @@ func TestLoadConfig(t *testing.T) {
 			BaseURL:     "/",
 			LogoutURL:   "",
 		},
+		Plan: PlanConfig{
+			RiskRules: []string{"high:delete:aws_rds_*", "high:delete:google_sql_*"},
+		},
+		Comment: CommentConfig{
+			GitlabAddress: "https://gitlab.com",
+			GithubAPIURL:  "https://api.github.com",
+		},
+		Export: ExportConfig{
+			Type:   "search",
+			Format: "csv",
+		},
 	}
 
 	if !reflect.DeepEqual(tmpConfig, compareConfig) {
@@ -150,6 +162,23 @@ func TestLoadConfigFromYaml(t *testing.T) {
 			BaseURL:     "/test/",
 			LogoutURL:   "/test-logout",
 		},
+		Compare: CompareConfig{
+			IgnoreRules: []string{"*.last_modified", "aws_lambda_function.source_code_hash"},
+		},
+		Plan: PlanConfig{
+			RiskRules:      []string{"high:delete:aws_rds_*", "medium:replace:*"},
+			RetentionDays:  90,
+			RetentionCount: 50,
+			MaskSensitive:  true,
+			Policies:       []string{"/etc/terraboard/policies"},
+			TrustProxyAuth: true,
+		},
+		Comment: CommentConfig{
+			GitlabAddress: "https://gitlab.example.com",
+			GitlabToken:   "foo",
+			GithubAPIURL:  "https://api.github.com",
+			GithubToken:   "bar",
+		},
 	}
 
 	if !reflect.DeepEqual(config, compareConfig) {
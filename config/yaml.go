@@ -60,3 +60,17 @@ func (s *GitlabConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	*s = GitlabConfig(raw)
 	return nil
 }
+
+func (s *CommentConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawCommentConfig CommentConfig
+	raw := rawCommentConfig{
+		GitlabAddress: "https://gitlab.com",
+		GithubAPIURL:  "https://api.github.com",
+	}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*s = CommentConfig(raw)
+	return nil
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/camptocamp/terraboard/compare"
+	"github.com/camptocamp/terraboard/types"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// maxPlanCandidates bounds the number of Plans matched against a new State version
+const maxPlanCandidates = 10
+
+// linkPlan links a newly inserted State version to the Plan it results from:
+// the most recent Plan of its lineage submitted since the previous version,
+// neither rejected nor superseded, whose planned values the State fulfils.
+// If the State fulfils none of them, it is linked to the most recent approved
+// or applied one, flagged as diverged. The linked Plan is moved to the applied
+// status, superseding the other Plans of its lineage waiting to be applied.
+func (db *Database) linkPlan(st types.State) error {
+	if st.Version.ID == 0 || !st.LineageID.Valid {
+		return nil
+	}
+
+	tx := db.Select("id", "created_at", "tf_version", "plan_json", "status").
+		Where("lineage_id = ? AND created_at <= ?", st.LineageID.Int64, st.Version.LastModified).
+		Where("status NOT IN ?", []string{types.PlanRejected, types.PlanSuperseded}).
+		Where("NOT EXISTS (SELECT 1 FROM plan_applies WHERE plan_applies.plan_id = plans.id)")
+
+	prevID, err := db.adjacentStateID(st, false)
+	if err == nil {
+		var prev types.State
+		if err := db.Preload("Version").First(&prev, prevID).Error; err != nil {
+			return err
+		}
+		tx = tx.Where("created_at > ?", prev.Version.LastModified)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	var plans []types.Plan
+	err = tx.Order("created_at desc").Order("id desc").Limit(maxPlanCandidates).Find(&plans).Error
+	if err != nil {
+		return err
+	}
+
+	var link *types.PlanApply
+	var linked types.Plan
+	for _, p := range plans {
+		divergences, err := compare.PlanDivergences(p, st, db.IgnoreRules)
+		if errors.Is(err, compare.ErrNoPlannedValues) {
+			continue
+		} else if err != nil {
+			log.Warnf("Failed to match plan %d with %s: %v", p.ID, st.Path, err)
+			continue
+		}
+
+		apply := types.PlanApply{
+			PlanID:       p.ID,
+			LineageID:    uint(st.LineageID.Int64),
+			StateID:      st.ID,
+			VersionID:    st.Version.VersionID,
+			Serial:       st.Serial,
+			LastModified: st.Version.LastModified,
+			Diverged:     len(divergences) > 0,
+			Divergences:  divergences,
+		}
+		if !apply.Diverged {
+			link, linked = &apply, p
+			break
+		}
+		// A diverged State is only assumed to result from a Plan which was let through
+		if link == nil && (p.Status == types.PlanApproved || p.Status == types.PlanApplied) {
+			link, linked = &apply, p
+		}
+	}
+
+	if link == nil {
+		return nil
+	}
+	if link.Diverged {
+		log.Warnf("State %s version %s diverges from plan %d", st.Path, st.Version.VersionID, link.PlanID)
+	}
+	if linked.Status == types.PlanPending {
+		log.Warnf("State %s version %s results from plan %d, which was not approved", st.Path, st.Version.VersionID, linked.ID)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(link).Error; err != nil {
+			return err
+		}
+		if linked.Status == types.PlanApplied {
+			return nil
+		}
+
+		res := tx.Model(&types.Plan{}).
+			Where("id = ? AND status = ?", linked.ID, linked.Status).
+			Update("status", types.PlanApplied)
+		if res.Error != nil || res.RowsAffected == 0 {
+			// The Plan was reviewed concurrently, it keeps the status it was given
+			return res.Error
+		}
+		review := types.PlanReview{
+			PlanID:  linked.ID,
+			Status:  types.PlanApplied,
+			Comment: fmt.Sprintf("Applied as version %s of %s", st.Version.VersionID, st.Path),
+		}
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+		return supersedePlans(tx, uint(st.LineageID.Int64), linked.ID)
+	})
+}
+
+// GetPlanApply returns the State version resulting from the apply of a Plan,
+// along with its divergences from the Plan
+func (db *Database) GetPlanApply(planID string) (apply types.PlanApply, err error) {
+	err = db.Preload("Divergences", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("id")
+	}).First(&apply, "plan_id = ?", planID).Error
+	return
+}
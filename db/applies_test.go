@@ -0,0 +1,186 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+func TestLinkPlan(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	prevModified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	st := types.State{
+		Path:      "app.tfstate",
+		Version:   types.Version{ID: 2, VersionID: "v2", LastModified: prevModified.Add(time.Hour)},
+		Serial:    5,
+		LineageID: sql.NullInt64{Int64: 1, Valid: true},
+		Modules: []types.Module{{Resources: []types.Resource{
+			{Mode: "managed", Type: "aws_instance", Name: "web", Attributes: []types.Attribute{
+				{Key: "id", Value: `"i-123"`},
+				{Key: "instance_type", Value: `"t3.large"`},
+			}},
+		}}},
+	}
+	st.ID = 2
+
+	mock.ExpectQuery(`^SELECT states.id FROM "states" JOIN versions`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`^SELECT \* FROM "states" WHERE "states"."id" = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version_id"}).AddRow(1, 1))
+	mock.ExpectQuery(`^SELECT \* FROM "versions" WHERE "versions"."id" = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version_id", "last_modified"}).AddRow(1, "v1", prevModified))
+	mock.ExpectQuery(`^SELECT "id","created_at","tf_version","plan_json","status" FROM "plans" WHERE \(lineage_id = \$1 AND created_at <= \$2\) AND status NOT IN \(\$3,\$4\) AND NOT EXISTS \(.+\) AND created_at > \$5 (.+) ORDER BY created_at desc,id desc LIMIT 10`).
+		WithArgs(1, st.Version.LastModified, types.PlanRejected, types.PlanSuperseded, prevModified).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "tf_version", "plan_json", "status"}).
+			AddRow(4, prevModified.Add(50*time.Minute), "1.5.0", `{"format_version":"1.0"}`, types.PlanPending).
+			AddRow(3, prevModified.Add(40*time.Minute), "1.5.0", `{"format_version":"1.0","planned_values":{"root_module":{"resources":[
+				{"mode":"managed","type":"aws_instance","name":"web","values":{"instance_type":"t3.xlarge"}}]}}}`, types.PlanApproved).
+			AddRow(2, prevModified.Add(30*time.Minute), "1.5.0", `{"format_version":"1.0","planned_values":{"root_module":{"resources":[
+				{"mode":"managed","type":"aws_instance","name":"web","values":{"instance_type":"t3.large"}}]}}}`, types.PlanApproved))
+
+	// The matching plan is applied, superseding the other ones
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^INSERT INTO "plan_applies"`).
+		WithArgs(2, 1, 2, "v2", 5, st.Version.LastModified, false).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(`^UPDATE "plans" SET "status"=\$1,"updated_at"=\$2 WHERE \(id = \$3 AND status = \$4\)`).
+		WithArgs(types.PlanApplied, sqlmock.AnyArg(), 2, types.PlanApproved).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`^INSERT INTO "plan_reviews"`).
+		WithArgs(2, sqlmock.AnyArg(), types.PlanApplied, "", "Applied as version v2 of app.tfstate").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`^SELECT "id" FROM "plans"`).
+		WithArgs(1, 2, types.PlanPending, types.PlanApproved).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(4))
+	mock.ExpectExec(`^UPDATE "plans" SET "status"=\$1,"updated_at"=\$2 WHERE id IN \(\$3,\$4\)`).
+		WithArgs(types.PlanSuperseded, sqlmock.AnyArg(), 3, 4).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(`^INSERT INTO "plan_reviews"`).
+		WithArgs(3, sqlmock.AnyArg(), types.PlanSuperseded, "", "Superseded by plan 2",
+			4, sqlmock.AnyArg(), types.PlanSuperseded, "", "Superseded by plan 2").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2).AddRow(3))
+	mock.ExpectCommit()
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	err = db.linkPlan(st)
+	assert.Nil(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestLinkPlan_Diverged(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	st := types.State{
+		Path:      "app.tfstate",
+		Version:   types.Version{ID: 1, VersionID: "v1", LastModified: modified},
+		Serial:    1,
+		LineageID: sql.NullInt64{Int64: 1, Valid: true},
+	}
+	st.ID = 1
+
+	// The diverging pending plan isn't linked, the applied one is
+	mock.ExpectQuery(`^SELECT states.id FROM "states" JOIN versions`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`^SELECT "id","created_at","tf_version","plan_json","status" FROM "plans"`).
+		WithArgs(1, modified, types.PlanRejected, types.PlanSuperseded).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "tf_version", "plan_json", "status"}).
+			AddRow(2, modified.Add(-time.Minute), "1.5.0", `{"format_version":"1.0","planned_values":{"root_module":{"resources":[
+				{"mode":"managed","type":"aws_instance","name":"db","values":{}}]}}}`, types.PlanPending).
+			AddRow(1, modified.Add(-time.Hour), "1.5.0", `{"format_version":"1.0","planned_values":{"root_module":{"resources":[
+				{"mode":"managed","type":"aws_instance","name":"web","values":{}}]}}}`, types.PlanApplied))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^INSERT INTO "plan_applies"`).
+		WithArgs(1, 1, 1, "v1", 1, modified, true).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`^INSERT INTO "plan_divergences"`).
+		WithArgs(1, types.DivergenceMissing, "aws_instance.web", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	err = db.linkPlan(st)
+	assert.Nil(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestLinkPlan_Unmatched(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	st := types.State{
+		Path:      "app.tfstate",
+		Version:   types.Version{ID: 1, VersionID: "v1", LastModified: modified},
+		Serial:    1,
+		LineageID: sql.NullInt64{Int64: 1, Valid: true},
+	}
+	st.ID = 1
+
+	// A state diverging from every pending plan is linked to none of them,
+	// which remain candidates for the next versions
+	mock.ExpectQuery(`^SELECT states.id FROM "states" JOIN versions`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`^SELECT "id","created_at","tf_version","plan_json","status" FROM "plans"`).
+		WithArgs(1, modified, types.PlanRejected, types.PlanSuperseded).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "tf_version", "plan_json", "status"}).
+			AddRow(1, modified.Add(-time.Hour), "1.5.0", `{"format_version":"1.0","planned_values":{"root_module":{"resources":[
+				{"mode":"managed","type":"aws_instance","name":"web","values":{}}]}}}`, types.PlanPending))
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	err = db.linkPlan(st)
+	assert.Nil(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
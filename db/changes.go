@@ -0,0 +1,270 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/camptocamp/terraboard/compare"
+	"github.com/camptocamp/terraboard/types"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// MigrateLineageChanges computes the changes of the lineages whose States
+// were inserted before changes were recorded, and marks them as recorded.
+// It is meant to run in the background: a lineage which fails is logged
+// and computed again on the next start.
+func (db *Database) MigrateLineageChanges() error {
+	var lineageIDs []uint
+	err := db.Model(&types.Lineage{}).
+		Where("changes_recorded = ?", false).
+		Order("id").
+		Pluck("id", &lineageIDs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, id := range lineageIDs {
+		count, err := db.recordLineageTimeline(id)
+		if err == nil {
+			err = db.Model(&types.Lineage{}).Where("id = ?", id).Update("changes_recorded", true).Error
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"lineage_id": id,
+				"error":      err,
+			}).Error("Failed to compute lineage changes")
+			continue
+		}
+		if count > 0 {
+			log.Infof("Computed %d changes of lineage %d", count, id)
+		}
+	}
+	return nil
+}
+
+// lineageStates returns the IDs of the States of a lineage, oldest version first
+func (db *Database) lineageStates(lineageID uint) (ids []uint, err error) {
+	err = db.Table("states").
+		Joins("JOIN versions ON versions.id = states.version_id").
+		Where("states.lineage_id = ? AND states.deleted_at IS NULL", lineageID).
+		Order("versions.last_modified").
+		Order("states.id").
+		Pluck("states.id", &ids).Error
+	return
+}
+
+// recordLineageTimeline computes and stores the changes between
+// all consecutive States of a lineage
+func (db *Database) recordLineageTimeline(lineageID uint) (count int, err error) {
+	ids, err := db.lineageStates(lineageID)
+	if err != nil {
+		return
+	}
+
+	var prev types.State
+	for i, id := range ids {
+		st, err := db.getStateByID(id)
+		if err != nil {
+			return count, err
+		}
+		if i > 0 {
+			if err := db.insertLineageChange(prev, st); err != nil {
+				return count, err
+			}
+			count++
+		}
+		prev = st
+	}
+	return
+}
+
+// getStateByID retrieves a State with its resources from the database by its ID
+func (db *Database) getStateByID(id uint) (st types.State, err error) {
+	err = db.Preload("Version").Preload("Modules").Preload("Modules.Resources").Preload("Modules.Resources.Attributes").
+		Preload("Modules.OutputValues").
+		First(&st, id).Error
+	return
+}
+
+// adjacentStateID returns the ID of the State of the same lineage right before
+// a State (or right after it), ordered by version. It returns sql.ErrNoRows
+// if there is none.
+func (db *Database) adjacentStateID(st types.State, after bool) (id uint, err error) {
+	order := "versions.last_modified DESC, states.id DESC"
+	if after {
+		order = "versions.last_modified, states.id"
+	}
+
+	row := db.Table("states").
+		Select("states.id").
+		Joins("JOIN versions ON versions.id = states.version_id").
+		Where("states.lineage_id = ? AND states.deleted_at IS NULL", st.LineageID).
+		Where(keysetCondition(!after, "versions.last_modified", "states.id"), st.Version.LastModified, st.ID).
+		Order(order).
+		Limit(1).
+		Row()
+	err = row.Scan(&id)
+	return
+}
+
+// recordLineageChanges stores the changes introduced by a newly inserted State,
+// compared with the previous version of its lineage. As versions are not always
+// inserted in order, the changes of the next version are computed again too.
+func (db *Database) recordLineageChanges(st types.State) error {
+	if st.Version.ID == 0 || !st.LineageID.Valid {
+		return nil
+	}
+
+	prevID, err := db.adjacentStateID(st, false)
+	if err == nil {
+		prev, err := db.getStateByID(prevID)
+		if err != nil {
+			return err
+		}
+		if err := db.insertLineageChange(prev, st); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	nextID, err := db.adjacentStateID(st, true)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	next, err := db.getStateByID(nextID)
+	if err != nil {
+		return err
+	}
+	return db.insertLineageChange(st, next)
+}
+
+// insertLineageChange computes and stores the changes between two consecutive
+// States of a lineage, replacing the ones previously computed for the 'to' State
+func (db *Database) insertLineageChange(from, to types.State) error {
+	change, err := lineageChange(from, to)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteLineageChange(tx, to.ID); err != nil {
+			return err
+		}
+		return tx.Create(&change).Error
+	})
+}
+
+// deleteLineageChange removes the changes computed for a State
+func deleteLineageChange(tx *gorm.DB, toStateID uint) error {
+	err := tx.Where("lineage_change_id IN (SELECT id FROM lineage_changes WHERE to_state_id = ?)", toStateID).
+		Delete(&types.LineageChangeResource{}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Where("to_state_id = ?", toStateID).Delete(&types.LineageChange{}).Error
+}
+
+// sortedKeys returns the keys of a map in alphabetical order
+func sortedKeys(m map[string]string) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// lineageChange builds the LineageChange between two consecutive States of a lineage.
+// No attribute is ignored, so that stored changes don't depend on the ignore rules
+// configured when they were recorded.
+func lineageChange(from, to types.State) (change types.LineageChange, err error) {
+	comp, err := compare.Compare(from, to)
+	if err != nil {
+		return
+	}
+
+	change = types.LineageChange{
+		LineageID:     uint(to.LineageID.Int64),
+		FromStateID:   from.ID,
+		ToStateID:     to.ID,
+		FromVersionID: from.Version.VersionID,
+		ToVersionID:   to.Version.VersionID,
+		LastModified:  to.Version.LastModified,
+	}
+
+	for _, addr := range sortedKeys(comp.Differences.OnlyInNew) {
+		change.Resources = append(change.Resources, types.LineageChangeResource{Action: types.ResourceAdded, Address: addr})
+		change.AddedCount++
+	}
+	for _, addr := range sortedKeys(comp.Differences.OnlyInOld) {
+		change.Resources = append(change.Resources, types.LineageChangeResource{Action: types.ResourceRemoved, Address: addr})
+		change.RemovedCount++
+	}
+	changed := make([]string, 0, len(comp.Differences.ResourceDiff))
+	for addr := range comp.Differences.ResourceDiff {
+		changed = append(changed, addr)
+	}
+	sort.Strings(changed)
+	for _, addr := range changed {
+		change.Resources = append(change.Resources, types.LineageChangeResource{Action: types.ResourceChanged, Address: addr})
+		change.ChangedCount++
+	}
+	for _, m := range comp.Differences.Moved {
+		change.Resources = append(change.Resources, types.LineageChangeResource{
+			Action:          types.ResourceMoved,
+			Address:         m.To,
+			PreviousAddress: m.From,
+		})
+		change.MovedCount++
+	}
+	return
+}
+
+// GetLineageChanges returns the changes between consecutive versions of a lineage,
+// most recent first, along with paging information
+func (db *Database) GetLineageChanges(lineage string, p Pagination) (changes []types.LineageChange, info PageInfo, err error) {
+	var total int64
+	err = db.Model(&types.LineageChange{}).
+		Joins("JOIN lineages ON lineages.id = lineage_changes.lineage_id").
+		Where("lineages.value = ?", lineage).
+		Count(&total).Error
+	if err != nil {
+		return
+	}
+	info = p.pageInfo(int(total))
+
+	tx := db.Joins("JOIN lineages ON lineages.id = lineage_changes.lineage_id").
+		Where("lineages.value = ?", lineage).
+		Order("lineage_changes.last_modified desc").
+		Order("lineage_changes.id desc")
+	if p.Cursor != "" {
+		var lastModified time.Time
+		var id uint
+		if err = decodeCursor(p.Cursor, &lastModified, &id); err != nil {
+			return
+		}
+		tx = tx.Where(keysetCondition(true, "lineage_changes.last_modified", "lineage_changes.id"), lastModified, id)
+	}
+
+	err = tx.Preload("Resources", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("id")
+	}).
+		Limit(p.PageSize + 1).
+		Offset(p.offset()).
+		Find(&changes).Error
+	if err != nil {
+		return
+	}
+
+	if len(changes) > p.PageSize {
+		changes = changes[:p.PageSize]
+		last := changes[len(changes)-1]
+		info.NextCursor, err = encodeCursor(last.LastModified, last.ID)
+	}
+	return
+}
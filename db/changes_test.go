@@ -0,0 +1,126 @@
+package db
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+func TestLineageChange(t *testing.T) {
+	lastModified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	from := types.State{
+		Path:      "terraform.tfstate",
+		Version:   types.Version{VersionID: "v1"},
+		LineageID: sql.NullInt64{Int64: 3, Valid: true},
+		Modules: []types.Module{
+			{
+				Path: "",
+				Resources: []types.Resource{
+					{Mode: "managed", Type: "aws_instance", Name: "web", Attributes: []types.Attribute{
+						{Key: "id", Value: `"i-123"`},
+						{Key: "instance_type", Value: `"t3.small"`},
+					}},
+					{Mode: "managed", Type: "aws_s3_bucket", Name: "logs", Attributes: []types.Attribute{
+						{Key: "id", Value: `"logs"`},
+					}},
+				},
+			},
+		},
+	}
+	from.ID = 1
+	to := types.State{
+		Path:      "terraform.tfstate",
+		Version:   types.Version{VersionID: "v2", LastModified: lastModified},
+		LineageID: sql.NullInt64{Int64: 3, Valid: true},
+		Modules: []types.Module{
+			{
+				Path: "",
+				Resources: []types.Resource{
+					{Mode: "managed", Type: "aws_instance", Name: "web", Attributes: []types.Attribute{
+						{Key: "id", Value: `"i-123"`},
+						{Key: "instance_type", Value: `"t3.large"`},
+					}},
+					{Mode: "managed", Type: "aws_sqs_queue", Name: "jobs", Attributes: []types.Attribute{
+						{Key: "id", Value: `"jobs"`},
+					}},
+				},
+			},
+		},
+	}
+	to.ID = 2
+
+	change, err := lineageChange(from, to)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := types.LineageChange{
+		LineageID:     3,
+		FromStateID:   1,
+		ToStateID:     2,
+		FromVersionID: "v1",
+		ToVersionID:   "v2",
+		LastModified:  lastModified,
+		AddedCount:    1,
+		RemovedCount:  1,
+		ChangedCount:  1,
+		Resources: []types.LineageChangeResource{
+			{Action: types.ResourceAdded, Address: "aws_sqs_queue.jobs"},
+			{Action: types.ResourceRemoved, Address: "aws_s3_bucket.logs"},
+			{Action: types.ResourceChanged, Address: "aws_instance.web"},
+		},
+	}
+	if !reflect.DeepEqual(change, expected) {
+		t.Fatalf("Expected %v, got %v", expected, change)
+	}
+}
+
+func TestMigrateLineageChanges(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	// A lineage with a single version has no changes, but is marked as recorded
+	mock.ExpectQuery(`^SELECT "id" FROM "lineages" WHERE changes_recorded = \$1 AND "lineages"."deleted_at" IS NULL ORDER BY id`).
+		WithArgs(false).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectQuery(`^SELECT "states"."id" FROM "states" JOIN versions (.+) WHERE states.lineage_id = \$1`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery(`^SELECT \* FROM "states" WHERE "states"."id" = \$1`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery(`^SELECT \* FROM "modules" WHERE "modules"."state_id" = \$1`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE "lineages" SET "changes_recorded"=\$1,"updated_at"=\$2 WHERE id = \$3`).
+		WithArgs(true, sqlmock.AnyArg(), 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	err = db.MigrateLineageChanges()
+	assert.Nil(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
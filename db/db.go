@@ -5,14 +5,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
-	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/camptocamp/terraboard/compare"
 	"github.com/camptocamp/terraboard/config"
 	"github.com/camptocamp/terraboard/internal/terraform/addrs"
 	"github.com/camptocamp/terraboard/internal/terraform/states"
 	"github.com/camptocamp/terraboard/internal/terraform/states/statefile"
+	"github.com/camptocamp/terraboard/policy"
+	"github.com/camptocamp/terraboard/risk"
 	"github.com/camptocamp/terraboard/state"
 	"github.com/camptocamp/terraboard/types"
 	log "github.com/sirupsen/logrus"
@@ -27,13 +30,23 @@ import (
 type Database struct {
 	*gorm.DB
 	lock sync.Mutex
+	// MaskSensitivePlans redacts the sensitive values of Plans before storing them
+	MaskSensitivePlans bool
+	// TrustProxyAuth takes the identity of Plan reviewers and SavedSearch owners
+	// from the authentication proxy headers
+	TrustProxyAuth bool
+	// RiskRules classify the risk of Plans
+	RiskRules []risk.Rule
+	// Policies are evaluated against Plans when they are submitted
+	Policies []policy.Policy
+	// IgnoreRules exclude attributes from State and Plan comparisons
+	IgnoreRules []compare.IgnoreRule
+	// Comment holds the GitLab and GitHub parameters used to comment Plans
+	Comment config.CommentConfig
 }
 
-var pageSize = 20
-
-// Init setups up the Database and a pointer to it
-func Init(config config.DBConfig, debug bool) *Database {
-	var err error
+// Open connects to the Database, without migrating it
+func Open(config config.DBConfig) (*Database, error) {
 	connString := fmt.Sprintf(
 		"host=%s port=%d user=%s dbname=%s sslmode=%s password=%s",
 		config.Host,
@@ -46,12 +59,24 @@ func Init(config config.DBConfig, debug bool) *Database {
 	db, err := gorm.Open(postgres.Open(connString), &gorm.Config{
 		Logger: &LogrusGormLogger,
 	})
+	if err != nil {
+		return nil, err
+	}
+	return &Database{DB: db}, nil
+}
+
+// Init setups up the Database and a pointer to it
+func Init(config config.DBConfig, debug bool) *Database {
+	d, err := Open(config)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// The mode of data resources is set once, when lineages start recording it
+	migrateModes := !d.Migrator().HasColumn(&types.Lineage{}, "modes_set")
+
 	log.Infof("Automigrate")
-	err = db.AutoMigrate(
+	err = d.AutoMigrate(
 		&types.Lineage{},
 		&types.Version{},
 		&types.State{},
@@ -71,19 +96,39 @@ func Init(config config.DBConfig, debug bool) *Database {
 		&types.PlanStateResourceAttribute{},
 		&types.PlanStateValue{},
 		&types.Change{},
+		&types.SavedSearch{},
+		&types.SavedSearchResult{},
+		&types.LineageChange{},
+		&types.LineageChangeResource{},
+		&types.PlanSummary{},
+		&types.PlanSummaryResourceType{},
+		&types.PlanReview{},
+		&types.PlanApply{},
+		&types.PlanDivergence{},
+		&types.APIToken{},
+		&types.APITokenScope{},
+		&types.PlanPolicyResult{},
+		&types.PlanPolicyMessage{},
 	)
 	if err != nil {
 		log.Fatalf("Migration failed: %v\n", err)
 	}
 
 	if debug {
-		db.Config.Logger.LogMode(logger.Info)
+		d.Config.Logger.LogMode(logger.Info)
 	}
 
-	d := &Database{DB: db}
 	if err = d.MigrateLineage(); err != nil {
 		log.Fatalf("Lineage migration failed: %v\n", err)
 	}
+	if err = d.MigrateSearchIndex(); err != nil {
+		log.Fatalf("Search index migration failed: %v\n", err)
+	}
+	if migrateModes {
+		if err = d.MigrateResourceModes(); err != nil {
+			log.Fatalf("Resource modes migration failed: %v\n", err)
+		}
+	}
 
 	return d
 }
@@ -123,7 +168,8 @@ func (db *Database) stateS3toDB(sf *statefile.File, path string, versionID strin
 	// If so, it recovers its ID otherwise it inserts it at the same time as the state
 	var lineage types.Lineage
 	db.lock.Lock()
-	err = db.FirstOrCreate(&lineage, types.Lineage{Value: sf.Lineage}).Error
+	// The changes and resource modes of a new lineage are recorded as its versions are inserted
+	err = db.Attrs(types.Lineage{ChangesRecorded: true, ModesSet: true}).FirstOrCreate(&lineage, types.Lineage{Value: sf.Lineage}).Error
 	if err != nil || lineage.ID == 0 {
 		log.WithField("error", err).
 			Error("Unknown error in stateS3toDB during lineage finding")
@@ -146,6 +192,7 @@ func (db *Database) stateS3toDB(sf *statefile.File, path string, versionID strin
 		for _, r := range m.Resources {
 			for index, i := range r.Instances {
 				res := types.Resource{
+					Mode:       getResourceMode(r.Addr.Resource.Mode),
 					Type:       r.Addr.Resource.Type,
 					Name:       r.Addr.Resource.Name,
 					Index:      getResourceIndex(index),
@@ -183,6 +230,17 @@ func getResourceIndex(index addrs.InstanceKey) string {
 	return ""
 }
 
+// getResourceMode transforms an addrs.ResourceMode into its Terraform JSON representation
+func getResourceMode(mode addrs.ResourceMode) string {
+	switch mode {
+	case addrs.ManagedResourceMode:
+		return "managed"
+	case addrs.DataResourceMode:
+		return "data"
+	}
+	return ""
+}
+
 func marshalAttributeValues(src *states.ResourceInstanceObjectSrc) (attrs []types.Attribute) {
 	vals := make(attributeValues)
 	if src == nil {
@@ -214,6 +272,18 @@ func (db *Database) InsertState(path string, versionID string, sf *statefile.Fil
 	st, err := db.stateS3toDB(sf, path, versionID)
 	if err == nil {
 		db.Create(&st)
+		if err := db.setResourceModes(st); err != nil {
+			return fmt.Errorf("failed to set the mode of %s previous data resources: %v", path, err)
+		}
+		if err := db.indexStateResources(st.ID); err != nil {
+			return fmt.Errorf("failed to index %s resources for full-text search: %v", path, err)
+		}
+		if err := db.recordLineageChanges(st); err != nil {
+			return fmt.Errorf("failed to record %s changes: %v", path, err)
+		}
+		if err := db.linkPlan(st); err != nil {
+			return fmt.Errorf("failed to link %s to its plan: %v", path, err)
+		}
 	}
 	return nil
 }
@@ -317,17 +387,13 @@ func (db *Database) KnownVersions() (versions []string) {
 	return
 }
 
-// SearchAttribute returns a slice of SearchResult given a query
-// The query might contain parameters 'type', 'name', 'key', 'value' and 'tf_version'
-// SearchAttribute also returns paging information: the page number and the total results
-func (db *Database) SearchAttribute(query url.Values) (results []types.SearchResult, page int, total int) {
-	log.WithFields(log.Fields{
-		"query": query,
-	}).Info("Searching for attribute with query")
-
+// searchAttributeFrom builds the FROM clause and WHERE conditions shared by
+// attribute search requests, along with their parameters.
+// The query might contain parameters 'versionid', 'type', 'name', 'key', 'value',
+// 'tf_version' and 'lineage_value'
+func searchAttributeFrom(query url.Values) (sqlQuery string, where []string, params []interface{}) {
 	targetVersion := string(query.Get("versionid"))
 
-	sqlQuery := ""
 	if targetVersion == "" {
 		sqlQuery += " FROM (SELECT states.path, max(states.serial) as mx FROM states GROUP BY states.path) t" +
 			" JOIN states ON t.path = states.path AND t.mx = states.serial"
@@ -341,8 +407,6 @@ func (db *Database) SearchAttribute(query url.Values) (results []types.SearchRes
 		" JOIN lineages ON lineages.id = states.lineage_id" +
 		" JOIN versions ON states.version_id = versions.id"
 
-	var where []string
-	var params []interface{}
 	if targetVersion != "" && targetVersion != "*" {
 		// filter by version unless we want all (*) or most recent ("")
 		where = append(where, "states.version_id = ?")
@@ -379,39 +443,168 @@ func (db *Database) SearchAttribute(query url.Values) (results []types.SearchRes
 		params = append(params, fmt.Sprintf("%%%s%%", v))
 	}
 
-	if len(where) > 0 {
-		sqlQuery += " WHERE " + strings.Join(where, " AND ")
+	return
+}
+
+// whereClause joins WHERE conditions into a WHERE clause
+func whereClause(where []string) string {
+	if len(where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(where, " AND ")
+}
+
+// searchAttributeQuery builds the FROM and WHERE clauses shared by
+// attribute search requests, along with their parameters.
+func searchAttributeQuery(query url.Values) (sqlQuery string, params []interface{}) {
+	sqlQuery, where, params := searchAttributeFrom(query)
+	return sqlQuery + whereClause(where), params
+}
+
+// searchAttributeSelect is the SELECT clause of attribute search requests,
+// matching the types.SearchResult structure
+const searchAttributeSelect = "SELECT states.path, versions.version_id, states.tf_version, states.serial, lineages.value as lineage_value, modules.path as module_path, resources.type, resources.name, resources.index, attributes.key, attributes.value, attributes.id as attribute_id"
+
+// searchAttributeOrder is the ORDER BY clause of attribute search requests
+const searchAttributeOrder = " ORDER BY states.path, states.serial, lineage_value, modules.path, resources.type, resources.name, resources.index, attributes.key, attributes.id"
+
+// searchAttributeKey lists the columns of the searchAttributeOrder sort key,
+// used to resume a search after a cursor
+var searchAttributeKey = []string{"states.path", "states.serial", "lineages.value", "modules.path",
+	"resources.type", "resources.name", "resources.index", "attributes.key", "attributes.id"}
+
+// searchResultCursor returns the cursor resuming a search after a result
+func searchResultCursor(r types.SearchResult) (string, error) {
+	return encodeCursor(r.Path, r.Serial, r.LineageValue, r.ModulePath,
+		r.ResourceType, r.ResourceName, r.ResourceIndex, r.AttributeKey, r.AttributeID)
+}
+
+// SearchAttribute returns a slice of SearchResult given a query
+// The query might contain parameters 'type', 'name', 'key', 'value' and 'tf_version',
+// as well as the paging parameters 'page_size' and 'cursor' or 'page'.
+// SearchAttribute also returns paging information.
+func (db *Database) SearchAttribute(query url.Values) (results []types.SearchResult, info PageInfo, err error) {
+	log.WithFields(log.Fields{
+		"query": query,
+	}).Info("Searching for attribute with query")
+
+	p := NewPagination(query)
+	sqlQuery, where, params := searchAttributeFrom(query)
+
+	if p.Cursor != "" {
+		var r types.SearchResult
+		if err = decodeCursor(p.Cursor, &r.Path, &r.Serial, &r.LineageValue, &r.ModulePath,
+			&r.ResourceType, &r.ResourceName, &r.ResourceIndex, &r.AttributeKey, &r.AttributeID); err != nil {
+			return
+		}
+		where = append(where, keysetCondition(false, searchAttributeKey...))
+		params = append(params, r.Path, r.Serial, r.LineageValue, r.ModulePath,
+			r.ResourceType, r.ResourceName, r.ResourceIndex, r.AttributeKey, r.AttributeID)
 	}
 
 	// Count everything
-	row := db.Raw("SELECT count(*)"+sqlQuery, params...).Row()
-	if err := row.Scan(&total); err != nil {
-		log.Error(err.Error())
+	total, err := db.countSearchAttribute(query)
+	if err != nil {
+		return
 	}
+	info = p.pageInfo(total)
 
-	// Now get results
+	// Now get results, fetching one more to know whether there is a next page
 	// gorm doesn't support subqueries...
-	sql := "SELECT states.path, versions.version_id, states.tf_version, states.serial, lineages.value as lineage_value, modules.path as module_path, resources.type, resources.name, resources.index, attributes.key, attributes.value" +
-		sqlQuery +
-		" ORDER BY states.path, states.serial, lineage_value, modules.path, resources.type, resources.name, resources.index, attributes.key" +
-		" LIMIT ?"
+	sql := searchAttributeSelect + sqlQuery + whereClause(where) + searchAttributeOrder + " LIMIT ? OFFSET ?"
+	params = append(params, p.PageSize+1, p.offset())
 
-	params = append(params, pageSize)
+	if err = db.Raw(sql, params...).Find(&results).Error; err != nil {
+		return
+	}
 
-	if v := string(query.Get("page")); v != "" {
-		page, _ = strconv.Atoi(v) // TODO: err
-		o := (page - 1) * pageSize
-		sql += " OFFSET ?"
-		params = append(params, o)
-	} else {
-		page = 1
+	if len(results) > p.PageSize {
+		results = results[:p.PageSize]
+		info.NextCursor, err = searchResultCursor(results[len(results)-1])
 	}
+	return
+}
+
+// countSearchAttribute returns the total number of results of a SearchAttribute query
+func (db *Database) countSearchAttribute(query url.Values) (total int, err error) {
+	sqlQuery, params := searchAttributeQuery(query)
+	row := db.Raw("SELECT count(*)"+sqlQuery, params...).Row()
+	err = row.Scan(&total)
+	return
+}
 
-	db.Raw(sql, params...).Find(&results)
+// SearchAttributeFacets returns the number of results of a SearchAttribute query
+// per resource type, Terraform version, lineage and module path
+func (db *Database) SearchAttributeFacets(query url.Values) (facets types.SearchFacets, err error) {
+	sqlQuery, params := searchAttributeQuery(query)
+
+	// Compute all facets in a single pass using grouping sets,
+	// GROUPING() tells which set each row belongs to
+	facetsSQL := "SELECT GROUPING(resources.type, states.tf_version, lineages.value, modules.path) AS facet," +
+		" COALESCE(resources.type, states.tf_version, lineages.value, modules.path) AS value, count(*) AS count" +
+		sqlQuery +
+		" GROUP BY GROUPING SETS ((resources.type), (states.tf_version), (lineages.value), (modules.path))" +
+		" ORDER BY count DESC, value"
+
+	rows, err := db.Raw(facetsSQL, params...).Rows()
+	if err != nil {
+		return facets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var facet int
+		// Resources may have no module or type, grouped under a NULL value
+		var value sql.NullString
+		var fc types.FacetCount
+		if err = rows.Scan(&facet, &value, &fc.Count); err != nil {
+			return
+		}
+		fc.Value = value.String
+
+		switch facet {
+		case 0b0111:
+			facets.ResourceTypes = append(facets.ResourceTypes, fc)
+		case 0b1011:
+			facets.TFVersions = append(facets.TFVersions, fc)
+		case 0b1101:
+			facets.Lineages = append(facets.Lineages, fc)
+		case 0b1110:
+			facets.ModulePaths = append(facets.ModulePaths, fc)
+		}
+	}
 
+	err = rows.Err()
 	return
 }
 
+// StreamSearchAttribute runs the same search as SearchAttribute, without paging,
+// and calls fn on each result as it is read from the Database
+func (db *Database) StreamSearchAttribute(query url.Values, fn func(types.SearchResult) error) error {
+	log.WithFields(log.Fields{
+		"query": query,
+	}).Info("Streaming attribute search with query")
+
+	sqlQuery, params := searchAttributeQuery(query)
+	rows, err := db.Raw(searchAttributeSelect+sqlQuery+searchAttributeOrder, params...).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result types.SearchResult
+		if err := db.ScanRows(rows, &result); err != nil {
+			return err
+		}
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
 // ListStatesVersions returns a map of Version IDs to a slice of State paths
 // from the Database
 func (db *Database) ListStatesVersions() (statesVersions map[string][]string) {
@@ -468,37 +661,80 @@ func (db *Database) ListTerraformVersionsWithCount(query url.Values) (results []
 	return
 }
 
+// stateStatsSelect is the request listing the latest State of each Lineage
+// along with its resource count
+const stateStatsSelect = "SELECT t.path, lineages.value as lineage_value, t.serial, t.tf_version, t.version_id, t.last_modified, count(resources.*) as resource_count" +
+	" FROM (SELECT DISTINCT ON(states.lineage_id) states.id, states.lineage_id, states.path, states.serial, states.tf_version, versions.version_id, versions.last_modified FROM states JOIN versions ON versions.id = states.version_id ORDER BY states.lineage_id, versions.last_modified DESC) t" +
+	" JOIN modules ON modules.state_id = t.id" +
+	" JOIN resources ON resources.module_id = modules.id" +
+	" JOIN lineages ON lineages.id = t.lineage_id" +
+	" GROUP BY t.path, lineages.value, t.serial, t.tf_version, t.version_id, t.last_modified"
+
+// stateStatsOrder sorts State stats most recently modified first
+const stateStatsOrder = " ORDER BY last_modified DESC, lineage_value DESC"
+
+// stateStatsQuery lists all State stats, most recently modified first
+const stateStatsQuery = stateStatsSelect + stateStatsOrder
+
 // ListStateStats returns a slice of StateStat, along with paging information
-func (db *Database) ListStateStats(query url.Values) (states []types.StateStat, page int, total int) {
+// The query might contain the paging parameters 'page_size' and 'cursor' or 'page'
+func (db *Database) ListStateStats(query url.Values) (states []types.StateStat, info PageInfo, err error) {
+	p := NewPagination(query)
+
+	var total int
 	row := db.Raw("SELECT count(*) FROM (SELECT DISTINCT lineage_id FROM states) AS t").Row()
-	if err := row.Scan(&total); err != nil {
-		log.Error(err.Error())
+	if err = row.Scan(&total); err != nil {
+		return
 	}
+	info = p.pageInfo(total)
 
-	var paginationQuery string
+	sql := "SELECT * FROM (" + stateStatsSelect + ") AS s"
 	var params []interface{}
-	if v := string(query.Get("page")); v != "" {
-		page, _ = strconv.Atoi(v) // TODO: err
-		offset := (page - 1) * pageSize
-		params = append(params, offset)
-		paginationQuery = " LIMIT 20 OFFSET ?"
-	} else {
-		page = -1
+	if p.Cursor != "" {
+		var last types.StateStat
+		if err = decodeCursor(p.Cursor, &last.LastModified, &last.LineageValue); err != nil {
+			return
+		}
+		sql += " WHERE " + keysetCondition(true, "last_modified", "lineage_value")
+		params = append(params, last.LastModified, last.LineageValue)
 	}
+	sql += stateStatsOrder + " LIMIT ? OFFSET ?"
+	params = append(params, p.PageSize+1, p.offset())
 
-	sql := "SELECT t.path, lineages.value as lineage_value, t.serial, t.tf_version, t.version_id, t.last_modified, count(resources.*) as resource_count" +
-		" FROM (SELECT DISTINCT ON(states.lineage_id) states.id, states.lineage_id, states.path, states.serial, states.tf_version, versions.version_id, versions.last_modified FROM states JOIN versions ON versions.id = states.version_id ORDER BY states.lineage_id, versions.last_modified DESC) t" +
-		" JOIN modules ON modules.state_id = t.id" +
-		" JOIN resources ON resources.module_id = modules.id" +
-		" JOIN lineages ON lineages.id = t.lineage_id" +
-		" GROUP BY t.path, lineages.value, t.serial, t.tf_version, t.version_id, t.last_modified" +
-		" ORDER BY last_modified DESC" +
-		paginationQuery
+	if err = db.Raw(sql, params...).Find(&states).Error; err != nil {
+		return
+	}
 
-	db.Raw(sql, params...).Find(&states)
+	if len(states) > p.PageSize {
+		states = states[:p.PageSize]
+		last := states[len(states)-1]
+		info.NextCursor, err = encodeCursor(last.LastModified, last.LineageValue)
+	}
 	return
 }
 
+// StreamStateStats calls fn on the StateStat of every Lineage,
+// as they are read from the Database
+func (db *Database) StreamStateStats(fn func(types.StateStat) error) error {
+	rows, err := db.Raw(stateStatsQuery).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stat types.StateStat
+		if err := db.ScanRows(rows, &stat); err != nil {
+			return err
+		}
+		if err := fn(stat); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
 // listField is a wrapper utility method to list distinct values in Database tables.
 func (db *Database) listField(table, field string) (results []string, err error) {
 	rows, err := db.Table(table).Select(fmt.Sprintf("DISTINCT %s", field)).Rows()
@@ -594,12 +830,22 @@ func (db *Database) ListAttributeKeys(resourceType string) (results []string, er
 	return
 }
 
-// InsertPlan inserts a Terraform plan with associated information in the Database
-func (db *Database) InsertPlan(plan []byte) error {
+// InsertPlan inserts a Terraform plan with associated information in the Database,
+// provided apiToken is allowed to submit Plans for its lineage.
+// Its sensitive values are masked if MaskSensitivePlans is set.
+// The new Plan supersedes the Plans of its lineage waiting to be applied.
+func (db *Database) InsertPlan(plan []byte, apiToken types.APIToken) error {
+	if err := validatePlan(plan); err != nil {
+		return err
+	}
+
 	var lineage types.Lineage
 	if err := json.Unmarshal(plan, &lineage); err != nil {
 		return err
 	}
+	if err := db.checkTokenScope(apiToken, lineage.Value); err != nil {
+		return err
+	}
 
 	// Recover lineage from db if it's already exists or insert it
 	res := db.FirstOrCreate(&lineage, lineage)
@@ -611,61 +857,105 @@ func (db *Database) InsertPlan(plan []byte) error {
 	if err := json.Unmarshal(plan, &p); err != nil {
 		return err
 	}
+	p.LineageID = lineage.ID
+	return db.createPlan(p, apiToken)
+}
+
+// createPlan stores a new Plan submitted by apiToken, from its JSON representation:
+// the configured policies are evaluated against it, its sensitive values are masked
+// if MaskSensitivePlans is set, and its changes are summarized with their risk.
+// The new Plan supersedes the Plans of its lineage waiting to be applied.
+func (db *Database) createPlan(p types.Plan, apiToken types.APIToken) (err error) {
+	if p.PolicyResults, err = policy.Evaluate(db.Policies, p.PlanJSON); err != nil {
+		return err
+	}
+	if db.MaskSensitivePlans {
+		if err := p.Redact(); err != nil {
+			return err
+		}
+	}
 	if err := json.Unmarshal(p.PlanJSON, &p.ParsedPlan); err != nil {
 		return err
 	}
 
-	p.LineageID = lineage.ID
-	return db.Create(&p).Error
+	p.Status = types.PlanPending
+	p.SubmittedBy = apiToken.Identity()
+	summary := risk.Summarize(p.ParsedPlan, db.RiskRules)
+	p.Summary = &summary
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&p).Error; err != nil {
+			return err
+		}
+		return supersedePlans(tx, p.LineageID, p.ID)
+	})
 }
 
-// GetPlansSummary retrieves a summary of all Plans of a lineage from the database
-func (db *Database) GetPlansSummary(lineage, limitStr, pageStr string) (plans []types.Plan, page int, total int) {
-	var whereClause []interface{}
+// plansPage returns a query listing the Plans of a lineage
+// (all of them if lineage is empty), most recent first, restricted to a page.
+// plansPage also returns paging information, without the next cursor.
+func (db *Database) plansPage(lineage string, p Pagination) (tx *gorm.DB, info PageInfo, err error) {
 	var whereClauseTotal string
+	tx = db.Joins("Lineage")
 	if lineage != "" {
-		whereClause = append(whereClause, `"Lineage"."value" = ?`, lineage)
+		tx = tx.Where(`"Lineage"."value" = ?`, lineage)
 		whereClauseTotal = ` JOIN lineages on lineages.id=t.lineage_id WHERE lineages.value = ?`
 	}
 
+	var total int
 	row := db.Raw("SELECT count(*) FROM plans AS t"+whereClauseTotal, lineage).Row()
-	if err := row.Scan(&total); err != nil {
-		log.Error(err.Error())
+	if err = row.Scan(&total); err != nil {
+		return
 	}
+	info = p.pageInfo(total)
 
-	var limit int
-	if limitStr == "" {
-		limit = -1
-	} else {
-		var err error
-		limit, err = strconv.Atoi(limitStr)
-		if err != nil {
-			log.Warnf("GetPlans limit ignored: %v", err)
-			limit = -1
+	if p.Cursor != "" {
+		var createdAt time.Time
+		var id uint
+		if err = decodeCursor(p.Cursor, &createdAt, &id); err != nil {
+			return
 		}
+		tx = tx.Where(keysetCondition(true, `"plans"."created_at"`, `"plans"."id"`), createdAt, id)
 	}
 
-	var offset int
-	if pageStr == "" {
-		offset = -1
-	} else {
-		var err error
-		page, err = strconv.Atoi(pageStr)
-		if err != nil {
-			log.Warnf("GetPlans offset ignored: %v", err)
-		} else {
-			offset = (page - 1) * pageSize
-		}
+	tx = tx.Order(`"plans"."created_at" desc`).
+		Order(`"plans"."id" desc`).
+		Limit(p.PageSize + 1).
+		Offset(p.offset())
+	return
+}
+
+// planCursor returns the next cursor of a page of Plans, and trims
+// the extra Plan fetched to detect it
+func planCursor(plans []types.Plan, info PageInfo) ([]types.Plan, string, error) {
+	if len(plans) <= info.PageSize {
+		return plans, "", nil
+	}
+	plans = plans[:info.PageSize]
+	last := plans[len(plans)-1]
+	cursor, err := encodeCursor(last.CreatedAt, last.ID)
+	return plans, cursor, err
+}
+
+// GetPlansSummary retrieves a summary of all Plans of a lineage from the database
+func (db *Database) GetPlansSummary(lineage string, p Pagination) (plans []types.Plan, info PageInfo, err error) {
+	tx, info, err := db.plansPage(lineage, p)
+	if err != nil {
+		return
 	}
 
-	db.Select(`"plans"."id"`, `"plans"."created_at"`, `"plans"."updated_at"`, `"plans"."tf_version"`,
-		`"plans"."git_remote"`, `"plans"."git_commit"`, `"plans"."ci_url"`, `"plans"."source"`, `"plans"."exit_code"`).
-		Joins("Lineage").
-		Order("created_at desc").
-		Limit(limit).
-		Offset(offset).
-		Find(&plans, whereClause...)
+	err = tx.Select(`"plans"."id"`, `"plans"."created_at"`, `"plans"."updated_at"`, `"plans"."tf_version"`,
+		`"plans"."git_remote"`, `"plans"."git_commit"`, `"plans"."ci_url"`, `"plans"."source"`, `"plans"."exit_code"`,
+		`"plans"."status"`).
+		Preload("Summary").
+		Preload("Summary.ResourceTypes", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("type")
+		}).
+		Find(&plans).Error
+	if err != nil {
+		return
+	}
 
+	plans, info.NextCursor, err = planCursor(plans, info)
 	return
 }
 
@@ -691,52 +981,32 @@ func (db *Database) GetPlan(id string) (plans types.Plan) {
 		Preload("ParsedPlan.PlanState.PlanStateValue.PlanStateModule.PlanStateResources").
 		Preload("ParsedPlan.PlanState.PlanStateValue.PlanStateModule.PlanStateResources.PlanStateResourceAttributes").
 		Preload("ParsedPlan.PlanState.PlanStateValue.PlanStateModule.PlanStateModules").
+		Preload("PolicyResults", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("policy")
+		}).
+		Preload("PolicyResults.Messages", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("id")
+		}).
 		Find(&plans, `"plans"."id" = ?`, id)
 
 	return
 }
 
-// GetPlans retrieves all Plan of a lineage from the database
-func (db *Database) GetPlans(lineage, limitStr, pageStr string) (plans []types.Plan, page int, total int) {
-	var whereClause []interface{}
-	var whereClauseTotal string
-	if lineage != "" {
-		whereClause = append(whereClause, `"Lineage"."value" = ?`, lineage)
-		whereClauseTotal = ` JOIN lineages on lineages.id=t.lineage_id WHERE lineages.value = ?`
-	}
-
-	row := db.Raw("SELECT count(*) FROM plans AS t"+whereClauseTotal, lineage).Row()
-	if err := row.Scan(&total); err != nil {
-		log.Error(err.Error())
-	}
-
-	var limit int
-	if limitStr == "" {
-		limit = -1
-	} else {
-		var err error
-		limit, err = strconv.Atoi(limitStr)
-		if err != nil {
-			log.Warnf("GetPlans limit ignored: %v", err)
-			limit = -1
-		}
-	}
+// GetPlanJSON retrieves a specific Plan by his ID from the database,
+// with its lineage and JSON representation but without its parsed content
+func (db *Database) GetPlanJSON(id string) (plan types.Plan, err error) {
+	err = db.Joins("Lineage").First(&plan, `"plans"."id" = ?`, id).Error
+	return
+}
 
-	var offset int
-	if pageStr == "" {
-		offset = -1
-	} else {
-		var err error
-		page, err = strconv.Atoi(pageStr)
-		if err != nil {
-			log.Warnf("GetPlans offset ignored: %v", err)
-		} else {
-			offset = (page - 1) * pageSize
-		}
+// GetPlans retrieves all Plan of a lineage from the database
+func (db *Database) GetPlans(lineage string, p Pagination) (plans []types.Plan, info PageInfo, err error) {
+	tx, info, err := db.plansPage(lineage, p)
+	if err != nil {
+		return
 	}
 
-	db.Joins("Lineage").
-		Preload("ParsedPlan").
+	err = tx.Preload("ParsedPlan").
 		Preload("ParsedPlan.PlanStateValue").
 		Preload("ParsedPlan.PlanStateValue.PlanStateOutputs").
 		Preload("ParsedPlan.PlanStateValue.PlanStateModule").
@@ -755,31 +1025,65 @@ func (db *Database) GetPlans(lineage, limitStr, pageStr string) (plans []types.P
 		Preload("ParsedPlan.PlanState.PlanStateValue.PlanStateModule.PlanStateResources").
 		Preload("ParsedPlan.PlanState.PlanStateValue.PlanStateModule.PlanStateResources.PlanStateResourceAttributes").
 		Preload("ParsedPlan.PlanState.PlanStateValue.PlanStateModule.PlanStateModules").
-		Order("created_at desc").
-		Limit(limit).
-		Offset(offset).
-		Find(&plans, whereClause...)
+		Preload("PolicyResults", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("policy")
+		}).
+		Preload("PolicyResults.Messages", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("id")
+		}).
+		Find(&plans).Error
+	if err != nil {
+		return
+	}
 
+	plans, info.NextCursor, err = planCursor(plans, info)
 	return
 }
 
-// GetLineages retrieves all Lineage from the database
-func (db *Database) GetLineages(limitStr string) (lineages []types.Lineage) {
-	var limit int
-	if limitStr == "" {
-		limit = -1
-	} else {
-		var err error
-		limit, err = strconv.Atoi(limitStr)
-		if err != nil {
-			log.Warnf("GetLineages limit ignored: %v", err)
-			limit = -1
+// GetLineages retrieves a page of the Lineages from the database, most recent first
+func (db *Database) GetLineages(p Pagination) (lineages []types.Lineage, info PageInfo, err error) {
+	var total int64
+	if err = db.Model(&types.Lineage{}).Count(&total).Error; err != nil {
+		return
+	}
+	info = p.pageInfo(int(total))
+
+	tx := db.Order("created_at desc").Order("id desc")
+	if p.Cursor != "" {
+		var createdAt time.Time
+		var id uint
+		if err = decodeCursor(p.Cursor, &createdAt, &id); err != nil {
+			return
 		}
+		tx = tx.Where(keysetCondition(true, "created_at", "id"), createdAt, id)
+	}
+
+	if err = tx.Limit(p.PageSize + 1).Offset(p.offset()).Find(&lineages).Error; err != nil {
+		return
+	}
+
+	if len(lineages) > p.PageSize {
+		lineages = lineages[:p.PageSize]
+		last := lineages[len(lineages)-1]
+		info.NextCursor, err = encodeCursor(last.CreatedAt, last.ID)
 	}
+	return
+}
+
+// LineageStateBySerial returns the State version of a Lineage with a given serial.
+// Only its serial is set if no such version was synced.
+func (db *Database) LineageStateBySerial(lineage string, serial int64) (stat types.StateStat, err error) {
+	sqlQuery := "SELECT states.path, lineages.value as lineage_value, states.tf_version, states.serial," +
+		" versions.version_id, versions.last_modified" +
+		" FROM states" +
+		" JOIN lineages ON lineages.id = states.lineage_id" +
+		" JOIN versions ON versions.id = states.version_id" +
+		" WHERE states.deleted_at IS NULL AND lineages.value = ? AND states.serial = ?" +
+		" ORDER BY versions.last_modified DESC" +
+		" LIMIT 1"
 
-	db.Order("created_at desc").
-		Limit(limit).
-		Find(&lineages)
+	err = db.Raw(sqlQuery, lineage, serial).Scan(&stat).Error
+	stat.Serial = serial
 	return
 }
 
@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	"net/url"
 	"reflect"
 	"regexp"
@@ -18,6 +19,7 @@ import (
 	"github.com/camptocamp/terraboard/internal/terraform/addrs"
 	"github.com/camptocamp/terraboard/internal/terraform/states"
 	"github.com/camptocamp/terraboard/internal/terraform/states/statefile"
+	"github.com/camptocamp/terraboard/risk"
 	"github.com/camptocamp/terraboard/state"
 	"github.com/camptocamp/terraboard/types"
 )
@@ -151,7 +153,7 @@ func TestInsertState(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectQuery("^INSERT (.+)").
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "lineage").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "lineage", true, true).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
 
@@ -164,7 +166,7 @@ func TestInsertState(t *testing.T) {
 		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectQuery("^INSERT (.+)").
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectQuery("^INSERT (.+)").
 		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
@@ -175,6 +177,10 @@ func TestInsertState(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
 
+	mock.ExpectExec("^UPDATE resources SET search_vector = (.+) AND modules.state_id = (.+)").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
 	db := &Database{
 		DB: gormDB,
 	}
@@ -295,7 +301,7 @@ func TestUpdateStateWithLineage(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectQuery("^INSERT (.+)").
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "lineage_value").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "lineage_value", false, false).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
 
@@ -354,7 +360,7 @@ func TestUpdateStateWithoutLineage(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectQuery("^INSERT (.+)").
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "lineage_value").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "lineage_value", false, false).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.ExpectCommit()
 
@@ -572,7 +578,7 @@ func TestSearchAttribute(t *testing.T) {
 	mock.ExpectQuery("^SELECT count(.+)").
 		WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(1))
 	mock.ExpectQuery("^SELECT (.+)").
-		WithArgs("%test_thing%", "%baz%", "%woozles%", `%"confuzles"%`, `%1.0.0%`, 20).
+		WithArgs("%test_thing%", "%baz%", "%woozles%", `%"confuzles"%`, `%1.0.0%`, 21, 0).
 		WillReturnRows(sqlmock.NewRows([]string{"path", "version_id", "tf_version"}).AddRow("path", "foo", "1.0.0"))
 
 	db := &Database{
@@ -586,10 +592,12 @@ func TestSearchAttribute(t *testing.T) {
 	params.Add("value", `"confuzles"`)
 	params.Add("tf_version", "1.0.0")
 
-	results, page, total := db.SearchAttribute(params)
+	results, info, err := db.SearchAttribute(params)
+	assert.Nil(t, err)
 	assert.Equal(t, 1, len(results))
-	assert.Equal(t, 1, page)
-	assert.Equal(t, 1, total)
+	assert.Equal(t, 1, info.Page)
+	assert.Equal(t, 1, info.Total)
+	assert.Equal(t, "", info.NextCursor)
 	assert.Equal(t, "path", results[0].Path)
 	assert.Equal(t, "1.0.0", results[0].TFVersion)
 	assert.Equal(t, "foo", results[0].VersionID)
@@ -598,6 +606,101 @@ func TestSearchAttribute(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestSearchAttribute_Cursor(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	cursor, err := encodeCursor("path", 3, "lineage", "", "aws_instance", "foo", "", "ami", 12)
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT count(.+)").
+		WithArgs("%aws_instance%").
+		WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(5))
+	mock.ExpectQuery(`^SELECT (.+) WHERE resources.type LIKE \$1 AND \(states.path, (.+), attributes.id\) > \(\$2, (.+)\) ORDER BY (.+) LIMIT \$11 OFFSET \$12`).
+		WithArgs("%aws_instance%", "path", 3, "lineage", "", "aws_instance", "foo", "", "ami", 12, 3, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"path", "serial", "lineage_value", "type", "name", "key", "attribute_id"}).
+			AddRow("path", 3, "lineage", "aws_instance", "foo", "id", 13).
+			AddRow("path", 3, "lineage", "aws_instance", "foo", "tags", 14).
+			AddRow("path", 3, "lineage", "aws_instance", "foo", "type", 15))
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	params := url.Values{}
+	params.Add("type", "aws_instance")
+	params.Add("page_size", "2")
+	params.Add("cursor", cursor)
+
+	results, info, err := db.SearchAttribute(params)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, 0, info.Page)
+	assert.Equal(t, 2, info.PageSize)
+	assert.Equal(t, 5, info.Total)
+
+	next, err := searchResultCursor(results[1])
+	assert.Nil(t, err)
+	assert.Equal(t, next, info.NextCursor)
+
+	params.Set("cursor", "not a cursor")
+	_, _, err = db.SearchAttribute(params)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestSearchAttributeFacets(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT GROUPING(.+) GROUP BY GROUPING SETS (.+)").
+		WithArgs("%aws_%").
+		WillReturnRows(sqlmock.NewRows([]string{"facet", "value", "count"}).
+			AddRow(7, "aws_instance", 12).
+			AddRow(7, "aws_s3_bucket", 3).
+			AddRow(11, "1.0.0", 15).
+			AddRow(13, "lineage", 15).
+			AddRow(14, "module.foo", 10).
+			AddRow(14, nil, 5))
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	params := url.Values{}
+	params.Add("type", "aws_")
+
+	facets, err := db.SearchAttributeFacets(params)
+	assert.Nil(t, err)
+	assert.Equal(t, types.SearchFacets{
+		ResourceTypes: []types.FacetCount{{Value: "aws_instance", Count: 12}, {Value: "aws_s3_bucket", Count: 3}},
+		TFVersions:    []types.FacetCount{{Value: "1.0.0", Count: 15}},
+		Lineages:      []types.FacetCount{{Value: "lineage", Count: 15}},
+		ModulePaths:   []types.FacetCount{{Value: "module.foo", Count: 10}, {Value: "", Count: 5}},
+	}, facets)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
 func TestListStatesVersions(t *testing.T) {
 	fakeDB, mock, err := sqlmock.New()
 	if err != nil {
@@ -676,8 +779,8 @@ func TestListStateStats(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).
 			AddRow(3))
 
-	mock.ExpectQuery("^SELECT (.+)").
-		WithArgs(0).
+	mock.ExpectQuery("^SELECT (.+) ORDER BY last_modified DESC, lineage_value DESC LIMIT (.+) OFFSET (.+)").
+		WithArgs(21, 0).
 		WillReturnRows(sqlmock.NewRows([]string{"path"}).
 			AddRow("foo").
 			AddRow("bar").
@@ -690,11 +793,52 @@ func TestListStateStats(t *testing.T) {
 	params := url.Values{}
 	params.Add("page", "1")
 
-	states, page, total := db.ListStateStats(params)
+	states, info, err := db.ListStateStats(params)
+	assert.Nil(t, err)
 	assert.NotNil(t, states)
 	assert.Equal(t, 3, len(states))
-	assert.Equal(t, 1, page)
-	assert.Equal(t, 3, total)
+	assert.Equal(t, 1, info.Page)
+	assert.Equal(t, 3, info.Total)
+	assert.Equal(t, "", info.NextCursor)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestListStateStats_DefaultPageSize(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).
+			AddRow(25))
+
+	rows := sqlmock.NewRows([]string{"path"})
+	for i := 0; i < 25; i++ {
+		rows.AddRow(fmt.Sprintf("state%d", i))
+	}
+	mock.ExpectQuery("^SELECT (.+) LIMIT (.+) OFFSET (.+)").
+		WithArgs(21, 0).
+		WillReturnRows(rows)
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	states, info, err := db.ListStateStats(url.Values{})
+	assert.Nil(t, err)
+	assert.Equal(t, 20, len(states))
+	assert.Equal(t, 20, info.PageSize)
+	assert.Equal(t, 25, info.Total)
+	assert.NotEmpty(t, info.NextCursor)
 
 	err = mock.ExpectationsWereMet()
 	assert.Nil(t, err)
@@ -890,13 +1034,21 @@ func TestInsertPlan(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"id"}))
 	mock.ExpectQuery("^INSERT (.+)").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`^INSERT INTO "plan_summaries" (.+)`).
+		WithArgs(sqlmock.AnyArg(), 3, 0, 0, 0, "low", risk.Fingerprint(nil)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`^INSERT INTO "plan_summary_resource_types" (.+)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`^SELECT "id" FROM "plans"`).
+		WithArgs(1, sqlmock.AnyArg(), types.PlanPending, types.PlanApproved).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
 	mock.ExpectCommit()
 
 	db := &Database{
 		DB: gormDB,
 	}
 
-	err = db.InsertPlan([]byte(`{"lineage":"lineage_value","terraform_version":"1.0.0","git_remote":"foo.com","git_commit":"#12345","ci_url":"","source":"","plan_json":{"format_version":"0.1","terraform_version":"0.12.6","planned_values":{"root_module":{"resources":[{"address":"aws_autoscaling_group.my_asg","mode":"managed","type":"aws_autoscaling_group","name":"my_asg","provider_name":"aws","schema_version":0,"values":{"availability_zones":["us-west-1a"],"desired_capacity":4,"enabled_metrics":null,"force_delete":true,"health_check_grace_period":300,"health_check_type":"ELB","initial_lifecycle_hook":[],"launch_configuration":"my_web_config","launch_template":[],"max_size":5,"metrics_granularity":"1Minute","min_elb_capacity":null,"min_size":1,"mixed_instances_policy":[],"name":"my_asg","name_prefix":null,"placement_group":null,"protect_from_scale_in":false,"suspended_processes":null,"tag":[],"tags":null,"termination_policies":null,"timeouts":null,"wait_for_capacity_timeout":"10m","wait_for_elb_capacity":null}},{"address":"aws_instance.web","mode":"managed","type":"aws_instance","name":"web","provider_name":"aws","schema_version":1,"values":{"ami":"ami-09b4b74c","credit_specification":[],"disable_api_termination":null,"ebs_optimized":null,"get_password_data":false,"iam_instance_profile":null,"instance_initiated_shutdown_behavior":null,"instance_type":"t2.micro","monitoring":null,"source_dest_check":true,"tags":null,"timeouts":null,"user_data":null,"user_data_base64":null}},{"address":"aws_launch_configuration.my_web_config","mode":"managed","type":"aws_launch_configuration","name":"my_web_config","provider_name":"aws","schema_version":0,"values":{"associate_public_ip_address":false,"enable_monitoring":true,"ephemeral_block_device":[],"iam_instance_profile":null,"image_id":"ami-09b4b74c","instance_type":"t2.micro","name":"my_web_config","name_prefix":null,"placement_tenancy":null,"security_groups":null,"spot_price":null,"user_data":null,"user_data_base64":null,"vpc_classic_link_id":null,"vpc_classic_link_security_groups":null}}]}},"resource_changes":[{"address":"aws_autoscaling_group.my_asg","mode":"managed","type":"aws_autoscaling_group","name":"my_asg","provider_name":"aws","change":{"actions":["create"],"before":null,"after":{"availability_zones":["us-west-1a"],"desired_capacity":4,"enabled_metrics":null,"force_delete":true,"health_check_grace_period":300,"health_check_type":"ELB","initial_lifecycle_hook":[],"launch_configuration":"my_web_config","launch_template":[],"max_size":5,"metrics_granularity":"1Minute","min_elb_capacity":null,"min_size":1,"mixed_instances_policy":[],"name":"my_asg","name_prefix":null,"placement_group":null,"protect_from_scale_in":false,"suspended_processes":null,"tag":[],"tags":null,"termination_policies":null,"timeouts":null,"wait_for_capacity_timeout":"10m","wait_for_elb_capacity":null},"after_unknown":{"arn":true,"availability_zones":[false],"default_cooldown":true,"id":true,"initial_lifecycle_hook":[],"launch_template":[],"load_balancers":true,"mixed_instances_policy":[],"service_linked_role_arn":true,"tag":[],"target_group_arns":true,"vpc_zone_identifier":true}}},{"address":"aws_instance.web","mode":"managed","type":"aws_instance","name":"web","provider_name":"aws","change":{"actions":["create"],"before":null,"after":{"ami":"ami-09b4b74c","credit_specification":[],"disable_api_termination":null,"ebs_optimized":null,"get_password_data":false,"iam_instance_profile":null,"instance_initiated_shutdown_behavior":null,"instance_type":"t2.micro","monitoring":null,"source_dest_check":true,"tags":null,"timeouts":null,"user_data":null,"user_data_base64":null},"after_unknown":{"arn":true,"associate_public_ip_address":true,"availability_zone":true,"cpu_core_count":true,"cpu_threads_per_core":true,"credit_specification":[],"ebs_block_device":true,"ephemeral_block_device":true,"host_id":true,"id":true,"instance_state":true,"ipv6_address_count":true,"ipv6_addresses":true,"key_name":true,"network_interface":true,"network_interface_id":true,"password_data":true,"placement_group":true,"primary_network_interface_id":true,"private_dns":true,"private_ip":true,"public_dns":true,"public_ip":true,"root_block_device":true,"security_groups":true,"subnet_id":true,"tenancy":true,"volume_tags":true,"vpc_security_group_ids":true}}},{"address":"aws_launch_configuration.my_web_config","mode":"managed","type":"aws_launch_configuration","name":"my_web_config","provider_name":"aws","change":{"actions":["create"],"before":null,"after":{"associate_public_ip_address":false,"enable_monitoring":true,"ephemeral_block_device":[],"iam_instance_profile":null,"image_id":"ami-09b4b74c","instance_type":"t2.micro","name":"my_web_config","name_prefix":null,"placement_tenancy":null,"security_groups":null,"spot_price":null,"user_data":null,"user_data_base64":null,"vpc_classic_link_id":null,"vpc_classic_link_security_groups":null},"after_unknown":{"ebs_block_device":true,"ebs_optimized":true,"ephemeral_block_device":[],"id":true,"key_name":true,"root_block_device":true}}}],"configuration":{"provider_config":{"aws":{"name":"aws","expressions":{"region":{"constant_value":"us-west-1"}}}},"root_module":{"resources":[{"address":"aws_autoscaling_group.my_asg","mode":"managed","type":"aws_autoscaling_group","name":"my_asg","provider_config_key":"aws","expressions":{"availability_zones":{"constant_value":["us-west-1a"]},"desired_capacity":{"constant_value":4},"force_delete":{"constant_value":true},"health_check_grace_period":{"constant_value":300},"health_check_type":{"constant_value":"ELB"},"launch_configuration":{"constant_value":"my_web_config"},"max_size":{"constant_value":5},"min_size":{"constant_value":1},"name":{"constant_value":"my_asg"}},"schema_version":0},{"address":"aws_instance.web","mode":"managed","type":"aws_instance","name":"web","provider_config_key":"aws","expressions":{"ami":{"constant_value":"ami-09b4b74c"},"instance_type":{"constant_value":"t2.micro"}},"schema_version":1},{"address":"aws_launch_configuration.my_web_config","mode":"managed","type":"aws_launch_configuration","name":"my_web_config","provider_config_key":"aws","expressions":{"image_id":{"constant_value":"ami-09b4b74c"},"instance_type":{"constant_value":"t2.micro"},"name":{"constant_value":"my_web_config"}},"schema_version":0}]}}}}`))
+	err = db.InsertPlan([]byte(`{"lineage":"lineage_value","terraform_version":"1.0.0","git_remote":"foo.com","git_commit":"#12345","ci_url":"","source":"","plan_json":{"format_version":"0.1","terraform_version":"0.12.6","planned_values":{"root_module":{"resources":[{"address":"aws_autoscaling_group.my_asg","mode":"managed","type":"aws_autoscaling_group","name":"my_asg","provider_name":"aws","schema_version":0,"values":{"availability_zones":["us-west-1a"],"desired_capacity":4,"enabled_metrics":null,"force_delete":true,"health_check_grace_period":300,"health_check_type":"ELB","initial_lifecycle_hook":[],"launch_configuration":"my_web_config","launch_template":[],"max_size":5,"metrics_granularity":"1Minute","min_elb_capacity":null,"min_size":1,"mixed_instances_policy":[],"name":"my_asg","name_prefix":null,"placement_group":null,"protect_from_scale_in":false,"suspended_processes":null,"tag":[],"tags":null,"termination_policies":null,"timeouts":null,"wait_for_capacity_timeout":"10m","wait_for_elb_capacity":null}},{"address":"aws_instance.web","mode":"managed","type":"aws_instance","name":"web","provider_name":"aws","schema_version":1,"values":{"ami":"ami-09b4b74c","credit_specification":[],"disable_api_termination":null,"ebs_optimized":null,"get_password_data":false,"iam_instance_profile":null,"instance_initiated_shutdown_behavior":null,"instance_type":"t2.micro","monitoring":null,"source_dest_check":true,"tags":null,"timeouts":null,"user_data":null,"user_data_base64":null}},{"address":"aws_launch_configuration.my_web_config","mode":"managed","type":"aws_launch_configuration","name":"my_web_config","provider_name":"aws","schema_version":0,"values":{"associate_public_ip_address":false,"enable_monitoring":true,"ephemeral_block_device":[],"iam_instance_profile":null,"image_id":"ami-09b4b74c","instance_type":"t2.micro","name":"my_web_config","name_prefix":null,"placement_tenancy":null,"security_groups":null,"spot_price":null,"user_data":null,"user_data_base64":null,"vpc_classic_link_id":null,"vpc_classic_link_security_groups":null}}]}},"resource_changes":[{"address":"aws_autoscaling_group.my_asg","mode":"managed","type":"aws_autoscaling_group","name":"my_asg","provider_name":"aws","change":{"actions":["create"],"before":null,"after":{"availability_zones":["us-west-1a"],"desired_capacity":4,"enabled_metrics":null,"force_delete":true,"health_check_grace_period":300,"health_check_type":"ELB","initial_lifecycle_hook":[],"launch_configuration":"my_web_config","launch_template":[],"max_size":5,"metrics_granularity":"1Minute","min_elb_capacity":null,"min_size":1,"mixed_instances_policy":[],"name":"my_asg","name_prefix":null,"placement_group":null,"protect_from_scale_in":false,"suspended_processes":null,"tag":[],"tags":null,"termination_policies":null,"timeouts":null,"wait_for_capacity_timeout":"10m","wait_for_elb_capacity":null},"after_unknown":{"arn":true,"availability_zones":[false],"default_cooldown":true,"id":true,"initial_lifecycle_hook":[],"launch_template":[],"load_balancers":true,"mixed_instances_policy":[],"service_linked_role_arn":true,"tag":[],"target_group_arns":true,"vpc_zone_identifier":true}}},{"address":"aws_instance.web","mode":"managed","type":"aws_instance","name":"web","provider_name":"aws","change":{"actions":["create"],"before":null,"after":{"ami":"ami-09b4b74c","credit_specification":[],"disable_api_termination":null,"ebs_optimized":null,"get_password_data":false,"iam_instance_profile":null,"instance_initiated_shutdown_behavior":null,"instance_type":"t2.micro","monitoring":null,"source_dest_check":true,"tags":null,"timeouts":null,"user_data":null,"user_data_base64":null},"after_unknown":{"arn":true,"associate_public_ip_address":true,"availability_zone":true,"cpu_core_count":true,"cpu_threads_per_core":true,"credit_specification":[],"ebs_block_device":true,"ephemeral_block_device":true,"host_id":true,"id":true,"instance_state":true,"ipv6_address_count":true,"ipv6_addresses":true,"key_name":true,"network_interface":true,"network_interface_id":true,"password_data":true,"placement_group":true,"primary_network_interface_id":true,"private_dns":true,"private_ip":true,"public_dns":true,"public_ip":true,"root_block_device":true,"security_groups":true,"subnet_id":true,"tenancy":true,"volume_tags":true,"vpc_security_group_ids":true}}},{"address":"aws_launch_configuration.my_web_config","mode":"managed","type":"aws_launch_configuration","name":"my_web_config","provider_name":"aws","change":{"actions":["create"],"before":null,"after":{"associate_public_ip_address":false,"enable_monitoring":true,"ephemeral_block_device":[],"iam_instance_profile":null,"image_id":"ami-09b4b74c","instance_type":"t2.micro","name":"my_web_config","name_prefix":null,"placement_tenancy":null,"security_groups":null,"spot_price":null,"user_data":null,"user_data_base64":null,"vpc_classic_link_id":null,"vpc_classic_link_security_groups":null},"after_unknown":{"ebs_block_device":true,"ebs_optimized":true,"ephemeral_block_device":[],"id":true,"key_name":true,"root_block_device":true}}}],"configuration":{"provider_config":{"aws":{"name":"aws","expressions":{"region":{"constant_value":"us-west-1"}}}},"root_module":{"resources":[{"address":"aws_autoscaling_group.my_asg","mode":"managed","type":"aws_autoscaling_group","name":"my_asg","provider_config_key":"aws","expressions":{"availability_zones":{"constant_value":["us-west-1a"]},"desired_capacity":{"constant_value":4},"force_delete":{"constant_value":true},"health_check_grace_period":{"constant_value":300},"health_check_type":{"constant_value":"ELB"},"launch_configuration":{"constant_value":"my_web_config"},"max_size":{"constant_value":5},"min_size":{"constant_value":1},"name":{"constant_value":"my_asg"}},"schema_version":0},{"address":"aws_instance.web","mode":"managed","type":"aws_instance","name":"web","provider_config_key":"aws","expressions":{"ami":{"constant_value":"ami-09b4b74c"},"instance_type":{"constant_value":"t2.micro"}},"schema_version":1},{"address":"aws_launch_configuration.my_web_config","mode":"managed","type":"aws_launch_configuration","name":"my_web_config","provider_config_key":"aws","expressions":{"image_id":{"constant_value":"ami-09b4b74c"},"instance_type":{"constant_value":"t2.micro"},"name":{"constant_value":"my_web_config"}},"schema_version":0}]}}}}`), types.APIToken{Scopes: []types.APITokenScope{{Lineage: "lineage_value"}}})
 	assert.Nil(t, err)
 
 	err = mock.ExpectationsWereMet()
@@ -920,19 +1072,41 @@ func TestGetPlansSummary(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).
 			AddRow(3))
 
-	mock.ExpectQuery("^SELECT (.+)").
+	mock.ExpectQuery(`^SELECT (.+) WHERE "Lineage"."value" = \$1 (.+) ORDER BY "plans"."created_at" desc,"plans"."id" desc LIMIT 3`).
+		WithArgs("lineage_value").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).
 			AddRow(1).AddRow(2).AddRow(3))
 
+	mock.ExpectQuery(`^SELECT \* FROM "plan_summaries" WHERE "plan_summaries"."plan_id" IN \(\$1,\$2,\$3\)`).
+		WithArgs(1, 2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_id", "delete", "risk"}).
+			AddRow(1, 1, 1, "high"))
+
+	mock.ExpectQuery(`^SELECT \* FROM "plan_summary_resource_types" WHERE "plan_summary_resource_types"."plan_summary_id" = \$1 ORDER BY type`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_summary_id", "type", "delete"}).
+			AddRow(1, 1, "aws_rds_cluster", 1))
+
 	db := &Database{
 		DB: gormDB,
 	}
 
-	plans, page, total := db.GetPlansSummary("lineage_value", "10", "1")
-	assert.NotNil(t, plans)
-	assert.Equal(t, 3, len(plans))
-	assert.Equal(t, 1, page)
-	assert.Equal(t, 3, total)
+	plans, info, err := db.GetPlansSummary("lineage_value", NewPagination(url.Values{"limit": []string{"2"}}))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(plans))
+	assert.Equal(t, 1, info.Page)
+	assert.Equal(t, 3, info.Total)
+	assert.NotEqual(t, "", info.NextCursor)
+	assert.Equal(t, &types.PlanSummary{
+		ID:               1,
+		PlanID:           1,
+		PlanChangeCounts: types.PlanChangeCounts{Delete: 1},
+		Risk:             types.RiskHigh,
+		ResourceTypes: []types.PlanSummaryResourceType{
+			{ID: 1, PlanSummaryID: 1, Type: "aws_rds_cluster", PlanChangeCounts: types.PlanChangeCounts{Delete: 1}},
+		},
+	}, plans[0].Summary)
+	assert.Nil(t, plans[1].Summary)
 
 	err = mock.ExpectationsWereMet()
 	assert.Nil(t, err)
@@ -985,19 +1159,36 @@ func TestGetPlans(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).
 			AddRow(3))
 
-	mock.ExpectQuery("^SELECT (.+)").
+	mock.ExpectQuery(`^SELECT (.+) WHERE "Lineage"."value" = \$1 (.+) ORDER BY "plans"."created_at" desc,"plans"."id" desc LIMIT 3`).
+		WithArgs("lineage_value").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).
 			AddRow(1).AddRow(2).AddRow(3))
+	mock.ExpectQuery(`^SELECT \* FROM "plan_policy_results" WHERE "plan_policy_results"."plan_id" IN \(\$1,\$2,\$3\) ORDER BY policy`).
+		WithArgs(1, 2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_id", "policy", "passed"}).
+			AddRow(1, 1, "s3", true))
+	mock.ExpectQuery(`^SELECT \* FROM "plan_policy_messages" WHERE "plan_policy_messages"."plan_policy_result_id" = \$1 ORDER BY id`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_policy_result_id", "level", "message"}).
+			AddRow(1, 1, types.PolicyWarn, "aws_s3_bucket.logs has no owner tag"))
 
 	db := &Database{
 		DB: gormDB,
 	}
 
-	plans, page, total := db.GetPlans("lineage_value", "10", "1")
-	assert.NotNil(t, plans)
-	assert.Equal(t, 3, len(plans))
-	assert.Equal(t, 1, page)
-	assert.Equal(t, 3, total)
+	plans, info, err := db.GetPlans("lineage_value", NewPagination(url.Values{"limit": []string{"2"}}))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(plans))
+	assert.Equal(t, 1, info.Page)
+	assert.Equal(t, 3, info.Total)
+	assert.Equal(t, []types.PlanPolicyResult{{
+		ID:       1,
+		PlanID:   1,
+		Policy:   "s3",
+		Passed:   true,
+		Messages: []types.PlanPolicyMessage{{ID: 1, PlanPolicyResultID: 1, Level: types.PolicyWarn, Message: "aws_s3_bucket.logs has no owner tag"}},
+	}}, plans[0].PolicyResults)
+	assert.NotEqual(t, "", info.NextCursor)
 
 	err = mock.ExpectationsWereMet()
 	assert.Nil(t, err)
@@ -1015,7 +1206,10 @@ func TestGetLineages(t *testing.T) {
 	}))
 	assert.Nil(t, err)
 
-	mock.ExpectQuery("^SELECT (.+)").
+	mock.ExpectQuery("^SELECT count(.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).
+			AddRow(3))
+	mock.ExpectQuery("^SELECT (.+) ORDER BY created_at desc,id desc LIMIT 11").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).
 			AddRow(1).AddRow(2).AddRow(3))
 
@@ -1023,9 +1217,12 @@ func TestGetLineages(t *testing.T) {
 		DB: gormDB,
 	}
 
-	lineages := db.GetLineages("10")
+	lineages, info, err := db.GetLineages(NewPagination(url.Values{"limit": []string{"10"}}))
+	assert.Nil(t, err)
 	assert.NotNil(t, lineages)
 	assert.Equal(t, 3, len(lineages))
+	assert.Equal(t, 3, info.Total)
+	assert.Equal(t, "", info.NextCursor)
 
 	err = mock.ExpectationsWereMet()
 	assert.Nil(t, err)
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"github.com/camptocamp/terraboard/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// searchVectorSet is the SET clause filling the full-text search vector of resources.
+// The resource address gets a higher weight than its attributes keys and values.
+// Attributes are truncated to keep the vector under the 1MB tsvector limit.
+const searchVectorSet = "UPDATE resources SET search_vector =" +
+	" setweight(to_tsvector('simple', concat_ws(' ', modules.path, resources.type, resources.name, resources.type || '.' || resources.name || resources.index)), 'A') ||" +
+	" setweight(to_tsvector('simple', left(coalesce((SELECT string_agg(attributes.key || ' ' || attributes.value, ' ') FROM attributes WHERE attributes.resource_id = resources.id), ''), 262144)), 'B')" +
+	" FROM modules WHERE modules.id = resources.module_id"
+
+// MigrateSearchIndex adds the full-text search vector column and its index
+// to the resources table, and indexes resources inserted before it existed
+func (db *Database) MigrateSearchIndex() error {
+	if err := db.Exec("ALTER TABLE resources ADD COLUMN IF NOT EXISTS search_vector tsvector").Error; err != nil {
+		return err
+	}
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_resources_search_vector ON resources USING GIN (search_vector)").Error; err != nil {
+		return err
+	}
+
+	res := db.Exec(searchVectorSet + " AND resources.search_vector IS NULL")
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		log.Infof("Indexed %d resources for full-text search", res.RowsAffected)
+	}
+	return nil
+}
+
+// indexStateResources fills the full-text search vector of all resources of a State
+func (db *Database) indexStateResources(stateID uint) error {
+	return db.Exec(searchVectorSet+" AND modules.state_id = ?", stateID).Error
+}
+
+// fullTextSearchKey lists the columns of the full-text search sort key,
+// used to resume a search after a cursor
+var fullTextSearchKey = []string{"-ts_rank(resources.search_vector, query)::float8", "states.path", "modules.path",
+	"resources.type", "resources.name", "resources.index", "resources.id"}
+
+// FullTextSearch returns the Resources of the latest States matching a full-text query,
+// ranked by relevance, along with paging information
+func (db *Database) FullTextSearch(q string, p Pagination) (results []types.ResourceSearchResult, info PageInfo, err error) {
+	sqlQuery := " FROM (SELECT states.path, max(states.serial) as mx FROM states GROUP BY states.path) t" +
+		" JOIN states ON t.path = states.path AND t.mx = states.serial" +
+		" JOIN modules ON states.id = modules.state_id" +
+		" JOIN resources ON modules.id = resources.module_id" +
+		" JOIN lineages ON lineages.id = states.lineage_id" +
+		" JOIN versions ON states.version_id = versions.id" +
+		" CROSS JOIN websearch_to_tsquery('simple', ?) AS query" +
+		" WHERE resources.search_vector @@ query"
+
+	var total int
+	row := db.Raw("SELECT count(*)"+sqlQuery, q).Row()
+	if err = row.Scan(&total); err != nil {
+		return
+	}
+	info = p.pageInfo(total)
+
+	params := []interface{}{q}
+	if p.Cursor != "" {
+		var r types.ResourceSearchResult
+		if err = decodeCursor(p.Cursor, &r.Rank, &r.Path, &r.ModulePath,
+			&r.ResourceType, &r.ResourceName, &r.ResourceIndex, &r.ResourceID); err != nil {
+			return
+		}
+		sqlQuery += " AND " + keysetCondition(false, fullTextSearchKey...)
+		params = append(params, -r.Rank, r.Path, r.ModulePath,
+			r.ResourceType, r.ResourceName, r.ResourceIndex, r.ResourceID)
+	}
+
+	sql := "SELECT states.path, versions.version_id, states.tf_version, states.serial, lineages.value as lineage_value, modules.path as module_path, resources.type, resources.name, resources.index, resources.id as resource_id, ts_rank(resources.search_vector, query)::float8 AS rank" +
+		sqlQuery +
+		" ORDER BY rank DESC, states.path, modules.path, resources.type, resources.name, resources.index, resources.id" +
+		" LIMIT ? OFFSET ?"
+	params = append(params, p.PageSize+1, p.offset())
+
+	if err = db.Raw(sql, params...).Find(&results).Error; err != nil {
+		return
+	}
+
+	if len(results) > p.PageSize {
+		results = results[:p.PageSize]
+		r := results[len(results)-1]
+		info.NextCursor, err = encodeCursor(r.Rank, r.Path, r.ModulePath,
+			r.ResourceType, r.ResourceName, r.ResourceIndex, r.ResourceID)
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestMigrateSearchIndex(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectExec("^ALTER TABLE resources ADD COLUMN IF NOT EXISTS search_vector tsvector").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^CREATE INDEX IF NOT EXISTS idx_resources_search_vector (.+)").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^UPDATE resources SET search_vector = (.+) AND resources.search_vector IS NULL").
+		WillReturnResult(sqlmock.NewResult(0, 42))
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	err = db.MigrateSearchIndex()
+	assert.Nil(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestFullTextSearch(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT count(.+) WHERE resources.search_vector @@ query").
+		WithArgs("arn:aws:iam::123456789012:role/foo").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(25))
+	mock.ExpectQuery("^SELECT (.+) ORDER BY rank DESC(.+) LIMIT (.+) OFFSET (.+)").
+		WithArgs("arn:aws:iam::123456789012:role/foo", 21, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"path", "type", "name", "rank"}).
+			AddRow("path", "aws_iam_role", "foo", 0.6).
+			AddRow("path", "aws_iam_role_policy_attachment", "foo", 0.2))
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	results, info, err := db.FullTextSearch("arn:aws:iam::123456789012:role/foo", NewPagination(url.Values{"page": []string{"2"}}))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, info.Page)
+	assert.Equal(t, 25, info.Total)
+	assert.Equal(t, "", info.NextCursor)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, "aws_iam_role", results[0].ResourceType)
+	assert.Equal(t, 0.6, results[0].Rank)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/camptocamp/terraboard/compare"
+	"github.com/camptocamp/terraboard/types"
+)
+
+// resourceAddress is the SQL expression of a resource instance address,
+// matching the keys used by compare
+const resourceAddress = "concat(CASE WHEN modules.path <> '' THEN modules.path || '.' ELSE '' END," +
+	" CASE WHEN resources.mode = 'data' THEN 'data.' ELSE '' END," +
+	" resources.type, '.', resources.name, resources.index)"
+
+// resourceHistoryRow is an attribute of a Resource at a given version of a State
+type resourceHistoryRow struct {
+	StateID      uint
+	Path         string
+	VersionID    string
+	LastModified time.Time
+	Serial       int64
+	Key          sql.NullString
+	Value        sql.NullString
+}
+
+// GetResourceHistory returns the versions of a lineage in which a resource address
+// existed, with its attributes and their changes since the previous of these versions
+func (db *Database) GetResourceHistory(lineage, address string) (history types.ResourceHistory, err error) {
+	sqlQuery := "SELECT states.id as state_id, states.path, versions.version_id, versions.last_modified, states.serial," +
+		" attributes.key, attributes.value" +
+		" FROM states" +
+		" JOIN lineages ON lineages.id = states.lineage_id" +
+		" JOIN versions ON versions.id = states.version_id" +
+		" JOIN modules ON modules.state_id = states.id" +
+		" JOIN resources ON resources.module_id = modules.id" +
+		" LEFT JOIN attributes ON attributes.resource_id = resources.id" +
+		" WHERE states.deleted_at IS NULL AND lineages.value = ? AND " + resourceAddress + " = ?" +
+		" ORDER BY versions.last_modified, states.id, attributes.key"
+
+	var rows []resourceHistoryRow
+	if err = db.Raw(sqlQuery, lineage, address).Scan(&rows).Error; err != nil {
+		return
+	}
+
+	history = types.ResourceHistory{
+		Lineage:  lineage,
+		Address:  address,
+		Versions: []types.ResourceVersion{},
+	}
+	var stateID uint
+	for _, r := range rows {
+		if len(history.Versions) == 0 || r.StateID != stateID {
+			stateID = r.StateID
+			history.Versions = append(history.Versions, types.ResourceVersion{
+				Path:         r.Path,
+				VersionID:    r.VersionID,
+				LastModified: r.LastModified,
+				Serial:       r.Serial,
+			})
+		}
+		if r.Key.Valid {
+			v := &history.Versions[len(history.Versions)-1]
+			v.Attributes = append(v.Attributes, types.Attribute{Key: r.Key.String, Value: r.Value.String})
+		}
+	}
+
+	for i := 1; i < len(history.Versions); i++ {
+		v := &history.Versions[i]
+		v.Changes = compare.DiffAttributes(
+			types.Resource{Attributes: history.Versions[i-1].Attributes},
+			types.Resource{Attributes: v.Attributes},
+		)
+		v.Changed = len(v.Changes) > 0
+	}
+	return
+}
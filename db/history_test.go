@@ -0,0 +1,62 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+func TestGetResourceHistory(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	t3 := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	columns := []string{"state_id", "path", "version_id", "last_modified", "serial", "key", "value"}
+	mock.ExpectQuery("^SELECT (.+) FROM states (.+) ORDER BY versions.last_modified, states.id, attributes.key").
+		WithArgs("lineage", "aws_security_group_rule.ingress").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "path", "v1", t1, 1, "cidr_blocks", `["10.0.0.0/8"]`).
+			AddRow(1, "path", "v1", t1, 1, "port", `22`).
+			AddRow(2, "path", "v2", t2, 2, "cidr_blocks", `["10.0.0.0/8"]`).
+			AddRow(2, "path", "v2", t2, 2, "port", `22`).
+			AddRow(3, "path", "v3", t3, 3, "cidr_blocks", `["0.0.0.0/0"]`).
+			AddRow(3, "path", "v3", t3, 3, "port", `22`))
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	history, err := db.GetResourceHistory("lineage", "aws_security_group_rule.ingress")
+	assert.Nil(t, err)
+	assert.Equal(t, "aws_security_group_rule.ingress", history.Address)
+	assert.Len(t, history.Versions, 3)
+	assert.Equal(t, []types.Attribute{
+		{Key: "cidr_blocks", Value: `["10.0.0.0/8"]`},
+		{Key: "port", Value: `22`},
+	}, history.Versions[0].Attributes)
+	assert.False(t, history.Versions[0].Changed)
+	assert.False(t, history.Versions[1].Changed)
+	assert.True(t, history.Versions[2].Changed)
+	assert.Equal(t, []types.AttributeDiff{
+		{Path: "cidr_blocks[0]", Kind: types.AttributeChanged, OldValue: "10.0.0.0/8", NewValue: "0.0.0.0/0"},
+	}, history.Versions[2].Changes)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
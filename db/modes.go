@@ -0,0 +1,86 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/camptocamp/terraboard/types"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// resourceModesSet sets the mode of the data resources inserted before resource
+// modes were recorded, which have no mode and are read as managed resources.
+// A resource is known to be a data resource when its address is only recorded
+// as a data resource in the other versions of its lineage.
+const resourceModesSet = "UPDATE resources SET mode = 'data'" +
+	" FROM modules, states, (" +
+	"SELECT states.lineage_id, modules.path, resources.type, resources.name" +
+	" FROM resources" +
+	" JOIN modules ON modules.id = resources.module_id" +
+	" JOIN states ON states.id = modules.state_id" +
+	" WHERE resources.mode IN ('managed', 'data')%s" +
+	" GROUP BY states.lineage_id, modules.path, resources.type, resources.name" +
+	" HAVING bool_and(resources.mode = 'data')" +
+	") AS data_resources" +
+	" WHERE modules.id = resources.module_id AND states.id = modules.state_id" +
+	" AND (resources.mode IS NULL OR resources.mode = '')" +
+	" AND data_resources.lineage_id = states.lineage_id AND data_resources.path = modules.path" +
+	" AND data_resources.type = resources.type AND data_resources.name = resources.name"
+
+// resourceModesRecorded selects the lineages with versions inserted since
+// resource modes were recorded
+const resourceModesRecorded = "EXISTS (SELECT 1 FROM states" +
+	" JOIN modules ON modules.state_id = states.id" +
+	" JOIN resources ON resources.module_id = modules.id" +
+	" WHERE states.lineage_id = lineages.id AND resources.mode IN ('managed', 'data'))"
+
+// MigrateResourceModes sets the mode of the data resources inserted
+// before resource modes were recorded, when their lineage has since
+// been synced, and marks these lineages as set. It is meant to run once,
+// when lineages start recording it: the other lineages are set
+// when their next version is inserted.
+func (db *Database) MigrateResourceModes() error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Exec(fmt.Sprintf(resourceModesSet, ""))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			log.Infof("Set the mode of %d data resources", res.RowsAffected)
+		}
+		return tx.Model(&types.Lineage{}).
+			Where(resourceModesRecorded).
+			Update("modes_set", true).Error
+	})
+}
+
+// setResourceModes sets the mode of the data resources of the previous
+// versions of the lineage of a State, inserted before resource modes were
+// recorded, unless they were already set. They are set from the first
+// State of the lineage with data resources.
+func (db *Database) setResourceModes(st types.State) error {
+	if !st.LineageID.Valid || !hasDataResources(st) {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&types.Lineage{}).
+			Where("id = ? AND modes_set = ?", st.LineageID.Int64, false).
+			Update("modes_set", true)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return tx.Exec(fmt.Sprintf(resourceModesSet, " AND states.lineage_id = ?"), st.LineageID.Int64).Error
+	})
+}
+
+// hasDataResources tells whether a State has data resources
+func hasDataResources(st types.State) bool {
+	for _, m := range st.Modules {
+		for _, r := range m.Resources {
+			if r.Mode == "data" {
+				return true
+			}
+		}
+	}
+	return false
+}
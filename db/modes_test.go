@@ -0,0 +1,94 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+func TestMigrateResourceModes(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE resources SET mode = 'data' FROM (.+) HAVING bool_and\(resources.mode = 'data'\)\) AS data_resources (.+) AND \(resources.mode IS NULL OR resources.mode = ''\)`).
+		WithArgs().
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`^UPDATE "lineages" SET "modes_set"=\$1,"updated_at"=\$2 WHERE \(EXISTS \(SELECT 1 FROM states (.+) resources.mode IN \('managed', 'data'\)\)`).
+		WithArgs(true, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	err = db.MigrateResourceModes()
+	assert.Nil(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestSetResourceModes(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	// The modes of the lineage are set on its first inserted version
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE "lineages" SET "modes_set"=\$1,"updated_at"=\$2 WHERE \(id = \$3 AND modes_set = \$4\)`).
+		WithArgs(true, sqlmock.AnyArg(), int64(4), false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^UPDATE resources SET mode = 'data' FROM (.+) AND states.lineage_id = \$1 GROUP BY (.+)`).
+		WithArgs(int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	// and only once
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE "lineages" SET "modes_set"=\$1,"updated_at"=\$2 WHERE \(id = \$3 AND modes_set = \$4\)`).
+		WithArgs(true, sqlmock.AnyArg(), int64(4), false).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	st := types.State{
+		LineageID: sql.NullInt64{Int64: 4, Valid: true},
+		Modules: []types.Module{
+			{Resources: []types.Resource{{Mode: "data", Type: "aws_vpc", Name: "main"}}},
+		},
+	}
+	assert.Nil(t, db.setResourceModes(st))
+	assert.Nil(t, db.setResourceModes(st))
+	// Nothing to set without lineage or data resources
+	assert.Nil(t, db.setResourceModes(types.State{Modules: st.Modules}))
+	st.Modules[0].Resources[0].Mode = "managed"
+	assert.Nil(t, db.setResourceModes(st))
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultPageSize is the number of results returned by list requests
+	// when no page size is given
+	defaultPageSize = 20
+	// maxPageSize is the maximum number of results a list request can return
+	maxPageSize = 1000
+)
+
+// ErrInvalidCursor is returned when a list request is given a cursor
+// which was not issued by a previous request of the same list
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Pagination holds the paging parameters of a list request.
+// Results are paginated with a Cursor when one is given, and with an offset
+// computed from Page otherwise.
+type Pagination struct {
+	Page     int
+	PageSize int
+	Cursor   string
+}
+
+// NewPagination parses paging parameters from a query: 'page_size' (or its
+// legacy 'limit' alias), 'cursor' and 'page'
+func NewPagination(query url.Values) Pagination {
+	p := Pagination{
+		Page:     1,
+		PageSize: defaultPageSize,
+		Cursor:   query.Get("cursor"),
+	}
+
+	size := query.Get("page_size")
+	if size == "" {
+		size = query.Get("limit")
+	}
+	if size != "" {
+		if v, err := strconv.Atoi(size); err != nil || v < 1 {
+			log.Warnf("Page size ignored: %s", size)
+		} else if v > maxPageSize {
+			p.PageSize = maxPageSize
+		} else {
+			p.PageSize = v
+		}
+	}
+
+	if p.Cursor != "" {
+		p.Page = 0
+	} else if page := query.Get("page"); page != "" {
+		if v, err := strconv.Atoi(page); err != nil || v < 1 {
+			log.Warnf("Page ignored: %s", page)
+		} else {
+			p.Page = v
+		}
+	}
+
+	return p
+}
+
+// PageInfo holds paging information about the results of a list request.
+// NextCursor is empty on the last page.
+type PageInfo struct {
+	Page       int
+	PageSize   int
+	Total      int
+	NextCursor string
+}
+
+// pageInfo returns the paging information of a list request, without cursor
+func (p Pagination) pageInfo(total int) PageInfo {
+	return PageInfo{
+		Page:     p.Page,
+		PageSize: p.PageSize,
+		Total:    total,
+	}
+}
+
+// offset returns the number of results to skip when not using a cursor
+func (p Pagination) offset() int {
+	if p.Cursor != "" || p.Page < 1 {
+		return 0
+	}
+	return (p.Page - 1) * p.PageSize
+}
+
+// encodeCursor builds an opaque cursor from the sort key of the last result of a page
+func encodeCursor(values ...interface{}) (string, error) {
+	j, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(j), nil
+}
+
+// decodeCursor reads the sort key stored in a cursor into dest
+func decodeCursor(cursor string, dest ...interface{}) error {
+	j, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	var values []json.RawMessage
+	if err := json.Unmarshal(j, &values); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	if len(values) != len(dest) {
+		return fmt.Errorf("%w: expected %d values, got %d", ErrInvalidCursor, len(dest), len(values))
+	}
+
+	for i, v := range values {
+		if err := json.Unmarshal(v, dest[i]); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+	}
+	return nil
+}
+
+// keysetCondition returns a row comparison selecting rows after the
+// given sort key columns, in ascending or descending order
+func keysetCondition(desc bool, columns ...string) string {
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	return fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), op, placeholders)
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPagination(t *testing.T) {
+	tests := []struct {
+		name string
+		args url.Values
+		want Pagination
+	}{
+		{
+			"Defaults",
+			url.Values{},
+			Pagination{Page: 1, PageSize: 20},
+		},
+		{
+			"Page and page size",
+			url.Values{"page": []string{"3"}, "page_size": []string{"50"}},
+			Pagination{Page: 3, PageSize: 50},
+		},
+		{
+			"Limit alias",
+			url.Values{"limit": []string{"5"}},
+			Pagination{Page: 1, PageSize: 5},
+		},
+		{
+			"Page size capped",
+			url.Values{"page_size": []string{"100000"}},
+			Pagination{Page: 1, PageSize: 1000},
+		},
+		{
+			"Invalid values ignored",
+			url.Values{"page": []string{"-1"}, "page_size": []string{"foo"}},
+			Pagination{Page: 1, PageSize: 20},
+		},
+		{
+			"Cursor",
+			url.Values{"page": []string{"3"}, "cursor": []string{"abc"}},
+			Pagination{Page: 0, PageSize: 20, Cursor: "abc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewPagination(tt.args)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf(
+					"TestNewPagination() -> \n\ngot:\n%v,\n\nwant:\n%v",
+					got,
+					tt.want,
+				)
+			}
+		})
+	}
+}
+
+func TestPaginationOffset(t *testing.T) {
+	assert.Equal(t, 0, Pagination{Page: 1, PageSize: 20}.offset())
+	assert.Equal(t, 40, Pagination{Page: 3, PageSize: 20}.offset())
+	assert.Equal(t, 0, Pagination{Page: 3, PageSize: 20, Cursor: "abc"}.offset())
+}
+
+func TestCursor(t *testing.T) {
+	lastModified := time.Date(2021, 6, 1, 12, 30, 0, 123456000, time.UTC)
+	cursor, err := encodeCursor(lastModified, "lineage", uint(42))
+	assert.Nil(t, err)
+
+	var gotTime time.Time
+	var gotLineage string
+	var gotID uint
+	err = decodeCursor(cursor, &gotTime, &gotLineage, &gotID)
+	assert.Nil(t, err)
+	assert.True(t, lastModified.Equal(gotTime))
+	assert.Equal(t, "lineage", gotLineage)
+	assert.Equal(t, uint(42), gotID)
+
+	err = decodeCursor(cursor, &gotTime, &gotLineage)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	err = decodeCursor("!!!", &gotTime)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestKeysetCondition(t *testing.T) {
+	assert.Equal(t, "(a, b) > (?, ?)", keysetCondition(false, "a", "b"))
+	assert.Equal(t, "(created_at, id) < (?, ?)", keysetCondition(true, "created_at", "id"))
+}
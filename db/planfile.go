@@ -0,0 +1,57 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/camptocamp/terraboard/planfile"
+	"github.com/camptocamp/terraboard/types"
+	"gorm.io/datatypes"
+)
+
+// InsertPlanFile inserts a binary plan file ('terraform plan -out') in the Database,
+// with the metadata (git remote, commit, CI URL, source, exit code) of meta.
+// Its changes and prior state are decoded and stored in the Terraform plan
+// JSON output format. Values are decoded without the schemas of providers,
+// which are not available to Terraboard, and the configuration is not included.
+// Its lineage is the one of the prior state.
+// As with InsertPlan, apiToken must be allowed to submit Plans for this lineage,
+// and the new Plan supersedes the Plans of its lineage waiting to be applied.
+// The configured policies are evaluated against its JSON representation,
+// then its sensitive values are masked if MaskSensitivePlans is set.
+func (db *Database) InsertPlanFile(plan []byte, meta types.Plan, apiToken types.APIToken) error {
+	pf, err := planfile.Read(plan)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedPlan, err)
+	}
+	sf := pf.PriorState
+	if sf.Lineage == "" {
+		return &PlanValidationError{Problems: []string{"lineage is required"}}
+	}
+	if err := db.checkTokenScope(apiToken, sf.Lineage); err != nil {
+		return err
+	}
+
+	planJSON, err := pf.JSON()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedPlan, err)
+	}
+
+	serial := int64(sf.Serial)
+	lineage := types.Lineage{Value: sf.Lineage}
+	if res := db.FirstOrCreate(&lineage, lineage); res.Error != nil {
+		return fmt.Errorf("Error on lineage retrival during plan insertion: %v", res.Error)
+	}
+
+	p := types.Plan{
+		LineageID:   lineage.ID,
+		TFVersion:   pf.TerraformVersion(),
+		GitRemote:   meta.GitRemote,
+		GitCommit:   meta.GitCommit,
+		CiURL:       meta.CiURL,
+		Source:      meta.Source,
+		ExitCode:    meta.ExitCode,
+		PlanJSON:    datatypes.JSON(planJSON),
+		PriorSerial: &serial,
+	}
+	return db.createPlan(p, apiToken)
+}
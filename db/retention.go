@@ -0,0 +1,187 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/camptocamp/terraboard/types"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// DeletePlan removes a Plan from the Database, along with its parsed plan,
+// summary, reviews, apply and policy results
+func (db *Database) DeletePlan(id string) error {
+	var plan types.Plan
+	if err := db.Select("id", "parsed_plan_id").First(&plan, "id = ?", id).Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		return deletePlan(tx, plan)
+	})
+}
+
+// PurgePlans removes the Plans older than maxAge, and the oldest Plans of
+// each lineage beyond the maxCount most recent ones.
+// A zero maxAge or maxCount disables the corresponding limit. Plans still
+// waiting to be applied, pending or approved, are kept regardless of the limits.
+// It returns the number of deleted Plans.
+func (db *Database) PurgePlans(maxAge time.Duration, maxCount int) (int, error) {
+	var conds []string
+	var args []interface{}
+	if maxAge > 0 {
+		conds = append(conds, "created_at < ?")
+		args = append(args, time.Now().Add(-maxAge))
+	}
+	if maxCount > 0 {
+		conds = append(conds, "id IN (?)")
+		args = append(args, db.Raw(`SELECT id FROM (
+			SELECT id, row_number() OVER (PARTITION BY lineage_id ORDER BY created_at DESC, id DESC) AS rank
+			FROM plans WHERE deleted_at IS NULL
+		) AS ranked WHERE rank > ?`, maxCount))
+	}
+	if len(conds) == 0 {
+		return 0, nil
+	}
+
+	var plans []types.Plan
+	err := db.Select("id", "parsed_plan_id").
+		Where(strings.Join(conds, " OR "), args...).
+		Where("status NOT IN ?", []string{types.PlanPending, types.PlanApproved}).
+		Order("id").
+		Find(&plans).Error
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, plan := range plans {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return deletePlan(tx, plan)
+		})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"plan_id": plan.ID,
+				"error":   err,
+			}).Error("Failed to delete plan")
+			continue
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// deletion is a DELETE statement, run unscoped to remove soft-deleted rows too
+type deletion struct {
+	model interface{}
+	query string
+	args  []interface{}
+}
+
+// runDeletions runs deletions in order, which must follow the foreign keys
+// between tables: referencing rows first
+func runDeletions(tx *gorm.DB, deletions []deletion) error {
+	for _, d := range deletions {
+		if err := tx.Unscoped().Where(d.query, d.args...).Delete(d.model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePlan removes a Plan and all the records depending on it
+func deletePlan(tx *gorm.DB, plan types.Plan) error {
+	summaries := tx.Unscoped().Model(&types.PlanSummary{}).Select("id").Where("plan_id = ?", plan.ID)
+	applies := tx.Unscoped().Model(&types.PlanApply{}).Select("id").Where("plan_id = ?", plan.ID)
+	policyResults := tx.Unscoped().Model(&types.PlanPolicyResult{}).Select("id").Where("plan_id = ?", plan.ID)
+
+	err := runDeletions(tx, []deletion{
+		{&types.PlanSummaryResourceType{}, "plan_summary_id IN (?)", []interface{}{summaries}},
+		{&types.PlanSummary{}, "plan_id = ?", []interface{}{plan.ID}},
+		{&types.PlanReview{}, "plan_id = ?", []interface{}{plan.ID}},
+		{&types.PlanDivergence{}, "plan_apply_id IN (?)", []interface{}{applies}},
+		{&types.PlanApply{}, "plan_id = ?", []interface{}{plan.ID}},
+		{&types.PlanPolicyMessage{}, "plan_policy_result_id IN (?)", []interface{}{policyResults}},
+		{&types.PlanPolicyResult{}, "plan_id = ?", []interface{}{plan.ID}},
+		{&types.Plan{}, "id = ?", []interface{}{plan.ID}},
+	})
+	if err != nil || !plan.ParsedPlanID.Valid {
+		return err
+	}
+	return deletePlanModel(tx, uint(plan.ParsedPlanID.Int64))
+}
+
+// deletePlanModel removes a parsed plan: its resource and output changes,
+// variables, prior state and planned values
+func deletePlanModel(tx *gorm.DB, id uint) error {
+	var model types.PlanModel
+	err := tx.Unscoped().Select("id", "plan_state_id", "plan_state_value_id").First(&model, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var valueIDs []uint
+	if model.PlanStateValueID.Valid {
+		valueIDs = append(valueIDs, uint(model.PlanStateValueID.Int64))
+	}
+	if model.PlanStateID.Valid {
+		var ids []uint
+		err := tx.Unscoped().Model(&types.PlanState{}).
+			Where("id = ? AND plan_state_value_id IS NOT NULL", model.PlanStateID.Int64).
+			Pluck("plan_state_value_id", &ids).Error
+		if err != nil {
+			return err
+		}
+		valueIDs = append(valueIDs, ids...)
+	}
+
+	var moduleIDs []uint
+	err = tx.Unscoped().Model(&types.PlanStateValue{}).
+		Where("id IN ? AND plan_state_module_id IS NOT NULL", valueIDs).
+		Pluck("plan_state_module_id", &moduleIDs).Error
+	if err != nil {
+		return err
+	}
+	for parents := moduleIDs; len(parents) > 0; {
+		var children []uint
+		err := tx.Unscoped().Model(&types.PlanStateModule{}).
+			Where("plan_state_module_id IN ?", parents).
+			Pluck("id", &children).Error
+		if err != nil {
+			return err
+		}
+		moduleIDs = append(moduleIDs, children...)
+		parents = children
+	}
+
+	var changeIDs []uint
+	for _, m := range []interface{}{&types.PlanResourceChange{}, &types.PlanOutput{}} {
+		var ids []uint
+		err := tx.Unscoped().Model(m).
+			Where("plan_model_id = ? AND change_id IS NOT NULL", id).
+			Pluck("change_id", &ids).Error
+		if err != nil {
+			return err
+		}
+		changeIDs = append(changeIDs, ids...)
+	}
+
+	resources := tx.Unscoped().Model(&types.PlanStateResource{}).Select("id").Where("plan_state_module_id IN ?", moduleIDs)
+	return runDeletions(tx, []deletion{
+		{&types.PlanStateResourceAttribute{}, "plan_state_resource_id IN (?)", []interface{}{resources}},
+		{&types.PlanStateResource{}, "plan_state_module_id IN ?", []interface{}{moduleIDs}},
+		{&types.PlanStateOutput{}, "plan_state_value_id IN ?", []interface{}{valueIDs}},
+		{&types.PlanResourceChange{}, "plan_model_id = ?", []interface{}{id}},
+		{&types.PlanOutput{}, "plan_model_id = ?", []interface{}{id}},
+		{&types.PlanModelVariable{}, "plan_model_id = ?", []interface{}{id}},
+		{&types.PlanModel{}, "id = ?", []interface{}{id}},
+		{&types.Change{}, "id IN ?", []interface{}{changeIDs}},
+		{&types.PlanState{}, "id = ?", []interface{}{model.PlanStateID}},
+		{&types.PlanStateValue{}, "id IN ?", []interface{}{valueIDs}},
+		{&types.PlanStateModule{}, "id IN ?", []interface{}{moduleIDs}},
+	})
+}
@@ -0,0 +1,190 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+func TestDeletePlan(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT "id","parsed_plan_id" FROM "plans" WHERE id = \$1 AND "plans"."deleted_at" IS NULL`).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parsed_plan_id"}).AddRow(1, 10))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^DELETE FROM "plan_summary_resource_types" WHERE plan_summary_id IN \(SELECT "id" FROM "plan_summaries" WHERE plan_id = \$1\)`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`^DELETE FROM "plan_summaries" WHERE plan_id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^DELETE FROM "plan_reviews" WHERE plan_id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^DELETE FROM "plan_divergences" WHERE plan_apply_id IN \(SELECT "id" FROM "plan_applies" WHERE plan_id = \$1\)`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^DELETE FROM "plan_applies" WHERE plan_id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^DELETE FROM "plan_policy_messages" WHERE plan_policy_result_id IN \(SELECT "id" FROM "plan_policy_results" WHERE plan_id = \$1\)`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^DELETE FROM "plan_policy_results" WHERE plan_id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^DELETE FROM "plans" WHERE id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery(`^SELECT "id","plan_state_id","plan_state_value_id" FROM "plan_models" WHERE "plan_models"."id" = \$1`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_state_id", "plan_state_value_id"}).AddRow(10, 20, 30))
+	mock.ExpectQuery(`^SELECT "plan_state_value_id" FROM "plan_states" WHERE id = \$1 AND plan_state_value_id IS NOT NULL`).
+		WithArgs(20).
+		WillReturnRows(sqlmock.NewRows([]string{"plan_state_value_id"}).AddRow(31))
+	mock.ExpectQuery(`^SELECT "plan_state_module_id" FROM "plan_state_values" WHERE id IN \(\$1,\$2\) AND plan_state_module_id IS NOT NULL`).
+		WithArgs(30, 31).
+		WillReturnRows(sqlmock.NewRows([]string{"plan_state_module_id"}).AddRow(40).AddRow(41))
+	mock.ExpectQuery(`^SELECT "id" FROM "plan_state_modules" WHERE plan_state_module_id IN \(\$1,\$2\)`).
+		WithArgs(40, 41).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectQuery(`^SELECT "id" FROM "plan_state_modules" WHERE plan_state_module_id IN \(\$1\)`).
+		WithArgs(42).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`^SELECT "change_id" FROM "plan_resource_changes" WHERE plan_model_id = \$1 AND change_id IS NOT NULL`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"change_id"}).AddRow(50).AddRow(51))
+	mock.ExpectQuery(`^SELECT "change_id" FROM "plan_outputs" WHERE plan_model_id = \$1 AND change_id IS NOT NULL`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"change_id"}).AddRow(52))
+
+	mock.ExpectExec(`^DELETE FROM "plan_state_resource_attributes" WHERE plan_state_resource_id IN \(SELECT "id" FROM "plan_state_resources" WHERE plan_state_module_id IN \(\$1,\$2,\$3\)\)`).
+		WithArgs(40, 41, 42).
+		WillReturnResult(sqlmock.NewResult(0, 20))
+	mock.ExpectExec(`^DELETE FROM "plan_state_resources" WHERE plan_state_module_id IN \(\$1,\$2,\$3\)`).
+		WithArgs(40, 41, 42).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec(`^DELETE FROM "plan_state_outputs" WHERE plan_state_value_id IN \(\$1,\$2\)`).
+		WithArgs(30, 31).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`^DELETE FROM "plan_resource_changes" WHERE plan_model_id = \$1`).
+		WithArgs(10).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`^DELETE FROM "plan_outputs" WHERE plan_model_id = \$1`).
+		WithArgs(10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^DELETE FROM "plan_model_variables" WHERE plan_model_id = \$1`).
+		WithArgs(10).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^DELETE FROM "plan_models" WHERE id = \$1`).
+		WithArgs(10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^DELETE FROM "changes" WHERE id IN \(\$1,\$2,\$3\)`).
+		WithArgs(50, 51, 52).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`^DELETE FROM "plan_states" WHERE id = \$1`).
+		WithArgs(20).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^DELETE FROM "plan_state_values" WHERE id IN \(\$1,\$2\)`).
+		WithArgs(30, 31).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`^DELETE FROM "plan_state_modules" WHERE id IN \(\$1,\$2,\$3\)`).
+		WithArgs(40, 41, 42).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	err = db.DeletePlan("1")
+	assert.Nil(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestDeletePlan_NotFound(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT "id","parsed_plan_id" FROM "plans"`).
+		WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parsed_plan_id"}))
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	err = db.DeletePlan("2")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestPurgePlans(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT "id","parsed_plan_id" FROM "plans" WHERE \(created_at < \$1 OR id IN \(SELECT id FROM \((.+)PARTITION BY lineage_id(.+)\) AS ranked WHERE rank > \$2\)\) AND status NOT IN \(\$3,\$4\) AND "plans"."deleted_at" IS NULL ORDER BY id`).
+		WithArgs(sqlmock.AnyArg(), 5, types.PlanPending, types.PlanApproved).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parsed_plan_id"}).AddRow(1, nil))
+
+	mock.ExpectBegin()
+	for _, table := range []string{"plan_summary_resource_types", "plan_summaries", "plan_reviews", "plan_divergences", "plan_applies", "plan_policy_messages", "plan_policy_results", "plans"} {
+		mock.ExpectExec(`^DELETE FROM "` + table + `"`).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	deleted, err := db.PurgePlans(30*24*time.Hour, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted)
+
+	deleted, err = db.PurgePlans(0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, deleted)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/camptocamp/terraboard/types"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidReview is returned when a review sets an unknown status,
+	// or neither sets a status nor has a comment
+	ErrInvalidReview = errors.New("invalid review")
+	// ErrInvalidTransition is returned when a review sets a status
+	// which cannot follow the current status of a Plan
+	ErrInvalidTransition = errors.New("invalid plan status transition")
+	// ErrSelfApproval is returned when the submitter of a Plan approves or rejects it
+	ErrSelfApproval = errors.New("plans can't be approved or rejected by their submitter")
+)
+
+// planTransitions lists the statuses each status of a Plan can move to.
+// Rejected, applied and superseded Plans cannot be reviewed anymore.
+var planTransitions = map[string][]string{
+	types.PlanPending:  {types.PlanApproved, types.PlanRejected, types.PlanSuperseded},
+	types.PlanApproved: {types.PlanApplied, types.PlanRejected, types.PlanSuperseded},
+}
+
+// canTransition tells whether a Plan can move from a status to another one
+func canTransition(from, to string) bool {
+	for _, s := range planTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// validPlanStatus tells whether a status is a review status of a Plan
+func validPlanStatus(status string) bool {
+	switch status {
+	case types.PlanPending, types.PlanApproved, types.PlanRejected, types.PlanApplied, types.PlanSuperseded:
+		return true
+	}
+	return false
+}
+
+// GetPlanStatus returns the review status of a Plan, along with its reviews
+func (db *Database) GetPlanStatus(id string) (status types.PlanStatus, err error) {
+	var plan types.Plan
+	err = db.Joins("Lineage").Select(`"plans"."id"`, `"plans"."status"`).
+		First(&plan, `"plans"."id" = ?`, id).Error
+	if err != nil {
+		return
+	}
+
+	status = types.PlanStatus{
+		PlanID:  plan.ID,
+		Lineage: plan.Lineage.Value,
+		Status:  plan.Status,
+		Reviews: []types.PlanReview{},
+	}
+	err = db.Where("plan_id = ?", plan.ID).Order("created_at").Order("id").Find(&status.Reviews).Error
+	return
+}
+
+// ReviewPlan records a review of a Plan, moving it to the status set by the review, if any.
+// The reviewer is required, and can't approve or reject the Plans they submitted.
+// Applying a Plan supersedes the other Plans of its lineage waiting to be applied.
+func (db *Database) ReviewPlan(id string, review *types.PlanReview) error {
+	if review.Reviewer == "" {
+		return fmt.Errorf("%w: a review needs a reviewer", ErrInvalidReview)
+	}
+	if review.Status == "" && review.Comment == "" {
+		return fmt.Errorf("%w: a review needs a status or a comment", ErrInvalidReview)
+	}
+	if review.Status != "" && !validPlanStatus(review.Status) {
+		return fmt.Errorf("%w: unknown status '%s'", ErrInvalidReview, review.Status)
+	}
+
+	var plan types.Plan
+	err := db.Select("id", "lineage_id", "status", "submitted_by").First(&plan, "id = ?", id).Error
+	if err != nil {
+		return err
+	}
+
+	if review.Status != "" && !canTransition(plan.Status, review.Status) {
+		return fmt.Errorf("%w: plan %d is %s, it cannot be %s", ErrInvalidTransition, plan.ID, plan.Status, review.Status)
+	}
+	if (review.Status == types.PlanApproved || review.Status == types.PlanRejected) && review.Reviewer == plan.SubmittedBy {
+		return fmt.Errorf("%w: plan %d was submitted by %s", ErrSelfApproval, plan.ID, plan.SubmittedBy)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if review.Status != "" {
+			res := tx.Model(&types.Plan{}).
+				Where("id = ? AND status = ?", plan.ID, plan.Status).
+				Update("status", review.Status)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return fmt.Errorf("%w: plan %d was reviewed concurrently", ErrInvalidTransition, plan.ID)
+			}
+		}
+
+		review.ID = 0
+		review.PlanID = plan.ID
+		if err := tx.Create(review).Error; err != nil {
+			return err
+		}
+
+		if review.Status == types.PlanApplied {
+			return supersedePlans(tx, plan.LineageID, plan.ID)
+		}
+		return nil
+	})
+}
+
+// supersedePlans moves the Plans of a lineage waiting to be applied,
+// other than a given one, to the superseded status
+func supersedePlans(tx *gorm.DB, lineageID, planID uint) error {
+	var ids []uint
+	err := tx.Model(&types.Plan{}).
+		Where("lineage_id = ? AND id <> ? AND status IN ?", lineageID, planID,
+			[]string{types.PlanPending, types.PlanApproved}).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	err = tx.Model(&types.Plan{}).Where("id IN ?", ids).Update("status", types.PlanSuperseded).Error
+	if err != nil {
+		return err
+	}
+
+	reviews := make([]types.PlanReview, 0, len(ids))
+	for _, id := range ids {
+		reviews = append(reviews, types.PlanReview{
+			PlanID:  id,
+			Status:  types.PlanSuperseded,
+			Comment: fmt.Sprintf("Superseded by plan %d", planID),
+		})
+	}
+	return tx.Create(&reviews).Error
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from, to string
+		expected bool
+	}{
+		{types.PlanPending, types.PlanApproved, true},
+		{types.PlanPending, types.PlanRejected, true},
+		{types.PlanPending, types.PlanApplied, false},
+		{types.PlanApproved, types.PlanApplied, true},
+		{types.PlanApproved, types.PlanPending, false},
+		{types.PlanRejected, types.PlanApproved, false},
+		{types.PlanApplied, types.PlanSuperseded, false},
+		{types.PlanSuperseded, types.PlanApproved, false},
+	}
+
+	for _, c := range cases {
+		if got := canTransition(c.from, c.to); got != c.expected {
+			t.Errorf("Expected transition from %s to %s: %v, got %v", c.from, c.to, c.expected, got)
+		}
+	}
+}
+
+func TestReviewPlan_Invalid(t *testing.T) {
+	db := &Database{}
+
+	err := db.ReviewPlan("1", &types.PlanReview{Reviewer: "testUser"})
+	assert.True(t, errors.Is(err, ErrInvalidReview), "unexpected error: %v", err)
+
+	err = db.ReviewPlan("1", &types.PlanReview{Status: "merged", Reviewer: "testUser"})
+	assert.True(t, errors.Is(err, ErrInvalidReview), "unexpected error: %v", err)
+
+	err = db.ReviewPlan("1", &types.PlanReview{Status: types.PlanApplied})
+	assert.True(t, errors.Is(err, ErrInvalidReview), "unexpected error: %v", err)
+}
+
+func TestReviewPlan_InvalidTransition(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT "id","lineage_id","status","submitted_by" FROM "plans"`).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "lineage_id", "status", "submitted_by"}).
+			AddRow(1, 1, types.PlanPending, "token:ci"))
+	mock.ExpectQuery(`^SELECT "id","lineage_id","status","submitted_by" FROM "plans"`).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "lineage_id", "status", "submitted_by"}).
+			AddRow(1, 1, types.PlanPending, "token:ci"))
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	err = db.ReviewPlan("1", &types.PlanReview{Status: types.PlanApplied, Reviewer: "token:ci"})
+	assert.True(t, errors.Is(err, ErrInvalidTransition), "unexpected error: %v", err)
+
+	err = db.ReviewPlan("1", &types.PlanReview{Status: types.PlanApproved, Reviewer: "token:ci"})
+	assert.True(t, errors.Is(err, ErrSelfApproval), "unexpected error: %v", err)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestReviewPlan_Applied(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT "id","lineage_id","status","submitted_by" FROM "plans"`).
+		WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "lineage_id", "status", "submitted_by"}).
+			AddRow(2, 1, types.PlanApproved, "token:ci"))
+
+	// The plan is applied and the other plans superseded in a single transaction
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE "plans" SET "status"=\$1,"updated_at"=\$2 WHERE \(id = \$3 AND status = \$4\)`).
+		WithArgs(types.PlanApplied, sqlmock.AnyArg(), 2, types.PlanApproved).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`^INSERT INTO "plan_reviews"`).
+		WithArgs(2, sqlmock.AnyArg(), types.PlanApplied, "token:ci", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`^SELECT "id" FROM "plans"`).
+		WithArgs(1, 2, types.PlanPending, types.PlanApproved).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec(`^UPDATE "plans" SET "status"=\$1,"updated_at"=\$2 WHERE id IN \(\$3\)`).
+		WithArgs(types.PlanSuperseded, sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`^INSERT INTO "plan_reviews"`).
+		WithArgs(3, sqlmock.AnyArg(), types.PlanSuperseded, "", "Superseded by plan 2").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectCommit()
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	review := types.PlanReview{Status: types.PlanApplied, Reviewer: "token:ci"}
+	err = db.ReviewPlan("2", &review)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), review.ID)
+	assert.Equal(t, uint(2), review.PlanID)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/camptocamp/terraboard/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// savedSearchParams lists the SearchAttribute parameters kept in a SavedSearch
+var savedSearchParams = []string{"versionid", "type", "name", "key", "value", "tf_version", "lineage_value"}
+
+// savedSearchQuery parses the URL-encoded query of a SavedSearch,
+// keeping only the parameters used to filter search results
+func savedSearchQuery(raw string) (url.Values, error) {
+	parsed, err := url.ParseQuery(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	for _, p := range savedSearchParams {
+		if v := parsed.Get(p); v != "" {
+			query.Set(p, v)
+		}
+	}
+	if len(query) == 0 {
+		return nil, fmt.Errorf("query has no search parameter")
+	}
+	return query, nil
+}
+
+// InsertSavedSearch validates and inserts a SavedSearch in the Database
+func (db *Database) InsertSavedSearch(search *types.SavedSearch) error {
+	if search.Name == "" {
+		return fmt.Errorf("saved search name is required")
+	}
+
+	query, err := savedSearchQuery(search.Query)
+	if err != nil {
+		return fmt.Errorf("invalid saved search query: %v", err)
+	}
+	search.Query = query.Encode()
+
+	return db.Create(search).Error
+}
+
+// ListSavedSearches returns all SavedSearches from the Database,
+// optionally filtered by owner
+func (db *Database) ListSavedSearches(owner string) (searches []types.SavedSearch, err error) {
+	query := db.Order("name")
+	if owner != "" {
+		query = query.Where("owner = ?", owner)
+	}
+	err = query.Find(&searches).Error
+	return
+}
+
+// GetSavedSearch retrieves a SavedSearch by its ID from the Database
+func (db *Database) GetSavedSearch(id string) (search types.SavedSearch, err error) {
+	err = db.First(&search, "id = ?", id).Error
+	return
+}
+
+// DeleteSavedSearch removes a SavedSearch of an owner and its results history
+// from the Database. The SavedSearches of other owners are not found.
+func (db *Database) DeleteSavedSearch(id, owner string) error {
+	var search types.SavedSearch
+	if err := db.First(&search, "id = ? AND owner = ?", id, owner).Error; err != nil {
+		return err
+	}
+
+	if err := db.Where("saved_search_id = ?", search.ID).Delete(&types.SavedSearchResult{}).Error; err != nil {
+		return err
+	}
+	return db.Delete(&search).Error
+}
+
+// GetSavedSearchResults returns the history of result counts of a SavedSearch,
+// most recent first
+func (db *Database) GetSavedSearchResults(id string) (results []types.SavedSearchResult, err error) {
+	err = db.Where("saved_search_id = ?", id).
+		Order("evaluated_at desc").
+		Find(&results).Error
+	return
+}
+
+// EvaluateSavedSearches runs all the SavedSearches and stores their result counts.
+// A SavedSearch which fails is logged and skipped.
+func (db *Database) EvaluateSavedSearches() error {
+	var searches []types.SavedSearch
+	if err := db.Find(&searches).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, s := range searches {
+		query, err := savedSearchQuery(s.Query)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"saved_search": s.Name,
+				"error":        err,
+			}).Error("Invalid saved search query, skipping")
+			continue
+		}
+
+		count, err := db.countSearchAttribute(query)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"saved_search": s.Name,
+				"error":        err,
+			}).Error("Failed to evaluate saved search")
+			continue
+		}
+
+		result := types.SavedSearchResult{
+			SavedSearchID: s.ID,
+			EvaluatedAt:   now,
+			Count:         count,
+		}
+		if err := db.Create(&result).Error; err != nil {
+			log.WithFields(log.Fields{
+				"saved_search": s.Name,
+				"error":        err,
+			}).Error("Failed to store saved search result")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+func TestSavedSearchQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    string
+		want    url.Values
+		wantErr bool
+	}{
+		{
+			"Search parameters only",
+			"type=aws_instance&key=ami&value=ami-123&page=2&format=csv",
+			url.Values{
+				"type":  []string{"aws_instance"},
+				"key":   []string{"ami"},
+				"value": []string{"ami-123"},
+			},
+			false,
+		},
+		{
+			"No search parameter",
+			"page=2",
+			nil,
+			true,
+		},
+		{
+			"Invalid query",
+			"type=%zz",
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := savedSearchQuery(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TestSavedSearchQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf(
+					"TestSavedSearchQuery() -> \n\ngot:\n%v,\n\nwant:\n%v",
+					got,
+					tt.want,
+				)
+			}
+		})
+	}
+}
+
+func TestInsertSavedSearch(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO \"saved_searches\" (.+)").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "old amis", "john", "type=aws_instance&value=ami-123").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	search := types.SavedSearch{
+		Name:  "old amis",
+		Owner: "john",
+		Query: "value=ami-123&type=aws_instance&page=3",
+	}
+	err = db.InsertSavedSearch(&search)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), search.ID)
+	assert.Equal(t, "type=aws_instance&value=ami-123", search.Query)
+
+	err = db.InsertSavedSearch(&types.SavedSearch{Query: "type=aws_instance"})
+	assert.EqualError(t, err, "saved search name is required")
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestEvaluateSavedSearches(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT (.+) FROM \"saved_searches\"").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "query"}).
+			AddRow(3, "failing", "type=aws_s3_bucket").
+			AddRow(1, "old amis", "type=aws_instance&value=ami-123").
+			AddRow(2, "broken", "page=1"))
+	// A failing search doesn't prevent evaluating the next ones
+	mock.ExpectQuery("^SELECT count(.+)").
+		WithArgs("%aws_s3_bucket%").
+		WillReturnError(fmt.Errorf("timeout"))
+	mock.ExpectQuery("^SELECT count(.+)").
+		WithArgs("%aws_instance%", "%ami-123%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+	mock.ExpectBegin()
+	mock.ExpectQuery("^INSERT INTO \"saved_search_results\" (.+)").
+		WithArgs(1, sqlmock.AnyArg(), 4).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	err = db.EvaluateSavedSearches()
+	assert.Nil(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestGetSavedSearchResults(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT (.+) FROM \"saved_search_results\" WHERE saved_search_id = (.+) ORDER BY evaluated_at desc").
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "count"}).
+			AddRow(2, 3).
+			AddRow(1, 4))
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	results, err := db.GetSavedSearchResults("1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, 3, results[0].Count)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
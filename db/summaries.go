@@ -0,0 +1,72 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/camptocamp/terraboard/risk"
+	"github.com/camptocamp/terraboard/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// MigratePlanSummaries computes the summaries of the Plans which were
+// inserted before summaries were recorded, and classifies again the risk
+// of the Plans whose summary was computed with other risk rules
+func (db *Database) MigratePlanSummaries() error {
+	var plans []types.Plan
+	err := db.Select("id", "parsed_plan_id").
+		Where("NOT EXISTS (SELECT 1 FROM plan_summaries WHERE plan_summaries.plan_id = plans.id)").
+		Find(&plans).Error
+	if err != nil {
+		return err
+	}
+
+	for _, p := range plans {
+		var parsed types.PlanModel
+		if p.ParsedPlanID.Valid {
+			err := db.Preload("PlanResourceChanges").Preload("PlanResourceChanges.Change").
+				First(&parsed, p.ParsedPlanID.Int64).Error
+			if err != nil {
+				return fmt.Errorf("failed to load plan %d: %v", p.ID, err)
+			}
+		}
+
+		summary := risk.Summarize(parsed, db.RiskRules)
+		summary.PlanID = p.ID
+		if err := db.Create(&summary).Error; err != nil {
+			return fmt.Errorf("failed to insert summary of plan %d: %v", p.ID, err)
+		}
+	}
+	if len(plans) > 0 {
+		log.Infof("Computed the summaries of %d plans", len(plans))
+	}
+
+	return db.classifyPlans()
+}
+
+// classifyPlans classifies the risk of the Plans whose summary was computed
+// with other risk rules than the current ones. The changes of Plans whose
+// risk is unknown are unknown, they are left as is.
+func (db *Database) classifyPlans() error {
+	fingerprint := risk.Fingerprint(db.RiskRules)
+	var summaries []types.PlanSummary
+	err := db.Preload("ResourceTypes").
+		Where("risk_rules IS DISTINCT FROM ? AND risk <> ?", fingerprint, types.RiskUnknown).
+		Find(&summaries).Error
+	if err != nil {
+		return err
+	}
+
+	for _, s := range summaries {
+		err := db.Model(&types.PlanSummary{}).Where("id = ?", s.ID).Updates(map[string]interface{}{
+			"risk":       risk.Classify(s.ResourceTypes, db.RiskRules),
+			"risk_rules": fingerprint,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to classify plan %d: %v", s.PlanID, err)
+		}
+	}
+	if len(summaries) > 0 {
+		log.Infof("Classified the risk of %d plans with the current rules", len(summaries))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/camptocamp/terraboard/risk"
+	"github.com/camptocamp/terraboard/types"
+)
+
+func TestMigratePlanSummaries(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	rules, err := risk.ParseRules([]string{"high:delete:aws_rds_*"})
+	assert.Nil(t, err)
+	fingerprint := risk.Fingerprint(rules)
+
+	mock.ExpectQuery(`^SELECT "id","parsed_plan_id" FROM "plans" WHERE NOT EXISTS`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parsed_plan_id"}))
+	// The summary of a plan computed with other rules is classified again
+	mock.ExpectQuery(`^SELECT \* FROM "plan_summaries" WHERE risk_rules IS DISTINCT FROM \$1 AND risk <> \$2`).
+		WithArgs(fingerprint, types.RiskUnknown).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_id", "delete", "risk", "risk_rules"}).
+			AddRow(1, 3, 1, types.RiskLow, ""))
+	mock.ExpectQuery(`^SELECT \* FROM "plan_summary_resource_types" WHERE "plan_summary_resource_types"."plan_summary_id" = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_summary_id", "type", "delete"}).
+			AddRow(1, 1, "aws_rds_cluster", 1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE "plan_summaries" SET "risk"=\$1,"risk_rules"=\$2 WHERE id = \$3`).
+		WithArgs(types.RiskHigh, fingerprint, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	db := &Database{
+		DB:        gormDB,
+		RiskRules: rules,
+	}
+
+	err = db.MigratePlanSummaries()
+	assert.Nil(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/camptocamp/terraboard/types"
+	"gorm.io/gorm"
+)
+
+// apiTokenPrefix starts every APIToken, so they can be recognized (e.g. by secret scanners)
+const apiTokenPrefix = "tb_"
+
+var (
+	// ErrInvalidToken is returned when an APIToken is unknown
+	ErrInvalidToken = errors.New("invalid API token")
+	// ErrTokenScope is returned when an APIToken is not allowed to manage the Plans of a lineage
+	ErrTokenScope = errors.New("API token not allowed for this lineage")
+)
+
+// hashAPIToken returns the hash under which an APIToken is stored.
+// Tokens are random, so a fast unsalted hash is enough to protect them.
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MigrateAPITokens creates the tables of the APITokens, if needed,
+// without migrating the rest of the Database
+func (db *Database) MigrateAPITokens() error {
+	return db.AutoMigrate(&types.APIToken{}, &types.APITokenScope{})
+}
+
+// CreateAPIToken creates an APIToken allowed to submit Plans for the given
+// lineages and state path prefixes. It returns the token itself, which is
+// not stored and can't be retrieved afterwards.
+func (db *Database) CreateAPIToken(name string, lineages, pathPrefixes []string) (string, types.APIToken, error) {
+	apiToken := types.APIToken{Name: name}
+	if name == "" {
+		return "", apiToken, errors.New("token name is required")
+	}
+	for _, l := range lineages {
+		if l == "" {
+			return "", apiToken, errors.New("token lineages can't be empty")
+		}
+		apiToken.Scopes = append(apiToken.Scopes, types.APITokenScope{Lineage: l})
+	}
+	for _, p := range pathPrefixes {
+		if p == "" {
+			return "", apiToken, errors.New("token path prefixes can't be empty")
+		}
+		apiToken.Scopes = append(apiToken.Scopes, types.APITokenScope{PathPrefix: p})
+	}
+	if len(apiToken.Scopes) == 0 {
+		return "", apiToken, errors.New("token requires at least one lineage or path prefix")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", apiToken, err
+	}
+	token := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	apiToken.Prefix = token[:len(apiTokenPrefix)+6]
+	apiToken.Hash = hashAPIToken(token)
+
+	if err := db.Create(&apiToken).Error; err != nil {
+		return "", apiToken, err
+	}
+	return token, apiToken, nil
+}
+
+// ListAPITokens returns all the APITokens, along with their scopes
+func (db *Database) ListAPITokens() (tokens []types.APIToken, err error) {
+	err = db.Preload("Scopes", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("id")
+	}).Order("name").Find(&tokens).Error
+	return
+}
+
+// RevokeAPIToken deletes an APIToken by its name
+func (db *Database) RevokeAPIToken(name string) error {
+	var apiToken types.APIToken
+	if err := db.Select("id").First(&apiToken, "name = ?", name).Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("api_token_id = ?", apiToken.ID).Delete(&types.APITokenScope{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&apiToken).Error
+	})
+}
+
+// GetAPIToken returns the APIToken matching a token, along with its scopes
+func (db *Database) GetAPIToken(token string) (apiToken types.APIToken, err error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return apiToken, ErrInvalidToken
+	}
+	err = db.Preload("Scopes").First(&apiToken, "hash = ?", hashAPIToken(token)).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = ErrInvalidToken
+	}
+	return
+}
+
+// CheckPlanToken returns an error wrapping ErrTokenScope if an APIToken
+// is not allowed to manage a Plan, or gorm.ErrRecordNotFound if it doesn't exist
+func (db *Database) CheckPlanToken(apiToken types.APIToken, id string) error {
+	var plan types.Plan
+	err := db.Joins("Lineage").Select(`"plans"."id"`).First(&plan, `"plans"."id" = ?`, id).Error
+	if err != nil {
+		return err
+	}
+	return db.checkTokenScope(apiToken, plan.Lineage.Value)
+}
+
+// checkTokenScope returns an error wrapping ErrTokenScope if an APIToken
+// is not allowed to manage the Plans of a lineage. Path prefixes are matched
+// against the paths of the states of the lineage, so they don't allow
+// the lineages with no known state.
+func (db *Database) checkTokenScope(apiToken types.APIToken, lineage string) error {
+	var prefixes []string
+	for _, s := range apiToken.Scopes {
+		if s.Lineage != "" && s.Lineage == lineage {
+			return nil
+		}
+		if s.PathPrefix != "" {
+			prefixes = append(prefixes, s.PathPrefix)
+		}
+	}
+
+	if len(prefixes) > 0 {
+		var paths []string
+		err := db.Model(&types.State{}).
+			Joins("JOIN lineages ON lineages.id = states.lineage_id").
+			Where("lineages.value = ?", lineage).
+			Distinct().
+			Pluck("states.path", &paths).Error
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(p, prefix) {
+					return nil
+				}
+			}
+		}
+		if len(paths) == 0 {
+			return fmt.Errorf("%w: token '%s' only allows path prefixes, and lineage '%s' has no known state to match them against: use a token allowed for this lineage",
+				ErrTokenScope, apiToken.Name, lineage)
+		}
+	}
+
+	return fmt.Errorf("%w: token '%s' can't manage plans of lineage '%s'", ErrTokenScope, apiToken.Name, lineage)
+}
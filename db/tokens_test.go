@@ -0,0 +1,139 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+func TestCreateAPIToken(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^INSERT INTO "api_tokens" \("created_at","name","prefix","hash"\)`).
+		WithArgs(sqlmock.AnyArg(), "ci", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`^INSERT INTO "api_token_scopes" \("api_token_id","lineage","path_prefix"\)`).
+		WithArgs(1, "lineage_value", "", 1, "", "prod/").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectCommit()
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	token, apiToken, err := db.CreateAPIToken("ci", []string{"lineage_value"}, []string{"prod/"})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(token, apiTokenPrefix))
+	assert.True(t, strings.HasPrefix(token, apiToken.Prefix))
+	assert.Equal(t, hashAPIToken(token), apiToken.Hash)
+	assert.NotContains(t, apiToken.Hash, token)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestCreateAPIToken_Invalid(t *testing.T) {
+	db := &Database{}
+
+	_, _, err := db.CreateAPIToken("", []string{"lineage_value"}, nil)
+	assert.NotNil(t, err)
+	_, _, err = db.CreateAPIToken("ci", nil, nil)
+	assert.NotNil(t, err)
+	_, _, err = db.CreateAPIToken("ci", nil, []string{""})
+	assert.NotNil(t, err)
+}
+
+func TestGetAPIToken_Invalid(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT \* FROM "api_tokens" WHERE hash = \$1`).
+		WithArgs(hashAPIToken("tb_unknown")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	_, err = db.GetAPIToken("")
+	assert.True(t, errors.Is(err, ErrInvalidToken), "unexpected error: %v", err)
+	_, err = db.GetAPIToken("tb_unknown")
+	assert.True(t, errors.Is(err, ErrInvalidToken), "unexpected error: %v", err)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestCheckTokenScope(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT DISTINCT "states"."path" FROM "states" JOIN lineages`).
+		WithArgs("prod_lineage").
+		WillReturnRows(sqlmock.NewRows([]string{"path"}).AddRow("prod/app.tfstate"))
+	mock.ExpectQuery(`^SELECT DISTINCT "states"."path" FROM "states" JOIN lineages`).
+		WithArgs("staging_lineage").
+		WillReturnRows(sqlmock.NewRows([]string{"path"}).AddRow("staging/app.tfstate"))
+	mock.ExpectQuery(`^SELECT DISTINCT "states"."path" FROM "states" JOIN lineages`).
+		WithArgs("new_lineage").
+		WillReturnRows(sqlmock.NewRows([]string{"path"}))
+
+	db := &Database{
+		DB: gormDB,
+	}
+
+	apiToken := types.APIToken{
+		Name: "ci",
+		Scopes: []types.APITokenScope{
+			{Lineage: "lineage_value"},
+			{PathPrefix: "prod/"},
+		},
+	}
+
+	assert.Nil(t, db.checkTokenScope(apiToken, "lineage_value"))
+	assert.Nil(t, db.checkTokenScope(apiToken, "prod_lineage"))
+	err = db.checkTokenScope(apiToken, "staging_lineage")
+	assert.True(t, errors.Is(err, ErrTokenScope), "unexpected error: %v", err)
+	err = db.checkTokenScope(apiToken, "new_lineage")
+	assert.True(t, errors.Is(err, ErrTokenScope), "unexpected error: %v", err)
+	assert.Contains(t, err.Error(), "has no known state")
+
+	err = db.checkTokenScope(types.APIToken{Scopes: []types.APITokenScope{{Lineage: "lineage_value"}}}, "other_lineage")
+	assert.True(t, errors.Is(err, ErrTokenScope), "unexpected error: %v", err)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+// ErrMalformedPlan is returned when a submitted plan is not a JSON object,
+// or not a binary plan file which can be decoded
+var ErrMalformedPlan = errors.New("malformed plan")
+
+// PlanValidationError lists the problems of a submitted plan
+type PlanValidationError struct {
+	Problems []string
+}
+
+func (e *PlanValidationError) Error() string {
+	return "invalid plan: " + strings.Join(e.Problems, "; ")
+}
+
+// supportedPlanFormats lists the supported major versions
+// of the Terraform plan JSON format
+var supportedPlanFormats = []string{"0", "1"}
+
+// jsonType returns the name of the JSON type a Go type is decoded from
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Ptr:
+		return jsonType(t.Elem())
+	}
+	return "number"
+}
+
+// typeProblem describes a JSON value of an unexpected type
+func typeProblem(prefix string, err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Sprintf("%s%s must be of type %s, got %s", prefix, typeErr.Field, jsonType(typeErr.Type), typeErr.Value)
+	}
+	return fmt.Sprintf("%sinvalid structure: %v", prefix, err)
+}
+
+// validatePlanJSON checks the format version and structure of a Terraform plan JSON export
+func validatePlanJSON(raw json.RawMessage) (problems []string) {
+	var planJSON map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &planJSON); err != nil || planJSON == nil {
+		return []string{"plan_json must be a JSON object"}
+	}
+
+	var formatVersion string
+	if v, ok := planJSON["format_version"]; !ok {
+		problems = append(problems, "plan_json.format_version is required")
+	} else if err := json.Unmarshal(v, &formatVersion); err == nil {
+		// Values of an unexpected type are reported by the structure check
+		major := strings.SplitN(formatVersion, ".", 2)[0]
+		supported := false
+		for _, f := range supportedPlanFormats {
+			supported = supported || major == f
+		}
+		if !supported {
+			problems = append(problems, fmt.Sprintf("plan_json.format_version '%s' is not supported (expected %s.x)",
+				formatVersion, strings.Join(supportedPlanFormats, ".x or ")))
+		}
+	}
+
+	var model types.PlanModel
+	if err := json.Unmarshal(raw, &model); err != nil {
+		problems = append(problems, typeProblem("plan_json.", err))
+	}
+	return
+}
+
+// validatePlan checks a plan wrapped in JSON before its insertion. It returns
+// ErrMalformedPlan if the plan is not a JSON object, and a PlanValidationError
+// listing its problems if it is not a valid plan.
+func validatePlan(plan []byte) error {
+	var wrapper map[string]json.RawMessage
+	if err := json.Unmarshal(plan, &wrapper); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedPlan, err)
+	}
+	if wrapper == nil {
+		return fmt.Errorf("%w: expected a JSON object", ErrMalformedPlan)
+	}
+
+	var problems []string
+	var lineage string
+	if err := json.Unmarshal(wrapper["lineage"], &lineage); err != nil || lineage == "" {
+		problems = append(problems, "lineage is required")
+	}
+
+	var p types.Plan
+	if err := json.Unmarshal(plan, &p); err != nil {
+		problems = append(problems, typeProblem("", err))
+	}
+
+	if raw, ok := wrapper["plan_json"]; !ok || string(raw) == "null" {
+		problems = append(problems, "plan_json is required")
+	} else {
+		problems = append(problems, validatePlanJSON(raw)...)
+	}
+
+	if len(problems) > 0 {
+		return &PlanValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePlan(t *testing.T) {
+	testCases := []struct {
+		name      string
+		plan      string
+		malformed bool
+		problems  []string
+	}{
+		{
+			name: "valid",
+			plan: `{"lineage":"lineage","terraform_version":"1.0.0","exit_code":2,"plan_json":{"format_version":"1.1","resource_changes":[]}}`,
+		},
+		{
+			name: "legacy format",
+			plan: `{"lineage":"lineage","plan_json":{"format_version":"0.1"}}`,
+		},
+		{
+			name:      "not JSON",
+			plan:      `lineage`,
+			malformed: true,
+		},
+		{
+			name:      "not an object",
+			plan:      `["lineage"]`,
+			malformed: true,
+		},
+		{
+			name:      "null",
+			plan:      `null`,
+			malformed: true,
+		},
+		{
+			name:     "missing lineage and plan",
+			plan:     `{"terraform_version":"1.0.0"}`,
+			problems: []string{"lineage is required", "plan_json is required"},
+		},
+		{
+			name:     "invalid field type",
+			plan:     `{"lineage":"lineage","exit_code":"2","plan_json":{"format_version":"1.0"}}`,
+			problems: []string{"exit_code must be of type number, got string"},
+		},
+		{
+			name:     "plan_json not an object",
+			plan:     `{"lineage":"lineage","plan_json":"plan"}`,
+			problems: []string{"plan_json must be a JSON object"},
+		},
+		{
+			name:     "invalid resource changes",
+			plan:     `{"lineage":"lineage","plan_json":{"format_version":"1.0","resource_changes":{}}}`,
+			problems: []string{"plan_json.resource_changes must be of type array, got object"},
+		},
+		{
+			name:     "missing format version",
+			plan:     `{"lineage":"lineage","plan_json":{"terraform_version":"1.0.0"}}`,
+			problems: []string{"plan_json.format_version is required"},
+		},
+		{
+			name:     "unsupported format version",
+			plan:     `{"lineage":"lineage","plan_json":{"format_version":"2.0"}}`,
+			problems: []string{"plan_json.format_version '2.0' is not supported (expected 0.x or 1.x)"},
+		},
+		{
+			name:     "invalid format version type",
+			plan:     `{"lineage":"lineage","plan_json":{"format_version":1}}`,
+			problems: []string{"plan_json.format_version must be of type string, got number"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validatePlan([]byte(tc.plan))
+			if tc.malformed {
+				assert.True(t, errors.Is(err, ErrMalformedPlan), "unexpected error: %v", err)
+				return
+			}
+			if tc.problems == nil {
+				assert.Nil(t, err)
+				return
+			}
+			var validationErr *PlanValidationError
+			if assert.True(t, errors.As(err, &validationErr), "unexpected error: %v", err) {
+				assert.Equal(t, tc.problems, validationErr.Problems)
+			}
+		})
+	}
+}
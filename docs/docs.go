@@ -1,17 +1,9 @@
-// Package docs GENERATED BY THE COMMAND ABOVE; DO NOT EDIT
-// This file was generated by swaggo/swag
+// Package docs Code generated by swaggo/swag. DO NOT EDIT
 package docs
 
-import (
-	"bytes"
-	"encoding/json"
-	"strings"
-	"text/template"
+import "github.com/swaggo/swag"
 
-	"github.com/swaggo/swag"
-)
-
-var doc = `{
+const docTemplate = `{
     "schemes": {{ marshal .Schemes }},
     "swagger": "2.0",
     "info": {
@@ -53,9 +45,85 @@ var doc = `{
                 }
             }
         },
+        "/compare": {
+            "get": {
+                "description": "Compares two States ('from' and 'to'), which may belong to different lineages (e.g. staging and production workspaces of a stack). Module path prefixes of the 'from' State can be mapped to the ones of the 'to' State, and attributes can be ignored.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Compares two States of any lineages",
+                "operationId": "compare-states",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Lineage of the from State",
+                        "name": "from_lineage",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Version of the from State (defaults to latest)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Lineage of the to State",
+                        "name": "to_lineage",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Version of the to State (defaults to latest)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Module path prefix mapping, as from_prefix=to_prefix",
+                        "name": "map",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Attribute path to ignore for all resource types (overrides configured rules)",
+                        "name": "ignore",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Ignore rule, as resource_type.attribute globs (overrides configured rules)",
+                        "name": "ignore_rule",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "ok",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/lineages": {
             "get": {
-                "description": "List all existing lineages",
+                "description": "List existing lineages, most recent first. Returns also paging informations (current page ans total items count in database)",
                 "produces": [
                     "application/json"
                 ],
@@ -64,9 +132,27 @@ var doc = `{
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Limit",
+                        "description": "Page",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of lineages per page (default 20, max 1000)",
+                        "name": "page_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Alias of page_size",
                         "name": "limit",
                         "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor returned as next_cursor by the previous page",
+                        "name": "cursor",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -81,9 +167,11 @@ var doc = `{
         },
         "/lineages/stats": {
             "get": {
-                "description": "Returns Lineage states stats along with paging information",
+                "description": "Returns Lineage states stats along with paging information, or all of them as a CSV/NDJSON file when 'format' is set",
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "text/csv",
+                    "application/x-ndjson"
                 ],
                 "summary": "Get Lineage states stats",
                 "operationId": "list-state-stats",
@@ -93,6 +181,24 @@ var doc = `{
                         "description": "Current page for pagination",
                         "name": "page",
                         "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of results per page (default 20, max 1000)",
+                        "name": "page_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor returned as next_cursor by the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Export format (csv, ndjson)",
+                        "name": "format",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -191,11 +297,58 @@ var doc = `{
                 }
             }
         },
+        "/lineages/{lineage}/changes": {
+            "get": {
+                "description": "Retrieves, for each pair of consecutive versions of a Lineage, the counts and addresses of resources added, removed, changed and moved. Sorted by most recent to oldest.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get Lineage changes",
+                "operationId": "get-lineage-changes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Lineage",
+                        "name": "lineage",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of changes per page (default 20, max 1000)",
+                        "name": "page_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor returned as next_cursor by the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "ok",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/lineages/{lineage}/compare": {
             "get": {
                 "description": "Compares two versions ('from' and 'to') of a State",
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "text/markdown",
+                    "text/html"
                 ],
                 "summary": "Compares two versions of a State",
                 "operationId": "state-compare",
@@ -220,6 +373,32 @@ var doc = `{
                         "name": "to",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Attribute path to ignore for all resource types (overrides configured rules)",
+                        "name": "ignore",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Ignore rule, as resource_type.attribute globs (overrides configured rules)",
+                        "name": "ignore_rule",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Report format ('markdown', 'html'), JSON by default",
+                        "name": "format",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -252,7 +431,7 @@ var doc = `{
         },
         "/plans": {
             "get": {
-                "description": "Provides a specific Plan of a lineage using ID or all plans if no ID is provided",
+                "description": "Provides a specific Plan of a lineage using ID or all plans if no ID is provided. Values marked as sensitive by Terraform are masked.",
                 "produces": [
                     "application/json"
                 ],
@@ -273,9 +452,21 @@ var doc = `{
                     },
                     {
                         "type": "integer",
-                        "description": "Limit",
+                        "description": "Number of plans per page (default 20, max 1000)",
+                        "name": "page_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Alias of page_size",
                         "name": "limit",
                         "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor returned as next_cursor by the previous page",
+                        "name": "cursor",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -288,9 +479,10 @@ var doc = `{
                 }
             },
             "post": {
-                "description": "Submits and inserts a new Terraform plan in the database.",
+                "description": "Submits and inserts a new Terraform plan in the database, either wrapped in JSON or as a binary plan file ('terraform plan -out'). Binary plan files are decoded without the schemas of providers or their configuration, their metadata are passed as query parameters. Requires an API token allowed to submit plans for the plan's lineage.",
                 "consumes": [
-                    "application/json"
+                    "application/json",
+                    "application/zip"
                 ],
                 "summary": "Submit a new plan",
                 "operationId": "submit-plan",
@@ -302,13 +494,92 @@ var doc = `{
                         "schema": {
                             "$ref": "#/definitions/api.planPayload"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Binary plan files: URL of the remote that generated the plan",
+                        "name": "git_remote",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Binary plan files: commit hash",
+                        "name": "git_commit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Binary plan files: URL of the CI that sent the plan",
+                        "name": "ci_url",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Binary plan files: triggering event",
+                        "name": "source",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Binary plan files: exit code of 'terraform plan -detailed-exitcode'",
+                        "name": "exit_code",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "API token, as 'Bearer \u003ctoken\u003e'",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "ok",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Malformed plan",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid API token",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "API token not allowed for the plan's lineage",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Invalid plan, with the list of its problems",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
                     }
-                ]
+                }
             }
         },
         "/plans/summary": {
             "get": {
-                "description": "Provides summary of all Plan by lineage (only metadata added by the wrapper). Sorted by most recent to oldest. Returns also paging informations (current page ans total items count in database)",
+                "description": "Provides summary of all Plan by lineage (only metadata added by the wrapper, and the counts of changes with the risk level computed on insertion). Sorted by most recent to oldest. Returns also paging informations (current page ans total items count in database)",
                 "produces": [
                     "application/json"
                 ],
@@ -329,9 +600,21 @@ var doc = `{
                     },
                     {
                         "type": "integer",
-                        "description": "Limit",
+                        "description": "Number of plans per page (default 20, max 1000)",
+                        "name": "page_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Alias of page_size",
                         "name": "limit",
                         "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor returned as next_cursor by the previous page",
+                        "name": "cursor",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -344,66 +627,490 @@ var doc = `{
                 }
             }
         },
-        "/resource/names": {
-            "get": {
-                "description": "Lists all resource names",
-                "produces": [
-                    "application/json"
+        "/plans/{id}": {
+            "delete": {
+                "description": "Removes a Plan, along with its parsed plan, summary, reviews, apply and policy results. Requires an API token allowed for the plan's lineage.",
+                "summary": "Delete a Plan",
+                "operationId": "delete-plan",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Plan's ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "API token, as 'Bearer \u003ctoken\u003e'",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
                 ],
-                "summary": "Get resource names",
-                "operationId": "list-resource-names",
                 "responses": {
-                    "200": {
-                        "description": "ok",
+                    "204": {
+                        "description": "no content",
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "401": {
+                        "description": "Missing or invalid API token",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "API token not allowed for the plan's lineage",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Plan not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
             }
         },
-        "/resource/types": {
+        "/plans/{id}/apply": {
             "get": {
-                "description": "Lists all Resource types",
+                "description": "Provides the State version resulting from the apply of a Plan, matched when the version was inserted, and whether (and where) it diverges from the Plan's planned values",
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Get Resource types",
-                "operationId": "list-resource-types",
+                "summary": "Get the apply of a Plan",
+                "operationId": "get-plan-apply",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Plan's ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "ok",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/types.PlanApply"
+                        }
+                    },
+                    "404": {
+                        "description": "Plan not applied yet",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     }
                 }
             }
         },
-        "/resource/types/count": {
+        "/plans/{id}/comment": {
             "get": {
-                "description": "Lists all resource types with their associated count",
+                "description": "Renders a plan as a Markdown summary of its resource changes, grouped by module, with the attribute diffs of updated and replaced resources in collapsible sections. Sensitive values are masked, and the resource changes beyond the size limit of GitHub comments (65536 characters) are left out.",
                 "produces": [
-                    "application/json"
+                    "text/markdown"
+                ],
+                "summary": "Get a plan as a Markdown comment",
+                "operationId": "get-plan-comment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Plan ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Get resource types with count",
-                "operationId": "list-resource-types-with-count",
                 "responses": {
                     "200": {
-                        "description": "ok",
+                        "description": "Markdown comment",
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "404": {
+                        "description": "Plan not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
-            }
-        },
-        "/search/attribute": {
-            "get": {
-                "description": "Performs a search on Resource Attributes by various parameters",
+            },
+            "post": {
+                "description": "Posts a plan, rendered as a Markdown comment, on the open GitLab merge request or GitHub pull request containing its commit, in the repository of its git remote. Requires a GitLab or GitHub token to be set for the repository host, and an API token allowed for the plan's lineage.",
                 "produces": [
                     "application/json"
                 ],
+                "summary": "Comment a plan on its merge request",
+                "operationId": "post-plan-comment",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Plan ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "API token, as 'Bearer \u003ctoken\u003e'",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "URL of the comment",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid API token",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "API token not allowed for the plan's lineage",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Plan or merge request not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unsupported git remote",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/plans/{id}/compare": {
+            "get": {
+                "description": "Compares the prior State of a Plan with the latest State of its lineage, reporting whether the State was written since the Plan was computed (serial status, unknown if the Plan has no prior serial) and which resources changed in between. The values marked as sensitive by the Plan are masked on both sides, and their changes are unknown.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Compares a Plan with the latest State",
+                "operationId": "compare-plan",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Plan's ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.PlanStateCompare"
+                        }
+                    }
+                }
+            }
+        },
+        "/plans/{id}/reviews": {
+            "get": {
+                "description": "Provides the review status of a plan (pending, approved, rejected, applied or superseded), along with its reviews, oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get the review status of a plan",
+                "operationId": "get-plan-status",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Plan ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.PlanStatus"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Records a review of a plan: a change of its status, a comment, or both. Pending plans can be approved, rejected or superseded, approved plans can be applied, rejected or superseded. Requires an API token allowed for the plan's lineage, which is the reviewer, unless the auth headers are trusted: the logged user is then the reviewer. A plan can't be approved or rejected by the token it was submitted with.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Review a plan",
+                "operationId": "review-plan",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Plan ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Review",
+                        "name": "review",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.reviewPayload"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "API token, as 'Bearer \u003ctoken\u003e', required unless the auth headers are trusted",
+                        "name": "Authorization",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/types.PlanReview"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid review",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid API token",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "API token not allowed for the plan's lineage, or plan approved or rejected by its submitter",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Plan not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Invalid status transition",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/resource/names": {
+            "get": {
+                "description": "Lists all resource names",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get resource names",
+                "operationId": "list-resource-names",
+                "responses": {
+                    "200": {
+                        "description": "ok",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/resource/types": {
+            "get": {
+                "description": "Lists all Resource types",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get Resource types",
+                "operationId": "list-resource-types",
+                "responses": {
+                    "200": {
+                        "description": "ok",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/resource/types/count": {
+            "get": {
+                "description": "Lists all resource types with their associated count",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get resource types with count",
+                "operationId": "list-resource-types-with-count",
+                "responses": {
+                    "200": {
+                        "description": "ok",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/resources/history": {
+            "get": {
+                "description": "Retrieves every version of a Lineage in which a resource address existed, oldest first, with its attribute values and their changes since the previous of these versions",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get resource history",
+                "operationId": "get-resource-history",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Lineage",
+                        "name": "lineage",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Resource address (e.g. module.network.aws_security_group.web[0])",
+                        "name": "address",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.ResourceHistory"
+                        }
+                    }
+                }
+            }
+        },
+        "/search": {
+            "get": {
+                "description": "Performs a full-text search on Resources of the latest States (address, type, attribute keys and values), ranked by relevance. The query supports quoted phrases, OR and -exclusions.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Full-text search on Resources",
+                "operationId": "full-text-search",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search query",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Current page for pagination",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of results per page (default 20, max 1000)",
+                        "name": "page_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor returned as next_cursor by the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "ok",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/search/attribute": {
+            "get": {
+                "description": "Performs a search on Resource Attributes by various parameters, returning paging information and result counts (facets) per resource type, Terraform version, lineage and module path, or all results as a CSV/NDJSON file when 'format' is set",
+                "produces": [
+                    "application/json",
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
                 "summary": "Search Resource Attributes",
                 "operationId": "search-attribute",
                 "parameters": [
@@ -438,16 +1145,172 @@ var doc = `{
                         "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "Terraform Version",
-                        "name": "tf_version",
-                        "in": "query"
-                    },
+                        "type": "string",
+                        "description": "Terraform Version",
+                        "name": "tf_version",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Lineage",
+                        "name": "lineage_value",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Current page for pagination",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of results per page (default 20, max 1000)",
+                        "name": "page_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor returned as next_cursor by the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Export format (csv, ndjson)",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "ok",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/searches": {
+            "get": {
+                "description": "Lists all saved searches, optionally filtered by owner",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List saved searches",
+                "operationId": "list-saved-searches",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Owner",
+                        "name": "owner",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "ok",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Saves a search query (name and SearchAttribute parameters), evaluated after each database sync",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Save a search",
+                "operationId": "save-search",
+                "parameters": [
+                    {
+                        "description": "Saved search",
+                        "name": "search",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.SavedSearch"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "created",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/searches/{id}": {
+            "get": {
+                "description": "Provides a saved search by its ID",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get a saved search",
+                "operationId": "get-saved-search",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Saved search ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "ok",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Removes a saved search and its results history. Only the searches of the logged user can be deleted (the searches without owner when the auth headers are not trusted).",
+                "summary": "Delete a saved search",
+                "operationId": "delete-saved-search",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Saved search ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "no content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/searches/{id}/results": {
+            "get": {
+                "description": "Returns the history of result counts of a saved search, most recent first",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get saved search results",
+                "operationId": "get-saved-search-results",
+                "parameters": [
                     {
-                        "type": "string",
-                        "description": "Lineage",
-                        "name": "lineage_value",
-                        "in": "query"
+                        "type": "integer",
+                        "description": "Saved search ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -526,60 +1389,401 @@ var doc = `{
                     "type": "string"
                 }
             }
+        },
+        "api.reviewPayload": {
+            "type": "object",
+            "properties": {
+                "comment": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "The status to move the plan to (approved, rejected, applied or superseded), empty for comments",
+                    "type": "string"
+                }
+            }
+        },
+        "types.Attribute": {
+            "type": "object",
+            "properties": {
+                "key": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.AttributeDiff": {
+            "type": "object",
+            "properties": {
+                "kind": {
+                    "type": "string"
+                },
+                "new_value": {},
+                "old_value": {},
+                "path": {
+                    "type": "string"
+                },
+                "sensitive": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "types.OutputDiff": {
+            "type": "object",
+            "properties": {
+                "new_value": {
+                    "type": "string"
+                },
+                "old_value": {
+                    "type": "string"
+                },
+                "sensitive": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "types.OutputsCompare": {
+            "type": "object",
+            "properties": {
+                "added": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/types.OutputDiff"
+                    }
+                },
+                "changed": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/types.OutputDiff"
+                    }
+                },
+                "removed": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/types.OutputDiff"
+                    }
+                }
+            }
+        },
+        "types.PlanApply": {
+            "type": "object",
+            "properties": {
+                "diverged": {
+                    "type": "boolean"
+                },
+                "divergences": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.PlanDivergence"
+                    }
+                },
+                "last_modified": {
+                    "type": "string"
+                },
+                "plan_id": {
+                    "type": "integer"
+                },
+                "serial": {
+                    "type": "integer"
+                },
+                "version_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.PlanDivergence": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "path": {
+                    "description": "The attribute path, for changed attributes",
+                    "type": "string"
+                }
+            }
+        },
+        "types.PlanReview": {
+            "type": "object",
+            "properties": {
+                "comment": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "plan_id": {
+                    "type": "integer"
+                },
+                "reviewer": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "The status set by the review, empty for comments",
+                    "type": "string"
+                }
+            }
+        },
+        "types.PlanStateCompare": {
+            "type": "object",
+            "properties": {
+                "changed": {
+                    "description": "Changed is true when resources of the latest State differ from the prior State of the Plan",
+                    "type": "boolean"
+                },
+                "compare": {
+                    "$ref": "#/definitions/types.StateCompare"
+                },
+                "latest_serial": {
+                    "type": "integer"
+                },
+                "latest_version_id": {
+                    "type": "string"
+                },
+                "lineage": {
+                    "type": "string"
+                },
+                "plan_id": {
+                    "type": "integer"
+                },
+                "plan_serial": {
+                    "type": "integer"
+                },
+                "plan_version_id": {
+                    "type": "string"
+                },
+                "serial_status": {
+                    "description": "SerialStatus is \"stale\" when the State was written since the Plan was\ncomputed, \"current\" when it was not, and \"unknown\" when the serial of\nthe prior State of the Plan is unknown",
+                    "type": "string"
+                },
+                "stale_serial": {
+                    "description": "StaleSerial is true when the State was written since the Plan was computed",
+                    "type": "boolean"
+                }
+            }
+        },
+        "types.PlanStatus": {
+            "type": "object",
+            "properties": {
+                "lineage": {
+                    "type": "string"
+                },
+                "plan_id": {
+                    "type": "integer"
+                },
+                "reviews": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.PlanReview"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.ResourceDiff": {
+            "type": "object",
+            "properties": {
+                "attribute_diffs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.AttributeDiff"
+                    }
+                },
+                "only_in_new": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "only_in_old": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "unified_diff": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.ResourceHistory": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "lineage": {
+                    "type": "string"
+                },
+                "versions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.ResourceVersion"
+                    }
+                }
+            }
+        },
+        "types.ResourceMove": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string"
+                },
+                "resource_diff": {
+                    "$ref": "#/definitions/types.ResourceDiff"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.ResourceVersion": {
+            "type": "object",
+            "properties": {
+                "attributes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.Attribute"
+                    }
+                },
+                "changed": {
+                    "type": "boolean"
+                },
+                "changes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.AttributeDiff"
+                    }
+                },
+                "last_modified": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                },
+                "serial": {
+                    "type": "integer"
+                },
+                "version_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.SavedSearch": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "query": {
+                    "description": "The URL-encoded SearchAttribute parameters",
+                    "type": "string"
+                }
+            }
+        },
+        "types.StateCompare": {
+            "type": "object",
+            "properties": {
+                "differences": {
+                    "type": "object",
+                    "properties": {
+                        "in_both": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        },
+                        "moved": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/types.ResourceMove"
+                            }
+                        },
+                        "only_in_new": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        },
+                        "only_in_old": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        },
+                        "resource_diff": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "$ref": "#/definitions/types.ResourceDiff"
+                            }
+                        }
+                    }
+                },
+                "outputs": {
+                    "$ref": "#/definitions/types.OutputsCompare"
+                },
+                "stats": {
+                    "type": "object",
+                    "properties": {
+                        "from": {
+                            "$ref": "#/definitions/types.StateInfo"
+                        },
+                        "to": {
+                            "$ref": "#/definitions/types.StateInfo"
+                        }
+                    }
+                }
+            }
+        },
+        "types.StateInfo": {
+            "type": "object",
+            "properties": {
+                "path": {
+                    "type": "string"
+                },
+                "resource_count": {
+                    "type": "integer"
+                },
+                "serial": {
+                    "type": "integer"
+                },
+                "terraform_version": {
+                    "type": "string"
+                },
+                "version_id": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
 
-type swaggerInfo struct {
-	Version     string
-	Host        string
-	BasePath    string
-	Schemes     []string
-	Title       string
-	Description string
-}
-
 // SwaggerInfo holds exported Swagger Info so clients can modify it
-var SwaggerInfo = swaggerInfo{
-	Version:     "1.0",
-	Host:        "localhost:8080",
-	BasePath:    "/api",
-	Schemes:     []string{},
-	Title:       "Terraboard API",
-	Description: "This is the API for Terraboard.",
-}
-
-type s struct{}
-
-func (s *s) ReadDoc() string {
-	sInfo := SwaggerInfo
-	sInfo.Description = strings.Replace(sInfo.Description, "\n", "\\n", -1)
-
-	t, err := template.New("swagger_info").Funcs(template.FuncMap{
-		"marshal": func(v interface{}) string {
-			a, _ := json.Marshal(v)
-			return string(a)
-		},
-		"escape": func(v interface{}) string {
-			// escape tabs
-			str := strings.Replace(v.(string), "\t", "\\t", -1)
-			// replace " with \", and if that results in \\", replace that with \\\"
-			str = strings.Replace(str, "\"", "\\\"", -1)
-			return strings.Replace(str, "\\\\\"", "\\\\\\\"", -1)
-		},
-	}).Parse(doc)
-	if err != nil {
-		return doc
-	}
-
-	var tpl bytes.Buffer
-	if err := t.Execute(&tpl, sInfo); err != nil {
-		return doc
-	}
-
-	return tpl.String()
+var SwaggerInfo = &swag.Spec{
+	Version:          "1.0",
+	Host:             "localhost:8080",
+	BasePath:         "/api",
+	Schemes:          []string{},
+	Title:            "Terraboard API",
+	Description:      "This is the API for Terraboard.",
+	InfoInstanceName: "swagger",
+	SwaggerTemplate:  docTemplate,
+	LeftDelim:        "{{",
+	RightDelim:       "}}",
 }
 
 func init() {
-	swag.Register(swag.Name, &s{})
+	swag.Register(SwaggerInfo.InstanceName(), SwaggerInfo)
 }
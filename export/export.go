@@ -0,0 +1,182 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/camptocamp/terraboard/config"
+	"github.com/camptocamp/terraboard/db"
+	"github.com/camptocamp/terraboard/types"
+)
+
+// Supported export formats
+const (
+	CSV    = "csv"
+	NDJSON = "ndjson"
+)
+
+// ContentType returns the MIME type associated to an export format,
+// or an error if the format is not supported
+func ContentType(format string) (string, error) {
+	switch format {
+	case CSV:
+		return "text/csv", nil
+	case NDJSON:
+		return "application/x-ndjson", nil
+	}
+	return "", fmt.Errorf("unsupported export format '%s'", format)
+}
+
+// encoder writes records one at a time in a given format
+type encoder interface {
+	encode(values []string, v interface{}) error
+	flush() error
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) encode(values []string, _ interface{}) error {
+	return e.w.Write(values)
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) encode(_ []string, v interface{}) error {
+	return e.enc.Encode(v)
+}
+
+func (e *ndjsonEncoder) flush() error {
+	return nil
+}
+
+// newEncoder returns an encoder for format, writing the header line
+// when the format requires one
+func newEncoder(format string, w io.Writer, header []string) (encoder, error) {
+	switch format {
+	case CSV:
+		e := &csvEncoder{w: csv.NewWriter(w)}
+		if err := e.w.Write(header); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case NDJSON:
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("unsupported export format '%s'", format)
+}
+
+var searchResultHeader = []string{
+	"path", "version_id", "tf_version", "serial", "lineage_value", "module_path",
+	"resource_type", "resource_name", "resource_index", "attribute_key", "attribute_value",
+}
+
+func searchResultValues(r types.SearchResult) []string {
+	return []string{
+		r.Path, r.VersionID, r.TFVersion, strconv.FormatInt(r.Serial, 10), r.LineageValue, r.ModulePath,
+		r.ResourceType, r.ResourceName, r.ResourceIndex, r.AttributeKey, r.AttributeValue,
+	}
+}
+
+var stateStatHeader = []string{
+	"path", "lineage_value", "terraform_version", "serial", "version_id", "last_modified", "resource_count",
+}
+
+func stateStatValues(s types.StateStat) []string {
+	return []string{
+		s.Path, s.LineageValue, s.TFVersion, strconv.FormatInt(s.Serial, 10), s.VersionID,
+		s.LastModified.Format(time.RFC3339), strconv.Itoa(s.ResourceCount),
+	}
+}
+
+// SearchAttribute writes all the attributes matching query to w in the given format
+func SearchAttribute(d *db.Database, query url.Values, format string, w io.Writer) error {
+	enc, err := newEncoder(format, w, searchResultHeader)
+	if err != nil {
+		return err
+	}
+
+	err = d.StreamSearchAttribute(query, func(r types.SearchResult) error {
+		return enc.encode(searchResultValues(r), r)
+	})
+	if err != nil {
+		return err
+	}
+	return enc.flush()
+}
+
+// StateStats writes the statistics of all the Lineages to w in the given format
+func StateStats(d *db.Database, format string, w io.Writer) error {
+	enc, err := newEncoder(format, w, stateStatHeader)
+	if err != nil {
+		return err
+	}
+
+	err = d.StreamStateStats(func(s types.StateStat) error {
+		return enc.encode(stateStatValues(s), s)
+	})
+	if err != nil {
+		return err
+	}
+	return enc.flush()
+}
+
+// searchQuery converts the search parameters of the export command
+// into a SearchAttribute query
+func searchQuery(c config.ExportConfig) url.Values {
+	query := url.Values{}
+	params := map[string]string{
+		"versionid":     c.VersionID,
+		"type":          c.ResourceType,
+		"name":          c.ResourceName,
+		"key":           c.AttributeKey,
+		"value":         c.AttributeValue,
+		"tf_version":    c.TFVersion,
+		"lineage_value": c.Lineage,
+	}
+	for k, v := range params {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	return query
+}
+
+// Run executes the export command, writing the requested data
+// to the configured output file or to stdout
+func Run(c config.ExportConfig, d *db.Database) (err error) {
+	out := os.Stdout
+	if c.Output != "" {
+		out, err = os.Create(c.Output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+		}()
+	}
+
+	switch c.Type {
+	case "states":
+		return StateStats(d, c.Format, out)
+	case "search":
+		return SearchAttribute(d, searchQuery(c), c.Format, out)
+	}
+	return fmt.Errorf("unsupported export type '%s'", c.Type)
+}
@@ -0,0 +1,124 @@
+package export
+
+import (
+	"bytes"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/camptocamp/terraboard/config"
+	"github.com/camptocamp/terraboard/db"
+)
+
+func TestContentType(t *testing.T) {
+	contentType, err := ContentType("csv")
+	assert.Nil(t, err)
+	assert.Equal(t, "text/csv", contentType)
+
+	contentType, err = ContentType("ndjson")
+	assert.Nil(t, err)
+	assert.Equal(t, "application/x-ndjson", contentType)
+
+	_, err = ContentType("xml")
+	assert.NotNil(t, err)
+}
+
+func TestSearchAttribute(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT (.+)").
+		WithArgs("%aws_instance%").
+		WillReturnRows(sqlmock.NewRows([]string{"path", "version_id", "tf_version", "serial", "type", "name", "key", "value"}).
+			AddRow("path", "foo", "1.0.0", 2, "aws_instance", "web", "ami", `"ami-123"`).
+			AddRow("path", "foo", "1.0.0", 2, "aws_instance", "web", "tags", `{"Name":"web, front"}`))
+
+	d := &db.Database{
+		DB: gormDB,
+	}
+
+	params := url.Values{}
+	params.Add("type", "aws_instance")
+
+	var buf bytes.Buffer
+	err = SearchAttribute(d, params, CSV, &buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "path,version_id,tf_version,serial,lineage_value,module_path,resource_type,resource_name,resource_index,attribute_key,attribute_value\n"+
+		"path,foo,1.0.0,2,,,aws_instance,web,,ami,\"\"\"ami-123\"\"\"\n"+
+		"path,foo,1.0.0,2,,,aws_instance,web,,tags,\"{\"\"Name\"\":\"\"web, front\"\"}\"\n", buf.String())
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestStateStats(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("^SELECT (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"path", "lineage_value", "last_modified", "resource_count"}).
+			AddRow("foo", "lineage1", time.Unix(1501782443, 0).UTC(), 3).
+			AddRow("bar", "lineage2", time.Unix(1501782443, 0).UTC(), 1))
+
+	d := &db.Database{
+		DB: gormDB,
+	}
+
+	var buf bytes.Buffer
+	err = StateStats(d, NDJSON, &buf)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"path":"foo","lineage_value":"lineage1","terraform_version":"","serial":0,"version_id":"","last_modified":"2017-08-03T17:47:23Z","resource_count":3}`+"\n"+
+		`{"path":"bar","lineage_value":"lineage2","terraform_version":"","serial":0,"version_id":"","last_modified":"2017-08-03T17:47:23Z","resource_count":1}`+"\n", buf.String())
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestStateStats_UnsupportedFormat(t *testing.T) {
+	var buf bytes.Buffer
+	err := StateStats(nil, "xml", &buf)
+	assert.NotNil(t, err)
+	assert.Equal(t, "", buf.String())
+}
+
+func TestSearchQuery(t *testing.T) {
+	expectedResult := url.Values{
+		"type":          []string{"aws_instance"},
+		"value":         []string{"ami-123"},
+		"lineage_value": []string{"lineage"},
+	}
+
+	result := searchQuery(config.ExportConfig{
+		Type:           "search",
+		Format:         "csv",
+		ResourceType:   "aws_instance",
+		AttributeValue: "ami-123",
+		Lineage:        "lineage",
+	})
+
+	if !reflect.DeepEqual(result, expectedResult) {
+		t.Fatalf("Expected %v, got %v", expectedResult, result)
+	}
+}
@@ -21,9 +21,14 @@ import (
 
 	"github.com/camptocamp/terraboard/api"
 	"github.com/camptocamp/terraboard/auth"
+	"github.com/camptocamp/terraboard/compare"
 	"github.com/camptocamp/terraboard/config"
 	"github.com/camptocamp/terraboard/db"
+	"github.com/camptocamp/terraboard/export"
+	"github.com/camptocamp/terraboard/policy"
+	"github.com/camptocamp/terraboard/risk"
 	"github.com/camptocamp/terraboard/state"
+	"github.com/camptocamp/terraboard/token"
 	"github.com/camptocamp/terraboard/util"
 	"github.com/gorilla/mux"
 	tfversion "github.com/hashicorp/terraform/version"
@@ -116,11 +121,62 @@ func refreshDB(syncInterval uint16, d *db.Database, sp state.Provider) {
 			}
 		}
 
+		evaluateSavedSearches(d)
+
 		log.Debugf("Waiting %d minutes until next DB sync", syncInterval)
 		time.Sleep(interval)
 	}
 }
 
+// Evaluate the saved searches against the synced states
+func evaluateSavedSearches(d *db.Database) {
+	if err := d.EvaluateSavedSearches(); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Failed to evaluate saved searches")
+	}
+}
+
+// planPurgeInterval is the interval between two purges of the plans exceeding the retention policy
+const planPurgeInterval = time.Hour
+
+// Delete the plans exceeding the retention policy
+func purgePlans(c config.PlanConfig, d *db.Database) {
+	maxAge := time.Duration(c.RetentionDays) * 24 * time.Hour
+	for {
+		deleted, err := d.PurgePlans(maxAge, int(c.RetentionCount))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Error("Failed to purge plans")
+		} else if deleted > 0 {
+			log.Infof("Purged %d plans", deleted)
+		}
+		time.Sleep(planPurgeInterval)
+	}
+}
+
+// migrateLineageChanges computes the changes of the lineages
+// inserted before they were recorded, without delaying the startup
+func migrateLineageChanges(d *db.Database) {
+	if err := d.MigrateLineageChanges(); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Lineage changes migration failed")
+	}
+}
+
+// migratePlanSummaries computes the summaries of the plans inserted before
+// they were recorded, and classifies the risk of the plans whose summary was
+// computed with other risk rules, without delaying the startup
+func migratePlanSummaries(d *db.Database) {
+	if err := d.MigratePlanSummaries(); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Plan summaries migration failed")
+	}
+}
+
 var version = "undefined"
 
 func getVersion(w http.ResponseWriter, _ *http.Request) {
@@ -140,8 +196,8 @@ func getVersion(w http.ResponseWriter, _ *http.Request) {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, Content-Length, Accept-Encoding")
 		next.ServeHTTP(w, r)
 	})
 }
@@ -152,13 +208,51 @@ func main() {
 
 	util.SetBasePath(c.Web.BaseURL)
 
+	ignoreRules, err := compare.ParseIgnoreRules(c.Compare.IgnoreRules)
+	if err != nil {
+		log.Fatal(err)
+	}
+	riskRules, err := risk.ParseRules(c.Plan.RiskRules)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policies, err := policy.Load(c.Plan.Policies)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	log.Infof("Terraboard %s (built for Terraform v%s) is starting...", version, tfversion.Version)
 
-	err := c.SetupLogging()
+	err = c.SetupLogging()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if c.Command == "export" {
+		database := db.Init(c.DB, c.Log.Level == "debug")
+		err := export.Run(c.Export, database)
+		database.Close()
+		if err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		return
+	}
+
+	if c.Command == "token" {
+		database, err := db.Open(c.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = database.MigrateAPITokens(); err == nil {
+			err = token.Run(c.Token, database)
+		}
+		database.Close()
+		if err != nil {
+			log.Fatalf("Token command failed: %v", err)
+		}
+		return
+	}
+
 	// Set up the state provider
 	sps, err := state.Configure(c)
 	if err != nil {
@@ -170,6 +264,12 @@ func main() {
 
 	// Set up the DB and start S3->DB sync
 	database := db.Init(c.DB, c.Log.Level == "debug")
+	database.MaskSensitivePlans = c.Plan.MaskSensitive
+	database.TrustProxyAuth = c.Plan.TrustProxyAuth
+	database.RiskRules = riskRules
+	database.Policies = policies
+	database.IgnoreRules = ignoreRules
+	database.Comment = c.Comment
 	if c.DB.NoSync {
 		log.Infof("Not syncing database, as requested.")
 	} else {
@@ -178,6 +278,11 @@ func main() {
 			go refreshDB(c.DB.SyncInterval, database, sp)
 		}
 	}
+	go migrateLineageChanges(database)
+	go migratePlanSummaries(database)
+	if c.Plan.RetentionDays > 0 || c.Plan.RetentionCount > 0 {
+		go purgePlans(c.Plan, database)
+	}
 	defer database.Close()
 
 	// Instantiate gorilla/mux router instance
@@ -193,9 +298,13 @@ func main() {
 		handleWithDB(api.ListTerraformVersionsWithCount, database))
 	apiRouter.HandleFunc(util.GetFullPath("lineages/{lineage}"), handleWithDB(api.GetState, database))
 	apiRouter.HandleFunc(util.GetFullPath("lineages/{lineage}/activity"), handleWithDB(api.GetLineageActivity, database))
+	apiRouter.HandleFunc(util.GetFullPath("lineages/{lineage}/changes"), handleWithDB(api.GetLineageChanges, database))
 	apiRouter.HandleFunc(util.GetFullPath("lineages/{lineage}/compare"), handleWithDB(api.StateCompare, database))
+	apiRouter.HandleFunc(util.GetFullPath("compare"), handleWithDB(api.CompareStates, database))
 	apiRouter.HandleFunc(util.GetFullPath("locks"), handleWithStateProviders(api.GetLocks, sps))
+	apiRouter.HandleFunc(util.GetFullPath("search"), handleWithDB(api.FullTextSearch, database))
 	apiRouter.HandleFunc(util.GetFullPath("search/attribute"), handleWithDB(api.SearchAttribute, database))
+	apiRouter.HandleFunc(util.GetFullPath("resources/history"), handleWithDB(api.GetResourceHistory, database))
 	apiRouter.HandleFunc(util.GetFullPath("resource/types"), handleWithDB(api.ListResourceTypes, database))
 	apiRouter.HandleFunc(util.GetFullPath("resource/types/count"), handleWithDB(api.ListResourceTypesWithCount, database))
 	apiRouter.HandleFunc(util.GetFullPath("resource/names"), handleWithDB(api.ListResourceNames, database))
@@ -203,6 +312,14 @@ func main() {
 	apiRouter.HandleFunc(util.GetFullPath("tf_versions"), handleWithDB(api.ListTfVersions, database))
 	apiRouter.HandleFunc(util.GetFullPath("plans"), handleWithDB(api.ManagePlans, database))
 	apiRouter.HandleFunc(util.GetFullPath("plans/summary"), handleWithDB(api.GetPlansSummary, database))
+	apiRouter.HandleFunc(util.GetFullPath("plans/{id}"), handleWithDB(api.ManagePlan, database))
+	apiRouter.HandleFunc(util.GetFullPath("plans/{id}/compare"), handleWithDB(api.ComparePlan, database))
+	apiRouter.HandleFunc(util.GetFullPath("plans/{id}/reviews"), handleWithDB(api.ManagePlanReviews, database))
+	apiRouter.HandleFunc(util.GetFullPath("plans/{id}/apply"), handleWithDB(api.GetPlanApply, database))
+	apiRouter.HandleFunc(util.GetFullPath("plans/{id}/comment"), handleWithDB(api.ManagePlanComment, database))
+	apiRouter.HandleFunc(util.GetFullPath("searches"), handleWithDB(api.ManageSavedSearches, database))
+	apiRouter.HandleFunc(util.GetFullPath("searches/{id}"), handleWithDB(api.ManageSavedSearch, database))
+	apiRouter.HandleFunc(util.GetFullPath("searches/{id}/results"), handleWithDB(api.GetSavedSearchResults, database))
 
 	// Handle swagger files
 	swaggerRouter := mux.NewRouter()
@@ -0,0 +1,56 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/camptocamp/terraboard/pkg/client/rest"
+)
+
+// Client is a client of the GitHub REST API
+type Client struct {
+	Endpoint string
+	Token    string
+}
+
+// PullRequest is a GitHub pull request
+type PullRequest struct {
+	Number  int    `json:"number"`
+	State   string `json:"state"`
+	HTMLURL string `json:"html_url"`
+}
+
+// IssueComment is a comment of a GitHub issue or pull request
+type IssueComment struct {
+	ID      int    `json:"id"`
+	HTMLURL string `json:"html_url"`
+}
+
+// NewClient returns a new Client
+func NewClient(endpoint, token string) Client {
+	return Client{
+		Endpoint: endpoint,
+		Token:    token,
+	}
+}
+
+// GetCommitPullRequests returns the pull requests of a repository,
+// written as '<owner>/<name>', containing a commit
+func (c *Client) GetCommitPullRequests(repository, sha string) (pullRequests []PullRequest, err error) {
+	err = c.do("GET", fmt.Sprintf("repos/%s/commits/%s/pulls", repository, url.PathEscape(sha)), nil, &pullRequests)
+	return
+}
+
+// CreateIssueComment comments an issue or a pull request of a repository
+func (c *Client) CreateIssueComment(repository string, number int, body string) (comment IssueComment, err error) {
+	err = c.do("POST", fmt.Sprintf("repos/%s/issues/%d/comments", repository, number),
+		map[string]string{"body": body}, &comment)
+	return
+}
+
+// do sends a request to the API
+func (c *Client) do(method, path string, payload, response interface{}) error {
+	return rest.Do(method, fmt.Sprintf("%s/%s", c.Endpoint, path), c.Token,
+		http.Header{"Accept": {"application/vnd.github+json"}}, payload, response)
+}
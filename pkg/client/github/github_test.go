@@ -0,0 +1,56 @@
+package github
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCommitPullRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/repos/owner/repo/commits/abc1234/pulls", r.URL.Path)
+		assert.Equal(t, "Bearer github-token", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/vnd.github+json", r.Header.Get("Accept"))
+		io.WriteString(w, `[{"number": 3, "state": "open", "html_url": "https://github.com/owner/repo/pull/3"}]`)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "github-token")
+	pullRequests, err := c.GetCommitPullRequests("owner/repo", "abc1234")
+	assert.Nil(t, err)
+	assert.Equal(t, []PullRequest{{Number: 3, State: "open", HTMLURL: "https://github.com/owner/repo/pull/3"}}, pullRequests)
+}
+
+func TestCreateIssueComment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/repos/owner/repo/issues/3/comments", r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"body":"comment"}`, string(body))
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id": 7, "html_url": "https://github.com/owner/repo/pull/3#issuecomment-7"}`)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "github-token")
+	comment, err := c.CreateIssueComment("owner/repo", 3, "comment")
+	assert.Nil(t, err)
+	assert.Equal(t, IssueComment{ID: 7, HTMLURL: "https://github.com/owner/repo/pull/3#issuecomment-7"}, comment)
+}
+
+func TestCreateIssueComment_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"message": "Resource not accessible by integration"}`)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "github-token")
+	_, err := c.CreateIssueComment("owner/repo", 3, "comment")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "403 Forbidden")
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"time"
 
+	"github.com/camptocamp/terraboard/pkg/client/rest"
 	"github.com/machinebox/graphql"
 )
 
@@ -258,6 +260,37 @@ func (c *Client) GetState(projectID, stateName, version string) (state []byte, e
 	return
 }
 
+// MergeRequest is a GitLab merge request
+type MergeRequest struct {
+	IID    int    `json:"iid"`
+	State  string `json:"state"`
+	WebURL string `json:"web_url"`
+}
+
+// Note is a comment of a GitLab merge request
+type Note struct {
+	ID int `json:"id"`
+}
+
+// GetCommitMergeRequests returns the merge requests of a project containing a commit
+func (c *Client) GetCommitMergeRequests(projectPath, sha string) (mergeRequests []MergeRequest, err error) {
+	err = c.rest("GET", fmt.Sprintf("projects/%s/repository/commits/%s/merge_requests",
+		url.PathEscape(projectPath), url.PathEscape(sha)), nil, &mergeRequests)
+	return
+}
+
+// CreateMergeRequestNote comments a merge request of a project
+func (c *Client) CreateMergeRequestNote(projectPath string, iid int, body string) (note Note, err error) {
+	err = c.rest("POST", fmt.Sprintf("projects/%s/merge_requests/%d/notes", url.PathEscape(projectPath), iid),
+		map[string]string{"body": body}, &note)
+	return
+}
+
+// rest sends a request to the REST API
+func (c *Client) rest(method, path string, payload, response interface{}) error {
+	return rest.Do(method, fmt.Sprintf("%s/api/v4/%s", c.Endpoint, path), c.Token, nil, payload, response)
+}
+
 // Query ..
 func (c *Client) Query(request string, response interface{}, vars map[string]interface{}) error {
 	req := graphql.NewRequest(request)
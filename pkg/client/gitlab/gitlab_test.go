@@ -1,3 +1,69 @@
 package gitlab
 
-// TODO: implement!
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCommitMergeRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/api/v4/projects/group%2Fproject/repository/commits/abc1234/merge_requests", r.URL.EscapedPath())
+		assert.Equal(t, "Bearer gitlab-token", r.Header.Get("Authorization"))
+		io.WriteString(w, `[{"iid": 2, "state": "opened", "web_url": "https://gitlab.example.com/group/project/-/merge_requests/2"}]`)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "gitlab-token")
+	mergeRequests, err := c.GetCommitMergeRequests("group/project", "abc1234")
+	assert.Nil(t, err)
+	assert.Equal(t, []MergeRequest{{IID: 2, State: "opened", WebURL: "https://gitlab.example.com/group/project/-/merge_requests/2"}}, mergeRequests)
+}
+
+func TestCreateMergeRequestNote(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/v4/projects/group%2Fproject/merge_requests/2/notes", r.URL.EscapedPath())
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"body":"comment"}`, string(body))
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id": 42}`)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "gitlab-token")
+	note, err := c.CreateMergeRequestNote("group/project", 2, "comment")
+	assert.Nil(t, err)
+	assert.Equal(t, Note{ID: 42}, note)
+}
+
+func TestCreateMergeRequestNote_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"message": "401 Unauthorized"}`)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "gitlab-token")
+	_, err := c.CreateMergeRequestNote("group/project", 2, "comment")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "401 Unauthorized")
+}
+
+func TestGetState(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v4/projects/1/terraform/state/production/versions/3", r.URL.Path)
+		assert.Equal(t, "Bearer gitlab-token", r.Header.Get("Authorization"))
+		io.WriteString(w, `{"version": 4, "serial": 3}`)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "gitlab-token")
+	state, err := c.GetState("1", "production", "3")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"version": 4, "serial": 3}`, string(state))
+}
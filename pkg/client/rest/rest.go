@@ -0,0 +1,45 @@
+// Package rest sends requests to the JSON REST APIs of the git hosting services
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Do sends a request to a REST API, authenticated with a bearer token and
+// the given headers, encoding its payload (if any) and decoding its response as JSON
+func Do(method, url, token string, header http.Header, payload, response interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		j, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(j)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, msg)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
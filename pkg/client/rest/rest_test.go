@@ -0,0 +1,62 @@
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/items", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "application/vnd.test+json", r.Header.Get("Accept"))
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"name":"item"}`, string(body))
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id": 1}`)
+	}))
+	defer server.Close()
+
+	var item struct {
+		ID int `json:"id"`
+	}
+	err := Do(http.MethodPost, server.URL+"/items", "token", http.Header{"Accept": {"application/vnd.test+json"}},
+		map[string]string{"name": "item"}, &item)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, item.ID)
+}
+
+func TestDo_NoPayload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Empty(t, body)
+		io.WriteString(w, `["a", "b"]`)
+	}))
+	defer server.Close()
+
+	var items []string
+	err := Do(http.MethodGet, server.URL, "token", nil, nil, &items)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, items)
+}
+
+func TestDo_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"message": "Not Found"}`)
+	}))
+	defer server.Close()
+
+	var items []string
+	err := Do(http.MethodGet, server.URL+"/missing", "token", nil, nil, &items)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "404 Not Found")
+	assert.Contains(t, err.Error(), `{"message": "Not Found"}`)
+	assert.Nil(t, items)
+}
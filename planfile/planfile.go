@@ -0,0 +1,429 @@
+package planfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/camptocamp/terraboard/internal/terraform/addrs"
+	"github.com/camptocamp/terraboard/internal/terraform/states/statefile"
+	"github.com/zclconf/go-cty/cty"
+	ctyJson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Files of the zip archives written by 'terraform plan -out'
+const (
+	planFilePlan       = "tfplan"
+	planFilePriorState = "tfstate"
+)
+
+// planFileMagic is the signature of zip archives
+var planFileMagic = []byte("PK\x03\x04")
+
+// IsPlanFile tells whether a submitted plan is a binary plan file
+// written by 'terraform plan -out', rather than a JSON wrapper
+func IsPlanFile(plan []byte) bool {
+	return bytes.HasPrefix(plan, planFileMagic)
+}
+
+// planJSONFormatVersion is the version of the Terraform JSON output format
+// plan files are converted to: the one of the Terraform version whose plan
+// file format is decoded
+const planJSONFormatVersion = "1.2"
+
+// stateJSONFormatVersion is the version of the Terraform JSON output format
+// of states
+const stateJSONFormatVersion = "1.0"
+
+// File is the content of a binary plan file
+type File struct {
+	plan tfplan
+	// PriorState is the state the plan was computed from
+	PriorState *statefile.File
+}
+
+// TerraformVersion returns the version of Terraform which wrote the plan file
+func (pf File) TerraformVersion() string {
+	return pf.plan.terraformVersion
+}
+
+// resourceMode returns the name of a resource mode
+// in the Terraform JSON output format
+func resourceMode(mode addrs.ResourceMode) string {
+	switch mode {
+	case addrs.ManagedResourceMode:
+		return "managed"
+	case addrs.DataResourceMode:
+		return "data"
+	}
+	return ""
+}
+
+// planFileResource is a resource instance of a plan prior state or planned
+// values, in the Terraform JSON output format
+type planFileResource struct {
+	Address       string          `json:"address"`
+	Mode          string          `json:"mode"`
+	Type          string          `json:"type"`
+	Name          string          `json:"name"`
+	Index         interface{}     `json:"index,omitempty"`
+	ProviderName  string          `json:"provider_name"`
+	SchemaVersion uint64          `json:"schema_version"`
+	Values        json.RawMessage `json:"values"`
+	// The sensitivity object of values
+	SensitiveValues interface{} `json:"sensitive_values,omitempty"`
+}
+
+// planFileModule is a module of a plan prior state or planned values,
+// in the Terraform JSON output format
+type planFileModule struct {
+	Address      string             `json:"address,omitempty"`
+	Resources    []planFileResource `json:"resources,omitempty"`
+	ChildModules []*planFileModule  `json:"child_modules,omitempty"`
+}
+
+// planFileModules are the modules of a plan prior state or planned values,
+// by address
+type planFileModules map[string]*planFileModule
+
+// module returns the module of an address, adding it
+// and its parents to the module tree if needed
+func (modules planFileModules) module(addr addrs.ModuleInstance) *planFileModule {
+	if m, ok := modules[addr.String()]; ok {
+		return m
+	}
+	m := &planFileModule{Address: addr.String()}
+	modules[addr.String()] = m
+	if !addr.IsRoot() {
+		parent := modules.module(addr.Parent())
+		parent.ChildModules = append(parent.ChildModules, m)
+	}
+	return m
+}
+
+// planFileIndex returns the JSON value of a resource instance key
+func planFileIndex(key addrs.InstanceKey) interface{} {
+	switch k := key.(type) {
+	case addrs.IntKey:
+		return int(k)
+	case addrs.StringKey:
+		return string(k)
+	}
+	return nil
+}
+
+// sensitivePaths converts the paths of the sensitive values of a resource
+// instance of a state. Paths through set elements, which can't be addressed
+// in JSON, are cut to the set, which is marked as sensitive as a whole.
+func sensitivePaths(pvms []cty.PathValueMarks) []tfplanPath {
+	paths := make([]tfplanPath, 0, len(pvms))
+	for _, pvm := range pvms {
+		path := make(tfplanPath, 0, len(pvm.Path))
+	steps:
+		for _, step := range pvm.Path {
+			switch s := step.(type) {
+			case cty.GetAttrStep:
+				path = append(path, s.Name)
+			case cty.IndexStep:
+				switch s.Key.Type() {
+				case cty.String:
+					path = append(path, s.Key.AsString())
+				case cty.Number:
+					path = append(path, json.Number(s.Key.AsBigFloat().Text('f', -1)))
+				default:
+					break steps
+				}
+			}
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// priorStateOutputs converts the outputs of the root module of a state
+// to the Terraform JSON output format
+func priorStateOutputs(sf *statefile.File) (map[string]interface{}, error) {
+	root := sf.State.RootModule()
+	if root == nil || len(root.OutputValues) == 0 {
+		return nil, nil
+	}
+
+	outputs := make(map[string]interface{}, len(root.OutputValues))
+	for name, o := range root.OutputValues {
+		value, err := ctyJson.Marshal(o.Value, o.Value.Type())
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of output %s: %v", name, err)
+		}
+		typ, err := ctyJson.MarshalType(o.Value.Type())
+		if err != nil {
+			return nil, fmt.Errorf("invalid type of output %s: %v", name, err)
+		}
+		outputs[name] = map[string]interface{}{
+			"sensitive": o.Sensitive,
+			"value":     json.RawMessage(value),
+			"type":      json.RawMessage(typ),
+		}
+	}
+	return outputs, nil
+}
+
+// priorStateJSON converts the prior state of a plan file
+// to the Terraform plan JSON output format, with its outputs and
+// the sensitive values of its resources
+func priorStateJSON(sf *statefile.File) (json.RawMessage, error) {
+	modules := make(planFileModules)
+	root := modules.module(addrs.RootModuleInstance)
+
+	moduleKeys := make([]string, 0, len(sf.State.Modules))
+	for k := range sf.State.Modules {
+		moduleKeys = append(moduleKeys, k)
+	}
+	sort.Strings(moduleKeys)
+
+	for _, mk := range moduleKeys {
+		m := sf.State.Modules[mk]
+		mod := modules.module(m.Addr)
+
+		resourceKeys := make([]string, 0, len(m.Resources))
+		for k := range m.Resources {
+			resourceKeys = append(resourceKeys, k)
+		}
+		sort.Strings(resourceKeys)
+
+		for _, rk := range resourceKeys {
+			r := m.Resources[rk]
+			instanceKeys := make([]addrs.InstanceKey, 0, len(r.Instances))
+			for k := range r.Instances {
+				instanceKeys = append(instanceKeys, k)
+			}
+			sort.Slice(instanceKeys, func(i, j int) bool {
+				return addrs.InstanceKeyLess(instanceKeys[i], instanceKeys[j])
+			})
+
+			for _, key := range instanceKeys {
+				src := r.Instances[key].Current
+				if src == nil {
+					continue
+				}
+				values := json.RawMessage(src.AttrsJSON)
+				if src.AttrsFlat != nil {
+					j, err := json.Marshal(src.AttrsFlat)
+					if err != nil {
+						return nil, err
+					}
+					values = j
+				}
+				var decoded interface{}
+				if err := json.Unmarshal(values, &decoded); err != nil {
+					return nil, fmt.Errorf("invalid values of %s: %v", r.Addr.Instance(key), err)
+				}
+				mod.Resources = append(mod.Resources, planFileResource{
+					Address:         r.Addr.Instance(key).String(),
+					Mode:            resourceMode(r.Addr.Resource.Mode),
+					Type:            r.Addr.Resource.Type,
+					Name:            r.Addr.Resource.Name,
+					Index:           planFileIndex(key),
+					ProviderName:    r.ProviderConfig.Provider.String(),
+					SchemaVersion:   src.SchemaVersion,
+					Values:          values,
+					SensitiveValues: sensitiveJSON(decoded, sensitivePaths(src.AttrSensitivePaths)),
+				})
+			}
+		}
+	}
+
+	values := map[string]interface{}{
+		"root_module": root,
+	}
+	outputs, err := priorStateOutputs(sf)
+	if err != nil {
+		return nil, err
+	}
+	if outputs != nil {
+		values["outputs"] = outputs
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"format_version":    stateJSONFormatVersion,
+		"terraform_version": sf.TerraformVersion.String(),
+		"values":            values,
+	})
+}
+
+// providerName returns the name of the provider of a resource instance
+// from the address of its provider configuration
+func providerName(config string) string {
+	addr, diags := addrs.ParseAbsProviderConfigStr(config)
+	if diags.HasErrors() {
+		return config
+	}
+	return addr.Provider.String()
+}
+
+// resourceChangesJSON converts the resource changes of a plan file to the
+// Terraform JSON output format, and returns them with the planned values
+// of the resources
+func resourceChangesJSON(plan tfplan) (changes []interface{}, root *planFileModule, err error) {
+	modules := make(planFileModules)
+	root = modules.module(addrs.RootModuleInstance)
+	changes = []interface{}{}
+
+	for _, rc := range plan.resourceChanges {
+		addr, diags := addrs.ParseAbsResourceInstanceStr(rc.addr)
+		if diags.HasErrors() {
+			return nil, nil, fmt.Errorf("invalid resource address %s: %v", rc.addr, diags.Err())
+		}
+		change, err := rc.change.json(false)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid change of %s: %v", rc.addr, err)
+		}
+		if len(rc.requiredReplace) > 0 {
+			change["replace_paths"] = rc.requiredReplace
+		}
+
+		resource := addr.Resource.Resource
+		res := map[string]interface{}{
+			"address":       rc.addr,
+			"mode":          resourceMode(resource.Mode),
+			"type":          resource.Type,
+			"name":          resource.Name,
+			"provider_name": providerName(rc.provider),
+			"change":        change,
+		}
+		if !addr.Module.IsRoot() {
+			res["module_address"] = addr.Module.String()
+		}
+		if index := planFileIndex(addr.Resource.Key); index != nil {
+			res["index"] = index
+		}
+		if rc.prevRunAddr != "" && rc.prevRunAddr != rc.addr {
+			res["previous_address"] = rc.prevRunAddr
+		}
+		if rc.deposedKey != "" {
+			res["deposed"] = rc.deposedKey
+		}
+		changes = append(changes, res)
+
+		// Resource instances are planned to exist after apply
+		// unless they are deleted, as deposed objects are
+		if tfplanActions[rc.change.action].after < 0 || rc.deposedKey != "" {
+			continue
+		}
+		values, err := json.Marshal(change["after"])
+		if err != nil {
+			return nil, nil, err
+		}
+		mod := modules.module(addr.Module)
+		mod.Resources = append(mod.Resources, planFileResource{
+			Address:         rc.addr,
+			Mode:            resourceMode(resource.Mode),
+			Type:            resource.Type,
+			Name:            resource.Name,
+			Index:           planFileIndex(addr.Resource.Key),
+			ProviderName:    providerName(rc.provider),
+			Values:          values,
+			SensitiveValues: change["after_sensitive"],
+		})
+	}
+	return
+}
+
+// JSON converts a plan file to the Terraform plan JSON output format.
+// Values are decoded without the schemas of providers, and the configuration
+// is not included.
+func (pf File) JSON() (json.RawMessage, error) {
+	variables := make(map[string]interface{})
+	for name, raw := range pf.plan.variables {
+		value, _, err := decodeMsgpack(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of variable %s: %v", name, err)
+		}
+		variables[name] = map[string]interface{}{"value": value}
+	}
+
+	resourceChanges, plannedRoot, err := resourceChangesJSON(pf.plan)
+	if err != nil {
+		return nil, err
+	}
+
+	outputChanges := make(map[string]interface{})
+	for _, oc := range pf.plan.outputChanges {
+		change, err := oc.change.json(oc.sensitive)
+		if err != nil {
+			return nil, fmt.Errorf("invalid change of output %s: %v", oc.name, err)
+		}
+		outputChanges[oc.name] = change
+	}
+
+	priorState, err := priorStateJSON(pf.PriorState)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert prior state: %v", err)
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"format_version":    planJSONFormatVersion,
+		"terraform_version": pf.plan.terraformVersion,
+		"variables":         variables,
+		"planned_values": map[string]interface{}{
+			"root_module": plannedRoot,
+		},
+		"resource_changes": resourceChanges,
+		"output_changes":   outputChanges,
+		"prior_state":      priorState,
+		"errored":          pf.plan.errored,
+	})
+}
+
+// Read decodes a binary plan file
+func Read(plan []byte) (pf File, err error) {
+	r, err := zip.NewReader(bytes.NewReader(plan), int64(len(plan)))
+	if err != nil {
+		return pf, fmt.Errorf("invalid plan file: %v", err)
+	}
+
+	var hasPlan bool
+	for _, f := range r.File {
+		switch f.Name {
+		case planFilePlan:
+			b, err := readPlanFileEntry(f)
+			if err != nil {
+				return pf, fmt.Errorf("failed to read plan file changes: %v", err)
+			}
+			if pf.plan, err = decodeTfplan(b); err != nil {
+				return pf, fmt.Errorf("failed to decode plan file changes: %v", err)
+			}
+			hasPlan = true
+		case planFilePriorState:
+			rc, err := f.Open()
+			if err != nil {
+				return pf, fmt.Errorf("failed to open plan file prior state: %v", err)
+			}
+			pf.PriorState, err = statefile.Read(rc)
+			rc.Close()
+			if err != nil {
+				return pf, fmt.Errorf("failed to read plan file prior state: %v", err)
+			}
+		}
+	}
+
+	if !hasPlan {
+		return pf, fmt.Errorf("invalid plan file: missing %s", planFilePlan)
+	}
+	if pf.PriorState == nil {
+		return pf, fmt.Errorf("invalid plan file: missing %s", planFilePriorState)
+	}
+	return pf, nil
+}
+
+// readPlanFileEntry returns the content of a file of a plan file archive
+func readPlanFileEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
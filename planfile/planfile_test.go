@@ -0,0 +1,364 @@
+package planfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	"gorm.io/datatypes"
+
+	"github.com/camptocamp/terraboard/internal/terraform/addrs"
+	"github.com/camptocamp/terraboard/internal/terraform/states"
+	"github.com/camptocamp/terraboard/internal/terraform/states/statefile"
+	"github.com/camptocamp/terraboard/risk"
+	"github.com/camptocamp/terraboard/types"
+)
+
+// testTfplan builds the 'tfplan' file of a plan replacing the resource
+// instance of the prior state of testPlanFile, creating a bucket and
+// deleting an instance
+func testTfplan(t *testing.T) []byte {
+	vpc := testChange(t, 6,
+		cty.ObjectVal(map[string]cty.Value{
+			"cidr_block": cty.StringVal("10.0.0.0/16"),
+			"id":         cty.StringVal("vpc-123"),
+			"password":   cty.NullVal(cty.String),
+		}),
+		cty.ObjectVal(map[string]cty.Value{
+			"cidr_block": cty.StringVal("10.1.0.0/16"),
+			"id":         cty.UnknownVal(cty.String),
+			"password":   cty.StringVal("secret"),
+		}),
+	)
+	vpc = protoBytes(vpc, tfplanChangeAfterSensitive, testPath("password"))
+
+	var rc []byte
+	rc = protoBytes(rc, tfplanResourceChangeAddr, []byte(`module.network["eu"].aws_vpc.main[0]`))
+	rc = protoBytes(rc, tfplanResourceChangeProvider, []byte(`provider["registry.terraform.io/hashicorp/aws"]`))
+	rc = protoBytes(rc, tfplanResourceChangeChange, vpc)
+	rc = protoBytes(rc, tfplanResourceChangeRequiredReplace, testPath("cidr_block"))
+
+	var bucket []byte
+	bucket = protoBytes(bucket, tfplanResourceChangeAddr, []byte("aws_s3_bucket.logs"))
+	bucket = protoBytes(bucket, tfplanResourceChangePrevRunAddr, []byte("aws_s3_bucket.log"))
+	bucket = protoBytes(bucket, tfplanResourceChangeProvider, []byte(`provider["registry.terraform.io/hashicorp/aws"]`))
+	bucket = protoBytes(bucket, tfplanResourceChangeChange, testChange(t, 1,
+		cty.ObjectVal(map[string]cty.Value{
+			"arn":    cty.UnknownVal(cty.String),
+			"bucket": cty.StringVal("logs"),
+			"tags":   cty.MapVal(map[string]cty.Value{"env": cty.StringVal("prod")}),
+		}),
+	))
+
+	var instance []byte
+	instance = protoBytes(instance, tfplanResourceChangeAddr, []byte("aws_instance.old"))
+	instance = protoBytes(instance, tfplanResourceChangeProvider, []byte(`provider["registry.terraform.io/hashicorp/aws"]`))
+	instance = protoBytes(instance, tfplanResourceChangeChange, testChange(t, 5,
+		cty.ObjectVal(map[string]cty.Value{"id": cty.StringVal("i-123")}),
+	))
+
+	var output []byte
+	output = protoBytes(output, tfplanOutputChangeName, []byte("vpc_id"))
+	output = protoBytes(output, tfplanOutputChangeChange, testChange(t, 1, cty.UnknownVal(cty.String)))
+
+	var variable []byte
+	variable = protoBytes(variable, tfplanMapEntryKey, []byte("region"))
+	variable = protoBytes(variable, tfplanMapEntryValue, testDynamicValue(t, cty.StringVal("eu-west-1")))
+
+	var b []byte
+	b = protoVarint(b, tfplanPlanVersion, tfplanFormatVersion)
+	b = protoBytes(b, tfplanPlanVariables, variable)
+	b = protoBytes(b, tfplanPlanResourceChanges, rc)
+	b = protoBytes(b, tfplanPlanResourceChanges, bucket)
+	b = protoBytes(b, tfplanPlanResourceChanges, instance)
+	b = protoBytes(b, tfplanPlanOutputChanges, output)
+	b = protoBytes(b, tfplanPlanTerraformVersion, []byte("1.6.6"))
+	return b
+}
+
+// testPlanFile builds a binary plan file with the given files and a prior
+// state holding a single resource instance in a child module, with a sensitive
+// tag, and a sensitive output
+func testPlanFile(t *testing.T, files ...string) []byte {
+	state := states.NewState()
+	module := state.EnsureModule(addrs.RootModuleInstance.Child("network", addrs.StringKey("eu")))
+	module.SetResourceInstanceCurrent(
+		addrs.Resource{
+			Mode: addrs.ManagedResourceMode,
+			Type: "aws_vpc",
+			Name: "main",
+		}.Instance(addrs.IntKey(0)),
+		&states.ResourceInstanceObjectSrc{
+			SchemaVersion: 1,
+			Status:        states.ObjectReady,
+			AttrsJSON:     []byte(`{"cidr_block":"10.0.0.0/16","id":"vpc-123","tags":{"Name":"main","Owner":"team"}}`),
+			AttrSensitivePaths: []cty.PathValueMarks{{
+				Path:  cty.GetAttrPath("tags").Index(cty.StringVal("Owner")),
+				Marks: cty.NewValueMarks("sensitive"),
+			}},
+		},
+		addrs.AbsProviderConfig{
+			Provider: addrs.NewDefaultProvider("aws"),
+			Module:   addrs.RootModule,
+		},
+	)
+	state.RootModule().SetOutputValue("db_password", cty.StringVal("hunter2"), true)
+	state.RootModule().SetOutputValue("subnet_count", cty.NumberIntVal(3), false)
+	sf := statefile.New(state, "lineage", 4)
+	sf.TerraformVersion = version.Must(version.NewVersion("1.5.0"))
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range files {
+		f, err := zw.Create(name)
+		assert.Nil(t, err)
+		if name == planFilePriorState {
+			assert.Nil(t, statefile.WriteForTest(sf, f))
+		} else {
+			_, err = f.Write(testTfplan(t))
+			assert.Nil(t, err)
+		}
+	}
+	assert.Nil(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestIsPlanFile(t *testing.T) {
+	assert.True(t, IsPlanFile(testPlanFile(t, planFilePlan, planFilePriorState)))
+	assert.False(t, IsPlanFile([]byte(`{"lineage":"lineage"}`)))
+}
+
+func TestReadPlanFile(t *testing.T) {
+	pf, err := Read(testPlanFile(t, planFilePlan, planFilePriorState))
+	assert.Nil(t, err)
+	assert.Equal(t, "lineage", pf.PriorState.Lineage)
+	assert.Equal(t, "1.6.6", pf.TerraformVersion())
+	assert.Len(t, pf.plan.resourceChanges, 3)
+
+	priorState, err := priorStateJSON(pf.PriorState)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"format_version": "1.0",
+		"terraform_version": "1.5.0",
+		"values": {
+			"outputs": {
+				"db_password": {"sensitive": true, "value": "hunter2", "type": "string"},
+				"subnet_count": {"sensitive": false, "value": 3, "type": "number"}
+			},
+			"root_module": {"child_modules": [{
+				"address": "module.network[\"eu\"]",
+				"resources": [{
+					"address": "module.network[\"eu\"].aws_vpc.main[0]",
+					"mode": "managed",
+					"type": "aws_vpc",
+					"name": "main",
+					"index": 0,
+					"provider_name": "registry.terraform.io/hashicorp/aws",
+					"schema_version": 1,
+					"values": {"cidr_block": "10.0.0.0/16", "id": "vpc-123", "tags": {"Name": "main", "Owner": "team"}},
+					"sensitive_values": {"tags": {"Owner": true}}
+				}]
+			}]}
+		}
+	}`, string(priorState))
+
+	_, err = Read(testPlanFile(t, planFilePriorState))
+	assert.EqualError(t, err, "invalid plan file: missing tfplan")
+
+	_, err = Read(testPlanFile(t, planFilePlan))
+	assert.EqualError(t, err, "invalid plan file: missing tfstate")
+
+	_, err = Read([]byte("PK\x03\x04garbage"))
+	assert.NotNil(t, err)
+}
+
+func TestPlanFileJSON(t *testing.T) {
+	pf, err := Read(testPlanFile(t, planFilePlan, planFilePriorState))
+	assert.Nil(t, err)
+
+	planJSON, err := pf.JSON()
+	assert.Nil(t, err)
+	var plan map[string]json.RawMessage
+	assert.Nil(t, json.Unmarshal(planJSON, &plan))
+	priorState, err := priorStateJSON(pf.PriorState)
+	assert.Nil(t, err)
+	assert.JSONEq(t, string(priorState), string(plan["prior_state"]))
+	delete(plan, "prior_state")
+	changes, err := json.Marshal(plan)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{
+		"errored": false,
+		"format_version": "1.2",
+		"output_changes": {
+			"vpc_id": {
+				"actions": [
+					"create"
+				],
+				"after": null,
+				"after_sensitive": false,
+				"after_unknown": true,
+				"before": null,
+				"before_sensitive": false
+			}
+		},
+		"planned_values": {
+			"root_module": {
+				"resources": [
+					{
+						"address": "aws_s3_bucket.logs",
+						"mode": "managed",
+						"type": "aws_s3_bucket",
+						"name": "logs",
+						"provider_name": "registry.terraform.io/hashicorp/aws",
+						"schema_version": 0,
+						"values": {
+							"bucket": "logs",
+							"tags": {
+								"env": "prod"
+							}
+						},
+						"sensitive_values": {
+							"tags": {}
+						}
+					}
+				],
+				"child_modules": [
+					{
+						"address": "module.network[\"eu\"]",
+						"resources": [
+							{
+								"address": "module.network[\"eu\"].aws_vpc.main[0]",
+								"mode": "managed",
+								"type": "aws_vpc",
+								"name": "main",
+								"index": 0,
+								"provider_name": "registry.terraform.io/hashicorp/aws",
+								"schema_version": 0,
+								"values": {
+									"cidr_block": "10.1.0.0/16",
+									"password": "secret"
+								},
+								"sensitive_values": {
+									"password": true
+								}
+							}
+						]
+					}
+				]
+			}
+		},
+		"resource_changes": [
+			{
+				"address": "module.network[\"eu\"].aws_vpc.main[0]",
+				"change": {
+					"actions": [
+						"delete",
+						"create"
+					],
+					"after": {
+						"cidr_block": "10.1.0.0/16",
+						"password": "secret"
+					},
+					"after_sensitive": {
+						"password": true
+					},
+					"after_unknown": {
+						"id": true
+					},
+					"before": {
+						"cidr_block": "10.0.0.0/16",
+						"id": "vpc-123",
+						"password": null
+					},
+					"before_sensitive": {},
+					"replace_paths": [
+						[
+							"cidr_block"
+						]
+					]
+				},
+				"index": 0,
+				"mode": "managed",
+				"module_address": "module.network[\"eu\"]",
+				"name": "main",
+				"provider_name": "registry.terraform.io/hashicorp/aws",
+				"type": "aws_vpc"
+			},
+			{
+				"address": "aws_s3_bucket.logs",
+				"change": {
+					"actions": [
+						"create"
+					],
+					"after": {
+						"bucket": "logs",
+						"tags": {
+							"env": "prod"
+						}
+					},
+					"after_sensitive": {
+						"tags": {}
+					},
+					"after_unknown": {
+						"arn": true,
+						"tags": {}
+					},
+					"before": null,
+					"before_sensitive": false
+				},
+				"mode": "managed",
+				"name": "logs",
+				"previous_address": "aws_s3_bucket.log",
+				"provider_name": "registry.terraform.io/hashicorp/aws",
+				"type": "aws_s3_bucket"
+			},
+			{
+				"address": "aws_instance.old",
+				"change": {
+					"actions": [
+						"delete"
+					],
+					"after": null,
+					"after_sensitive": false,
+					"after_unknown": false,
+					"before": {
+						"id": "i-123"
+					},
+					"before_sensitive": {}
+				},
+				"mode": "managed",
+				"name": "old",
+				"provider_name": "registry.terraform.io/hashicorp/aws",
+				"type": "aws_instance"
+			}
+		],
+		"terraform_version": "1.6.6",
+		"variables": {
+			"region": {
+				"value": "eu-west-1"
+			}
+		}
+	}`, string(changes))
+
+	var p types.Plan
+	assert.Nil(t, json.Unmarshal(planJSON, &p.ParsedPlan))
+	summary := risk.Summarize(p.ParsedPlan, nil)
+	assert.Equal(t, 1, summary.Create)
+	assert.Equal(t, 1, summary.Delete)
+	assert.Equal(t, 1, summary.Replace)
+
+	// The sensitive values of the prior state are masked
+	p.PlanJSON = datatypes.JSON(planJSON)
+	assert.Nil(t, p.Redact())
+	assert.NotContains(t, string(p.PlanJSON), "hunter2")
+	assert.NotContains(t, string(p.PlanJSON), `"team"`)
+	for _, o := range p.ParsedPlan.PlanState.PlanStateValue.PlanStateOutputs {
+		if o.Name == "db_password" {
+			assert.Equal(t, types.SensitiveValue, o.Value)
+		}
+	}
+}
@@ -0,0 +1,633 @@
+package planfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+	"github.com/zclconf/go-cty/cty"
+	ctymsgpack "github.com/zclconf/go-cty/cty/msgpack"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+/*********************************************
+ * Decoding of the 'tfplan' file of plan files
+ *
+ * The 'tfplan' file is a protobuf message, described by
+ * internal/plans/internal/planproto/planfile.proto in Terraform.
+ * Its values are encoded with msgpack, as cty values of the types
+ * given by the schemas of the providers. Terraboard doesn't have
+ * these schemas, so values are decoded from the structure of their
+ * encoding: lists and sets can't be told apart, which doesn't matter
+ * in JSON.
+ *********************************************/
+
+// tfplanFormatVersion is the supported version of the 'tfplan' file format
+const tfplanFormatVersion = 3
+
+// Fields of the messages of the 'tfplan' file
+const (
+	tfplanPlanVersion          protowire.Number = 1
+	tfplanPlanVariables        protowire.Number = 2
+	tfplanPlanResourceChanges  protowire.Number = 3
+	tfplanPlanOutputChanges    protowire.Number = 4
+	tfplanPlanTerraformVersion protowire.Number = 14
+	tfplanPlanErrored          protowire.Number = 20
+
+	tfplanMapEntryKey   protowire.Number = 1
+	tfplanMapEntryValue protowire.Number = 2
+
+	tfplanChangeAction          protowire.Number = 1
+	tfplanChangeValues          protowire.Number = 2
+	tfplanChangeBeforeSensitive protowire.Number = 3
+	tfplanChangeAfterSensitive  protowire.Number = 4
+
+	tfplanResourceChangeDeposedKey      protowire.Number = 7
+	tfplanResourceChangeProvider        protowire.Number = 8
+	tfplanResourceChangeChange          protowire.Number = 9
+	tfplanResourceChangeRequiredReplace protowire.Number = 11
+	tfplanResourceChangeAddr            protowire.Number = 13
+	tfplanResourceChangePrevRunAddr     protowire.Number = 14
+
+	tfplanOutputChangeName      protowire.Number = 1
+	tfplanOutputChangeChange    protowire.Number = 2
+	tfplanOutputChangeSensitive protowire.Number = 3
+
+	tfplanDynamicValueMsgpack protowire.Number = 1
+
+	tfplanPathSteps             protowire.Number = 1
+	tfplanPathStepAttributeName protowire.Number = 1
+	tfplanPathStepElementKey    protowire.Number = 2
+)
+
+// tfplanAction is an action of a change of a plan file, with its name in the
+// Terraform JSON output format and the indexes of its before and after values
+// (-1 when the change has no such value)
+type tfplanAction struct {
+	names         []string
+	before, after int
+}
+
+// tfplanActions are the actions of changes, by their protobuf value
+var tfplanActions = map[uint64]tfplanAction{
+	0: {[]string{"no-op"}, 0, 0},
+	1: {[]string{"create"}, -1, 0},
+	2: {[]string{"read"}, 0, 1},
+	3: {[]string{"update"}, 0, 1},
+	5: {[]string{"delete"}, 0, -1},
+	6: {[]string{"delete", "create"}, 0, 1},
+	7: {[]string{"create", "delete"}, 0, 1},
+}
+
+// tfplanPath is a path to a value, as a list of attribute names or map keys
+// (strings) and list indexes (json.Number)
+type tfplanPath []interface{}
+
+// tfplanChange is a change of a resource instance or an output of a plan file
+type tfplanChange struct {
+	action          uint64
+	values          [][]byte
+	beforeSensitive []tfplanPath
+	afterSensitive  []tfplanPath
+}
+
+// tfplanResourceChange is a change of a resource instance of a plan file
+type tfplanResourceChange struct {
+	addr            string
+	prevRunAddr     string
+	deposedKey      string
+	provider        string
+	change          tfplanChange
+	requiredReplace []tfplanPath
+}
+
+// tfplanOutputChange is a change of an output of a plan file
+type tfplanOutputChange struct {
+	name      string
+	change    tfplanChange
+	sensitive bool
+}
+
+// tfplan is the content of the 'tfplan' file of a plan file
+type tfplan struct {
+	version          uint64
+	terraformVersion string
+	errored          bool
+	variables        map[string][]byte
+	resourceChanges  []tfplanResourceChange
+	outputChanges    []tfplanOutputChange
+}
+
+// protoField is a field of a protobuf message
+type protoField struct {
+	num protowire.Number
+	// The value of varint fields
+	value uint64
+	// The value of length-delimited fields
+	bytes []byte
+}
+
+// protoFields decodes the fields of a protobuf message.
+// Fields of other wire types than varint and length-delimited are skipped.
+func protoFields(b []byte) (fields []protoField, err error) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := protoField{num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.value, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return
+}
+
+// decodeDynamicValue returns the msgpack encoding of a DynamicValue message
+func decodeDynamicValue(b []byte) (value []byte, err error) {
+	fields, err := protoFields(b)
+	for _, f := range fields {
+		if f.num == tfplanDynamicValueMsgpack {
+			value = f.bytes
+		}
+	}
+	if err == nil && len(value) == 0 {
+		err = fmt.Errorf("dynamic value has no msgpack encoding")
+	}
+	return
+}
+
+// decodeTfplanPath decodes a Path message
+func decodeTfplanPath(b []byte) (path tfplanPath, err error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return
+	}
+	for _, f := range fields {
+		if f.num != tfplanPathSteps {
+			continue
+		}
+		steps, err := protoFields(f.bytes)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range steps {
+			switch s.num {
+			case tfplanPathStepAttributeName:
+				path = append(path, string(s.bytes))
+			case tfplanPathStepElementKey:
+				raw, err := decodeDynamicValue(s.bytes)
+				if err != nil {
+					return nil, err
+				}
+				key, _, err := decodeMsgpack(raw)
+				if err != nil {
+					return nil, fmt.Errorf("invalid path key: %v", err)
+				}
+				path = append(path, key)
+			}
+		}
+	}
+	return
+}
+
+// decodeTfplanChange decodes a Change message
+func decodeTfplanChange(b []byte) (c tfplanChange, err error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return
+	}
+	for _, f := range fields {
+		switch f.num {
+		case tfplanChangeAction:
+			c.action = f.value
+		case tfplanChangeValues:
+			v, err := decodeDynamicValue(f.bytes)
+			if err != nil {
+				return c, err
+			}
+			c.values = append(c.values, v)
+		case tfplanChangeBeforeSensitive, tfplanChangeAfterSensitive:
+			p, err := decodeTfplanPath(f.bytes)
+			if err != nil {
+				return c, err
+			}
+			if f.num == tfplanChangeBeforeSensitive {
+				c.beforeSensitive = append(c.beforeSensitive, p)
+			} else {
+				c.afterSensitive = append(c.afterSensitive, p)
+			}
+		}
+	}
+	return
+}
+
+// decodeTfplanResourceChange decodes a ResourceInstanceChange message
+func decodeTfplanResourceChange(b []byte) (rc tfplanResourceChange, err error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return
+	}
+	for _, f := range fields {
+		switch f.num {
+		case tfplanResourceChangeAddr:
+			rc.addr = string(f.bytes)
+		case tfplanResourceChangePrevRunAddr:
+			rc.prevRunAddr = string(f.bytes)
+		case tfplanResourceChangeDeposedKey:
+			rc.deposedKey = string(f.bytes)
+		case tfplanResourceChangeProvider:
+			rc.provider = string(f.bytes)
+		case tfplanResourceChangeChange:
+			if rc.change, err = decodeTfplanChange(f.bytes); err != nil {
+				return
+			}
+		case tfplanResourceChangeRequiredReplace:
+			p, err := decodeTfplanPath(f.bytes)
+			if err != nil {
+				return rc, err
+			}
+			rc.requiredReplace = append(rc.requiredReplace, p)
+		}
+	}
+	// Resource instances were identified by other fields
+	// in the plan files written by older Terraform versions
+	if rc.addr == "" {
+		err = fmt.Errorf("resource change has no address: the plan file was written by an unsupported Terraform version")
+	}
+	return
+}
+
+// decodeTfplanOutputChange decodes an OutputChange message
+func decodeTfplanOutputChange(b []byte) (oc tfplanOutputChange, err error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return
+	}
+	for _, f := range fields {
+		switch f.num {
+		case tfplanOutputChangeName:
+			oc.name = string(f.bytes)
+		case tfplanOutputChangeChange:
+			if oc.change, err = decodeTfplanChange(f.bytes); err != nil {
+				return
+			}
+		case tfplanOutputChangeSensitive:
+			oc.sensitive = f.value != 0
+		}
+	}
+	return
+}
+
+// decodeTfplan decodes the 'tfplan' file of a plan file
+func decodeTfplan(b []byte) (p tfplan, err error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return
+	}
+
+	p.variables = make(map[string][]byte)
+	for _, f := range fields {
+		switch f.num {
+		case tfplanPlanVersion:
+			p.version = f.value
+		case tfplanPlanTerraformVersion:
+			p.terraformVersion = string(f.bytes)
+		case tfplanPlanErrored:
+			p.errored = f.value != 0
+		case tfplanPlanVariables:
+			entry, err := protoFields(f.bytes)
+			if err != nil {
+				return p, err
+			}
+			var name string
+			var value []byte
+			for _, e := range entry {
+				switch e.num {
+				case tfplanMapEntryKey:
+					name = string(e.bytes)
+				case tfplanMapEntryValue:
+					if value, err = decodeDynamicValue(e.bytes); err != nil {
+						return p, fmt.Errorf("invalid variable: %v", err)
+					}
+				}
+			}
+			p.variables[name] = value
+		case tfplanPlanResourceChanges:
+			rc, err := decodeTfplanResourceChange(f.bytes)
+			if err != nil {
+				return p, err
+			}
+			p.resourceChanges = append(p.resourceChanges, rc)
+		case tfplanPlanOutputChanges:
+			oc, err := decodeTfplanOutputChange(f.bytes)
+			if err != nil {
+				return p, err
+			}
+			p.outputChanges = append(p.outputChanges, oc)
+		}
+	}
+
+	if p.version != tfplanFormatVersion {
+		err = fmt.Errorf("unsupported plan file format version %d (expected %d)", p.version, tfplanFormatVersion)
+	}
+	return
+}
+
+/*********************************************
+ * Conversion to the Terraform JSON output format
+ *
+ * Unknown values are omitted from objects and set to null in lists,
+ * and reported by an object mirroring the structure of the value with
+ * unknown values replaced with true, as 'after_unknown'.
+ *********************************************/
+
+// jsonNumber returns the JSON representation of a number
+func jsonNumber(f *big.Float) interface{} {
+	if f.IsInf() {
+		// Infinities can't be represented by JSON numbers
+		return f.String()
+	}
+	return json.Number(f.Text('f', -1))
+}
+
+// decodedObject holds the decoded attributes of an object or map,
+// and the ones which are unknown
+type decodedObject struct {
+	values  map[string]interface{}
+	unknown map[string]interface{}
+}
+
+func newDecodedObject() decodedObject {
+	return decodedObject{values: make(map[string]interface{}), unknown: make(map[string]interface{})}
+}
+
+// set adds a decoded attribute. Like Terraform, attributes which are known
+// are omitted from unknown, and unknown attributes are omitted from values.
+func (o decodedObject) set(key string, value, unknown interface{}) {
+	if unknown != true {
+		o.values[key] = value
+	}
+	if unknown != false {
+		o.unknown[key] = unknown
+	}
+}
+
+// ctyJSON returns the JSON representation of a cty value,
+// and whether it is unknown
+func ctyJSON(v cty.Value) (value, unknown interface{}) {
+	switch {
+	case !v.IsKnown():
+		return nil, true
+	case v.IsNull():
+		return nil, false
+	}
+
+	ty := v.Type()
+	switch {
+	case ty == cty.String:
+		return v.AsString(), false
+	case ty == cty.Number:
+		return jsonNumber(v.AsBigFloat()), false
+	case ty == cty.Bool:
+		return v.True(), false
+	case ty.IsObjectType() || ty.IsMapType():
+		o := newDecodedObject()
+		for it := v.ElementIterator(); it.Next(); {
+			k, e := it.Element()
+			ev, eu := ctyJSON(e)
+			o.set(k.AsString(), ev, eu)
+		}
+		return o.values, o.unknown
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType():
+		values, unknowns := []interface{}{}, []interface{}{}
+		for it := v.ElementIterator(); it.Next(); {
+			_, e := it.Element()
+			ev, eu := ctyJSON(e)
+			values = append(values, ev)
+			unknowns = append(unknowns, eu)
+		}
+		return values, unknowns
+	}
+	return nil, false
+}
+
+// decodeMsgpack decodes a msgpack encoded cty value without its type,
+// and returns its JSON representation and whether it is unknown
+func decodeMsgpack(b []byte) (value, unknown interface{}, err error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	return decodeMsgpackValue(dec)
+}
+
+// decodeMsgpackValue decodes the next value of a msgpack decoder
+func decodeMsgpackValue(dec *msgpack.Decoder) (value, unknown interface{}, err error) {
+	code, err := dec.PeekCode()
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch {
+	case code == msgpcode.Nil:
+		return nil, false, dec.DecodeNil()
+	case msgpcode.IsExt(code):
+		// Unknown values are encoded as extensions
+		return nil, true, dec.Skip()
+	case code == msgpcode.True || code == msgpcode.False:
+		value, err = dec.DecodeBool()
+	case msgpcode.IsString(code):
+		value, err = dec.DecodeString()
+	case code == msgpcode.Float || code == msgpcode.Double:
+		var f float64
+		f, err = dec.DecodeFloat64()
+		value = jsonNumber(big.NewFloat(f))
+	case code == msgpcode.Uint8 || code == msgpcode.Uint16 || code == msgpcode.Uint32 || code == msgpcode.Uint64:
+		var n uint64
+		n, err = dec.DecodeUint64()
+		value = json.Number(strconv.FormatUint(n, 10))
+	case msgpcode.IsFixedNum(code) || code == msgpcode.Int8 || code == msgpcode.Int16 || code == msgpcode.Int32 || code == msgpcode.Int64:
+		var n int64
+		n, err = dec.DecodeInt64()
+		value = json.Number(strconv.FormatInt(n, 10))
+	case msgpcode.IsFixedMap(code) || code == msgpcode.Map16 || code == msgpcode.Map32:
+		return decodeMsgpackMap(dec)
+	case msgpcode.IsFixedArray(code) || code == msgpcode.Array16 || code == msgpcode.Array32:
+		return decodeMsgpackArray(dec)
+	default:
+		err = fmt.Errorf("unsupported msgpack code %#x", code)
+	}
+	return value, false, err
+}
+
+// decodeMsgpackMap decodes an object or a map
+func decodeMsgpackMap(dec *msgpack.Decoder) (value, unknown interface{}, err error) {
+	n, err := dec.DecodeMapLen()
+	if err != nil {
+		return nil, false, err
+	}
+	o := newDecodedObject()
+	for i := 0; i < n; i++ {
+		k, err := dec.DecodeString()
+		if err != nil {
+			return nil, false, err
+		}
+		ev, eu, err := decodeMsgpackValue(dec)
+		if err != nil {
+			return nil, false, err
+		}
+		o.set(k, ev, eu)
+	}
+	return o.values, o.unknown, nil
+}
+
+// decodeMsgpackArray decodes a list, a set or a tuple, or a value of an
+// attribute whose type is only known at runtime, which is encoded along
+// with its type as a pair of its JSON type and its value
+func decodeMsgpackArray(dec *msgpack.Decoder) (value, unknown interface{}, err error) {
+	n, err := dec.DecodeArrayLen()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if n == 2 {
+		code, err := dec.PeekCode()
+		if err != nil {
+			return nil, false, err
+		}
+		if code == msgpcode.Bin8 || code == msgpcode.Bin16 || code == msgpcode.Bin32 {
+			typeJSON, err := dec.DecodeBytes()
+			if err != nil {
+				return nil, false, err
+			}
+			var ty cty.Type
+			if err := ty.UnmarshalJSON(typeJSON); err != nil {
+				return nil, false, fmt.Errorf("invalid dynamic value type: %v", err)
+			}
+			raw, err := dec.DecodeRaw()
+			if err != nil {
+				return nil, false, err
+			}
+			v, err := ctymsgpack.Unmarshal(raw, ty)
+			if err != nil {
+				return nil, false, err
+			}
+			value, unknown = ctyJSON(v)
+			return value, unknown, nil
+		}
+	}
+
+	values, unknowns := []interface{}{}, []interface{}{}
+	for i := 0; i < n; i++ {
+		ev, eu, err := decodeMsgpackValue(dec)
+		if err != nil {
+			return nil, false, err
+		}
+		values = append(values, ev)
+		unknowns = append(unknowns, eu)
+	}
+	return values, unknowns, nil
+}
+
+// sensitiveJSON returns the sensitivity object of a decoded value, with the
+// values at paths marked as sensitive: like Terraform does, it mirrors the
+// structure of the value, with sensitive values replaced with true and
+// non-sensitive values of objects omitted
+func sensitiveJSON(value interface{}, paths []tfplanPath) interface{} {
+	for _, p := range paths {
+		if len(p) == 0 {
+			return true
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		sensitive := make(map[string]interface{})
+		for k, e := range v {
+			var sub []tfplanPath
+			for _, p := range paths {
+				if key, ok := p[0].(string); ok && key == k {
+					sub = append(sub, p[1:])
+				}
+			}
+			if s := sensitiveJSON(e, sub); s != false {
+				sensitive[k] = s
+			}
+		}
+		return sensitive
+	case []interface{}:
+		sensitive := make([]interface{}, len(v))
+		for i, e := range v {
+			var sub []tfplanPath
+			for _, p := range paths {
+				if index, ok := p[0].(json.Number); ok && index.String() == strconv.Itoa(i) {
+					sub = append(sub, p[1:])
+				}
+			}
+			sensitive[i] = sensitiveJSON(e, sub)
+		}
+		return sensitive
+	}
+	return false
+}
+
+// json converts a change to the Terraform JSON output format.
+// The values of sensitive changes are entirely marked as sensitive.
+func (c tfplanChange) json(sensitive bool) (map[string]interface{}, error) {
+	action, ok := tfplanActions[c.action]
+	if !ok {
+		return nil, fmt.Errorf("unsupported change action %d", c.action)
+	}
+
+	change := map[string]interface{}{
+		"actions":          action.names,
+		"before":           nil,
+		"after":            nil,
+		"after_unknown":    false,
+		"before_sensitive": false,
+		"after_sensitive":  false,
+	}
+	for _, v := range []struct {
+		index                     int
+		value, unknown, sensitive string
+		paths                     []tfplanPath
+	}{
+		{action.before, "before", "", "before_sensitive", c.beforeSensitive},
+		{action.after, "after", "after_unknown", "after_sensitive", c.afterSensitive},
+	} {
+		if v.index < 0 {
+			continue
+		}
+		if v.index >= len(c.values) {
+			return nil, fmt.Errorf("missing %s value of %s change", v.value, action.names[0])
+		}
+		value, unknown, err := decodeMsgpack(c.values[v.index])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value: %v", v.value, err)
+		}
+		change[v.value] = value
+		if v.unknown != "" {
+			change[v.unknown] = unknown
+		}
+		paths := v.paths
+		if sensitive {
+			paths = []tfplanPath{{}}
+		}
+		change[v.sensitive] = sensitiveJSON(value, paths)
+	}
+	return change, nil
+}
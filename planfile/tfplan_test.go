@@ -0,0 +1,120 @@
+package planfile
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	ctymsgpack "github.com/zclconf/go-cty/cty/msgpack"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoBytes appends a length-delimited field to a protobuf message
+func protoBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// protoVarint appends a varint field to a protobuf message
+func protoVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// testDynamicValue encodes a value as a DynamicValue message
+func testDynamicValue(t *testing.T, v cty.Value) []byte {
+	raw, err := ctymsgpack.Marshal(v, v.Type())
+	assert.Nil(t, err)
+	return protoBytes(nil, tfplanDynamicValueMsgpack, raw)
+}
+
+// testPath encodes the path to an attribute as a Path message
+func testPath(name string) []byte {
+	step := protoBytes(nil, tfplanPathStepAttributeName, []byte(name))
+	return protoBytes(nil, tfplanPathSteps, step)
+}
+
+// testChange encodes a Change message
+func testChange(t *testing.T, action uint64, values ...cty.Value) []byte {
+	b := protoVarint(nil, tfplanChangeAction, action)
+	for _, v := range values {
+		b = protoBytes(b, tfplanChangeValues, testDynamicValue(t, v))
+	}
+	return b
+}
+
+func TestDecodeTfplan(t *testing.T) {
+	_, err := decodeTfplan(protoVarint(nil, tfplanPlanVersion, 2))
+	assert.EqualError(t, err, "unsupported plan file format version 2 (expected 3)")
+
+	_, err = decodeTfplan([]byte{0xff})
+	assert.NotNil(t, err)
+
+	var rc []byte
+	rc = protoBytes(rc, tfplanResourceChangeChange, testChange(t, 1, cty.EmptyObjectVal))
+	_, err = decodeTfplan(protoBytes(protoVarint(nil, tfplanPlanVersion, 3), tfplanPlanResourceChanges, rc))
+	assert.EqualError(t, err, "resource change has no address: the plan file was written by an unsupported Terraform version")
+}
+
+func TestDecodeMsgpack(t *testing.T) {
+	ty := cty.Object(map[string]cty.Type{
+		"name":    cty.String,
+		"id":      cty.String,
+		"count":   cty.Number,
+		"ratio":   cty.Number,
+		"enabled": cty.Bool,
+		"ports":   cty.List(cty.Number),
+		"extra":   cty.DynamicPseudoType,
+		"deleted": cty.String,
+	})
+	raw, err := ctymsgpack.Marshal(cty.ObjectVal(map[string]cty.Value{
+		"name":    cty.StringVal("web"),
+		"id":      cty.UnknownVal(cty.String),
+		"count":   cty.NumberIntVal(3),
+		"ratio":   cty.NumberFloatVal(1.5),
+		"enabled": cty.True,
+		"ports":   cty.ListVal([]cty.Value{cty.NumberIntVal(80), cty.UnknownVal(cty.Number)}),
+		"extra":   cty.MapVal(map[string]cty.Value{"env": cty.StringVal("prod")}),
+		"deleted": cty.NullVal(cty.String),
+	}), ty)
+	assert.Nil(t, err)
+
+	value, unknown, err := decodeMsgpack(raw)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":    "web",
+		"count":   json.Number("3"),
+		"ratio":   json.Number("1.5"),
+		"enabled": true,
+		"ports":   []interface{}{json.Number("80"), nil},
+		"extra":   map[string]interface{}{"env": "prod"},
+		"deleted": nil,
+	}, value)
+	assert.Equal(t, map[string]interface{}{
+		"id":    true,
+		"ports": []interface{}{false, true},
+		"extra": map[string]interface{}{},
+	}, unknown)
+
+	_, _, err = decodeMsgpack([]byte{0xc1})
+	assert.NotNil(t, err)
+}
+
+func TestSensitiveJSON(t *testing.T) {
+	value := map[string]interface{}{
+		"tags":  map[string]interface{}{"Name": "web", "Owner": "team"},
+		"ports": []interface{}{json.Number("80"), json.Number("443")},
+		"name":  "web",
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"tags":  map[string]interface{}{"Owner": true},
+		"ports": []interface{}{false, true},
+	}, sensitiveJSON(value, []tfplanPath{{"tags", "Owner"}, {"ports", json.Number("1")}}))
+	assert.Equal(t, map[string]interface{}{
+		"tags":  map[string]interface{}{},
+		"ports": []interface{}{false, false},
+	}, sensitiveJSON(value, nil))
+	assert.Equal(t, true, sensitiveJSON(value, []tfplanPath{{}}))
+}
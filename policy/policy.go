@@ -0,0 +1,158 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/loader"
+	"github.com/open-policy-agent/opa/rego"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+// evalTimeout bounds the evaluation of a rule of a policy against a plan
+const evalTimeout = 10 * time.Second
+
+// root is the package of the policies: policies are the Rego packages
+// below it, named after their path relative to it
+var root = ast.MustParseRef("data.terraboard")
+
+// Policy is a Rego package evaluated against plans. Its 'deny' rule
+// lists violations, failing the policy, and its 'warn' rule lists warnings.
+type Policy struct {
+	Name    string
+	queries map[string]rego.PreparedEvalQuery
+}
+
+// Load loads and compiles the Rego files found in paths (files or directories),
+// and returns the policies they define below the 'terraboard' package
+func Load(paths []string) (policies []Policy, err error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	res, err := loader.AllRegos(paths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policies: %v", err)
+	}
+
+	compiler := ast.NewCompiler()
+	if compiler.Compile(res.ParsedModules()); compiler.Failed() {
+		return nil, fmt.Errorf("failed to compile policies: %v", compiler.Errors)
+	}
+
+	packages := make(map[string]ast.Ref)
+	for _, m := range res.ParsedModules() {
+		path := m.Package.Path
+		if len(path) > len(root) && path.HasPrefix(root) {
+			packages[path.String()] = path
+		}
+	}
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := Policy{
+			Name:    strings.TrimPrefix(name, root.String()+"."),
+			queries: make(map[string]rego.PreparedEvalQuery),
+		}
+		for _, level := range []string{types.PolicyDeny, types.PolicyWarn} {
+			q, err := rego.New(
+				rego.Query(packages[name].Append(ast.StringTerm(level)).String()),
+				rego.Compiler(compiler),
+			).PrepareForEval(context.Background())
+			if err != nil {
+				return nil, fmt.Errorf("failed to prepare policy %s: %v", p.Name, err)
+			}
+			p.queries[level] = q
+		}
+		policies = append(policies, p)
+	}
+	return
+}
+
+// message formats a message reported by a rule, which is usually a string
+func message(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(j)
+}
+
+// messages evaluates a rule of a policy, returning the messages it reports
+func messages(q rego.PreparedEvalQuery, input interface{}) (msgs []string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), evalTimeout)
+	defer cancel()
+
+	rs, err := q.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rs {
+		for _, e := range r.Expressions {
+			switch v := e.Value.(type) {
+			case []interface{}:
+				for _, m := range v {
+					msgs = append(msgs, message(m))
+				}
+			case bool:
+				// A boolean rule reports a single, anonymous message
+				if v {
+					msgs = append(msgs, e.Text)
+				}
+			default:
+				msgs = append(msgs, message(v))
+			}
+		}
+	}
+	sort.Strings(msgs)
+	return
+}
+
+// Evaluate evaluates a policy against the decoded JSON representation of a plan.
+// A policy passes if it reports no violation, and could be evaluated.
+func (p Policy) Evaluate(input interface{}) types.PlanPolicyResult {
+	result := types.PlanPolicyResult{Policy: p.Name, Passed: true}
+	for _, level := range []string{types.PolicyDeny, types.PolicyWarn} {
+		msgs, err := messages(p.queries[level], input)
+		if err != nil {
+			result.Passed = false
+			result.Messages = append(result.Messages, types.PlanPolicyMessage{Level: types.PolicyError, Message: err.Error()})
+			continue
+		}
+		for _, m := range msgs {
+			if level == types.PolicyDeny {
+				result.Passed = false
+			}
+			result.Messages = append(result.Messages, types.PlanPolicyMessage{Level: level, Message: m})
+		}
+	}
+	return result
+}
+
+// Evaluate evaluates policies against the JSON representation of a plan,
+// which is their input
+func Evaluate(policies []Policy, planJSON []byte) (results []types.PlanPolicyResult, err error) {
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	var input interface{}
+	if err := json.Unmarshal(planJSON, &input); err != nil {
+		return nil, fmt.Errorf("invalid plan JSON: %v", err)
+	}
+	for _, p := range policies {
+		results = append(results, p.Evaluate(input))
+	}
+	return
+}
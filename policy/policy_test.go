@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+const testPolicies = `package terraboard.s3
+
+import future.keywords.contains
+import future.keywords.if
+
+deny contains msg if {
+	rc := input.resource_changes[_]
+	rc.type == "aws_s3_bucket_acl"
+	rc.change.after.acl == "public-read"
+	msg := sprintf("%s must not be public", [rc.address])
+}
+
+warn contains msg if {
+	rc := input.resource_changes[_]
+	rc.type == "aws_s3_bucket"
+	not rc.change.after.tags.owner
+	msg := sprintf("%s has no owner tag", [rc.address])
+}
+`
+
+const testLibrary = `package lib.tags
+
+required := ["owner"]
+`
+
+const testPlanJSON = `{
+	"resource_changes": [
+		{"address": "aws_s3_bucket.logs", "type": "aws_s3_bucket", "change": {"after": {"tags": {}}}},
+		{"address": "aws_s3_bucket_acl.logs", "type": "aws_s3_bucket_acl", "change": {"after": {"acl": "public-read"}}}
+	]
+}`
+
+func writePolicies(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestEvaluate(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"s3.rego":   testPolicies,
+		"lib.rego":  testLibrary,
+		"data.json": `{"ignored": true}`,
+	})
+	policies, err := Load([]string{dir})
+	assert.Nil(t, err)
+
+	results, err := Evaluate(policies, []byte(testPlanJSON))
+	assert.Nil(t, err)
+	assert.Equal(t, []types.PlanPolicyResult{
+		{
+			Policy: "s3",
+			Passed: false,
+			Messages: []types.PlanPolicyMessage{
+				{Level: types.PolicyDeny, Message: "aws_s3_bucket_acl.logs must not be public"},
+				{Level: types.PolicyWarn, Message: "aws_s3_bucket.logs has no owner tag"},
+			},
+		},
+	}, results)
+
+	results, err = Evaluate(policies, []byte(`{"resource_changes": []}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []types.PlanPolicyResult{{Policy: "s3", Passed: true}}, results)
+}
+
+func TestEvaluate_NoPolicies(t *testing.T) {
+	results, err := Evaluate(nil, []byte(testPlanJSON))
+	assert.Nil(t, err)
+	assert.Nil(t, results)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"invalid.rego": "package terraboard.invalid\n\ndeny[msg] {\n",
+	})
+	_, err := Load([]string{dir})
+	assert.NotNil(t, err)
+
+	_, err = Load([]string{filepath.Join(dir, "missing.rego")})
+	assert.NotNil(t, err)
+}
+
+func TestEvaluate_Error(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"conflict.rego": "package terraboard.conflict\n\nimport future.keywords.if\n\ndeny := \"a\" if input.a\n\ndeny := \"b\" if input.b\n",
+	})
+	policies, err := Load([]string{dir})
+	assert.Nil(t, err)
+
+	results, err := Evaluate(policies, []byte(`{"a": true, "b": true}`))
+	assert.Nil(t, err)
+	if assert.Len(t, results, 1) {
+		assert.False(t, results[0].Passed)
+		assert.Equal(t, types.PolicyError, results[0].Messages[0].Level)
+	}
+}
@@ -0,0 +1,199 @@
+package risk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+// Actions of a resource change
+const (
+	Create  = "create"
+	Update  = "update"
+	Delete  = "delete"
+	Replace = "replace"
+)
+
+// levels orders the risk levels which can be set by a rule
+var levels = map[string]int{
+	types.RiskLow:    1,
+	types.RiskMedium: 2,
+	types.RiskHigh:   3,
+}
+
+// Rule raises the risk of the Plans changing resources of a type with an action.
+// The resource type is a glob, where '*' matches any sequence of characters.
+type Rule struct {
+	Level        string
+	Action       string
+	ResourceType string
+}
+
+// ParseRule parses a risk rule written as '<level>:<action>:<resource type>',
+// e.g. 'high:delete:aws_rds_*'. The action is one of create, update, delete,
+// replace or '*' for any of them.
+func ParseRule(rule string) (r Rule, err error) {
+	parts := strings.Split(rule, ":")
+	if len(parts) != 3 || parts[2] == "" {
+		return r, fmt.Errorf("invalid risk rule '%s', expected '<level>:<action>:<resource type>'", rule)
+	}
+	r = Rule{Level: parts[0], Action: parts[1], ResourceType: parts[2]}
+	if _, ok := levels[r.Level]; !ok {
+		return r, fmt.Errorf("invalid risk rule '%s', unknown level '%s'", rule, r.Level)
+	}
+	switch r.Action {
+	case Create, Update, Delete, Replace, "*":
+	default:
+		return r, fmt.Errorf("invalid risk rule '%s', unknown action '%s'", rule, r.Action)
+	}
+	if _, err = path.Match(r.ResourceType, ""); err != nil {
+		return r, fmt.Errorf("invalid risk rule '%s': %v", rule, err)
+	}
+	return
+}
+
+// ParseRules parses a list of risk rules, skipping empty ones
+func ParseRules(rules []string) (parsed []Rule, err error) {
+	for _, rule := range rules {
+		if rule == "" {
+			continue
+		}
+		r, err := ParseRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, r)
+	}
+	return
+}
+
+// String returns the rule written as '<level>:<action>:<resource type>'
+func (r Rule) String() string {
+	return strings.Join([]string{r.Level, r.Action, r.ResourceType}, ":")
+}
+
+// Fingerprint identifies a set of rules, so that the risk of Plans
+// can be classified again when the rules change
+func Fingerprint(rules []Rule) string {
+	list := make([]string, 0, len(rules))
+	for _, r := range rules {
+		list = append(list, r.String())
+	}
+	sort.Strings(list)
+	sum := sha256.Sum256([]byte(strings.Join(list, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Match tells whether the rule applies to the changes of a resource type.
+// As replacing a resource deletes it, delete rules apply to replacements too.
+func (r Rule) Match(resourceType string, counts types.PlanChangeCounts) bool {
+	if ok, _ := path.Match(r.ResourceType, resourceType); !ok {
+		return false
+	}
+	switch r.Action {
+	case Create:
+		return counts.Create > 0
+	case Update:
+		return counts.Update > 0
+	case Delete:
+		return counts.Delete > 0 || counts.Replace > 0
+	case Replace:
+		return counts.Replace > 0
+	}
+	return counts != types.PlanChangeCounts{}
+}
+
+// ChangeAction returns the action of a resource change, or an empty string
+// if the resource is left unchanged or only read
+func ChangeAction(actions string) string {
+	var list []string
+	if err := json.Unmarshal([]byte(actions), &list); err != nil {
+		return ""
+	}
+	switch len(list) {
+	case 1:
+		switch list[0] {
+		case Create, Update, Delete:
+			return list[0]
+		}
+	case 2:
+		return Replace
+	}
+	return ""
+}
+
+// add counts a change with an action
+func add(counts *types.PlanChangeCounts, action string) {
+	switch action {
+	case Create:
+		counts.Create++
+	case Update:
+		counts.Update++
+	case Delete:
+		counts.Delete++
+	case Replace:
+		counts.Replace++
+	}
+}
+
+// Classify returns the risk of a Plan from its changes by resource type:
+// the highest level of the rules applying to them. A Plan with changes
+// which no rule applies to is a low risk one.
+func Classify(resourceTypes []types.PlanSummaryResourceType, rules []Rule) string {
+	risk := types.RiskNone
+	level := 0
+	for _, t := range resourceTypes {
+		if level == 0 {
+			risk = types.RiskLow
+			level = levels[types.RiskLow]
+		}
+		for _, r := range rules {
+			if levels[r.Level] > level && r.Match(t.Type, t.PlanChangeCounts) {
+				risk = r.Level
+				level = levels[r.Level]
+			}
+		}
+	}
+	return risk
+}
+
+// Summarize counts the resource changes of a Plan by action and resource type,
+// and classifies its risk with rules
+func Summarize(plan types.PlanModel, rules []Rule) (summary types.PlanSummary) {
+	byType := make(map[string]*types.PlanChangeCounts)
+	for _, rc := range plan.PlanResourceChanges {
+		action := ChangeAction(string(rc.Change.Actions))
+		if action == "" {
+			continue
+		}
+		counts, ok := byType[rc.Type]
+		if !ok {
+			counts = &types.PlanChangeCounts{}
+			byType[rc.Type] = counts
+		}
+		add(counts, action)
+		add(&summary.PlanChangeCounts, action)
+	}
+
+	resourceTypes := make([]string, 0, len(byType))
+	for t := range byType {
+		resourceTypes = append(resourceTypes, t)
+	}
+	sort.Strings(resourceTypes)
+
+	for _, t := range resourceTypes {
+		summary.ResourceTypes = append(summary.ResourceTypes, types.PlanSummaryResourceType{
+			Type:             t,
+			PlanChangeCounts: *byType[t],
+		})
+	}
+	summary.Risk = Classify(summary.ResourceTypes, rules)
+	summary.RiskRules = Fingerprint(rules)
+	return
+}
@@ -0,0 +1,97 @@
+package risk
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/terraboard/types"
+)
+
+func testPlan(t *testing.T, changes string) (plan types.PlanModel) {
+	if err := json.Unmarshal([]byte(`{"resource_changes":`+changes+`}`), &plan); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return
+}
+
+func TestParseRule_Invalid(t *testing.T) {
+	for _, rule := range []string{"high", "high:delete", "high:delete:", "critical:delete:aws_rds_*", "high:destroy:aws_rds_*", "high:delete:[aws"} {
+		if _, err := ParseRule(rule); err == nil {
+			t.Errorf("Expected an error for %s, got nil", rule)
+		}
+	}
+}
+
+func TestRule_Match(t *testing.T) {
+	cases := []struct {
+		rule         string
+		resourceType string
+		counts       types.PlanChangeCounts
+		expected     bool
+	}{
+		{"high:delete:aws_rds_*", "aws_rds_cluster", types.PlanChangeCounts{Delete: 1}, true},
+		{"high:delete:aws_rds_*", "aws_rds_cluster", types.PlanChangeCounts{Replace: 1}, true},
+		{"high:delete:aws_rds_*", "aws_rds_cluster", types.PlanChangeCounts{Update: 1}, false},
+		{"high:delete:aws_rds_*", "aws_db_instance", types.PlanChangeCounts{Delete: 1}, false},
+		{"medium:replace:*", "aws_instance", types.PlanChangeCounts{Delete: 1}, false},
+		{"medium:*:aws_iam_*", "aws_iam_role", types.PlanChangeCounts{Create: 1}, true},
+		{"medium:*:aws_iam_*", "aws_iam_role", types.PlanChangeCounts{}, false},
+	}
+
+	for _, c := range cases {
+		r, err := ParseRule(c.rule)
+		if err != nil {
+			t.Fatalf("Expected no error for %s, got %v", c.rule, err)
+		}
+		if got := r.Match(c.resourceType, c.counts); got != c.expected {
+			t.Errorf("Expected %s to match %s %+v: %v, got %v", c.rule, c.resourceType, c.counts, c.expected, got)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	rules, err := ParseRules([]string{"high:delete:aws_rds_*", "medium:update:aws_security_group", ""})
+	assert.Nil(t, err)
+
+	plan := testPlan(t, `[
+		{"type":"aws_instance","change":{"actions":["create"]}},
+		{"type":"aws_instance","change":{"actions":["delete","create"]}},
+		{"type":"aws_security_group","change":{"actions":["update"]}},
+		{"type":"aws_s3_bucket","change":{"actions":["no-op"]}},
+		{"type":"aws_ami","change":{"actions":["read"]}}
+	]`)
+	summary := Summarize(plan, rules)
+	assert.Equal(t, types.PlanChangeCounts{Create: 1, Update: 1, Replace: 1}, summary.PlanChangeCounts)
+	assert.Equal(t, types.RiskMedium, summary.Risk)
+	assert.Equal(t, []types.PlanSummaryResourceType{
+		{Type: "aws_instance", PlanChangeCounts: types.PlanChangeCounts{Create: 1, Replace: 1}},
+		{Type: "aws_security_group", PlanChangeCounts: types.PlanChangeCounts{Update: 1}},
+	}, summary.ResourceTypes)
+
+	plan = testPlan(t, `[
+		{"type":"aws_security_group","change":{"actions":["update"]}},
+		{"type":"aws_rds_cluster","change":{"actions":["delete"]}}
+	]`)
+	summary = Summarize(plan, rules)
+	assert.Equal(t, types.PlanChangeCounts{Update: 1, Delete: 1}, summary.PlanChangeCounts)
+	assert.Equal(t, types.RiskHigh, summary.Risk)
+
+	summary = Summarize(testPlan(t, `[{"type":"aws_iam_role","change":{"actions":["create"]}}]`), rules)
+	assert.Equal(t, types.RiskLow, summary.Risk)
+
+	summary = Summarize(testPlan(t, `[{"type":"aws_iam_role","change":{"actions":["no-op"]}}]`), rules)
+	assert.Equal(t, types.RiskNone, summary.Risk)
+	assert.Empty(t, summary.ResourceTypes)
+}
+
+func TestFingerprint(t *testing.T) {
+	rules, err := ParseRules([]string{"high:delete:aws_rds_*", "medium:update:aws_security_group"})
+	assert.Nil(t, err)
+	reordered := []Rule{rules[1], rules[0]}
+
+	assert.Equal(t, Fingerprint(rules), Fingerprint(reordered))
+	assert.NotEqual(t, Fingerprint(rules), Fingerprint(rules[:1]))
+	assert.NotEqual(t, Fingerprint(rules), Fingerprint(nil))
+}
@@ -0,0 +1,76 @@
+package token
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/camptocamp/terraboard/config"
+	"github.com/camptocamp/terraboard/db"
+	"github.com/camptocamp/terraboard/types"
+)
+
+// Run runs a token subcommand as configured by c, writing its output to stdout
+func Run(c config.TokenConfig, d *db.Database) error {
+	switch c.Action {
+	case "create":
+		return Create(d, c.Create, os.Stdout)
+	case "list":
+		return List(d, os.Stdout)
+	case "revoke":
+		return Revoke(d, c.Revoke, os.Stdout)
+	}
+	return fmt.Errorf("unsupported token command '%s'", c.Action)
+}
+
+// Create creates an API token and writes it to w.
+// The token is not stored, so it is only displayed once.
+func Create(d *db.Database, c config.TokenCreateConfig, w io.Writer) error {
+	token, apiToken, err := d.CreateAPIToken(c.Name, c.Lineages, c.PathPrefixes)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "Created token '%s' (%s). It won't be displayed again:\n%s\n", apiToken.Name, scopes(apiToken), token)
+	return err
+}
+
+// List writes the API tokens to w, as a table
+func List(d *db.Database, w io.Writer) error {
+	apiTokens, err := d.ListAPITokens()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPREFIX\tCREATED\tSCOPES")
+	for _, t := range apiTokens {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t.Name, t.Prefix, t.CreatedAt.Format("2006-01-02 15:04:05"), scopes(t))
+	}
+	return tw.Flush()
+}
+
+// Revoke deletes an API token
+func Revoke(d *db.Database, c config.TokenRevokeConfig, w io.Writer) error {
+	if err := d.RevokeAPIToken(c.Name); err != nil {
+		return fmt.Errorf("failed to revoke token '%s': %v", c.Name, err)
+	}
+
+	_, err := fmt.Fprintf(w, "Revoked token '%s'\n", c.Name)
+	return err
+}
+
+// scopes formats the scopes of an API token
+func scopes(t types.APIToken) string {
+	var s []string
+	for _, scope := range t.Scopes {
+		if scope.Lineage != "" {
+			s = append(s, "lineage="+scope.Lineage)
+		} else {
+			s = append(s, "path="+scope.PathPrefix+"*")
+		}
+	}
+	return strings.Join(s, ", ")
+}
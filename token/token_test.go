@@ -0,0 +1,98 @@
+package token
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/camptocamp/terraboard/config"
+	"github.com/camptocamp/terraboard/db"
+)
+
+func TestList(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT \* FROM "api_tokens" ORDER BY name`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "name", "prefix"}).
+			AddRow(1, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "ci", "tb_abcdef"))
+	mock.ExpectQuery(`^SELECT \* FROM "api_token_scopes" WHERE "api_token_scopes"."api_token_id" = \$1 ORDER BY id`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "api_token_id", "lineage", "path_prefix"}).
+			AddRow(1, 1, "lineage_value", "").
+			AddRow(2, 1, "", "prod/"))
+
+	d := &db.Database{
+		DB: gormDB,
+	}
+
+	var out bytes.Buffer
+	err = List(d, &out)
+	assert.Nil(t, err)
+	assert.Equal(t, "NAME  PREFIX     CREATED              SCOPES\n"+
+		"ci    tb_abcdef  2024-01-02 03:04:05  lineage=lineage_value, path=prod/*\n", out.String())
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestRevoke(t *testing.T) {
+	fakeDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer fakeDB.Close()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: fakeDB,
+	}))
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`^SELECT "id" FROM "api_tokens" WHERE name = \$1`).
+		WithArgs("ci").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`^DELETE FROM "api_token_scopes" WHERE api_token_id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`^DELETE FROM "api_tokens" WHERE "api_tokens"."id" = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`^SELECT "id" FROM "api_tokens" WHERE name = \$1`).
+		WithArgs("unknown").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	d := &db.Database{
+		DB: gormDB,
+	}
+
+	var out bytes.Buffer
+	err = Revoke(d, config.TokenRevokeConfig{Name: "ci"}, &out)
+	assert.Nil(t, err)
+	assert.Equal(t, "Revoked token 'ci'\n", out.String())
+
+	err = Revoke(d, config.TokenRevokeConfig{Name: "unknown"}, &out)
+	assert.NotNil(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.Nil(t, err)
+}
+
+func TestRun_UnsupportedAction(t *testing.T) {
+	err := Run(config.TokenConfig{Action: "rotate"}, &db.Database{})
+	assert.NotNil(t, err)
+}
@@ -15,11 +15,58 @@ type StateInfo struct {
 	Serial        int64  `json:"serial"`
 }
 
+// Kinds of AttributeDiff
+const (
+	AttributeAdded   = "added"
+	AttributeRemoved = "removed"
+	AttributeChanged = "changed"
+)
+
+// AttributeDiff represents the change of a single attribute value.
+// Nested values are addressed by their path, e.g. "tags.Name" or
+// "ingress[0].cidr_blocks[1]". The values of sensitive attributes
+// are masked.
+type AttributeDiff struct {
+	Path      string      `json:"path"`
+	Kind      string      `json:"kind"`
+	OldValue  interface{} `json:"old_value,omitempty"`
+	NewValue  interface{} `json:"new_value,omitempty"`
+	Sensitive bool        `json:"sensitive,omitempty"`
+}
+
 // ResourceDiff represents a diff between two versions of a Resource
 type ResourceDiff struct {
-	OnlyInOld   map[string]string `json:"only_in_old"`
-	OnlyInNew   map[string]string `json:"only_in_new"`
-	UnifiedDiff string            `json:"unified_diff"`
+	OnlyInOld      map[string]string `json:"only_in_old"`
+	OnlyInNew      map[string]string `json:"only_in_new"`
+	UnifiedDiff    string            `json:"unified_diff"`
+	AttributeDiffs []AttributeDiff   `json:"attribute_diffs"`
+}
+
+// ResourceMove represents a Resource whose address changed between
+// two versions of a State, along with its changes if any
+type ResourceMove struct {
+	From         string        `json:"from"`
+	To           string        `json:"to"`
+	ResourceDiff *ResourceDiff `json:"resource_diff,omitempty"`
+}
+
+// SensitiveValue replaces sensitive values in plans and compare results
+const SensitiveValue = "(sensitive)"
+
+// OutputDiff represents an output value in two versions of a State.
+// Values are JSON-encoded, and masked when the output is sensitive.
+type OutputDiff struct {
+	Sensitive bool   `json:"sensitive"`
+	OldValue  string `json:"old_value,omitempty"`
+	NewValue  string `json:"new_value,omitempty"`
+}
+
+// OutputsCompare lists the outputs added, removed and changed
+// between two versions of a State
+type OutputsCompare struct {
+	Added   map[string]OutputDiff `json:"added"`
+	Removed map[string]OutputDiff `json:"removed"`
+	Changed map[string]OutputDiff `json:"changed"`
 }
 
 // StateCompare represents a diff between two versions of a State
@@ -33,5 +80,38 @@ type StateCompare struct {
 		OnlyInNew    map[string]string       `json:"only_in_new"`
 		InBoth       []string                `json:"in_both"`
 		ResourceDiff map[string]ResourceDiff `json:"resource_diff"`
+		Moved        []ResourceMove          `json:"moved"`
 	} `json:"differences"`
+	Outputs OutputsCompare `json:"outputs"`
+}
+
+// Statuses of the serial of a Plan compared with the latest State
+const (
+	// SerialCurrent is the status of a Plan computed from the latest State
+	SerialCurrent = "current"
+	// SerialStale is the status of a Plan computed from an earlier State
+	SerialStale = "stale"
+	// SerialUnknown is the status of a Plan whose prior State serial is unknown
+	SerialUnknown = "unknown"
+)
+
+// PlanStateCompare reports the changes of the latest State of a lineage
+// since a Plan was computed. PlanSerial and PlanVersionID identify the
+// State version the Plan was computed from, when known.
+type PlanStateCompare struct {
+	PlanID          uint   `json:"plan_id"`
+	Lineage         string `json:"lineage"`
+	PlanSerial      int64  `json:"plan_serial"`
+	PlanVersionID   string `json:"plan_version_id"`
+	LatestSerial    int64  `json:"latest_serial"`
+	LatestVersionID string `json:"latest_version_id"`
+	// SerialStatus is "stale" when the State was written since the Plan was
+	// computed, "current" when it was not, and "unknown" when the serial of
+	// the prior State of the Plan is unknown
+	SerialStatus string `json:"serial_status"`
+	// StaleSerial is true when the State was written since the Plan was computed
+	StaleSerial bool `json:"stale_serial"`
+	// Changed is true when resources of the latest State differ from the prior State of the Plan
+	Changed bool         `json:"changed"`
+	Compare StateCompare `json:"compare"`
 }
@@ -38,6 +38,11 @@ type Lineage struct {
 	Value  string  `gorm:"index;unique" json:"lineage"`
 	States []State `json:"states"`
 	Plans  []Plan  `json:"plans"`
+	// Whether the changes between the versions of the lineage were computed
+	ChangesRecorded bool `gorm:"not null;default:false" json:"-"`
+	// Whether the mode of the data resources of the versions of the lineage
+	// inserted before resource modes were recorded was set
+	ModesSet bool `gorm:"not null;default:false" json:"-"`
 }
 
 // Module is a Terraform module in a State
@@ -53,10 +58,14 @@ type Module struct {
 type Resource struct {
 	ID         uint          `sql:"AUTO_INCREMENT" gorm:"primary_key" json:"-"`
 	ModuleID   sql.NullInt64 `gorm:"index" json:"-"`
+	Mode       string        `json:"mode"`
 	Type       string        `gorm:"index" json:"type"`
 	Name       string        `gorm:"index" json:"name"`
 	Index      string        `gorm:"index" json:"index"`
 	Attributes []Attribute   `json:"attributes"`
+	// The sensitivity objects of the attributes, by attribute key, for
+	// Resources built from plans, which mark their sensitive values
+	SensitiveAttributes map[string]interface{} `gorm:"-" json:"-"`
 }
 
 // OutputValue is a Terraform output in a Module
@@ -78,18 +87,144 @@ type Attribute struct {
 
 // Plan is a Terraform plan
 type Plan struct {
-	gorm.Model   `swaggerignore:"true"`
-	LineageID    uint           `gorm:"index" json:"-"`
-	Lineage      Lineage        `json:"lineage_data"`
-	TFVersion    string         `gorm:"varchar(10)" json:"terraform_version"`
-	GitRemote    string         `json:"git_remote"`
-	GitCommit    string         `gorm:"varchar(50)" json:"git_commit"`
-	CiURL        string         `json:"ci_url"`
-	Source       string         `json:"source"`
-	ExitCode     int            `json:"exit_code"`
+	gorm.Model `swaggerignore:"true"`
+	LineageID  uint    `gorm:"index" json:"-"`
+	Lineage    Lineage `json:"lineage_data"`
+	TFVersion  string  `gorm:"varchar(10)" json:"terraform_version"`
+	GitRemote  string  `json:"git_remote"`
+	GitCommit  string  `gorm:"varchar(50)" json:"git_commit"`
+	CiURL      string  `json:"ci_url"`
+	Source     string  `json:"source"`
+	ExitCode   int     `json:"exit_code"`
+	// The identity of the submitter of the Plan, who can't approve or reject it
+	SubmittedBy string `json:"submitted_by,omitempty"`
+	// The serial of the State the Plan was computed from, if known
+	PriorSerial  *int64         `json:"prior_serial,omitempty"`
 	ParsedPlan   PlanModel      `json:"parsed_plan"`
 	ParsedPlanID sql.NullInt64  `gorm:"index" json:"-"`
 	PlanJSON     datatypes.JSON `json:"plan_json"`
+	Status       string         `gorm:"index;default:pending" json:"status"`
+	Summary      *PlanSummary   `json:"summary,omitempty"`
+	// The results of the policies evaluated on insertion
+	PolicyResults []PlanPolicyResult `json:"policy_results,omitempty"`
+}
+
+// Kinds of PlanDivergence
+const (
+	// DivergenceMissing is a planned Resource missing from the applied State
+	DivergenceMissing = "missing"
+	// DivergenceUnexpected is a Resource of the applied State which was not planned
+	DivergenceUnexpected = "unexpected"
+	// DivergenceChanged is an attribute whose applied value differs from the planned one
+	DivergenceChanged = "changed"
+)
+
+// PlanApply links a Plan to the State version resulting from its apply
+type PlanApply struct {
+	ID           uint             `sql:"AUTO_INCREMENT" gorm:"primary_key" json:"-"`
+	PlanID       uint             `gorm:"uniqueIndex" json:"plan_id"`
+	LineageID    uint             `gorm:"index" json:"-"`
+	StateID      uint             `gorm:"uniqueIndex" json:"-"`
+	VersionID    string           `json:"version_id"`
+	Serial       int64            `json:"serial"`
+	LastModified time.Time        `json:"last_modified"`
+	Diverged     bool             `gorm:"index" json:"diverged"`
+	Divergences  []PlanDivergence `json:"divergences"`
+}
+
+// PlanDivergence is a difference between the State planned by a Plan
+// and the State resulting from its apply
+type PlanDivergence struct {
+	ID          uint   `sql:"AUTO_INCREMENT" gorm:"primary_key" json:"-"`
+	PlanApplyID uint   `gorm:"index" json:"-"`
+	Kind        string `json:"kind"`
+	Address     string `json:"address"`
+	// The attribute path, for changed attributes
+	Path string `json:"path,omitempty"`
+}
+
+// Review statuses of a Plan
+const (
+	PlanPending    = "pending"
+	PlanApproved   = "approved"
+	PlanRejected   = "rejected"
+	PlanApplied    = "applied"
+	PlanSuperseded = "superseded"
+)
+
+// PlanReview is a review of a Plan: a change of its status, a comment, or both
+type PlanReview struct {
+	ID        uint      `sql:"AUTO_INCREMENT" gorm:"primary_key" json:"id"`
+	PlanID    uint      `gorm:"index" json:"plan_id"`
+	CreatedAt time.Time `json:"created_at"`
+	// The status set by the review, empty for comments
+	Status   string `json:"status,omitempty"`
+	Reviewer string `json:"reviewer"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Risk levels of a Plan, from the lowest to the highest
+const (
+	RiskNone   = "none"
+	RiskLow    = "low"
+	RiskMedium = "medium"
+	RiskHigh   = "high"
+	// RiskUnknown is the risk of Plans whose changes could not be decoded
+	RiskUnknown = "unknown"
+)
+
+// PlanChangeCounts counts the resource changes of a Plan by action
+type PlanChangeCounts struct {
+	Create  int `json:"create"`
+	Update  int `json:"update"`
+	Delete  int `json:"delete"`
+	Replace int `json:"replace"`
+}
+
+// PlanSummary summarizes the resource changes of a Plan, computed on insertion
+type PlanSummary struct {
+	ID               uint `sql:"AUTO_INCREMENT" gorm:"primary_key" json:"-"`
+	PlanID           uint `gorm:"uniqueIndex" json:"-"`
+	PlanChangeCounts `gorm:"embedded"`
+	Risk             string `gorm:"index" json:"risk"`
+	// RiskRules is the fingerprint of the risk rules Risk was classified with
+	RiskRules     string                    `json:"-"`
+	ResourceTypes []PlanSummaryResourceType `json:"resource_types"`
+}
+
+// PlanSummaryResourceType counts the changes of a resource type in a Plan
+type PlanSummaryResourceType struct {
+	ID               uint   `sql:"AUTO_INCREMENT" gorm:"primary_key" json:"-"`
+	PlanSummaryID    uint   `gorm:"index" json:"-"`
+	Type             string `json:"type"`
+	PlanChangeCounts `gorm:"embedded"`
+}
+
+// Levels of PlanPolicyMessage
+const (
+	// PolicyDeny is a violation of a policy, failing it
+	PolicyDeny = "deny"
+	// PolicyWarn is a warning of a policy, which does not fail it
+	PolicyWarn = "warn"
+	// PolicyError is an error evaluating a policy, failing it
+	PolicyError = "error"
+)
+
+// PlanPolicyResult is the result of a policy evaluated against a Plan on insertion
+type PlanPolicyResult struct {
+	ID       uint                `sql:"AUTO_INCREMENT" gorm:"primary_key" json:"-"`
+	PlanID   uint                `gorm:"index" json:"-"`
+	Policy   string              `gorm:"index" json:"policy"`
+	Passed   bool                `gorm:"index" json:"passed"`
+	Messages []PlanPolicyMessage `json:"messages"`
+}
+
+// PlanPolicyMessage is a message reported by a policy evaluated against a Plan
+type PlanPolicyMessage struct {
+	ID                 uint   `sql:"AUTO_INCREMENT" gorm:"primary_key" json:"-"`
+	PlanPolicyResultID uint   `gorm:"index" json:"-"`
+	Level              string `json:"level"`
+	Message            string `json:"message"`
 }
 
 // PlanModel represents the entire contents of an output Terraform plan.
@@ -337,3 +472,82 @@ type PlanModelVariable struct {
 	Key         string        `gorm:"index" json:"key"`
 	Value       string        `json:"value,omitempty"`
 }
+
+// SavedSearch is a SearchAttribute query saved by a user,
+// evaluated after each database sync
+type SavedSearch struct {
+	gorm.Model `swaggerignore:"true"`
+	Name       string `gorm:"index" json:"name"`
+	Owner      string `gorm:"index" json:"owner"`
+	// The URL-encoded SearchAttribute parameters
+	Query string `json:"query"`
+}
+
+// SavedSearchResult is the result count of a SavedSearch evaluation
+type SavedSearchResult struct {
+	ID            uint      `sql:"AUTO_INCREMENT" gorm:"primary_key" json:"-"`
+	SavedSearchID uint      `gorm:"index" json:"-"`
+	EvaluatedAt   time.Time `gorm:"index" json:"evaluated_at"`
+	Count         int       `json:"count"`
+}
+
+// Actions of a LineageChangeResource
+const (
+	ResourceAdded   = "added"
+	ResourceRemoved = "removed"
+	ResourceChanged = "changed"
+	ResourceMoved   = "moved"
+)
+
+// LineageChange summarizes the resource changes between two consecutive
+// versions of a lineage, computed when the most recent one is inserted
+type LineageChange struct {
+	ID            uint                    `sql:"AUTO_INCREMENT" gorm:"primary_key" json:"-"`
+	LineageID     uint                    `gorm:"index" json:"-"`
+	FromStateID   uint                    `gorm:"index" json:"-"`
+	ToStateID     uint                    `gorm:"uniqueIndex" json:"-"`
+	FromVersionID string                  `json:"from_version_id"`
+	ToVersionID   string                  `json:"to_version_id"`
+	LastModified  time.Time               `gorm:"index" json:"last_modified"`
+	AddedCount    int                     `json:"added_count"`
+	RemovedCount  int                     `json:"removed_count"`
+	ChangedCount  int                     `json:"changed_count"`
+	MovedCount    int                     `json:"moved_count"`
+	Resources     []LineageChangeResource `json:"resources"`
+}
+
+// LineageChangeResource is a resource added, removed, changed or moved in a LineageChange
+type LineageChangeResource struct {
+	ID              uint   `sql:"AUTO_INCREMENT" gorm:"primary_key" json:"-"`
+	LineageChangeID uint   `gorm:"index" json:"-"`
+	Action          string `gorm:"index" json:"action"`
+	Address         string `gorm:"index" json:"address"`
+	// The address of a moved resource in the previous version
+	PreviousAddress string `json:"previous_address,omitempty"`
+}
+
+// APIToken is a token allowed to submit Plans for a set of lineages
+// or state paths. Only the SHA-256 hash of the token is stored.
+type APIToken struct {
+	ID        uint      `sql:"AUTO_INCREMENT" gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `gorm:"uniqueIndex" json:"name"`
+	// The first characters of the token, to identify it
+	Prefix string          `json:"prefix"`
+	Hash   string          `gorm:"uniqueIndex" json:"-"`
+	Scopes []APITokenScope `json:"scopes"`
+}
+
+// Identity identifies the holder of an APIToken, as the submitter or the reviewer of Plans
+func (t APIToken) Identity() string {
+	return "token:" + t.Name
+}
+
+// APITokenScope is a lineage, or a prefix of state paths,
+// an APIToken is allowed to submit Plans for
+type APITokenScope struct {
+	ID         uint   `sql:"AUTO_INCREMENT" gorm:"primary_key" json:"-"`
+	APITokenID uint   `gorm:"index" json:"-"`
+	Lineage    string `json:"lineage,omitempty"`
+	PathPrefix string `json:"path_prefix,omitempty"`
+}
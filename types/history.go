@@ -0,0 +1,30 @@
+package types
+
+import "time"
+
+/*******************************************************
+ * History types
+ *
+ * Used to follow a resource across versions of a State
+ *******************************************************/
+
+// ResourceVersion is a Resource at a given version of a State.
+// Changes lists the attribute differences with the previous version
+// in which the Resource existed.
+type ResourceVersion struct {
+	Path         string          `json:"path"`
+	VersionID    string          `json:"version_id"`
+	LastModified time.Time       `json:"last_modified"`
+	Serial       int64           `json:"serial"`
+	Changed      bool            `json:"changed"`
+	Attributes   []Attribute     `json:"attributes"`
+	Changes      []AttributeDiff `json:"changes,omitempty"`
+}
+
+// ResourceHistory lists the versions of a lineage in which
+// a resource address existed, oldest first
+type ResourceHistory struct {
+	Lineage  string            `json:"lineage"`
+	Address  string            `json:"address"`
+	Versions []ResourceVersion `json:"versions"`
+}
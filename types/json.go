@@ -56,7 +56,10 @@ func (p *planVariableList) UnmarshalJSON(b []byte) error {
 }
 
 func (p *planStateOutputList) UnmarshalJSON(b []byte) error {
-	tmp := map[string]PlanStateOutput{}
+	var tmp map[string]struct {
+		Sensitive bool        `json:"sensitive"`
+		Value     interface{} `json:"value"`
+	}
 	err := json.Unmarshal(b, &tmp)
 	if err != nil {
 		return err
@@ -64,8 +67,11 @@ func (p *planStateOutputList) UnmarshalJSON(b []byte) error {
 
 	var list planStateOutputList
 	for key, value := range tmp {
-		value.Name = key
-		list = append(list, value)
+		list = append(list, PlanStateOutput{
+			Name:      key,
+			Sensitive: value.Sensitive,
+			Value:     fmt.Sprintf("%v", value.Value),
+		})
 	}
 
 	*p = list
@@ -105,6 +105,10 @@ func TestPlanStateOutputList(t *testing.T) {
 		"dynamodb_table_name": {
 			"value": "terraform-state-locks",
 			"sensitive": false
+		},
+		"instance_count": {
+			"value": 3,
+			"sensitive": false
 		}
 	}`
 
@@ -119,6 +123,11 @@ func TestPlanStateOutputList(t *testing.T) {
 			Sensitive: false,
 			Value:     "terraform-state-locks",
 		},
+		{
+			Name:      "instance_count",
+			Sensitive: false,
+			Value:     "3",
+		},
 	}
 
 	tests := []struct {
@@ -0,0 +1,15 @@
+package types
+
+/*******************************************************
+ * Review types
+ *
+ * Used to follow the review of a Plan before its apply
+ *******************************************************/
+
+// PlanStatus is the review status of a Plan, along with its reviews, oldest first
+type PlanStatus struct {
+	PlanID  uint         `json:"plan_id"`
+	Lineage string       `json:"lineage"`
+	Status  string       `json:"status"`
+	Reviews []PlanReview `json:"reviews"`
+}
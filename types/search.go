@@ -21,6 +21,38 @@ type SearchResult struct {
 	ResourceIndex  string `gorm:"column:index" json:"resource_index"`
 	AttributeKey   string `gorm:"column:key" json:"attribute_key"`
 	AttributeValue string `gorm:"column:value" json:"attribute_value"`
+	AttributeID    uint   `gorm:"column:attribute_id" json:"-"`
+}
+
+// ResourceSearchResult is a Resource matching a full-text search,
+// with its relevance rank
+type ResourceSearchResult struct {
+	Path          string  `gorm:"column:path" json:"path"`
+	VersionID     string  `json:"version_id"`
+	TFVersion     string  `gorm:"column:tf_version" json:"tf_version"`
+	Serial        int64   `gorm:"column:serial" json:"serial"`
+	LineageValue  string  `json:"lineage_value"`
+	ModulePath    string  `gorm:"column:module_path" json:"module_path"`
+	ResourceType  string  `gorm:"column:type" json:"resource_type"`
+	ResourceName  string  `gorm:"column:name" json:"resource_name"`
+	ResourceIndex string  `gorm:"column:index" json:"resource_index"`
+	Rank          float64 `gorm:"column:rank" json:"rank"`
+	ResourceID    uint    `gorm:"column:resource_id" json:"-"`
+}
+
+// FacetCount is the number of search results sharing a given value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// SearchFacets stores the number of search results per resource type,
+// Terraform version, lineage and module path
+type SearchFacets struct {
+	ResourceTypes []FacetCount `json:"resource_type"`
+	TFVersions    []FacetCount `json:"tf_version"`
+	Lineages      []FacetCount `json:"lineage_value"`
+	ModulePaths   []FacetCount `json:"module_path"`
 }
 
 // StateStat stores State stats
@@ -0,0 +1,298 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/datatypes"
+)
+
+/*********************************************
+ * Sensitive values of plans
+ *
+ * Terraform marks the sensitive values of a plan with objects
+ * mirroring their structure, with all sensitive leaf values
+ * replaced with true and all non-sensitive ones omitted.
+ *********************************************/
+
+// decodeJSON decodes a JSON document, keeping numbers as they are encoded
+func decodeJSON(raw []byte) (v interface{}, err error) {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	err = d.Decode(&v)
+	return
+}
+
+// IsSensitive returns whether a sensitivity object marks any value as sensitive
+func IsSensitive(sensitive interface{}) bool {
+	switch s := sensitive.(type) {
+	case bool:
+		return s
+	case map[string]interface{}:
+		for _, v := range s {
+			if IsSensitive(v) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, v := range s {
+			if IsSensitive(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RedactValue replaces the parts of a decoded JSON value marked as sensitive
+// by a sensitivity object with SensitiveValue.
+// Values whose structure does not match their sensitivity object are entirely
+// replaced if any of their parts is sensitive.
+func RedactValue(value, sensitive interface{}) interface{} {
+	switch s := sensitive.(type) {
+	case bool:
+		if s {
+			return SensitiveValue
+		}
+	case map[string]interface{}:
+		v, ok := value.(map[string]interface{})
+		if !ok {
+			break
+		}
+		redacted := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			redacted[k] = RedactValue(e, s[k])
+		}
+		return redacted
+	case []interface{}:
+		v, ok := value.([]interface{})
+		if !ok {
+			break
+		}
+		redacted := make([]interface{}, len(v))
+		for i, e := range v {
+			if i < len(s) {
+				e = RedactValue(e, s[i])
+			}
+			redacted[i] = e
+		}
+		return redacted
+	}
+
+	if IsSensitive(sensitive) {
+		return SensitiveValue
+	}
+	return value
+}
+
+// redactRawJSON masks the parts of a JSON value marked as sensitive
+func redactRawJSON(value, sensitive rawJSON) (rawJSON, error) {
+	if value == "" || sensitive == "" {
+		return value, nil
+	}
+	s, err := decodeJSON([]byte(sensitive))
+	if err != nil {
+		return value, err
+	}
+	if !IsSensitive(s) {
+		return value, nil
+	}
+	v, err := decodeJSON([]byte(value))
+	if err != nil {
+		return value, err
+	}
+	j, err := json.Marshal(RedactValue(v, s))
+	return rawJSON(j), err
+}
+
+// Redact masks the values of a Change marked as sensitive
+// by BeforeSensitive and AfterSensitive
+func (c *Change) Redact() (err error) {
+	if c.Before, err = redactRawJSON(c.Before, c.BeforeSensitive); err != nil {
+		return fmt.Errorf("invalid before value: %v", err)
+	}
+	if c.After, err = redactRawJSON(c.After, c.AfterSensitive); err != nil {
+		return fmt.Errorf("invalid after value: %v", err)
+	}
+	return nil
+}
+
+// redactedAttributes holds the redacted values of the sensitive
+// attributes of resources, by resource address and attribute key
+type redactedAttributes map[string]map[string]interface{}
+
+// redactJSONChange masks the sensitive values of a change of a plan JSON document
+func redactJSONChange(c interface{}) {
+	change, ok := c.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if v, ok := change["before"]; ok {
+		change["before"] = RedactValue(v, change["before_sensitive"])
+	}
+	if v, ok := change["after"]; ok {
+		change["after"] = RedactValue(v, change["after_sensitive"])
+	}
+}
+
+// redactJSONModule masks the sensitive attributes of the resources of a module
+// of a plan JSON document and of its child modules, and adds them to attrs
+func redactJSONModule(m interface{}, attrs redactedAttributes) {
+	module, _ := m.(map[string]interface{})
+
+	resources, _ := module["resources"].([]interface{})
+	for _, r := range resources {
+		res, _ := r.(map[string]interface{})
+		address, _ := res["address"].(string)
+		values, _ := res["values"].(map[string]interface{})
+		sensitive, _ := res["sensitive_values"].(map[string]interface{})
+		for k, s := range sensitive {
+			v, ok := values[k]
+			if !ok || !IsSensitive(s) {
+				continue
+			}
+			values[k] = RedactValue(v, s)
+			if attrs[address] == nil {
+				attrs[address] = make(map[string]interface{})
+			}
+			attrs[address][k] = values[k]
+		}
+	}
+
+	children, _ := module["child_modules"].([]interface{})
+	for _, c := range children {
+		redactJSONModule(c, attrs)
+	}
+}
+
+// redactJSONStateValues masks the sensitive outputs and resource attributes
+// of the prior state or planned values of a plan JSON document,
+// and returns the redacted attributes
+func redactJSONStateValues(v interface{}) redactedAttributes {
+	values, _ := v.(map[string]interface{})
+
+	outputs, _ := values["outputs"].(map[string]interface{})
+	for _, o := range outputs {
+		output, _ := o.(map[string]interface{})
+		if _, ok := output["value"]; ok && output["sensitive"] == true {
+			output["value"] = SensitiveValue
+		}
+	}
+
+	attrs := make(redactedAttributes)
+	redactJSONModule(values["root_module"], attrs)
+	return attrs
+}
+
+// redactPlanJSON masks the sensitive values of a plan JSON document.
+// It returns the names of the sensitive variables, and the redacted
+// attributes of the prior state and planned values.
+func redactPlanJSON(doc map[string]interface{}) (variables map[string]bool, prior, planned redactedAttributes) {
+	variables = make(map[string]bool)
+	configuration, _ := doc["configuration"].(map[string]interface{})
+	rootModule, _ := configuration["root_module"].(map[string]interface{})
+	configVariables, _ := rootModule["variables"].(map[string]interface{})
+	for name, v := range configVariables {
+		if variable, _ := v.(map[string]interface{}); variable["sensitive"] == true {
+			variables[name] = true
+		}
+	}
+
+	planVariables, _ := doc["variables"].(map[string]interface{})
+	for name := range variables {
+		if variable, ok := planVariables[name].(map[string]interface{}); ok {
+			variable["value"] = SensitiveValue
+		}
+	}
+
+	for _, key := range []string{"resource_changes", "resource_drift"} {
+		changes, _ := doc[key].([]interface{})
+		for _, c := range changes {
+			if rc, ok := c.(map[string]interface{}); ok {
+				redactJSONChange(rc["change"])
+			}
+		}
+	}
+	outputChanges, _ := doc["output_changes"].(map[string]interface{})
+	for _, c := range outputChanges {
+		redactJSONChange(c)
+	}
+
+	planned = redactJSONStateValues(doc["planned_values"])
+	priorState, _ := doc["prior_state"].(map[string]interface{})
+	prior = redactJSONStateValues(priorState["values"])
+	return
+}
+
+// redact masks the sensitive outputs and resource attributes of a PlanStateModule
+// and of its child modules
+func (m *PlanStateModule) redact(attrs redactedAttributes) {
+	for i := range m.PlanStateResources {
+		r := &m.PlanStateResources[i]
+		for j, a := range r.PlanStateResourceAttributes {
+			if v, ok := attrs[r.Address][a.Key]; ok {
+				r.PlanStateResourceAttributes[j].Value = fmt.Sprintf("%v", v)
+			}
+		}
+	}
+	for i := range m.PlanStateModules {
+		m.PlanStateModules[i].redact(attrs)
+	}
+}
+
+// redact masks the sensitive outputs and resource attributes of a PlanStateValue
+func (v *PlanStateValue) redact(attrs redactedAttributes) {
+	for i, o := range v.PlanStateOutputs {
+		if o.Sensitive {
+			v.PlanStateOutputs[i].Value = SensitiveValue
+		}
+	}
+	v.PlanStateModule.redact(attrs)
+}
+
+// redact masks the sensitive values of a PlanModel, using the sensitive
+// variables and the redacted attributes of its plan JSON document
+func (m *PlanModel) redact(variables map[string]bool, prior, planned redactedAttributes) error {
+	for i, v := range m.Variables {
+		if variables[v.Key] {
+			m.Variables[i].Value = fmt.Sprintf("%v", map[string]interface{}{"value": SensitiveValue})
+		}
+	}
+	for i := range m.PlanResourceChanges {
+		if err := m.PlanResourceChanges[i].Change.Redact(); err != nil {
+			return fmt.Errorf("failed to redact change of %s: %v", m.PlanResourceChanges[i].Address, err)
+		}
+	}
+	for i := range m.PlanOutputs {
+		if err := m.PlanOutputs[i].Change.Redact(); err != nil {
+			return fmt.Errorf("failed to redact change of output %s: %v", m.PlanOutputs[i].Name, err)
+		}
+	}
+	m.PlanStateValue.redact(planned)
+	m.PlanState.PlanStateValue.redact(prior)
+	return nil
+}
+
+// Redact replaces the sensitive values of a Plan with SensitiveValue, in both
+// its JSON representation and its parsed content: sensitive variables,
+// resource and output changes, outputs and resource attributes.
+func (p *Plan) Redact() error {
+	var variables map[string]bool
+	var prior, planned redactedAttributes
+	if len(p.PlanJSON) > 0 {
+		v, err := decodeJSON(p.PlanJSON)
+		if err != nil {
+			return fmt.Errorf("invalid plan JSON: %v", err)
+		}
+		if doc, ok := v.(map[string]interface{}); ok {
+			variables, prior, planned = redactPlanJSON(doc)
+			j, err := json.Marshal(doc)
+			if err != nil {
+				return err
+			}
+			p.PlanJSON = datatypes.JSON(j)
+		}
+	}
+	return p.ParsedPlan.redact(variables, prior, planned)
+}
@@ -0,0 +1,196 @@
+package types
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRedactValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		sensitive string
+		want      string
+	}{
+		{"not sensitive", `"foo"`, `false`, `"foo"`},
+		{"sensitive", `"foo"`, `true`, `"(sensitive)"`},
+		{"object", `{"name":"foo","password":"bar"}`, `{"password":true}`, `{"name":"foo","password":"(sensitive)"}`},
+		{"list", `[{"a":1},{"a":2},{"a":3}]`, `[{},{"a":true}]`, `[{"a":1},{"a":"(sensitive)"},{"a":3}]`},
+		{"structure mismatch", `"foo"`, `{"password":true}`, `"(sensitive)"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value, sensitive, want interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.sensitive), &sensitive); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if got := RedactValue(value, sensitive); !reflect.DeepEqual(got, want) {
+				t.Errorf("RedactValue() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPlanRedact(t *testing.T) {
+	planJSON := `{
+		"variables": {
+			"db_password": {"value": "hunter2"},
+			"region": {"value": "eu-west-1"}
+		},
+		"configuration": {
+			"root_module": {
+				"variables": {
+					"db_password": {"sensitive": true},
+					"region": {}
+				}
+			}
+		},
+		"resource_changes": [{
+			"address": "aws_db_instance.db",
+			"change": {
+				"actions": ["update"],
+				"before": {"port": 5432, "password": "old"},
+				"after": {"port": 5432, "password": "hunter2"},
+				"before_sensitive": {"password": true},
+				"after_sensitive": {"password": true}
+			}
+		}],
+		"output_changes": {
+			"db_password": {"actions": ["create"], "after": "hunter2", "after_sensitive": true}
+		},
+		"planned_values": {
+			"outputs": {"db_password": {"sensitive": true, "value": "hunter2"}},
+			"root_module": {
+				"child_modules": [{
+					"address": "module.db",
+					"resources": [{
+						"address": "module.db.aws_db_instance.db",
+						"values": {"port": 5432, "password": "hunter2"},
+						"sensitive_values": {"password": true}
+					}]
+				}]
+			}
+		}
+	}`
+	p := Plan{
+		PlanJSON: []byte(planJSON),
+		ParsedPlan: PlanModel{
+			Variables: planVariableList{
+				{Key: "db_password", Value: "map[value:hunter2]"},
+				{Key: "region", Value: "map[value:eu-west-1]"},
+			},
+			PlanResourceChanges: []PlanResourceChange{{
+				Address: "aws_db_instance.db",
+				Change: Change{
+					Before:          `{"port": 5432, "password": "old"}`,
+					After:           `{"port": 5432, "password": "hunter2"}`,
+					BeforeSensitive: `{"password": true}`,
+					AfterSensitive:  `{"password": true}`,
+				},
+			}},
+			PlanOutputs: planOutputList{{
+				Name:   "db_password",
+				Change: Change{After: `"hunter2"`, AfterSensitive: `true`},
+			}},
+			PlanStateValue: PlanStateValue{
+				PlanStateOutputs: planStateOutputList{{Name: "db_password", Sensitive: true, Value: "hunter2"}},
+				PlanStateModule: PlanStateModule{
+					PlanStateModules: []PlanStateModule{{
+						Address: "module.db",
+						PlanStateResources: []PlanStateResource{{
+							Address: "module.db.aws_db_instance.db",
+							PlanStateResourceAttributes: planStateResourceAttributeList{
+								{Key: "port", Value: "5432"},
+								{Key: "password", Value: "hunter2"},
+							},
+						}},
+					}},
+				},
+			},
+		},
+	}
+
+	if err := p.Redact(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var got, want interface{}
+	if err := json.Unmarshal(p.PlanJSON, &got); err != nil {
+		t.Fatal(err)
+	}
+	wantJSON := `{
+		"variables": {
+			"db_password": {"value": "(sensitive)"},
+			"region": {"value": "eu-west-1"}
+		},
+		"configuration": {
+			"root_module": {
+				"variables": {
+					"db_password": {"sensitive": true},
+					"region": {}
+				}
+			}
+		},
+		"resource_changes": [{
+			"address": "aws_db_instance.db",
+			"change": {
+				"actions": ["update"],
+				"before": {"port": 5432, "password": "(sensitive)"},
+				"after": {"port": 5432, "password": "(sensitive)"},
+				"before_sensitive": {"password": true},
+				"after_sensitive": {"password": true}
+			}
+		}],
+		"output_changes": {
+			"db_password": {"actions": ["create"], "after": "(sensitive)", "after_sensitive": true}
+		},
+		"planned_values": {
+			"outputs": {"db_password": {"sensitive": true, "value": "(sensitive)"}},
+			"root_module": {
+				"child_modules": [{
+					"address": "module.db",
+					"resources": [{
+						"address": "module.db.aws_db_instance.db",
+						"values": {"port": 5432, "password": "(sensitive)"},
+						"sensitive_values": {"password": true}
+					}]
+				}]
+			}
+		}
+	}`
+	if err := json.Unmarshal([]byte(wantJSON), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected plan JSON: %s", p.PlanJSON)
+	}
+
+	m := p.ParsedPlan
+	if v := m.Variables[0].Value; v != "map[value:(sensitive)]" {
+		t.Errorf("Sensitive variable not masked: %s", v)
+	}
+	if v := m.Variables[1].Value; v != "map[value:eu-west-1]" {
+		t.Errorf("Variable unexpectedly masked: %s", v)
+	}
+	c := m.PlanResourceChanges[0].Change
+	if c.Before != `{"password":"(sensitive)","port":5432}` || c.After != `{"password":"(sensitive)","port":5432}` {
+		t.Errorf("Resource change not masked: %s, %s", c.Before, c.After)
+	}
+	if v := m.PlanOutputs[0].Change.After; v != `"(sensitive)"` {
+		t.Errorf("Output change not masked: %s", v)
+	}
+	if v := m.PlanStateValue.PlanStateOutputs[0].Value; v != SensitiveValue {
+		t.Errorf("Output not masked: %s", v)
+	}
+	attrs := m.PlanStateValue.PlanStateModule.PlanStateModules[0].PlanStateResources[0].PlanStateResourceAttributes
+	if attrs[0].Value != "5432" || attrs[1].Value != SensitiveValue {
+		t.Errorf("Unexpected resource attributes: %v", attrs)
+	}
+}